@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ecommerce/database/migrations"
+	"github.com/ecommerce/internal/core/setup"
+	"github.com/ecommerce/internal/services/category"
+	"github.com/ecommerce/internal/services/product"
+)
+
+const usage = `usage:
+  ecommerce                     start the server
+  ecommerce migrate up          apply every pending migration
+  ecommerce migrate down [n]    revert the last n migrations (default 1)
+  ecommerce migrate status      list migrations and when they were applied
+  ecommerce products import [-dry-run] [-format csv|ndjson] <file>
+                                create or update products from a CSV or NDJSON file
+  ecommerce products export [-format csv|ndjson] [file]
+                                write the catalog to a file, or to stdout`
+
+// runCommand runs a command line command
+func runCommand(args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(args[1:])
+	case "products":
+		return runProducts(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+// runMigrate applies, reverts or lists schema migrations
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate action\n%s", usage)
+	}
+
+	_, dbConn, err := setup.InitializeDatabase(configFilePath)
+	if err != nil {
+		return err
+	}
+	if dbConn == nil {
+		return fmt.Errorf("migrations need the mysql database driver")
+	}
+	defer dbConn.Close()
+
+	migrator, err := migrations.NewMigrator(dbConn)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migrations applied\n", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migrations reverted\n", reverted)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s  %s\n", status.Version, status.Name, applied)
+		}
+	default:
+		return fmt.Errorf("unknown migrate action %q\n%s", args[0], usage)
+	}
+	return nil
+}
+
+// runProducts imports products from a file or exports the catalog to one
+func runProducts(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing products action\n%s", usage)
+	}
+
+	flags := flag.NewFlagSet("products "+args[0], flag.ContinueOnError)
+	format := flags.String("format", "", "csv or ndjson, guessed from the file name by default")
+	dryRun := flags.Bool("dry-run", false, "only report what the import would change")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if args[0] == "import" && flags.NArg() != 1 {
+		return fmt.Errorf("missing file to import\n%s", usage)
+	}
+
+	_, dbConn, err := setup.InitializeDatabase(configFilePath)
+	if err != nil {
+		return err
+	}
+	if dbConn == nil {
+		return fmt.Errorf("product import and export need the mysql database driver")
+	}
+	defer dbConn.Close()
+
+	categories := category.NewCategoryService(category.NewMySQLCategoryRepository(dbConn))
+	// import and export leave images alone, so no blob store is needed
+	service := product.NewProductService(product.NewMySQLProductRepository(dbConn), categories, nil, 0)
+
+	switch args[0] {
+	case "import":
+		path := flags.Arg(0)
+		if *format == "" {
+			*format = path
+		}
+		fileFormat, err := product.ParseFormat(*format)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		report, err := service.ImportProductsService(file, fileFormat, *dryRun)
+		if report != nil {
+			for _, row := range report.Rows {
+				for field, message := range row.Errors {
+					fmt.Printf("line %d: %s %s\n", row.Line, field, message)
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if report.DryRun {
+			fmt.Printf("dry run: %d products would be created, %d updated\n", report.Created, report.Updated)
+		} else {
+			fmt.Printf("%d products created, %d updated\n", report.Created, report.Updated)
+		}
+	case "export":
+		out := os.Stdout
+		if path := flags.Arg(0); path != "" && path != "-" {
+			if *format == "" {
+				*format = path
+			}
+			out, err = os.Create(path)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		if *format == "" {
+			*format = product.FormatCSV
+		}
+		fileFormat, err := product.ParseFormat(*format)
+		if err != nil {
+			return err
+		}
+
+		return service.ExportProductsService(out, fileFormat)
+	default:
+		return fmt.Errorf("unknown products action %q\n%s", args[0], usage)
+	}
+	return nil
+}
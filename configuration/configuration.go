@@ -1,111 +1,241 @@
-package configuration
-
-import (
-	"errors"
-	"fmt"
-	"log"
-	"os"
-
-	"gopkg.in/yaml.v3"
-)
-
-// Config holds the application configuration
-type Config struct {
-	Session struct {
-		SessionKey        string `yaml:"session_key"`
-		SessionContextKey string `yaml:"session_context_key"`
-		Domain            string `yaml:"domain"`
-		Secure            bool   `yaml:"secure"`
-		HttpOnly          bool   `yaml:"http_only"`
-		Path              string `yaml:"path"`
-		MaxAge            int    `yaml:"max_age"`
-	} `yaml:"session"`
-
-	Database struct {
-		URL             string `yaml:"url"`
-		User            string `yaml:"user"`
-		Password        string `yaml:"password"`
-		DbName          string `yaml:"dbName"`
-		MaxOpenConns    int    `yaml:"max_open_conns"`
-		MaxIdleConns    int    `yaml:"max_idle_conns"`
-		ConnMaxLifetime int    `yaml:"conn_max_lifetime"` // In seconds
-	} `yaml:"database"`
-}
-
-// Init loads and initializes the configuration from the specified file
-func Init(configPath string) (*Config, error) {
-	config, err := loadConfig(configPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load configuration: %w", err)
-	}
-
-	return config, nil
-}
-
-// loadConfig loads configuration from a YAML file
-func loadConfig(configPath string) (*Config, error) {
-	file, err := os.Open(configPath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	var config Config
-	decoder := yaml.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		return nil, err
-	}
-	return &config, nil
-}
-
-// Validate checks if the loaded configuration is complete and valid
-func (c *Config) Validate() error {
-	if c.Database.URL == "" {
-		return fmt.Errorf("incomplete database configuration: missing URL")
-	}
-	if c.Database.User == "" {
-		return fmt.Errorf("incomplete database configuration: missing User")
-	}
-	if c.Database.Password == "" {
-		return fmt.Errorf("incomplete database configuration: missing Password")
-	}
-	if c.Database.DbName == "" {
-		return fmt.Errorf("incomplete database configuration: missing DbName")
-	}
-	if c.Database.MaxOpenConns <= 0 {
-		return fmt.Errorf("database configuration error: MaxOpenConns must be greater than 0")
-	}
-
-	if c.Database.MaxIdleConns < 0 {
-		return fmt.Errorf("database configuration error: MaxIdleConns cannot be negative")
-	}
-
-	if c.Database.ConnMaxLifetime < 0 {
-		return fmt.Errorf("database configuration error: ConnMaxLifetime cannot be negative")
-	}
-
-	if c.Session.SessionKey == "" {
-		return fmt.Errorf("incomplete session configuration: missing SessionKey")
-	}
-	if c.Session.SessionContextKey == "" {
-		return fmt.Errorf("incomplete session configuration: missing SessionContextKey")
-	}
-	if c.Session.Domain == "" {
-		return fmt.Errorf("incomplete session configuration: missing Domain")
-	}
-	// Validate Secure flag based on the Domain
-	if c.Session.Domain == "localhost" && c.Session.Secure {
-		log.Println("Warning: Secure is true for localhost. This may not work in development.")
-	} else if c.Session.Domain != "localhost" && !c.Session.Secure {
-		return errors.New("session configuration error: Secure must be true for production environments")
-	}
-	if c.Session.Path == "" {
-		return errors.New("session configuration error: Path cannot be empty")
-	}
-
-	if c.Session.MaxAge < 0 {
-		return errors.New("session configuration error: MaxAge cannot be negative")
-	}
-
-	return nil
-}
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the application configuration
+type Config struct {
+	Session struct {
+		SessionKey        string `yaml:"session_key"`
+		SessionContextKey string `yaml:"session_context_key"`
+		Domain            string `yaml:"domain"`
+		Secure            bool   `yaml:"secure"`
+		HttpOnly          bool   `yaml:"http_only"`
+		Path              string `yaml:"path"`
+		MaxAge            int    `yaml:"max_age"`
+		Store             string `yaml:"store"` // "cookie" (default) or "database"
+	} `yaml:"session"`
+
+	Database struct {
+		Driver          string `yaml:"driver"` // "mysql" (default) or "memory", which needs no database server
+		URL             string `yaml:"url"`
+		User            string `yaml:"user"`
+		Password        string `yaml:"password"`
+		DbName          string `yaml:"dbName"`
+		MaxOpenConns    int    `yaml:"max_open_conns"`
+		MaxIdleConns    int    `yaml:"max_idle_conns"`
+		ConnMaxLifetime int    `yaml:"conn_max_lifetime"` // In seconds
+		AutoMigrate     bool   `yaml:"auto_migrate"`      // apply pending schema migrations at startup
+	} `yaml:"database"`
+
+	Mail struct {
+		Driver  string `yaml:"driver"`   // "log" (default) or "file"
+		Dir     string `yaml:"dir"`      // output directory of the file driver
+		From    string `yaml:"from"`     // sender address
+		BaseURL string `yaml:"base_url"` // used to build links in mails, e.g. http://localhost:5000
+	} `yaml:"mail"`
+
+	Storage struct {
+		Driver       string `yaml:"driver"`         // "local" (default)
+		Dir          string `yaml:"dir"`            // root directory of the local driver, "uploads" by default
+		MaxImageSize int64  `yaml:"max_image_size"` // largest accepted image upload in bytes, 5 MiB by default
+	} `yaml:"storage"`
+
+	Pricing struct {
+		DefaultRegion string             `yaml:"default_region"` // region of carts whose user picked none, e.g. "US-CA"
+		TaxRates      map[string]float64 `yaml:"tax_rates"`      // percent by region, "US-CA" falls back to "US", untaxed when missing
+		Shipping      struct {
+			Method   string  `yaml:"method"`    // "flat" (default) or "weight"
+			FlatRate float64 `yaml:"flat_rate"` // cost of shipping an order with the flat method
+			BaseRate float64 `yaml:"base_rate"` // cost of shipping an order with the weight method, plus PerKg
+			PerKg    float64 `yaml:"per_kg"`    // cost of every started kilogram with the weight method
+			FreeOver float64 `yaml:"free_over"` // orders costing at least this after discounts ship for free, 0 never does
+		} `yaml:"shipping"`
+	} `yaml:"pricing"`
+
+	Payment struct {
+		Driver        string `yaml:"driver"`         // "fake" (default), a local gateway simulating payments
+		Currency      string `yaml:"currency"`       // ISO 4217 code orders are charged in, "USD" by default
+		WebhookSecret string `yaml:"webhook_secret"` // key webhooks are signed with, random at every start by default
+		WebhookURL    string `yaml:"webhook_url"`    // where the fake gateway posts its webhooks, derived from the mail base_url by default
+		ConfirmDelay  int    `yaml:"confirm_delay"`  // In seconds, before the fake gateway settles an asynchronous payment, 2 by default
+	} `yaml:"payment"`
+}
+
+// DefaultMaxImageSize is the largest accepted image upload when the storage configuration sets none
+const DefaultMaxImageSize = 5 << 20
+
+// Init loads and initializes the configuration from the specified file
+func Init(configPath string) (*Config, error) {
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+// loadConfig loads configuration from a YAML file
+func loadConfig(configPath string) (*Config, error) {
+	file, err := os.Open(configPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var config Config
+	decoder := yaml.NewDecoder(file)
+	if err := decoder.Decode(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Validate checks if the loaded configuration is complete and valid
+func (c *Config) Validate() error {
+	switch c.Database.Driver {
+	case "", "mysql":
+		if c.Database.URL == "" {
+			return fmt.Errorf("incomplete database configuration: missing URL")
+		}
+		if c.Database.User == "" {
+			return fmt.Errorf("incomplete database configuration: missing User")
+		}
+		if c.Database.Password == "" {
+			return fmt.Errorf("incomplete database configuration: missing Password")
+		}
+		if c.Database.DbName == "" {
+			return fmt.Errorf("incomplete database configuration: missing DbName")
+		}
+		if c.Database.MaxOpenConns <= 0 {
+			return fmt.Errorf("database configuration error: MaxOpenConns must be greater than 0")
+		}
+
+		if c.Database.MaxIdleConns < 0 {
+			return fmt.Errorf("database configuration error: MaxIdleConns cannot be negative")
+		}
+
+		if c.Database.ConnMaxLifetime < 0 {
+			return fmt.Errorf("database configuration error: ConnMaxLifetime cannot be negative")
+		}
+	case "memory":
+		if c.Session.Store == "database" {
+			return errors.New("session configuration error: the database store needs the mysql driver")
+		}
+	default:
+		return fmt.Errorf("database configuration error: unknown driver %q", c.Database.Driver)
+	}
+
+	if c.Session.SessionKey == "" {
+		return fmt.Errorf("incomplete session configuration: missing SessionKey")
+	}
+	if c.Session.SessionContextKey == "" {
+		return fmt.Errorf("incomplete session configuration: missing SessionContextKey")
+	}
+	if c.Session.Domain == "" {
+		return fmt.Errorf("incomplete session configuration: missing Domain")
+	}
+	// Validate Secure flag based on the Domain
+	if c.Session.Domain == "localhost" && c.Session.Secure {
+		log.Println("Warning: Secure is true for localhost. This may not work in development.")
+	} else if c.Session.Domain != "localhost" && !c.Session.Secure {
+		return errors.New("session configuration error: Secure must be true for production environments")
+	}
+	if c.Session.Path == "" {
+		return errors.New("session configuration error: Path cannot be empty")
+	}
+
+	if c.Session.MaxAge < 0 {
+		return errors.New("session configuration error: MaxAge cannot be negative")
+	}
+
+	if c.Session.Store != "" && c.Session.Store != "cookie" && c.Session.Store != "database" {
+		return fmt.Errorf("session configuration error: unknown store %q", c.Session.Store)
+	}
+
+	switch c.Mail.Driver {
+	case "", "log":
+	case "file":
+		if c.Mail.Dir == "" {
+			return errors.New("mail configuration error: Dir is required by the file driver")
+		}
+	default:
+		return fmt.Errorf("mail configuration error: unknown driver %q", c.Mail.Driver)
+	}
+	if c.Mail.BaseURL == "" {
+		c.Mail.BaseURL = "http://localhost:5000"
+	}
+	if c.Mail.From == "" {
+		c.Mail.From = "no-reply@localhost"
+	}
+
+	if c.Storage.Driver != "" && c.Storage.Driver != "local" {
+		return fmt.Errorf("storage configuration error: unknown driver %q", c.Storage.Driver)
+	}
+	if c.Storage.MaxImageSize < 0 {
+		return errors.New("storage configuration error: MaxImageSize cannot be negative")
+	}
+	if c.Storage.Dir == "" {
+		c.Storage.Dir = "uploads"
+	}
+	if c.Storage.MaxImageSize == 0 {
+		c.Storage.MaxImageSize = DefaultMaxImageSize
+	}
+
+	if err := c.validatePricing(); err != nil {
+		return err
+	}
+
+	if c.Payment.Driver != "" && c.Payment.Driver != "fake" {
+		return fmt.Errorf("payment configuration error: unknown driver %q", c.Payment.Driver)
+	}
+	if c.Payment.ConfirmDelay < 0 {
+		return errors.New("payment configuration error: ConfirmDelay cannot be negative")
+	}
+	if c.Payment.Currency == "" {
+		c.Payment.Currency = "USD"
+	}
+	if c.Payment.WebhookURL == "" {
+		c.Payment.WebhookURL = strings.TrimSuffix(c.Mail.BaseURL, "/") + "/api/payments/webhook"
+	}
+	if c.Payment.ConfirmDelay == 0 {
+		c.Payment.ConfirmDelay = 2
+	}
+
+	return nil
+}
+
+// validatePricing checks the pricing configuration and upper cases its regions, which are matched regardless of case
+func (c *Config) validatePricing() error {
+	c.Pricing.DefaultRegion = strings.ToUpper(strings.TrimSpace(c.Pricing.DefaultRegion))
+
+	rates := make(map[string]float64, len(c.Pricing.TaxRates))
+	for region, rate := range c.Pricing.TaxRates {
+		if rate < 0 || rate > 100 {
+			return fmt.Errorf("pricing configuration error: tax rate of %q must be between 0 and 100", region)
+		}
+		rates[strings.ToUpper(strings.TrimSpace(region))] = rate
+	}
+	c.Pricing.TaxRates = rates
+
+	shipping := &c.Pricing.Shipping
+	switch shipping.Method {
+	case "":
+		shipping.Method = "flat"
+	case "flat", "weight":
+	default:
+		return fmt.Errorf("pricing configuration error: unknown shipping method %q", shipping.Method)
+	}
+	if shipping.FlatRate < 0 || shipping.BaseRate < 0 || shipping.PerKg < 0 || shipping.FreeOver < 0 {
+		return errors.New("pricing configuration error: shipping rates cannot be negative")
+	}
+
+	return nil
+}
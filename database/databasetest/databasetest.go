@@ -0,0 +1,55 @@
+// Package databasetest connects tests to a MySQL compatible database, e.g. a local MySQL or
+// MariaDB container, for what the in-memory repositories can't show: row locks and transactions.
+package databasetest
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/ecommerce/database/migrations"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// DSNEnv is the environment variable holding the DSN of the test database,
+// e.g. root:root@tcp(127.0.0.1:3306)/ecommerce_test?parseTime=true
+const DSNEnv = "ECOMMERCE_TEST_DSN"
+
+// Open connects to the test database and migrates it to the latest schema.
+// The test is skipped when DSNEnv isn't set.
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv(DSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set, skipping the MySQL test", DSNEnv)
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		t.Fatalf("failed to reach the test database: %v", err)
+	}
+
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("failed to migrate the test database: %v", err)
+	}
+	return db
+}
+
+// Exec runs a statement of a test fixture and returns the id of the inserted row
+func Exec(t testing.TB, db *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	id, _ := result.LastInsertId()
+	return int(id)
+}
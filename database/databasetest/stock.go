@@ -0,0 +1,47 @@
+package databasetest
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Stock is the fixture of the tests racing carts for a limited stock: a product with a few units
+// in stock in its default variant and buyers with an empty cart each
+type Stock struct {
+	ProductID int
+	VariantID int
+	Buyers    []Buyer
+}
+
+// Buyer is a user of a Stock fixture along with their cart
+type Buyer struct {
+	UserID, CartID int
+}
+
+// InsertStock inserts a product with units in stock in its default variant and buyers users with
+// an empty cart each. They are deleted along with the orders of the buyers when the test ends.
+func InsertStock(t testing.TB, db *sql.DB, units, buyers int) Stock {
+	t.Helper()
+	stock := Stock{}
+	stock.ProductID = Exec(t, db, `INSERT INTO products (pricePerUnit, productName, productBrand, description, stockQuantity)
+		VALUES (10, 'Concurrency test', 'Test', '', ?)`, units)
+	stock.VariantID = Exec(t, db, `INSERT INTO product_variants (product_id, attributes, stock_quantity, is_default)
+		VALUES (?, JSON_OBJECT(), ?, 1)`, stock.ProductID, units)
+
+	run := time.Now().UnixNano()
+	for i := 0; i < buyers; i++ {
+		userID := Exec(t, db, `INSERT INTO users (email, password) VALUES (?, '')`, fmt.Sprintf("buyer%d-%d@example.com", i, run))
+		cartID := Exec(t, db, `INSERT INTO carts (user_id) VALUES (?)`, userID)
+		stock.Buyers = append(stock.Buyers, Buyer{UserID: userID, CartID: cartID})
+	}
+	t.Cleanup(func() {
+		for _, b := range stock.Buyers {
+			db.Exec(`DELETE FROM orders WHERE user_id = ?`, b.UserID)
+			db.Exec(`DELETE FROM users WHERE userId = ?`, b.UserID)
+		}
+		db.Exec(`DELETE FROM products WHERE productId = ?`, stock.ProductID)
+	})
+	return stock
+}
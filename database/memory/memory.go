@@ -0,0 +1,160 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// DB is a thread-safe in-memory database of named tables, used in place of MySQL for demos and tests.
+// A single lock guards every table: a function run by Update sees and leaves a consistent state
+// across tables, much like a serializable transaction. There is no rollback, so Update functions
+// must validate before they write.
+type DB struct {
+	mu      sync.RWMutex
+	version atomic.Uint64 // number of Update calls, see Version
+
+	tablesMu sync.Mutex
+	tables   map[string]interface{}
+}
+
+// Table holds rows of one type keyed by an auto-increment id
+type Table[T any] struct {
+	rows   map[int]T
+	lastID int
+}
+
+// New creates an empty database
+func New() *DB {
+	return &DB{tables: make(map[string]interface{})}
+}
+
+// View runs fn with the database locked for reading
+func (db *DB) View(fn func() error) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return fn()
+}
+
+// Update runs fn with the database locked for writing
+func (db *DB) Update(fn func() error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	defer db.version.Add(1)
+	return fn()
+}
+
+// Version changes every time Update runs. Reading it before a check made under View and comparing
+// it inside the Update acting on the check tells whether anything may have changed in between,
+// for checks that call code taking the lock themselves. It may be read with or without the lock.
+func (db *DB) Version() uint64 {
+	return db.version.Load()
+}
+
+// TableOf returns the named table, creating it on first use. Rows must only be read
+// inside View or Update, and only be written inside Update.
+func TableOf[T any](db *DB, name string) *Table[T] {
+	db.tablesMu.Lock()
+	defer db.tablesMu.Unlock()
+
+	if existing, ok := db.tables[name]; ok {
+		table, ok := existing.(*Table[T])
+		if !ok {
+			panic(fmt.Sprintf("memory: table %s holds %T rows", name, existing))
+		}
+		return table
+	}
+
+	table := &Table[T]{rows: make(map[int]T)}
+	db.tables[name] = table
+	return table
+}
+
+// NextID reserves the next auto-increment id
+func (t *Table[T]) NextID() int {
+	t.lastID++
+	return t.lastID
+}
+
+// Get returns the row with the given id
+func (t *Table[T]) Get(id int) (T, bool) {
+	row, ok := t.rows[id]
+	return row, ok
+}
+
+// Put inserts or replaces the row with the given id
+func (t *Table[T]) Put(id int, row T) {
+	if id > t.lastID {
+		t.lastID = id
+	}
+	t.rows[id] = row
+}
+
+// Delete removes the row with the given id and reports whether it existed
+func (t *Table[T]) Delete(id int) bool {
+	_, ok := t.rows[id]
+	delete(t.rows, id)
+	return ok
+}
+
+// Rows returns every row ordered by id
+func (t *Table[T]) Rows() []T {
+	return t.Filter(func(T) bool { return true })
+}
+
+// Filter returns the rows matching keep, ordered by id
+func (t *Table[T]) Filter(keep func(T) bool) []T {
+	rows := make([]T, 0)
+	for _, id := range t.ids() {
+		if row := t.rows[id]; keep(row) {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// First returns the row with the lowest id matching keep
+func (t *Table[T]) First(keep func(T) bool) (T, bool) {
+	for _, id := range t.ids() {
+		if row := t.rows[id]; keep(row) {
+			return row, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// Update replaces every row matching keep with the result of change and returns how many changed
+func (t *Table[T]) Update(keep func(T) bool, change func(T) T) int {
+	count := 0
+	for id, row := range t.rows {
+		if keep(row) {
+			t.rows[id] = change(row)
+			count++
+		}
+	}
+	return count
+}
+
+// DeleteWhere removes every row matching remove and returns how many were removed
+func (t *Table[T]) DeleteWhere(remove func(T) bool) int {
+	count := 0
+	for id, row := range t.rows {
+		if remove(row) {
+			delete(t.rows, id)
+			count++
+		}
+	}
+	return count
+}
+
+// ids returns the row ids in ascending order
+func (t *Table[T]) ids() []int {
+	ids := make([]int, 0, len(t.rows))
+	for id := range t.rows {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
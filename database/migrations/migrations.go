@@ -0,0 +1,281 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+const (
+	// lockName is the MySQL named lock held while migrating, so two instances starting
+	// at the same time don't apply the same migration twice
+	lockName    = "schema_migrations"
+	lockTimeout = 30 // seconds
+
+	createTableQuery = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (version)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+)
+
+// fileName matches migration files: <version>_<name>.<up|down>.sql
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change with the SQL to apply and revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration along with the time it was applied, nil when pending
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies the embedded migrations and records them in the schema_migrations table.
+// MySQL commits DDL statements implicitly, so a migration failing halfway has to be fixed by hand;
+// keep each migration small.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator creates a Migrator over the embedded migrations
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load reads the embedded migrations ordered by version. Every version needs an up and a down file.
+func Load() ([]Migration, error) {
+	entries, err := files.ReadDir("sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := files.ReadFile(path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies every pending migration in version order and returns how many were applied
+func (m *Migrator) Up() (int, error) {
+	var count int
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			if err := execStatements(ctx, conn, migration.Up); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %v", migration.Version, migration.Name, err)
+			}
+			_, err := conn.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, migration.Version, migration.Name)
+			if err != nil {
+				return err
+			}
+
+			log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down reverts the given number of most recently applied migrations and returns how many were reverted
+func (m *Migrator) Down(steps int) (int, error) {
+	var count int
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			if err := execStatements(ctx, conn, migration.Down); err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %v", migration.Version, migration.Name, err)
+			}
+			_, err := conn.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+			if err != nil {
+				return err
+			}
+
+			log.Printf("Reverted migration %d_%s", migration.Version, migration.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Status lists every embedded migration with the time it was applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := MigrationStatus{Migration: migration}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// withLock runs fn on a single connection holding the migration lock, after making sure
+// the schema_migrations table exists
+func (m *Migrator) withLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, lockName, lockTimeout).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return errors.New("timed out waiting for the migration lock")
+	}
+	defer conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, lockName)
+
+	if _, err := conn.ExecContext(ctx, createTableQuery); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+	return fn(ctx, conn)
+}
+
+// helper functions
+
+// appliedVersions returns the applied migration versions with the time they were applied
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// execStatements runs the statements of a migration file one at a time,
+// the driver doesn't accept several statements in a single Exec
+func execStatements(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, statement := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits a script on the semicolons ending a line, dropping empty statements.
+// Migration files must not use semicolons at the end of a line inside a statement.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(strings.ReplaceAll(script, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if statement := strings.TrimSuffix(strings.TrimSpace(current.String()), ";"); statement != "" {
+				statements = append(statements, statement)
+			}
+			current.Reset()
+		}
+	}
+	if statement := strings.TrimSpace(current.String()); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
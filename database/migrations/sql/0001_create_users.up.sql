@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS users (
+    userId INT NOT NULL AUTO_INCREMENT,
+    email VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    isAdmin TINYINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (userId),
+    UNIQUE KEY uq_users_email (email)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
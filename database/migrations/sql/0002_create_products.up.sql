@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS products (
+    productId INT NOT NULL AUTO_INCREMENT,
+    pricePerUnit DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    productName VARCHAR(255) NOT NULL,
+    productBrand VARCHAR(255) NOT NULL DEFAULT '',
+    description TEXT NOT NULL,
+    stockQuantity INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (productId),
+    KEY idx_products_brand (productBrand)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id INT NOT NULL AUTO_INCREMENT,
+    cart_id INT NOT NULL,
+    product_id INT NOT NULL,
+    quantity INT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_stock_reservations_product (cart_id, product_id),
+    KEY idx_stock_reservations_expiry (product_id, expires_at),
+    CONSTRAINT fk_stock_reservations_cart FOREIGN KEY (cart_id) REFERENCES carts (id) ON DELETE CASCADE,
+    CONSTRAINT fk_stock_reservations_product FOREIGN KEY (product_id) REFERENCES products (productId) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS auth_tokens (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    family_id VARCHAR(64) NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_auth_tokens_hash (token_hash),
+    KEY idx_auth_tokens_family (family_id),
+    KEY idx_auth_tokens_user (user_id),
+    CONSTRAINT fk_auth_tokens_user FOREIGN KEY (user_id) REFERENCES users (userId) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id VARCHAR(64) NOT NULL,
+    user_id INT NULL,
+    data MEDIUMBLOB NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY idx_sessions_user (user_id),
+    KEY idx_sessions_expiry (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
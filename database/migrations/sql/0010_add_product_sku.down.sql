@@ -0,0 +1 @@
+ALTER TABLE products DROP INDEX uq_products_sku, DROP COLUMN sku_key, DROP COLUMN sku;
@@ -0,0 +1,6 @@
+ALTER TABLE products ADD COLUMN sku VARCHAR(64) NOT NULL DEFAULT '' AFTER productId;
+
+-- products without a SKU keep an empty one, only the others must be unique
+ALTER TABLE products
+    ADD COLUMN sku_key VARCHAR(64) AS (NULLIF(sku, '')) STORED,
+    ADD UNIQUE KEY uq_products_sku (sku_key);
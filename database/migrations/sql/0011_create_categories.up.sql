@@ -0,0 +1,22 @@
+-- categories form a tree through parent_id, root categories have no parent
+CREATE TABLE IF NOT EXISTS categories (
+    id INT NOT NULL AUTO_INCREMENT,
+    parent_id INT NULL,
+    name VARCHAR(100) NOT NULL,
+    -- root categories share parent_key 0, so their names are unique too
+    parent_key INT AS (COALESCE(parent_id, 0)) STORED,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_categories_parent_name (parent_key, name),
+    CONSTRAINT fk_categories_parent FOREIGN KEY (parent_id) REFERENCES categories (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS product_categories (
+    product_id INT NOT NULL,
+    category_id INT NOT NULL,
+    PRIMARY KEY (product_id, category_id),
+    KEY idx_product_categories_category (category_id),
+    CONSTRAINT fk_product_categories_product FOREIGN KEY (product_id) REFERENCES products (productId) ON DELETE CASCADE,
+    CONSTRAINT fk_product_categories_category FOREIGN KEY (category_id) REFERENCES categories (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
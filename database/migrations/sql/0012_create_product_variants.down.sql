@@ -0,0 +1,21 @@
+ALTER TABLE order_items DROP COLUMN variant_id;
+
+-- a cart keeps a single line per product again, the largest one
+DELETE r FROM stock_reservations r JOIN stock_reservations other
+    ON other.cart_id = r.cart_id AND other.product_id = r.product_id AND (other.quantity > r.quantity OR other.quantity = r.quantity AND other.id < r.id);
+ALTER TABLE stock_reservations ADD UNIQUE KEY uq_stock_reservations_product (cart_id, product_id);
+ALTER TABLE stock_reservations
+    DROP FOREIGN KEY fk_stock_reservations_variant,
+    DROP INDEX uq_stock_reservations_variant,
+    DROP INDEX idx_stock_reservations_variant_expiry,
+    DROP COLUMN variant_id;
+
+DELETE ci FROM cart_items ci JOIN cart_items other
+    ON other.cart_id = ci.cart_id AND other.product_id = ci.product_id AND (other.quantity > ci.quantity OR other.quantity = ci.quantity AND other.id < ci.id);
+ALTER TABLE cart_items ADD UNIQUE KEY uq_cart_items_product (cart_id, product_id);
+ALTER TABLE cart_items
+    DROP FOREIGN KEY fk_cart_items_variant,
+    DROP INDEX uq_cart_items_variant,
+    DROP COLUMN variant_id;
+
+DROP TABLE IF EXISTS product_variants;
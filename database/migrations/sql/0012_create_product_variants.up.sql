@@ -0,0 +1,42 @@
+-- every product gets a default variant, the products.stockQuantity column becomes the total stock of its variants
+CREATE TABLE IF NOT EXISTS product_variants (
+    id INT NOT NULL AUTO_INCREMENT,
+    product_id INT NOT NULL,
+    sku VARCHAR(64) NOT NULL DEFAULT '',
+    attributes JSON NOT NULL,
+    price_override DECIMAL(10, 2) NULL,
+    stock_quantity INT NOT NULL DEFAULT 0,
+    is_default TINYINT(1) NOT NULL DEFAULT 0,
+    sku_key VARCHAR(64) AS (NULLIF(sku, '')) STORED,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_product_variants_sku (sku_key),
+    KEY idx_product_variants_product (product_id, is_default),
+    CONSTRAINT fk_product_variants_product FOREIGN KEY (product_id) REFERENCES products (productId) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT INTO product_variants (product_id, attributes, stock_quantity, is_default)
+SELECT productId, JSON_OBJECT(), stockQuantity, 1 FROM products;
+
+-- cart lines and reservations of existing carts move to the default variant of their product
+ALTER TABLE cart_items ADD COLUMN variant_id INT NULL AFTER product_id;
+UPDATE cart_items ci JOIN product_variants v ON v.product_id = ci.product_id AND v.is_default = 1 SET ci.variant_id = v.id;
+ALTER TABLE cart_items
+    MODIFY variant_id INT NOT NULL,
+    ADD UNIQUE KEY uq_cart_items_variant (cart_id, variant_id),
+    ADD CONSTRAINT fk_cart_items_variant FOREIGN KEY (variant_id) REFERENCES product_variants (id) ON DELETE CASCADE;
+ALTER TABLE cart_items DROP INDEX uq_cart_items_product;
+
+ALTER TABLE stock_reservations ADD COLUMN variant_id INT NULL AFTER product_id;
+UPDATE stock_reservations r JOIN product_variants v ON v.product_id = r.product_id AND v.is_default = 1 SET r.variant_id = v.id;
+ALTER TABLE stock_reservations
+    MODIFY variant_id INT NOT NULL,
+    ADD UNIQUE KEY uq_stock_reservations_variant (cart_id, variant_id),
+    ADD KEY idx_stock_reservations_variant_expiry (variant_id, expires_at),
+    ADD CONSTRAINT fk_stock_reservations_variant FOREIGN KEY (variant_id) REFERENCES product_variants (id) ON DELETE CASCADE;
+ALTER TABLE stock_reservations DROP INDEX uq_stock_reservations_product;
+
+-- order items keep no foreign key to their variant, like they keep none to their product
+ALTER TABLE order_items ADD COLUMN variant_id INT NULL AFTER product_id;
+UPDATE order_items oi JOIN product_variants v ON v.product_id = oi.product_id AND v.is_default = 1 SET oi.variant_id = v.id;
@@ -0,0 +1,16 @@
+-- the files of an image live in the blob store, the table keeps their keys and what was read from them
+CREATE TABLE IF NOT EXISTS product_images (
+    id INT NOT NULL AUTO_INCREMENT,
+    product_id INT NOT NULL,
+    blob_key VARCHAR(255) NOT NULL,
+    thumbnail_key VARCHAR(255) NOT NULL,
+    content_type VARCHAR(50) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    checksum CHAR(64) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_product_images_checksum (product_id, checksum),
+    CONSTRAINT fk_product_images_product FOREIGN KEY (product_id) REFERENCES products (productId) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
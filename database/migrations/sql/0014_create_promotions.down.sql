@@ -0,0 +1,9 @@
+ALTER TABLE orders
+    DROP COLUMN coupon_code,
+    DROP COLUMN discount_amount,
+    DROP COLUMN subtotal_amount;
+
+ALTER TABLE carts DROP COLUMN coupon_code;
+
+DROP TABLE IF EXISTS promotion_redemptions;
+DROP TABLE IF EXISTS promotions;
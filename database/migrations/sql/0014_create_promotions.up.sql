@@ -0,0 +1,45 @@
+-- promotions have no foreign key to their category: one whose category is removed applies to no product
+CREATE TABLE IF NOT EXISTS promotions (
+    id INT NOT NULL AUTO_INCREMENT,
+    code VARCHAR(32) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    kind VARCHAR(20) NOT NULL,
+    value DECIMAL(10, 2) NOT NULL,
+    buy_quantity INT NOT NULL DEFAULT 0,
+    get_quantity INT NOT NULL DEFAULT 0,
+    min_spend DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    category_id INT NULL,
+    max_uses INT NOT NULL DEFAULT 0,
+    max_uses_per_user INT NOT NULL DEFAULT 0,
+    starts_at DATETIME NULL,
+    ends_at DATETIME NULL,
+    active TINYINT(1) NOT NULL DEFAULT 1,
+    uses INT NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_promotions_code (code)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS promotion_redemptions (
+    id INT NOT NULL AUTO_INCREMENT,
+    promotion_id INT NOT NULL,
+    user_id INT NOT NULL,
+    order_id INT NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY idx_promotion_redemptions_user (promotion_id, user_id),
+    CONSTRAINT fk_promotion_redemptions_promotion FOREIGN KEY (promotion_id) REFERENCES promotions (id),
+    CONSTRAINT fk_promotion_redemptions_order FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- the coupon applied to a cart, redeemed at checkout
+ALTER TABLE carts ADD COLUMN coupon_code VARCHAR(32) NULL AFTER user_id;
+
+-- orders keep their subtotal and the discount they were given, total_amount is what the customer pays
+ALTER TABLE orders
+    ADD COLUMN subtotal_amount DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER user_id,
+    ADD COLUMN discount_amount DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER subtotal_amount,
+    ADD COLUMN coupon_code VARCHAR(32) NOT NULL DEFAULT '' AFTER discount_amount;
+UPDATE orders SET subtotal_amount = total_amount;
@@ -0,0 +1,10 @@
+ALTER TABLE orders
+    DROP COLUMN shipping_amount,
+    DROP COLUMN shipping_method,
+    DROP COLUMN tax_amount,
+    DROP COLUMN tax_rate,
+    DROP COLUMN region;
+
+ALTER TABLE carts DROP COLUMN region;
+
+ALTER TABLE products DROP COLUMN weightGrams;
@@ -0,0 +1,13 @@
+-- shipping weight of one unit, 0 when unknown
+ALTER TABLE products ADD COLUMN weightGrams INT NOT NULL DEFAULT 0 AFTER stockQuantity;
+
+-- the region a cart ships to, NULL for the default region of the pricing configuration
+ALTER TABLE carts ADD COLUMN region VARCHAR(8) NULL AFTER coupon_code;
+
+-- orders keep the tax and shipping they were quoted, total_amount is still what the customer pays
+ALTER TABLE orders
+    ADD COLUMN region VARCHAR(8) NOT NULL DEFAULT '' AFTER coupon_code,
+    ADD COLUMN tax_rate DECIMAL(6, 3) NOT NULL DEFAULT 0 AFTER region,
+    ADD COLUMN tax_amount DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER tax_rate,
+    ADD COLUMN shipping_method VARCHAR(20) NOT NULL DEFAULT '' AFTER tax_amount,
+    ADD COLUMN shipping_amount DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER shipping_method;
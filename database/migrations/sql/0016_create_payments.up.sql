@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS payments (
+    id INT NOT NULL AUTO_INCREMENT,
+    order_id INT NOT NULL,
+    user_id INT NOT NULL,
+    provider VARCHAR(20) NOT NULL,
+    reference VARCHAR(64) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    currency CHAR(3) NOT NULL,
+    captured_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    refunded_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    failure_reason VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_payments_reference (provider, reference),
+    KEY idx_payments_order (order_id),
+    CONSTRAINT fk_payments_order FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- the history of a payment, event_id is the id of a provider webhook so an event delivered twice is applied once
+CREATE TABLE IF NOT EXISTS payment_events (
+    id INT NOT NULL AUTO_INCREMENT,
+    payment_id INT NOT NULL,
+    event_id VARCHAR(64) NULL,
+    status VARCHAR(20) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    note VARCHAR(255) NOT NULL DEFAULT '',
+    actor VARCHAR(64) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_payment_events_event (payment_id, event_id),
+    CONSTRAINT fk_payment_events_payment FOREIGN KEY (payment_id) REFERENCES payments (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
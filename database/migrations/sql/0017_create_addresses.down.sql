@@ -0,0 +1,5 @@
+ALTER TABLE orders
+    DROP COLUMN billing_address,
+    DROP COLUMN shipping_address;
+
+DROP TABLE IF EXISTS addresses;
@@ -0,0 +1,26 @@
+-- the address books of the users, a user has at most one default shipping and one default billing address
+CREATE TABLE IF NOT EXISTS addresses (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    label VARCHAR(50) NOT NULL DEFAULT '',
+    full_name VARCHAR(100) NOT NULL,
+    line1 VARCHAR(255) NOT NULL,
+    line2 VARCHAR(255) NOT NULL DEFAULT '',
+    city VARCHAR(100) NOT NULL,
+    region VARCHAR(100) NOT NULL DEFAULT '',
+    postal_code VARCHAR(20) NOT NULL DEFAULT '',
+    country CHAR(2) NOT NULL,
+    phone VARCHAR(30) NOT NULL DEFAULT '',
+    is_default_shipping TINYINT(1) NOT NULL DEFAULT 0,
+    is_default_billing TINYINT(1) NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY idx_addresses_user (user_id),
+    CONSTRAINT fk_addresses_user FOREIGN KEY (user_id) REFERENCES users (userId) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- orders keep a copy of the addresses they were placed with, NULL for orders placed before addresses
+ALTER TABLE orders
+    ADD COLUMN shipping_address JSON NULL AFTER shipping_amount,
+    ADD COLUMN billing_address JSON NULL AFTER shipping_address;
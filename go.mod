@@ -7,12 +7,12 @@ toolchain go1.23.3
 require (
 	github.com/go-sql-driver/mysql v1.8.1
 	github.com/gorilla/mux v1.8.1
+	github.com/gorilla/securecookie v1.1.2
 	github.com/gorilla/sessions v1.4.0
 	golang.org/x/crypto v0.28.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	filippo.io/edwards25519 v1.1.0 // indirect
-	github.com/gorilla/securecookie v1.1.2 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
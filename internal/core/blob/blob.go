@@ -0,0 +1,111 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/ecommerce/configuration"
+)
+
+// ErrNotFound is returned when no blob is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps binary objects such as product images under slash separated keys,
+// e.g. "products/1/3f2a.jpg". Implementations must be safe for concurrent use.
+type BlobStore interface {
+	// Put stores the content of r under key, replacing any blob stored under it
+	Put(key string, r io.Reader) error
+	// Open returns the content of the blob stored under key, the caller must close it
+	Open(key string) (io.ReadSeekCloser, error)
+	// Delete removes the blob stored under key, deleting a missing blob is not an error
+	Delete(key string) error
+}
+
+// LocalStore keeps every blob as a file below Dir
+type LocalStore struct {
+	Dir string
+}
+
+// Init builds the blob store selected by the storage configuration
+func Init(config *configuration.Config) (BlobStore, error) {
+	switch config.Storage.Driver {
+	case "", "local":
+		if err := os.MkdirAll(config.Storage.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory %s: %w", config.Storage.Dir, err)
+		}
+		return &LocalStore{Dir: config.Storage.Dir}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", config.Storage.Driver)
+	}
+}
+
+// Put writes the blob to a temporary file first, so readers never see a partly written blob
+func (s *LocalStore) Put(key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory of blob %s: %w", key, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to store blob %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store blob %s: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store blob %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStore) Open(key string) (io.ReadSeekCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open blob %s: %w", key, err)
+	}
+	return file, nil
+}
+
+func (s *LocalStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob %s: %w", key, err)
+	}
+	return nil
+}
+
+// helper functions
+
+// path returns the file of a key, keys can't reach outside of Dir
+func (s *LocalStore) path(key string) (string, error) {
+	if !fs.ValidPath(key) || key == "." {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,253 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/utils"
+)
+
+// Payment tokens understood by the fake gateway, every other token is declined
+const (
+	TokenSuccess      = "tok_success"       // authorized right away
+	TokenDecline      = "tok_decline"       // declined right away
+	TokenAsync        = "tok_async"         // pending, authorized by a webhook after the confirm delay
+	TokenAsyncDecline = "tok_async_decline" // pending, declined by a webhook after the confirm delay
+)
+
+// FakeSignatureHeader carries the signature of the fake gateway webhooks: "t=<unix time>,v1=<hex HMAC-SHA256>"
+// of the timestamp, a dot and the body, keyed with the webhook secret
+const FakeSignatureHeader = "X-Fake-Signature"
+
+// webhookTolerance is how old a webhook may be, older ones are rejected as replays
+const webhookTolerance = 5 * time.Minute
+
+// webhookAttempts is how many times the fake gateway delivers a webhook before giving up
+const webhookAttempts = 3
+
+// FakeGateway is a PaymentProvider simulating a gateway in process, to develop payment flows without
+// sandbox credentials. The outcome of a payment depends on its token, see TokenSuccess and friends.
+// Asynchronous outcomes are posted as signed webhooks to WebhookURL, payments are lost on exit.
+type FakeGateway struct {
+	Secret       string
+	WebhookURL   string
+	ConfirmDelay time.Duration
+	Client       *http.Client
+
+	mu       sync.Mutex
+	payments map[string]*fakePayment
+}
+
+// fakePayment is the state of a payment at the fake gateway
+type fakePayment struct {
+	status   Status
+	amount   float64
+	captured float64
+	refunded float64
+}
+
+func NewFakeGateway(secret, webhookURL string, confirmDelay time.Duration) *FakeGateway {
+	return &FakeGateway{
+		Secret:       secret,
+		WebhookURL:   webhookURL,
+		ConfirmDelay: confirmDelay,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+		payments:     make(map[string]*fakePayment),
+	}
+}
+
+func (g *FakeGateway) Name() string {
+	return "fake"
+}
+
+func (g *FakeGateway) Authorize(req AuthorizeRequest) (*Result, error) {
+	if req.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	result := &Result{Reference: "fake_" + randomID(), Amount: req.Amount}
+	switch req.Token {
+	case TokenSuccess:
+		result.Status = StatusAuthorized
+	case TokenAsync, TokenAsyncDecline:
+		result.Status = StatusPending
+	case TokenDecline:
+		result.Status = StatusDeclined
+		result.Reason = "card declined"
+	default:
+		result.Status = StatusDeclined
+		result.Reason = "invalid payment token"
+	}
+
+	g.mu.Lock()
+	g.payments[result.Reference] = &fakePayment{status: result.Status, amount: req.Amount}
+	g.mu.Unlock()
+
+	if result.Status == StatusPending {
+		outcome := Result{Reference: result.Reference, Status: StatusAuthorized, Amount: req.Amount}
+		if req.Token == TokenAsyncDecline {
+			outcome.Status = StatusDeclined
+			outcome.Reason = "card declined by the issuer"
+		}
+		time.AfterFunc(g.ConfirmDelay, func() { g.settle(outcome) })
+	}
+
+	log.Printf("Fake gateway: payment %s of order %d for %.2f %s is %s", result.Reference, req.OrderID, req.Amount, req.Currency, result.Status)
+	return result, nil
+}
+
+func (g *FakeGateway) Capture(reference string, amount float64) (*Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	payment, ok := g.payments[reference]
+	if !ok {
+		return nil, ErrUnknownPayment
+	}
+	if payment.status != StatusAuthorized {
+		return nil, fmt.Errorf("%w: can't capture a %s payment", ErrInvalidState, payment.status)
+	}
+	if amount <= 0 || utils.RoundAmount(amount) > payment.amount {
+		return nil, fmt.Errorf("%w: can capture up to %.2f", ErrInvalidAmount, payment.amount)
+	}
+
+	payment.status = StatusCaptured
+	payment.captured = utils.RoundAmount(amount)
+	return &Result{Reference: reference, Status: StatusCaptured, Amount: payment.captured}, nil
+}
+
+func (g *FakeGateway) Refund(reference string, amount float64) (*Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	payment, ok := g.payments[reference]
+	if !ok {
+		return nil, ErrUnknownPayment
+	}
+	if payment.status != StatusCaptured {
+		return nil, fmt.Errorf("%w: can't refund a %s payment", ErrInvalidState, payment.status)
+	}
+	remaining := utils.RoundAmount(payment.captured - payment.refunded)
+	if amount <= 0 || utils.RoundAmount(amount) > remaining {
+		return nil, fmt.Errorf("%w: can refund up to %.2f", ErrInvalidAmount, remaining)
+	}
+
+	payment.refunded = utils.RoundAmount(payment.refunded + amount)
+	if payment.refunded >= payment.captured {
+		payment.status = StatusRefunded
+	}
+	return &Result{Reference: reference, Status: StatusRefunded, Amount: utils.RoundAmount(amount)}, nil
+}
+
+func (g *FakeGateway) VerifyWebhook(header http.Header, payload []byte) (*Event, error) {
+	var timestamp, signature string
+	for _, part := range strings.Split(header.Get(FakeSignatureHeader), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signature == "" {
+		return nil, ErrInvalidSignature
+	}
+	expected := g.sign(timestamp, payload)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return nil, fmt.Errorf("%w: timestamp outside the tolerance", ErrInvalidSignature)
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return &event, nil
+}
+
+// Signature returns the FakeSignatureHeader value of a webhook body sent at the given time,
+// to craft webhooks by hand
+func (g *FakeGateway) Signature(payload []byte, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, g.sign(timestamp, payload))
+}
+
+// settle applies the outcome of an asynchronous payment and reports it through a webhook
+func (g *FakeGateway) settle(outcome Result) {
+	g.mu.Lock()
+	if payment, ok := g.payments[outcome.Reference]; ok && payment.status == StatusPending {
+		payment.status = outcome.Status
+	}
+	g.mu.Unlock()
+
+	event := Event{ID: "evt_" + randomID(), Result: outcome}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Fake gateway: failed to encode event %s: %v", event.ID, err)
+		return
+	}
+
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		err = g.post(payload)
+		if err == nil {
+			log.Printf("Fake gateway: payment %s is %s, webhook %s delivered", outcome.Reference, outcome.Status, event.ID)
+			return
+		}
+		log.Printf("Fake gateway: attempt %d to deliver webhook %s failed: %v", attempt, event.ID, err)
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+// post delivers a webhook body to WebhookURL, any answer but a 2xx is a failed delivery
+func (g *FakeGateway) post(payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, g.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(FakeSignatureHeader, g.Signature(payload, time.Now()))
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// helper functions
+
+// sign returns the hex HMAC-SHA256 of a timestamped webhook body
+func (g *FakeGateway) sign(timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(g.Secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// randomID returns a random identifier for references and events
+func randomID() string {
+	random := make([]byte, 12)
+	rand.Read(random)
+	return hex.EncodeToString(random)
+}
@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ecommerce/configuration"
+)
+
+var (
+	// ErrUnknownPayment is returned when the provider has no payment with the given reference
+	ErrUnknownPayment = errors.New("unknown payment")
+	// ErrInvalidState is returned when a payment can't be captured or refunded in its current state
+	ErrInvalidState = errors.New("invalid payment state")
+	// ErrInvalidAmount is returned when capturing or refunding more than the payment allows
+	ErrInvalidAmount = errors.New("invalid payment amount")
+	// ErrInvalidSignature is returned when a webhook isn't signed by the provider
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// Status is the state of a payment at the provider
+type Status string
+
+const (
+	StatusPending    Status = "pending"    // awaiting an asynchronous confirmation, settled by a webhook
+	StatusAuthorized Status = "authorized" // the amount is held and can be captured
+	StatusDeclined   Status = "declined"
+	StatusCaptured   Status = "captured"
+	StatusRefunded   Status = "refunded"
+)
+
+// PaymentProvider charges customers through a payment gateway. Payments are authorized first,
+// which holds the amount, then captured, and may be refunded once captured. Gateways report
+// asynchronous outcomes through webhooks. Implementations must be safe for concurrent use.
+type PaymentProvider interface {
+	// Name identifies the provider, payment references are unique per provider
+	Name() string
+	// Authorize holds the amount on the payment method the token stands for. A declined payment is
+	// not an error, its result has the declined status and the reason.
+	Authorize(req AuthorizeRequest) (*Result, error)
+	// Capture collects amount of an authorized payment
+	Capture(reference string, amount float64) (*Result, error)
+	// Refund pays amount of a captured payment back
+	Refund(reference string, amount float64) (*Result, error)
+	// VerifyWebhook checks that a webhook request was sent by the provider and returns the event it carries
+	VerifyWebhook(header http.Header, payload []byte) (*Event, error)
+}
+
+// AuthorizeRequest is a payment to authorize
+type AuthorizeRequest struct {
+	OrderID  int
+	Amount   float64
+	Currency string
+	Token    string // payment method collected by the provider on the client side
+}
+
+// Result is the outcome of a payment operation. Amount is what the operation was about,
+// e.g. the refunded amount of a refund.
+type Result struct {
+	Reference string  `json:"reference"`
+	Status    Status  `json:"status"`
+	Amount    float64 `json:"amount"`
+	Reason    string  `json:"reason,omitempty"` // why the payment was declined
+}
+
+// Event is an outcome the provider reports through a webhook. Providers may deliver an event
+// more than once, the ID tells the deliveries of the same event apart from other events.
+type Event struct {
+	ID string `json:"id"`
+	Result
+}
+
+// Init builds the payment provider selected by the payment configuration
+func Init(config *configuration.Config) (PaymentProvider, error) {
+	switch config.Payment.Driver {
+	case "", "fake":
+		secret := config.Payment.WebhookSecret
+		if secret == "" {
+			random := make([]byte, 32)
+			if _, err := rand.Read(random); err != nil {
+				return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+			}
+			secret = hex.EncodeToString(random)
+		}
+		delay := time.Duration(config.Payment.ConfirmDelay) * time.Second
+		return NewFakeGateway(secret, config.Payment.WebhookURL, delay), nil
+	default:
+		return nil, fmt.Errorf("unknown payment driver %q", config.Payment.Driver)
+	}
+}
@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ecommerce/configuration"
+)
+
+// Message is a plain text email, the sender is set by the mailer
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// LogMailer writes every message to the application log, for local development
+type LogMailer struct {
+	From string
+}
+
+// FileMailer writes every message as an .eml file into Dir, for local development
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Init builds the mailer selected by the mail configuration
+func Init(config *configuration.Config) (Mailer, error) {
+	switch config.Mail.Driver {
+	case "", "log":
+		return &LogMailer{From: config.Mail.From}, nil
+	case "file":
+		if err := os.MkdirAll(config.Mail.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create mail directory %s: %w", config.Mail.Dir, err)
+		}
+		return &FileMailer{Dir: config.Mail.Dir, From: config.Mail.From}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", config.Mail.Driver)
+	}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("Mail from %s to %s: %s\n%s", m.From, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), sanitize(msg.To))
+	path := filepath.Join(m.Dir, name)
+
+	content := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		m.From, msg.To, msg.Subject, time.Now().Format(time.RFC1123Z), msg.Body)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		return fmt.Errorf("failed to write mail to %s: %w", path, err)
+	}
+
+	log.Printf("Mail to %s written to %s", msg.To, path)
+	return nil
+}
+
+// helper functions
+
+// sanitize keeps an email address usable as part of a file name
+func sanitize(address string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, address)
+}
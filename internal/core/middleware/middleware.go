@@ -1,77 +1,249 @@
-package middleware
-
-import (
-	"context"
-	"net/http"
-
-	"github.com/ecommerce/internal/core/setup"
-	"github.com/gorilla/mux"
-)
-
-// CORS Middleware
-func CorsMiddleware() func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// CORS logic
-			w.Header().Add("Access-Control-Allow-Origin", "*")
-			// w.Header().Add("Content-Type", "application/json")
-			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-// AUTH Middleware
-func AuthMiddleware() func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// CORS logic
-			w.Header().Add("Access-Control-Allow-Origin", "*")
-			// w.Header().Add("Content-Type", "application/json")
-			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-// Session Middleware : to load session and add it to the context
-func SessionMiddleware(setupRes *setup.CoreSetupInitResult) func(http.Handler) http.Handler {
-	//extract session store
-	store := setupRes.Store
-	config := setupRes.Config
-
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Session logic
-			session, err := store.Get(r, "session-name")
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			// Add session to the request context
-			ctx := context.WithValue(r.Context(), config.Session.SessionContextKey, session)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
-	}
-}
-
-// InjectConfigMiddleware injects the configuration into the request context
-func InjectConfigMiddleware(setupRes *setup.CoreSetupInitResult) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Inject configuration into context
-			ctx := context.WithValue(r.Context(), "config", setupRes.Config)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
-	}
-}
-
-// Setup middleware
-func RegisterMiddleWares(r *mux.Router, setupRes *setup.CoreSetupInitResult) {
-	r.Use(InjectConfigMiddleware(setupRes)) // Add middleware for injecting config
-	r.Use(CorsMiddleware())
-	r.Use(SessionMiddleware(setupRes))
-}
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/core/session"
+	"github.com/ecommerce/internal/core/setup"
+	"github.com/gorilla/mux"
+)
+
+// CORS Middleware
+func CorsMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// CORS logic
+			w.Header().Add("Access-Control-Allow-Origin", "*")
+			// w.Header().Add("Content-Type", "application/json")
+			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Role is the access level a route requires
+type Role int
+
+const (
+	RoleUser  Role = iota // any logged in user
+	RoleAdmin             // users with isAdmin set
+)
+
+// publicPathPrefixes are reachable under /api and /prod without logging in
+var publicPathPrefixes = []string{
+	"/api/auth/",
+	"/prod/auth/",
+	"/api/users/resetPass",
+	"/prod/users/forgotPass",
+	"/prod/users/resetPass",
+	"/api/payments/webhook", // signed by the payment provider
+}
+
+var (
+	errAuthRequired = response.Unauthorized("authentication required")
+	errInvalidToken = response.New(http.StatusUnauthorized, "invalid_token", "invalid or expired token")
+	errNotAllowed   = response.Forbidden("you are not allowed to perform this action")
+)
+
+// TokenAuthenticator resolves a bearer token to the user it was issued to and that user's cart
+type TokenAuthenticator interface {
+	AuthenticateToken(token string) (*session.User, *session.Cart, error)
+}
+
+// AUTH Middleware : requires a logged in user for every /api and /prod route that isn't public.
+// The user comes from an "Authorization: Bearer" token when one is sent, from the session otherwise.
+// Unauthenticated /prod requests are redirected to the login page, /api requests get a 401 JSON error.
+// Public routes are let through either way, with the user in the context when there is one.
+func AuthMiddleware(tokens TokenAuthenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions || !isAppPath(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			public := isPublicPath(r.URL.Path)
+
+			sess, err := session.GetSessionFromContext(r)
+			if sess == nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			if bearer, ok := bearerToken(r); ok {
+				user, cart, err := tokens.AuthenticateToken(bearer)
+				if err != nil {
+					if public {
+						next.ServeHTTP(w, r)
+						return
+					}
+					log.Println(err)
+					response.WriteError(w, errInvalidToken)
+					return
+				}
+
+				// fill the request's session (it is never saved for token requests)
+				// so handlers read the user and cart the same way for both kinds of clients
+				sess.Values["user"] = user
+				sess.Values["userId"] = user.UserID
+				sess.Values["cart"] = cart
+				next.ServeHTTP(w, r.WithContext(session.WithUser(r.Context(), user)))
+				return
+			}
+
+			user, err := session.GetSessionUser(sess)
+			if err != nil {
+				if public {
+					next.ServeHTTP(w, r)
+					return
+				}
+				if isAPIPath(r.URL.Path) {
+					response.WriteError(w, errAuthRequired)
+					return
+				}
+				http.Redirect(w, r, "/prod/auth/login", http.StatusSeeOther)
+				return
+			}
+
+			// Add the authenticated user to the request context
+			next.ServeHTTP(w, r.WithContext(session.WithUser(r.Context(), user)))
+		})
+	}
+}
+
+// RequireRole wraps a handler so that it only runs for users with at least the given role.
+// When methods are given the role is only enforced for those methods, e.g. to let every user
+// read a resource while only admins may change it. Must run behind AuthMiddleware.
+func RequireRole(role Role, next http.HandlerFunc, methods ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || !appliesTo(r.Method, methods) {
+			next(w, r)
+			return
+		}
+
+		user, err := session.GetUserFromContext(r)
+		if err != nil {
+			if isAPIPath(r.URL.Path) {
+				response.WriteError(w, errAuthRequired)
+				return
+			}
+			http.Redirect(w, r, "/prod/auth/login", http.StatusSeeOther)
+			return
+		}
+
+		if roleOf(user) < role {
+			log.Printf("user %d denied %s %s", user.UserID, r.Method, r.URL.Path)
+			writeError(w, r, errNotAllowed)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// Session Middleware : to load session and add it to the context
+func SessionMiddleware(setupRes *setup.CoreSetupInitResult) func(http.Handler) http.Handler {
+	//extract session store
+	store := setupRes.Store
+	config := setupRes.Config
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Session logic
+			session, err := store.Get(r, "session-name")
+			if err != nil {
+				log.Println(err)
+				writeError(w, r, err)
+				return
+			}
+
+			// Add session to the request context
+			ctx := context.WithValue(r.Context(), config.Session.SessionContextKey, session)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// InjectConfigMiddleware injects the configuration into the request context
+func InjectConfigMiddleware(setupRes *setup.CoreSetupInitResult) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Inject configuration into context
+			ctx := context.WithValue(r.Context(), "config", setupRes.Config)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Setup middleware
+func RegisterMiddleWares(r *mux.Router, setupRes *setup.CoreSetupInitResult) {
+	r.Use(InjectConfigMiddleware(setupRes)) // Add middleware for injecting config
+	r.Use(CorsMiddleware())
+	r.Use(SessionMiddleware(setupRes))
+	// AuthMiddleware needs the services and is registered along with the routes
+}
+
+// helper functions
+
+func isAPIPath(path string) bool {
+	return strings.HasPrefix(path, "/api/")
+}
+
+// writeError answers with the JSON error envelope on api routes and with plain text elsewhere
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if isAPIPath(r.URL.Path) {
+		response.WriteError(w, err)
+		return
+	}
+	response.PageError(w, err)
+}
+
+// bearerToken extracts the token of an "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+// isAppPath reports whether a path belongs to the api or prod routes, which go through authentication
+func isAppPath(path string) bool {
+	return isAPIPath(path) || strings.HasPrefix(path, "/prod/")
+}
+
+// isPublicPath reports whether a path is reachable without logging in
+func isPublicPath(path string) bool {
+	for _, prefix := range publicPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesTo reports whether method is one of methods, an empty list matches every method
+func appliesTo(method string, methods []string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func roleOf(user *session.User) Role {
+	if user.IsAdmin == 1 {
+		return RoleAdmin
+	}
+	return RoleUser
+}
@@ -0,0 +1,147 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Generic error codes. Services declare more specific ones next to their sentinel errors,
+// e.g. "product_not_found" or "insufficient_stock", so clients can branch on them.
+const (
+	CodeBadRequest   = "bad_request"
+	CodeInvalidBody  = "invalid_body"
+	CodeValidation   = "validation_failed"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeNotFound     = "not_found"
+	CodeConflict     = "conflict"
+	CodeInternal     = "internal_error"
+)
+
+// Error is an application error: a stable code, a message that is safe to show to clients,
+// optional details per request field or about the whole request and the HTTP status it is
+// answered with. The underlying cause is only logged, it never reaches the client.
+type Error struct {
+	Status  int               `json:"-"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Details interface{}       `json:"details,omitempty"`
+	Cause   error             `json:"-"`
+}
+
+// envelope is the body of every error response: {"success": false, "error": {...}}
+type envelope struct {
+	Success bool   `json:"success"`
+	Error   *Error `json:"error"`
+}
+
+// New creates an application error
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// BadRequest is a 400 error with the generic bad_request code
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// InvalidBody is the 400 error of a request body that can't be decoded
+func InvalidBody(cause error) *Error {
+	return New(http.StatusBadRequest, CodeInvalidBody, "request body is malformed").Wrap(cause)
+}
+
+// Validation is a 422 error listing what is wrong with each request field
+func Validation(fields map[string]string) *Error {
+	err := New(http.StatusUnprocessableEntity, CodeValidation, "request validation failed")
+	err.Fields = fields
+	return err
+}
+
+// Unauthorized is a 401 error with the generic unauthorized code
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+// Forbidden is a 403 error with the generic forbidden code
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+// Internal is the 500 error every unexpected failure is reported as
+func Internal(cause error) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, "something went wrong, please try again later").Wrap(cause)
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is matches errors with the same code, so copies made with Wrap or Withf
+// still match their sentinel with errors.Is
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of the error recording its cause
+func (e *Error) Wrap(cause error) *Error {
+	wrapped := *e
+	wrapped.Cause = cause
+	return &wrapped
+}
+
+// Withf returns a copy of the error with a more detailed message
+func (e *Error) Withf(format string, args ...interface{}) *Error {
+	detailed := *e
+	detailed.Message = fmt.Sprintf(format, args...)
+	return &detailed
+}
+
+// WithDetails returns a copy of the error carrying details for the client, e.g. an import report
+func (e *Error) WithDetails(details interface{}) *Error {
+	detailed := *e
+	detailed.Details = details
+	return &detailed
+}
+
+// From returns the application error in err's chain, or an internal error wrapping err
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return Internal(err)
+}
+
+// JSON writes v as a JSON response with the given status
+func JSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Error encoding response:", err)
+	}
+}
+
+// WriteError answers an API request with err in the error envelope.
+// Errors that aren't application errors are reported as internal errors.
+func WriteError(w http.ResponseWriter, err error) {
+	appErr := From(err)
+	JSON(w, appErr.Status, envelope{Error: appErr})
+}
+
+// PageError answers a page request with the message of err as plain text
+func PageError(w http.ResponseWriter, err error) {
+	appErr := From(err)
+	http.Error(w, appErr.Message, appErr.Status)
+}
@@ -1,24 +1,38 @@
-package routes
-
-import (
-	"github.com/ecommerce/internal/core/services"
-	"github.com/ecommerce/internal/core/setup"
-	"github.com/ecommerce/internal/services/authentication"
-	"github.com/ecommerce/internal/services/cart"
-	"github.com/ecommerce/internal/services/index"
-	"github.com/ecommerce/internal/services/product"
-	"github.com/ecommerce/internal/services/user"
-	"github.com/gorilla/mux"
-)
-
-func RegisterRoutes(r *mux.Router, setupRes *setup.CoreSetupInitResult) {
-	// Initialize services and repositories
-	serviceRegistry := services.InitializeServices(setupRes.DbConn)
-
-	// Register routes
-	index.SetupIndexRoutes(r)
-	product.SetupProductRoutes(r, serviceRegistry.ProductService)
-	user.SetupUserRoutes(r, serviceRegistry.UserService)
-	authentication.SetupAuthRoutes(r, serviceRegistry.AuthService)
-	cart.SetupCartRoutes(r, serviceRegistry.CartService)
-}
+package routes
+
+import (
+	"github.com/ecommerce/internal/core/middleware"
+	"github.com/ecommerce/internal/core/services"
+	"github.com/ecommerce/internal/core/setup"
+	"github.com/ecommerce/internal/services/address"
+	"github.com/ecommerce/internal/services/authentication"
+	"github.com/ecommerce/internal/services/cart"
+	"github.com/ecommerce/internal/services/category"
+	"github.com/ecommerce/internal/services/index"
+	"github.com/ecommerce/internal/services/order"
+	"github.com/ecommerce/internal/services/payment"
+	"github.com/ecommerce/internal/services/product"
+	"github.com/ecommerce/internal/services/promotion"
+	"github.com/ecommerce/internal/services/user"
+	"github.com/gorilla/mux"
+)
+
+func RegisterRoutes(r *mux.Router, setupRes *setup.CoreSetupInitResult) {
+	// Initialize services and repositories
+	serviceRegistry := services.InitializeServices(setupRes)
+
+	// Register the auth middleware, it resolves bearer tokens through the auth service
+	r.Use(middleware.AuthMiddleware(serviceRegistry.AuthService))
+
+	// Register routes
+	index.SetupIndexRoutes(r)
+	product.SetupProductRoutes(r, serviceRegistry.ProductService)
+	user.SetupUserRoutes(r, serviceRegistry.UserService)
+	authentication.SetupAuthRoutes(r, serviceRegistry.AuthService)
+	cart.SetupCartRoutes(r, serviceRegistry.CartService)
+	order.SetupOrderRoutes(r, serviceRegistry.OrderService)
+	category.SetupCategoryRoutes(r, serviceRegistry.CategoryService)
+	promotion.SetupPromotionRoutes(r, serviceRegistry.PromotionService)
+	payment.SetupPaymentRoutes(r, serviceRegistry.PaymentService)
+	address.SetupAddressRoutes(r, serviceRegistry.AddressService)
+}
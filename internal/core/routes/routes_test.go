@@ -0,0 +1,254 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ecommerce/internal/core/middleware"
+	"github.com/ecommerce/internal/core/setup"
+	"github.com/gorilla/mux"
+)
+
+// testConfig runs the application on the in-memory database, which is seeded with the demo products
+const testConfig = `
+session:
+  session_key: "0123456789abcdef0123456789abcdef"
+  session_context_key: "session"
+  domain: localhost
+  path: /
+database:
+  driver: memory
+storage:
+  dir: %q
+pricing:
+  default_region: US-CA
+  tax_rates:
+    US-CA: 7.25
+  shipping:
+    method: flat
+    flat_rate: 5
+`
+
+// newTestServer serves the whole application from a fresh in-memory database
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(testConfig, filepath.Join(dir, "uploads"))), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	setupRes, err := setup.InitializeAll(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mux.NewRouter()
+	middleware.RegisterMiddleWares(r, setupRes)
+	RegisterRoutes(r, setupRes)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// apiClient calls the JSON API, as the user of its bearer token once it has one
+type apiClient struct {
+	t           *testing.T
+	baseURL     string
+	accessToken string
+}
+
+// call sends body as JSON and decodes the answer into out when it is not nil, it returns the status code
+func (c *apiClient) call(method, path string, body, out interface{}) int {
+	c.t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, &payload)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			c.t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// mustCall is call failing the test unless the answer has the status want
+func (c *apiClient) mustCall(method, path string, body, out interface{}, want int) {
+	c.t.Helper()
+	if status := c.call(method, path, body, out); status != want {
+		c.t.Fatalf("%s %s: status %d, want %d", method, path, status, want)
+	}
+}
+
+// signIn logs in with the credentials and calls the API with the access token from then on
+func (c *apiClient) signIn(credentials map[string]string) {
+	c.t.Helper()
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	c.mustCall(http.MethodPost, "/api/auth/login", credentials, &tokens, http.StatusOK)
+	c.accessToken = tokens.AccessToken
+}
+
+func TestRegisterLoginAndCheckout(t *testing.T) {
+	server := newTestServer(t)
+	c := &apiClient{t: t, baseURL: server.URL}
+
+	credentials := map[string]string{"email": "ann@example.com", "password": "longenough"}
+	c.mustCall(http.MethodPost, "/api/auth/register", credentials, nil, http.StatusCreated)
+	c.mustCall(http.MethodPost, "/api/auth/register", credentials, nil, http.StatusConflict)
+	c.mustCall(http.MethodPost, "/api/auth/login", map[string]string{"email": "ann@example.com", "password": "wrongpassword"}, nil, http.StatusUnauthorized)
+
+	c.signIn(credentials)
+
+	var product struct {
+		StockQuantity int `json:"stockQuantity"`
+	}
+	c.mustCall(http.MethodGet, "/api/products/1", nil, &product, http.StatusOK)
+	stock := product.StockQuantity
+
+	// checking out needs a shipping address
+	c.mustCall(http.MethodPost, "/api/cart/1", map[string]int{"quantity": 2}, nil, http.StatusOK)
+	c.mustCall(http.MethodPost, "/api/orders/checkout", nil, nil, http.StatusBadRequest)
+	c.mustCall(http.MethodPost, "/api/addresses", map[string]string{
+		"full_name": "Ann Smith", "line1": "1 Market St", "city": "San Francisco", "region": "CA", "postal_code": "94105", "country": "US",
+	}, nil, http.StatusCreated)
+
+	var cart struct {
+		TotalItems int `json:"total_items"`
+		Quote      struct {
+			Region     string  `json:"region"`
+			GrandTotal float64 `json:"grand_total"`
+		} `json:"quote"`
+	}
+	c.mustCall(http.MethodGet, "/api/cart", nil, &cart, http.StatusOK)
+	if cart.TotalItems != 2 || cart.Quote.Region != "US-CA" {
+		t.Fatalf("cart = %+v, want 2 items quoted for US-CA", cart)
+	}
+
+	var order struct {
+		ID          int     `json:"id"`
+		Status      string  `json:"status"`
+		TotalAmount float64 `json:"total_amount"`
+	}
+	c.mustCall(http.MethodPost, "/api/orders/checkout", nil, &order, http.StatusCreated)
+	if order.Status != "pending" || order.TotalAmount != cart.Quote.GrandTotal {
+		t.Errorf("order = %+v, want a pending order of the cart quote %.2f", order, cart.Quote.GrandTotal)
+	}
+
+	c.mustCall(http.MethodGet, "/api/cart", nil, &cart, http.StatusOK)
+	if cart.TotalItems != 0 {
+		t.Errorf("cart still holds %d items after checkout", cart.TotalItems)
+	}
+	c.mustCall(http.MethodGet, "/api/products/1", nil, &product, http.StatusOK)
+	if product.StockQuantity != stock-2 {
+		t.Errorf("stock = %d after checkout, want %d", product.StockQuantity, stock-2)
+	}
+
+	var orders []struct {
+		ID int `json:"id"`
+	}
+	c.mustCall(http.MethodGet, "/api/orders", nil, &orders, http.StatusOK)
+	if len(orders) != 1 || orders[0].ID != order.ID {
+		t.Errorf("orders = %+v, want the order %d", orders, order.ID)
+	}
+}
+
+func TestCheckoutChargesTheQuoteOfTheChosenAddress(t *testing.T) {
+	server := newTestServer(t)
+	c := &apiClient{t: t, baseURL: server.URL}
+
+	credentials := map[string]string{"email": "ann@example.com", "password": "longenough"}
+	c.mustCall(http.MethodPost, "/api/auth/register", credentials, nil, http.StatusCreated)
+	c.signIn(credentials)
+
+	// the default shipping address is taxed, the other one isn't
+	c.mustCall(http.MethodPost, "/api/addresses", map[string]string{
+		"full_name": "Ann Smith", "line1": "1 Market St", "city": "San Francisco", "region": "CA", "postal_code": "94105", "country": "US",
+	}, nil, http.StatusCreated)
+	var other struct {
+		ID int `json:"id"`
+	}
+	c.mustCall(http.MethodPost, "/api/addresses", map[string]string{
+		"full_name": "Ann Smith", "line1": "1 Main St", "city": "Portland", "region": "OR", "postal_code": "97201", "country": "US",
+	}, &other, http.StatusCreated)
+	c.mustCall(http.MethodPost, "/api/cart/1", map[string]int{"quantity": 1}, nil, http.StatusOK)
+
+	type quotedCart struct {
+		Quote struct {
+			Region     string  `json:"region"`
+			GrandTotal float64 `json:"grand_total"`
+		} `json:"quote"`
+	}
+	var byDefault, chosen quotedCart
+	c.mustCall(http.MethodGet, "/api/cart", nil, &byDefault, http.StatusOK)
+	c.mustCall(http.MethodGet, fmt.Sprintf("/api/cart?address_id=%d", other.ID), nil, &chosen, http.StatusOK)
+	if chosen.Quote.Region != "US-OR" || chosen.Quote.GrandTotal >= byDefault.Quote.GrandTotal {
+		t.Fatalf("quote for the chosen address = %+v, want it for US-OR without the tax of %+v", chosen.Quote, byDefault.Quote)
+	}
+	c.mustCall(http.MethodGet, "/api/cart?address_id=999", nil, nil, http.StatusNotFound)
+
+	var order struct {
+		TotalAmount float64 `json:"total_amount"`
+	}
+	c.mustCall(http.MethodPost, "/api/orders/checkout", map[string]int{"address_id": other.ID}, &order, http.StatusCreated)
+	if order.TotalAmount != chosen.Quote.GrandTotal {
+		t.Errorf("order total = %.2f, want the quote of the chosen address %.2f", order.TotalAmount, chosen.Quote.GrandTotal)
+	}
+}
+
+func TestCartRegionIsAnEstimateUntilAnAddressIsAdded(t *testing.T) {
+	server := newTestServer(t)
+	c := &apiClient{t: t, baseURL: server.URL}
+
+	credentials := map[string]string{"email": "ann@example.com", "password": "longenough"}
+	c.mustCall(http.MethodPost, "/api/auth/register", credentials, nil, http.StatusCreated)
+	c.signIn(credentials)
+	c.mustCall(http.MethodPost, "/api/cart/1", map[string]int{"quantity": 1}, nil, http.StatusOK)
+
+	var cart struct {
+		Region       string `json:"region"`
+		RegionSource string `json:"region_source"`
+	}
+	c.mustCall(http.MethodGet, "/api/cart", nil, &cart, http.StatusOK)
+	if cart.Region != "US-CA" || cart.RegionSource != "default" {
+		t.Errorf("new cart quoted for %s from %s, want the default region", cart.Region, cart.RegionSource)
+	}
+	c.mustCall(http.MethodPut, "/api/cart/region", map[string]string{"region": "US-OR"}, &cart, http.StatusOK)
+	if cart.Region != "US-OR" || cart.RegionSource != "cart" {
+		t.Errorf("cart quoted for %s from %s after picking US-OR", cart.Region, cart.RegionSource)
+	}
+
+	// the address decides from now on
+	c.mustCall(http.MethodPost, "/api/addresses", map[string]string{
+		"full_name": "Ann Smith", "line1": "1 Market St", "city": "San Francisco", "region": "CA", "postal_code": "94105", "country": "US",
+	}, nil, http.StatusCreated)
+	c.mustCall(http.MethodGet, "/api/cart", nil, &cart, http.StatusOK)
+	if cart.Region != "US-CA" || cart.RegionSource != "address" {
+		t.Errorf("cart quoted for %s from %s, want the region of the address", cart.Region, cart.RegionSource)
+	}
+	c.mustCall(http.MethodPut, "/api/cart/region", map[string]string{"region": "US-OR"}, nil, http.StatusConflict)
+}
@@ -1,42 +1,139 @@
-package services
-
-import (
-	"database/sql"
-
-	"github.com/ecommerce/internal/services/authentication"
-	"github.com/ecommerce/internal/services/cart"
-	"github.com/ecommerce/internal/services/product"
-	"github.com/ecommerce/internal/services/user"
-)
-
-type ServiceRegistry struct {
-	UserService    *user.UserService
-	AuthService    *authentication.AuthService
-	ProductService *product.ProductService
-	CartService    *cart.CartService
-}
-
-func InitializeServices(db *sql.DB) *ServiceRegistry {
-	// Initialize user repository and service
-	userRepo := user.NewUserRepository(db)
-	userService := user.NewUserService(userRepo)
-
-	// Initialize cart repository and service
-	cartRepo := cart.NewCartRepository(db)
-	cartService := cart.NewCartService(cartRepo)
-
-	// Initialize authentication service
-	authService := authentication.NewAuthService(userService, cartService)
-
-	// Initialize product repository and service
-	productRepo := product.NewProductRepository(db)
-	productService := product.NewProductService(productRepo)
-
-	// Return the ServiceRegistry with all services initialized
-	return &ServiceRegistry{
-		UserService:    userService,
-		AuthService:    authService,
-		ProductService: productService,
-		CartService:    cartService,
-	}
-}
+package services
+
+import (
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/core/setup"
+	"github.com/ecommerce/internal/services/address"
+	"github.com/ecommerce/internal/services/authentication"
+	"github.com/ecommerce/internal/services/cart"
+	"github.com/ecommerce/internal/services/category"
+	"github.com/ecommerce/internal/services/order"
+	"github.com/ecommerce/internal/services/payment"
+	"github.com/ecommerce/internal/services/pricing"
+	"github.com/ecommerce/internal/services/product"
+	"github.com/ecommerce/internal/services/promotion"
+	"github.com/ecommerce/internal/services/user"
+)
+
+type ServiceRegistry struct {
+	UserService    *user.UserService
+	AuthService    *authentication.AuthService
+	ProductService *product.ProductService
+	CartService    *cart.CartService
+	OrderService   *order.OrderService
+
+	CategoryService  *category.CategoryService
+	PromotionService *promotion.PromotionService
+	PaymentService   *payment.PaymentService
+	AddressService   *address.AddressService
+}
+
+// repositories holds the storage of every service
+type repositories struct {
+	users    user.UserRepository
+	carts    cart.CartRepository
+	tokens   authentication.TokenRepository
+	products product.ProductRepository
+	orders   order.OrderRepository
+
+	categories category.CategoryRepository
+	promotions promotion.PromotionRepository
+	payments   payment.PaymentRepository
+	addresses  address.AddressRepository
+}
+
+func InitializeServices(setupRes *setup.CoreSetupInitResult) *ServiceRegistry {
+	// Initialize repositories for the configured database driver
+	repos := newRepositories(setupRes)
+
+	// Initialize user service, the mailer sends password reset links
+	userService := user.NewUserService(repos.users, setupRes.Mailer, setupRes.Config.Mail.BaseURL)
+
+	// Initialize category service
+	categoryService := category.NewCategoryService(repos.categories)
+
+	// Initialize promotion service, per-category promotions apply to the products of a category
+	promotionService := promotion.NewPromotionService(repos.promotions, categoryService)
+
+	// Initialize the pricing pipeline quoting carts and orders: discount, tax by region and shipping
+	pipeline := pricing.NewConfiguredPipeline(setupRes.Config)
+
+	// Initialize address service, the address books carts are quoted for and orders ship to
+	addressService := address.NewAddressService(repos.addresses)
+
+	// Initialize cart service, promotions price the coupon of a cart
+	cartService := cart.NewCartService(repos.carts, promotionService, pipeline, addressService)
+
+	// Initialize authentication service
+	authService := authentication.NewAuthService(userService, cartService, repos.tokens)
+
+	// A password reset signs the user out of every session and token
+	userService.SignOutEverywhere = func(userID int) error {
+		return authService.LogoutEverywhere(userID, setupRes.Store)
+	}
+
+	// Initialize product service, listings can be filtered by category and images go to the blob store
+	productService := product.NewProductService(repos.products, categoryService, setupRes.Blobs, setupRes.Config.Storage.MaxImageSize)
+
+	// Initialize order service, checkout quotes the cart like the cart page, redeems its coupon and keeps a copy of the addresses
+	orderService := order.NewOrderService(repos.orders, promotionService, pipeline, addressService)
+
+	// Initialize payment service, payments are charged through the gateway and drive the status of their order
+	paymentService := payment.NewPaymentService(repos.payments, setupRes.Payments, orderService, setupRes.Config.Payment.Currency)
+
+	// An order with a payment in progress or collected can't be cancelled
+	orderService.Guards = append(orderService.Guards, paymentService.GuardOrderTransition)
+
+	// Return the ServiceRegistry with all services initialized
+	return &ServiceRegistry{
+		UserService:    userService,
+		AuthService:    authService,
+		ProductService: productService,
+		CartService:    cartService,
+		OrderService:   orderService,
+
+		CategoryService:  categoryService,
+		PromotionService: promotionService,
+		PaymentService:   paymentService,
+		AddressService:   addressService,
+	}
+}
+
+// newRepositories returns the MySQL repositories, or in-memory ones sharing a single
+// memory.DB seeded with demo products and categories when the database driver is "memory"
+func newRepositories(setupRes *setup.CoreSetupInitResult) repositories {
+	if setupRes.Config.Database.Driver == "memory" {
+		mem := memory.New()
+		productRepo := product.NewMemoryProductRepository(mem)
+		productRepo.Seed(product.DemoProducts)
+		categoryRepo := category.NewMemoryCategoryRepository(mem)
+		categoryRepo.Seed(category.DemoCategories, category.DemoProductCategories)
+
+		return repositories{
+			users:    user.NewMemoryUserRepository(mem),
+			carts:    cart.NewMemoryCartRepository(mem),
+			tokens:   authentication.NewMemoryTokenRepository(mem),
+			products: productRepo,
+			orders:   order.NewMemoryOrderRepository(mem),
+
+			categories: categoryRepo,
+			promotions: promotion.NewMemoryPromotionRepository(mem),
+			payments:   payment.NewMemoryPaymentRepository(mem),
+			addresses:  address.NewMemoryAddressRepository(mem),
+		}
+	}
+
+	db := setupRes.DbConn
+	return repositories{
+		users:    user.NewMySQLUserRepository(db),
+		carts:    cart.NewMySQLCartRepository(db),
+		tokens:   authentication.NewMySQLTokenRepository(db),
+		products: product.NewMySQLProductRepository(db),
+		orders:   order.NewMySQLOrderRepository(db),
+
+		categories: category.NewMySQLCategoryRepository(db),
+		promotions: promotion.NewMySQLPromotionRepository(db),
+		payments:   payment.NewMySQLPaymentRepository(db),
+		addresses:  address.NewMySQLAddressRepository(db),
+	}
+}
@@ -1,72 +1,122 @@
-package session
-
-import (
-	"encoding/gob"
-	"fmt"
-	"net/http"
-
-	"github.com/ecommerce/configuration"
-	"github.com/gorilla/sessions"
-)
-
-// type declaration
-type (
-	User struct {
-		UserID   int
-		Email    string
-		Password string
-		IsAdmin  int
-	}
-
-	Cart struct {
-		CartID int
-	}
-)
-
-func Init(config *configuration.Config) (*sessions.CookieStore, error) {
-	registerTypes()
-	store := sessions.NewCookieStore([]byte(config.Session.SessionKey), nil)
-	store.Options = &sessions.Options{
-		Domain:   config.Session.Domain,
-		Path:     config.Session.Path,
-		MaxAge:   config.Session.MaxAge,
-		Secure:   config.Session.Secure,
-		HttpOnly: config.Session.HttpOnly,
-	}
-
-	return store, nil
-}
-
-func registerTypes() {
-	gob.Register(&User{})
-	gob.Register(&Cart{})
-}
-
-// Helper function to get session from request context
-func GetSessionFromContext(r *http.Request) (*sessions.Session, error) {
-	// Retrieve configuration from the context
-	config, ok := r.Context().Value("config").(*configuration.Config)
-	if !ok {
-		return nil, fmt.Errorf("configuration not found in request context")
-	}
-	session, ok := r.Context().Value(config.Session.SessionContextKey).(*sessions.Session)
-	if !ok {
-		return nil, fmt.Errorf("session not found in request context")
-	}
-	return session, nil
-}
-
-// GetSessionUserID retrieves the userId from the session and returns an error if it doesn't exist or is not an int.
-func GetSessionUserID(session *sessions.Session) (int, error) {
-	userIdValue, exists := session.Values["userId"]
-	if !exists {
-		return 0, fmt.Errorf("userId not found in session")
-	}
-
-	userId, ok := userIdValue.(int)
-	if !ok {
-		return 0, fmt.Errorf("userId is not an int, found type: %T", userIdValue)
-	}
-
-	return userId, nil
-}
+package session
+
+import (
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+
+	"github.com/ecommerce/configuration"
+	"github.com/gorilla/sessions"
+)
+
+// userContextKey is the request context key of the authenticated user
+type userContextKey struct{}
+
+// type declaration
+type (
+	User struct {
+		UserID  int
+		Email   string
+		IsAdmin int
+	}
+
+	Cart struct {
+		CartID int
+	}
+)
+
+// Init builds the session store selected by the configuration: signed cookies holding the
+// whole session, or the sessions table with only the session ID in the cookie
+func Init(config *configuration.Config, db *sql.DB) (sessions.Store, error) {
+	registerTypes()
+	options := &sessions.Options{
+		Domain:   config.Session.Domain,
+		Path:     config.Session.Path,
+		MaxAge:   config.Session.MaxAge,
+		Secure:   config.Session.Secure,
+		HttpOnly: config.Session.HttpOnly,
+	}
+
+	switch config.Session.Store {
+	case "", "cookie":
+		store := sessions.NewCookieStore([]byte(config.Session.SessionKey), nil)
+		store.Options = options
+		return store, nil
+	case "database":
+		store := NewMySQLStore(db, options, []byte(config.Session.SessionKey))
+		store.stopCleanup = store.StartCleanup(CleanupInterval)
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown session store %q", config.Session.Store)
+	}
+}
+
+// RenewID gives the session a new ID when it is saved next, it is called when a user signs in
+// so that a session ID known before (e.g. planted in the victim's browser) doesn't end up
+// authenticated. Cookie sessions have no server side ID, their cookie is replaced on Save.
+func RenewID(sess *sessions.Session) error {
+	if renewer, ok := sess.Store().(Renewer); ok {
+		return renewer.Renew(sess)
+	}
+	return nil
+}
+
+func registerTypes() {
+	gob.Register(&User{})
+	gob.Register(&Cart{})
+}
+
+// Helper function to get session from request context
+func GetSessionFromContext(r *http.Request) (*sessions.Session, error) {
+	// Retrieve configuration from the context
+	config, ok := r.Context().Value("config").(*configuration.Config)
+	if !ok {
+		return nil, fmt.Errorf("configuration not found in request context")
+	}
+	session, ok := r.Context().Value(config.Session.SessionContextKey).(*sessions.Session)
+	if !ok {
+		return nil, fmt.Errorf("session not found in request context")
+	}
+	return session, nil
+}
+
+// GetSessionUserID retrieves the userId from the session and returns an error if it doesn't exist or is not an int.
+func GetSessionUserID(session *sessions.Session) (int, error) {
+	userIdValue, exists := session.Values["userId"]
+	if !exists {
+		return 0, fmt.Errorf("userId not found in session")
+	}
+
+	userId, ok := userIdValue.(int)
+	if !ok {
+		return 0, fmt.Errorf("userId is not an int, found type: %T", userIdValue)
+	}
+
+	return userId, nil
+}
+
+// GetSessionUser retrieves the logged in user from the session and returns an error if it doesn't exist.
+func GetSessionUser(session *sessions.Session) (*User, error) {
+	user, ok := session.Values["user"].(*User)
+	if !ok || user == nil {
+		return nil, fmt.Errorf("user not found in session")
+	}
+
+	return user, nil
+}
+
+// WithUser returns a copy of ctx carrying the authenticated user
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// GetUserFromContext returns the user authenticated by the auth middleware
+func GetUserFromContext(r *http.Request) (*User, error) {
+	user, ok := r.Context().Value(userContextKey{}).(*User)
+	if !ok || user == nil {
+		return nil, fmt.Errorf("user not found in request context")
+	}
+	return user, nil
+}
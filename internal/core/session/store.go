@@ -0,0 +1,245 @@
+package session
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ecommerce/utils"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// DefaultSessionTTL is how long a database session lives when MaxAge is 0 (browser session)
+	DefaultSessionTTL = 24 * time.Hour
+
+	// CleanupInterval is how often expired database sessions are deleted
+	CleanupInterval = 10 * time.Minute
+)
+
+// UserSessionDeleter is implemented by session stores able to end every session of a user,
+// which is what "log out everywhere" needs. Cookie sessions live in the browser and can't do it.
+type UserSessionDeleter interface {
+	DeleteUserSessions(userID int) error
+}
+
+// Renewer is implemented by session stores keeping the session under an ID on the server.
+// Renew makes the next Save issue a new ID, see RenewID.
+type Renewer interface {
+	Renew(sess *sessions.Session) error
+}
+
+// MySQLStore is a sessions.Store keeping the session values in the sessions table.
+// The cookie only carries the signed session ID, so deleting the row ends the session
+// even if the cookie was copied.
+type MySQLStore struct {
+	db          *sql.DB
+	Codecs      []securecookie.Codec
+	Options     *sessions.Options
+	stopCleanup func() // set while the cleanup started by Init runs
+}
+
+// NewMySQLStore creates a MySQLStore signing session IDs with the given key pairs
+func NewMySQLStore(db *sql.DB, options *sessions.Options, keyPairs ...[]byte) *MySQLStore {
+	store := &MySQLStore{
+		db:      db,
+		Codecs:  securecookie.CodecsFromPairs(keyPairs...),
+		Options: options,
+	}
+	for _, codec := range store.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(options.MaxAge)
+		}
+	}
+	return store
+}
+
+// Get returns the session of the request, cached for the duration of the request
+func (store *MySQLStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(store, name)
+}
+
+// New loads the session referenced by the request cookie, or returns a new session when
+// there is no cookie, its signature doesn't match or the session has expired.
+func (store *MySQLStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	sess := sessions.NewSession(store, name)
+	options := *store.Options
+	sess.Options = &options
+	sess.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return sess, nil
+	}
+
+	var id string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &id, store.Codecs...); err != nil {
+		log.Printf("Ignoring invalid session cookie: %v", err)
+		return sess, nil
+	}
+
+	found, err := store.load(id, sess)
+	if err != nil {
+		return sess, err
+	}
+	if found {
+		sess.ID = id
+		sess.IsNew = false
+	}
+	return sess, nil
+}
+
+// Save writes the session to the database and sends its signed ID to the client.
+// A negative MaxAge deletes the session.
+func (store *MySQLStore) Save(r *http.Request, w http.ResponseWriter, sess *sessions.Session) error {
+	if sess.Options.MaxAge < 0 {
+		if sess.ID != "" {
+			if err := store.delete(sess.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(sess.Name(), "", sess.Options))
+		return nil
+	}
+
+	if sess.ID == "" {
+		id, err := utils.GenerateToken(32)
+		if err != nil {
+			return err
+		}
+		sess.ID = id
+	}
+
+	if err := store.save(sess); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(sess.Name(), sess.ID, store.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(sess.Name(), encoded, sess.Options))
+	return nil
+}
+
+// Renew deletes the row of the session and clears its ID, so that Save stores the values
+// under a freshly generated ID. The values are kept.
+func (store *MySQLStore) Renew(sess *sessions.Session) error {
+	if sess.ID != "" {
+		if err := store.delete(sess.ID); err != nil {
+			return err
+		}
+		sess.ID = ""
+	}
+	sess.IsNew = true
+	return nil
+}
+
+// DeleteUserSessions ends every session of a user
+func (store *MySQLStore) DeleteUserSessions(userID int) error {
+	result, err := store.db.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	deleted, _ := result.RowsAffected()
+	log.Printf("Deleted %d sessions of user %d", deleted, userID)
+	return nil
+}
+
+// DeleteExpired removes the expired sessions
+func (store *MySQLStore) DeleteExpired() error {
+	_, err := store.db.Exec(`DELETE FROM sessions WHERE expires_at <= ?`, time.Now())
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+// StartCleanup deletes expired sessions every interval until the returned stop function is called
+func (store *MySQLStore) StartCleanup(interval time.Duration) (stop func()) {
+	quit := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				store.DeleteExpired()
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return func() { close(quit) }
+}
+
+// Close stops the cleanup of expired sessions started by Init
+func (store *MySQLStore) Close() error {
+	if store.stopCleanup != nil {
+		store.stopCleanup()
+		store.stopCleanup = nil
+	}
+	return nil
+}
+
+// load reads the values of an unexpired session, it reports false when there is none
+func (store *MySQLStore) load(id string, sess *sessions.Session) (bool, error) {
+	var data []byte
+	err := store.db.QueryRow(`SELECT data FROM sessions WHERE id = ? AND expires_at > ?`, id, time.Now()).Scan(&data)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	if err := (securecookie.GobEncoder{}).Deserialize(data, &sess.Values); err != nil {
+		return false, fmt.Errorf("failed to decode session: %v", err)
+	}
+	return true, nil
+}
+
+// save upserts the session row, the user id is kept in its own column for DeleteUserSessions
+func (store *MySQLStore) save(sess *sessions.Session) error {
+	data, err := (securecookie.GobEncoder{}).Serialize(sess.Values)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %v", err)
+	}
+
+	var userID sql.NullInt64
+	if id, err := GetSessionUserID(sess); err == nil {
+		userID = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+
+	ttl := DefaultSessionTTL
+	if sess.Options.MaxAge > 0 {
+		ttl = time.Duration(sess.Options.MaxAge) * time.Second
+	}
+
+	_, err = store.db.Exec(`
+		INSERT INTO sessions (id, user_id, data, expires_at)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), data = VALUES(data), expires_at = VALUES(expires_at)`,
+		sess.ID, userID, data, time.Now().Add(ttl))
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+// delete removes a single session
+func (store *MySQLStore) delete(id string) error {
+	_, err := store.db.Exec(`DELETE FROM sessions WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
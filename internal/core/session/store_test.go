@@ -0,0 +1,75 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ecommerce/database/databasetest"
+	"github.com/gorilla/sessions"
+)
+
+const sessionName = "session"
+
+// saveSession saves the session and returns the cookie the client gets back
+func saveSession(t *testing.T, store *MySQLStore, r *http.Request, sess *sessions.Session) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := store.Save(r, w, sess); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("%d cookies set, want 1", len(cookies))
+	}
+	return cookies[0]
+}
+
+// loadSession returns the session the store finds for the cookie
+func loadSession(t *testing.T, store *MySQLStore, cookie *http.Cookie) *sessions.Session {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+	sess, err := store.New(r, sessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+func TestRenewIDAtSignIn(t *testing.T) {
+	db := databasetest.Open(t)
+	registerTypes()
+	store := NewMySQLStore(db, &sessions.Options{Path: "/", MaxAge: 60}, []byte("0123456789abcdef0123456789abcdef"))
+
+	// an anonymous session, e.g. planted in the browser of the victim
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	sess, err := store.New(r, sessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Values["theme"] = "dark"
+	planted := saveSession(t, store, r, sess)
+
+	// signing in with that cookie
+	sess = loadSession(t, store, planted)
+	oldID := sess.ID
+	if err := RenewID(sess); err != nil {
+		t.Fatal(err)
+	}
+	sess.Values["user"] = &User{UserID: 1, Email: "ann@example.com"}
+	sess.Values["userId"] = 1
+	signedIn := saveSession(t, store, r, sess)
+	t.Cleanup(func() { db.Exec(`DELETE FROM sessions WHERE id = ?`, sess.ID) })
+
+	if sess.ID == oldID {
+		t.Fatal("the session kept its ID at sign in")
+	}
+	if old := loadSession(t, store, planted); !old.IsNew || old.Values["userId"] != nil {
+		t.Errorf("the cookie from before sign in still loads a session: %v", old.Values)
+	}
+	renewed := loadSession(t, store, signedIn)
+	if renewed.IsNew || renewed.Values["userId"] != 1 || renewed.Values["theme"] != "dark" {
+		t.Errorf("session after sign in = %v, want the user and the values from before", renewed.Values)
+	}
+}
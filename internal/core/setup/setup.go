@@ -1,55 +1,130 @@
-package setup
-
-import (
-	"database/sql"
-	"log"
-
-	"github.com/ecommerce/configuration"
-	"github.com/ecommerce/database"
-
-	"github.com/ecommerce/internal/core/session"
-	"github.com/gorilla/sessions"
-)
-
-type CoreSetupInitResult struct {
-	Config *configuration.Config // configuration type
-	Store  *sessions.CookieStore // Or the exact type of your session store
-	DbConn *sql.DB               // Database type
-}
-
-// initialize all core components (except routes)
-func InitializeAll(configPath string) (*CoreSetupInitResult, error) {
-	result := &CoreSetupInitResult{}
-
-	// Setup yaml configuration
-	config, err := configuration.Init(configPath)
-	if err != nil {
-		log.Printf("Failed to initialize configuration from %s: %v", configPath, err)
-		return nil, err
-	}
-
-	err = config.Validate()
-	if err != nil {
-		log.Printf("Failed to Validate initialized configuration from %s: %v", configPath, err)
-		return nil, err
-	}
-	result.Config = config
-
-	// Setup database
-	dbConn, err := database.SetupDatabase(config)
-	if err != nil {
-		log.Printf("Failed to initialize database from %s: %v", configPath, err)
-		return nil, err
-	}
-	result.DbConn = dbConn
-
-	// Setup session
-	store, err := session.Init(config)
-	if err != nil {
-		log.Printf("Failed to initialize session: %v from %s", configPath, err)
-		return nil, err
-	}
-	result.Store = store
-
-	return result, nil
-}
+package setup
+
+import (
+	"database/sql"
+	"io"
+	"log"
+
+	"github.com/ecommerce/configuration"
+	"github.com/ecommerce/database"
+	"github.com/ecommerce/database/migrations"
+
+	"github.com/ecommerce/internal/core/blob"
+	"github.com/ecommerce/internal/core/gateway"
+	"github.com/ecommerce/internal/core/mailer"
+	"github.com/ecommerce/internal/core/session"
+	"github.com/gorilla/sessions"
+)
+
+type CoreSetupInitResult struct {
+	Config   *configuration.Config   // configuration type
+	Store    sessions.Store          // Cookie or database session store
+	DbConn   *sql.DB                 // Database type
+	Mailer   mailer.Mailer           // Outgoing mail
+	Blobs    blob.BlobStore          // Uploaded files such as product images
+	Payments gateway.PaymentProvider // Payment gateway orders are charged through
+}
+
+// InitializeDatabase loads the configuration and connects to the database, for commands
+// that don't need the rest of the application. The connection is nil with the memory driver.
+func InitializeDatabase(configPath string) (*configuration.Config, *sql.DB, error) {
+	config, err := configuration.Init(configPath)
+	if err != nil {
+		log.Printf("Failed to initialize configuration from %s: %v", configPath, err)
+		return nil, nil, err
+	}
+
+	err = config.Validate()
+	if err != nil {
+		log.Printf("Failed to Validate initialized configuration from %s: %v", configPath, err)
+		return nil, nil, err
+	}
+
+	if config.Database.Driver == "memory" {
+		log.Println("Using the in-memory database, data is lost on exit")
+		return config, nil, nil
+	}
+
+	dbConn, err := database.SetupDatabase(config)
+	if err != nil {
+		log.Printf("Failed to initialize database from %s: %v", configPath, err)
+		return nil, nil, err
+	}
+	return config, dbConn, nil
+}
+
+// initialize all core components (except routes)
+func InitializeAll(configPath string) (*CoreSetupInitResult, error) {
+	result := &CoreSetupInitResult{}
+
+	// Setup yaml configuration and database
+	config, dbConn, err := InitializeDatabase(configPath)
+	if err != nil {
+		return nil, err
+	}
+	result.Config = config
+	result.DbConn = dbConn
+
+	// Apply pending schema migrations
+	if config.Database.AutoMigrate && dbConn != nil {
+		migrator, err := migrations.NewMigrator(dbConn)
+		if err != nil {
+			log.Printf("Failed to load migrations: %v", err)
+			return nil, err
+		}
+		applied, err := migrator.Up()
+		if err != nil {
+			log.Printf("Failed to migrate database: %v", err)
+			return nil, err
+		}
+		log.Printf("Database schema up to date, %d migrations applied", applied)
+	}
+
+	// Setup session
+	store, err := session.Init(config, dbConn)
+	if err != nil {
+		log.Printf("Failed to initialize session: %v from %s", configPath, err)
+		return nil, err
+	}
+	result.Store = store
+
+	// Setup mailer
+	mail, err := mailer.Init(config)
+	if err != nil {
+		log.Printf("Failed to initialize mailer: %v", err)
+		return nil, err
+	}
+	result.Mailer = mail
+
+	// Setup blob storage
+	blobs, err := blob.Init(config)
+	if err != nil {
+		log.Printf("Failed to initialize blob storage: %v", err)
+		return nil, err
+	}
+	result.Blobs = blobs
+
+	// Setup payment gateway
+	payments, err := gateway.Init(config)
+	if err != nil {
+		log.Printf("Failed to initialize payment gateway: %v", err)
+		return nil, err
+	}
+	result.Payments = payments
+
+	return result, nil
+}
+
+// Close stops the background work of the core components and closes the database connection
+func (result *CoreSetupInitResult) Close() {
+	if closer, ok := result.Store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("Failed to close session store: %v", err)
+		}
+	}
+	if result.DbConn != nil {
+		if err := result.DbConn.Close(); err != nil {
+			log.Printf("Failed to close database: %v", err)
+		}
+	}
+}
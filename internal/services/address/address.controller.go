@@ -0,0 +1,204 @@
+package address
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/core/session"
+	"github.com/gorilla/mux"
+)
+
+const (
+	addressesBasePath = "addresses"
+	profileBasePath   = "profile"
+	prodBasePath      = "prod"
+	apiBasePath       = "api"
+)
+
+var (
+	errAuthRequired      = response.Unauthorized("authentication required")
+	errAddressIDSet      = response.BadRequest("id must not be set when adding an address")
+	errAddressIDMismatch = response.BadRequest("id of the payload doesn't match the URL")
+)
+
+// SetupRoutes :
+func SetupAddressRoutes(r *mux.Router, s *AddressService) {
+	apiUrlPath := fmt.Sprintf("/%s/%s", apiBasePath, addressesBasePath)
+	addressRouter := r.PathPrefix(apiUrlPath).Subrouter()
+
+	addressRouter.HandleFunc("", addressesHandler(s))
+	addressRouter.HandleFunc("/{id}", addressHandler(s))
+
+	// -------------------------PROD----------------------
+	prodUrlPath := fmt.Sprintf("/%s/%s", prodBasePath, addressesBasePath)
+	prodAddressRouter := r.PathPrefix(prodUrlPath).Subrouter()
+
+	prodAddressRouter.HandleFunc("", addressesHandler(s)).Methods(http.MethodPost)
+	prodAddressRouter.HandleFunc("/{id}", addressHandler(s)).Methods(http.MethodGet, http.MethodPut, http.MethodDelete)
+
+	r.HandleFunc(fmt.Sprintf("/%s/%s", prodBasePath, profileBasePath), profileProdHandler(s)).Methods(http.MethodGet)
+}
+
+// profileProdHandler renders the profile page of the user along with their address book
+func profileProdHandler(s *AddressService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := session.GetUserFromContext(r)
+		if err != nil {
+			log.Println(err)
+			response.PageError(w, errAuthRequired)
+			return
+		}
+
+		tmpl, err := template.ParseFiles("template/profile.html")
+		if err != nil {
+			log.Println("Template parsing error:", err)
+			http.Error(w, "Error loading profile page", http.StatusInternalServerError)
+			return
+		}
+
+		addresses, err := s.getAddressesService(user.UserID)
+		if err != nil {
+			log.Println(err)
+			response.PageError(w, err)
+			return
+		}
+
+		err = tmpl.Execute(w, map[string]interface{}{"User": user, "Addresses": addresses})
+		if err != nil {
+			log.Println("Template execution error:", err)
+			http.Error(w, "Error rendering profile page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// addressesHandler lists the address book of the user (GET) or adds an address to it (POST)
+func addressesHandler(s *AddressService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			return
+		}
+
+		user, err := session.GetUserFromContext(r)
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, errAuthRequired)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			addresses, err := s.getAddressesService(user.UserID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, addresses)
+			return
+		case http.MethodPost:
+			var newAddress Address
+			if err := json.NewDecoder(r.Body).Decode(&newAddress); err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if newAddress.ID != 0 {
+				log.Println(errAddressIDSet)
+				response.WriteError(w, errAddressIDSet)
+				return
+			}
+
+			address, err := s.addAddressService(newAddress, user.UserID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusCreated, address)
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// addressHandler returns (GET), changes (PUT) or deletes (DELETE) an address of the user
+func addressHandler(s *AddressService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			return
+		}
+
+		user, err := session.GetUserFromContext(r)
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, errAuthRequired)
+			return
+		}
+
+		addressID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, ErrAddressNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			address, err := s.getAddressService(addressID, user.UserID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, address)
+			return
+		case http.MethodPut:
+			var updatedAddress Address
+			if err := json.NewDecoder(r.Body).Decode(&updatedAddress); err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if updatedAddress.ID == 0 {
+				updatedAddress.ID = addressID
+			} else if updatedAddress.ID != addressID {
+				log.Println(errAddressIDMismatch)
+				response.WriteError(w, errAddressIDMismatch)
+				return
+			}
+
+			address, err := s.updateAddressService(updatedAddress, user.UserID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, address)
+			return
+		case http.MethodDelete:
+			err := s.removeAddressService(addressID, user.UserID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package address
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ecommerce/internal/core/response"
+)
+
+// Address is an entry of a user's address book. A user has at most one default shipping and one
+// default billing address, which may be the same address.
+type Address struct {
+	ID                int       `json:"id"`
+	UserID            int       `json:"user_id"`
+	Label             string    `json:"label" validate:"max=50"` // e.g. "Home" or "Work"
+	FullName          string    `json:"full_name" validate:"required,max=100"`
+	Line1             string    `json:"line1" validate:"required,max=255"`
+	Line2             string    `json:"line2" validate:"max=255"`
+	City              string    `json:"city" validate:"required,max=100"`
+	Region            string    `json:"region" validate:"max=100"` // state, province or county
+	PostalCode        string    `json:"postal_code" validate:"max=20"`
+	Country           string    `json:"country" validate:"required"` // ISO 3166-1 alpha-2 code
+	Phone             string    `json:"phone" validate:"max=30"`
+	IsDefaultShipping bool      `json:"is_default_shipping"`
+	IsDefaultBilling  bool      `json:"is_default_billing"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Snapshot is a copy of an address taken when an order is placed, later edits of the address book
+// don't change where an order was shipped to. It is stored as a JSON object.
+type Snapshot struct {
+	FullName   string `json:"full_name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	Region     string `json:"region,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country"`
+	Phone      string `json:"phone,omitempty"`
+}
+
+// countryRule lists what an address in a country needs on top of the fields every address needs.
+// The region of an address in a country with Regions must be one of their codes, the names are
+// accepted and stored as the code, e.g. "California" as CA.
+type countryRule struct {
+	RegionRequired bool
+	Regions        map[string]string // subdivision code -> name, nil when regions are free text
+	RegionExample  string
+	PostalCode     *regexp.Regexp // nil when the country has no postal codes we check
+	PostalExample  string
+}
+
+// countryRules are the countries whose addresses are checked further, addresses elsewhere only
+// need the fields every address needs
+var countryRules = map[string]countryRule{
+	"US": {RegionRequired: true, Regions: usStates, RegionExample: "CA", PostalCode: regexp.MustCompile(`^\d{5}(-\d{4})?$`), PostalExample: "12345 or 12345-6789"},
+	"CA": {RegionRequired: true, Regions: canadianProvinces, RegionExample: "ON", PostalCode: regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`), PostalExample: "K1A 0B1"},
+	"AU": {RegionRequired: true, Regions: australianStates, RegionExample: "NSW", PostalCode: regexp.MustCompile(`^\d{4}$`), PostalExample: "2000"},
+	"GB": {PostalCode: regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`), PostalExample: "SW1A 1AA"},
+	"DE": {PostalCode: regexp.MustCompile(`^\d{5}$`), PostalExample: "10115"},
+	"FR": {PostalCode: regexp.MustCompile(`^\d{5}$`), PostalExample: "75001"},
+	"ES": {PostalCode: regexp.MustCompile(`^\d{5}$`), PostalExample: "28001"},
+	"IT": {PostalCode: regexp.MustCompile(`^\d{5}$`), PostalExample: "00118"},
+	"NL": {PostalCode: regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`), PostalExample: "1012 AB"},
+}
+
+// usStates are the states, the district and the territories of the US along with the military "states"
+var usStates = map[string]string{
+	"AL": "Alabama", "AK": "Alaska", "AZ": "Arizona", "AR": "Arkansas", "CA": "California", "CO": "Colorado",
+	"CT": "Connecticut", "DE": "Delaware", "FL": "Florida", "GA": "Georgia", "HI": "Hawaii", "ID": "Idaho",
+	"IL": "Illinois", "IN": "Indiana", "IA": "Iowa", "KS": "Kansas", "KY": "Kentucky", "LA": "Louisiana",
+	"ME": "Maine", "MD": "Maryland", "MA": "Massachusetts", "MI": "Michigan", "MN": "Minnesota", "MS": "Mississippi",
+	"MO": "Missouri", "MT": "Montana", "NE": "Nebraska", "NV": "Nevada", "NH": "New Hampshire", "NJ": "New Jersey",
+	"NM": "New Mexico", "NY": "New York", "NC": "North Carolina", "ND": "North Dakota", "OH": "Ohio", "OK": "Oklahoma",
+	"OR": "Oregon", "PA": "Pennsylvania", "RI": "Rhode Island", "SC": "South Carolina", "SD": "South Dakota",
+	"TN": "Tennessee", "TX": "Texas", "UT": "Utah", "VT": "Vermont", "VA": "Virginia", "WA": "Washington",
+	"WV": "West Virginia", "WI": "Wisconsin", "WY": "Wyoming", "DC": "District of Columbia",
+	"AS": "American Samoa", "GU": "Guam", "MP": "Northern Mariana Islands", "PR": "Puerto Rico", "VI": "U.S. Virgin Islands",
+	"AA": "Armed Forces Americas", "AE": "Armed Forces Europe", "AP": "Armed Forces Pacific",
+}
+
+// canadianProvinces are the provinces and territories of Canada
+var canadianProvinces = map[string]string{
+	"AB": "Alberta", "BC": "British Columbia", "MB": "Manitoba", "NB": "New Brunswick", "NL": "Newfoundland and Labrador",
+	"NS": "Nova Scotia", "NT": "Northwest Territories", "NU": "Nunavut", "ON": "Ontario", "PE": "Prince Edward Island",
+	"QC": "Quebec", "SK": "Saskatchewan", "YT": "Yukon",
+}
+
+// australianStates are the states and territories of Australia
+var australianStates = map[string]string{
+	"ACT": "Australian Capital Territory", "NSW": "New South Wales", "NT": "Northern Territory", "QLD": "Queensland",
+	"SA": "South Australia", "TAS": "Tasmania", "VIC": "Victoria", "WA": "Western Australia",
+}
+
+// ErrRegionUnknown is returned when pricing an order for an address whose region isn't one of the codes
+// of its country, e.g. one saved before regions were checked
+var ErrRegionUnknown = response.New(http.StatusUnprocessableEntity, "address_region_unknown",
+	"the state or province of the address isn't known, update the address")
+
+// regionCodePattern matches the region codes that make up a pricing region along with the country, e.g. CA in US-CA
+var regionCodePattern = regexp.MustCompile(`^[A-Z0-9]{1,3}$`)
+
+// Snapshot returns a copy of the address to keep with an order
+func (a Address) Snapshot() *Snapshot {
+	return &Snapshot{
+		FullName:   a.FullName,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+		Phone:      a.Phone,
+	}
+}
+
+// PricingRegion is the region an order shipped to the address is taxed in: the country along with
+// the region when it is a short code, e.g. US-CA, otherwise the country alone. It fails rather than
+// fall back to the country for a country whose regions are known and are taxed apart.
+func (a Address) PricingRegion() (string, error) {
+	region := a.Region
+	if rule, ok := countryRules[a.Country]; ok && rule.Regions != nil {
+		code, known := rule.regionCode(region)
+		if !known {
+			return "", ErrRegionUnknown.Withf("%q isn't a state or province of %s, update the address", a.Region, a.Country)
+		}
+		region = code
+	}
+	if regionCodePattern.MatchString(region) {
+		return a.Country + "-" + region, nil
+	}
+	return a.Country, nil
+}
+
+// regionCode returns the code of a region of the country given by its code or its name, regardless of case
+func (rule countryRule) regionCode(region string) (string, bool) {
+	if _, ok := rule.Regions[strings.ToUpper(region)]; ok {
+		return strings.ToUpper(region), true
+	}
+	for code, name := range rule.Regions {
+		if strings.EqualFold(name, region) {
+			return code, true
+		}
+	}
+	return "", false
+}
+
+// normalize trims every field, uppercases the country, the postal code and region codes, and replaces
+// the name of a region by its code in the countries whose regions are known
+func (a *Address) normalize() {
+	a.Label = strings.TrimSpace(a.Label)
+	a.FullName = strings.TrimSpace(a.FullName)
+	a.Line1 = strings.TrimSpace(a.Line1)
+	a.Line2 = strings.TrimSpace(a.Line2)
+	a.City = strings.TrimSpace(a.City)
+	a.Region = strings.TrimSpace(a.Region)
+	if region := strings.ToUpper(a.Region); regionCodePattern.MatchString(region) {
+		a.Region = region
+	}
+	a.PostalCode = strings.ToUpper(strings.TrimSpace(a.PostalCode))
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+	if rule, ok := countryRules[a.Country]; ok && rule.Regions != nil {
+		if code, known := rule.regionCode(a.Region); known {
+			a.Region = code
+		}
+	}
+	a.Phone = strings.TrimSpace(a.Phone)
+}
+
+// String formats the snapshot on a single line, e.g. "Jane Doe, 1 Main St, Springfield, IL 62701, US"
+func (s Snapshot) String() string {
+	parts := []string{s.FullName, s.Line1}
+	if s.Line2 != "" {
+		parts = append(parts, s.Line2)
+	}
+	parts = append(parts, s.City)
+	if locality := strings.TrimSpace(s.Region + " " + s.PostalCode); locality != "" {
+		parts = append(parts, locality)
+	}
+	return strings.Join(append(parts, s.Country), ", ")
+}
+
+// Value stores the snapshot as a JSON object
+func (s Snapshot) Value() (driver.Value, error) {
+	encoded, err := json.Marshal(s)
+	return string(encoded), err
+}
+
+// Scan reads a snapshot stored as a JSON object
+func (s *Snapshot) Scan(src interface{}) error {
+	var raw []byte
+	switch src := src.(type) {
+	case []byte:
+		raw = src
+	case string:
+		raw = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into Snapshot", src)
+	}
+	return json.Unmarshal(raw, s)
+}
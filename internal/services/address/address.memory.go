@@ -0,0 +1,113 @@
+package address
+
+import (
+	"time"
+
+	"github.com/ecommerce/database/memory"
+)
+
+// MemoryAddressRepository is an AddressRepository keeping addresses in a memory.DB
+type MemoryAddressRepository struct {
+	mem *memory.DB
+}
+
+func NewMemoryAddressRepository(mem *memory.DB) *MemoryAddressRepository {
+	return &MemoryAddressRepository{mem: mem}
+}
+
+// getAddresses returns the address book of a user, oldest first
+func (repo *MemoryAddressRepository) getAddresses(userID int) ([]Address, error) {
+	var addresses []Address
+	err := repo.mem.View(func() error {
+		addresses = repo.addresses().Filter(func(a Address) bool { return a.UserID == userID })
+		return nil
+	})
+	return addresses, err
+}
+
+// getAddress returns an address, nil if there is none
+func (repo *MemoryAddressRepository) getAddress(addressID int) (*Address, error) {
+	var address *Address
+	err := repo.mem.View(func() error {
+		if found, ok := repo.addresses().Get(addressID); ok {
+			address = &found
+		}
+		return nil
+	})
+	return address, err
+}
+
+// addAddress adds an address to the book of its user. The first address of a user becomes both
+// their default shipping and billing address.
+func (repo *MemoryAddressRepository) addAddress(address Address) (int, error) {
+	err := repo.mem.Update(func() error {
+		if _, ok := repo.addresses().First(func(a Address) bool { return a.UserID == address.UserID }); !ok {
+			address.IsDefaultShipping = true
+			address.IsDefaultBilling = true
+		}
+		repo.clearDefaults(address)
+
+		now := time.Now()
+		address.ID = repo.addresses().NextID()
+		address.CreatedAt = now
+		address.UpdatedAt = now
+		repo.addresses().Put(address.ID, address)
+		return nil
+	})
+	return address.ID, err
+}
+
+// updateAddress changes an address of a user
+func (repo *MemoryAddressRepository) updateAddress(address Address) error {
+	return repo.mem.Update(func() error {
+		existing, ok := repo.addresses().Get(address.ID)
+		if !ok || existing.UserID != address.UserID {
+			return ErrAddressNotFound
+		}
+		repo.clearDefaults(address)
+
+		address.CreatedAt = existing.CreatedAt
+		address.UpdatedAt = time.Now()
+		repo.addresses().Put(address.ID, address)
+		return nil
+	})
+}
+
+// removeAddress deletes an address, orders keep their own copy of the addresses they were placed with.
+// When the address was a default, the oldest remaining address of the user takes over its flags.
+func (repo *MemoryAddressRepository) removeAddress(addressID int) error {
+	return repo.mem.Update(func() error {
+		removed, ok := repo.addresses().Get(addressID)
+		if !ok {
+			return nil
+		}
+		repo.addresses().Delete(addressID)
+
+		oldest, ok := repo.addresses().First(func(a Address) bool { return a.UserID == removed.UserID })
+		if !ok {
+			return nil
+		}
+		oldest.IsDefaultShipping = oldest.IsDefaultShipping || removed.IsDefaultShipping
+		oldest.IsDefaultBilling = oldest.IsDefaultBilling || removed.IsDefaultBilling
+		repo.addresses().Put(oldest.ID, oldest)
+		return nil
+	})
+}
+
+// clearDefaults takes the default flags the address is given off the other addresses of its user,
+// the caller must hold the write lock
+func (repo *MemoryAddressRepository) clearDefaults(address Address) {
+	repo.addresses().Update(func(a Address) bool { return a.UserID == address.UserID && a.ID != address.ID }, func(a Address) Address {
+		if address.IsDefaultShipping {
+			a.IsDefaultShipping = false
+		}
+		if address.IsDefaultBilling {
+			a.IsDefaultBilling = false
+		}
+		return a
+	})
+}
+
+func (repo *MemoryAddressRepository) addresses() *memory.Table[Address] {
+	return memory.TableOf[Address](repo.mem, TABLE_NAME)
+}
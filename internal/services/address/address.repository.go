@@ -0,0 +1,253 @@
+package address
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/utils"
+)
+
+const TABLE_NAME = "addresses"
+
+// addressColumns are the columns scanned by scanAddress
+const addressColumns = `id, user_id, label, full_name, line1, line2, city, region, postal_code, country, phone,
+	is_default_shipping, is_default_billing, created_at, updated_at`
+
+var (
+	ErrAddressNotFound = response.New(http.StatusNotFound, "address_not_found", "address not found")
+	ErrAddressRequired = response.New(http.StatusBadRequest, "address_required", "add a shipping address before checking out")
+)
+
+// AddressRepository stores the address books of the users. MySQLAddressRepository is the production
+// implementation, MemoryAddressRepository keeps everything in process for demos and tests.
+// Marking an address as a default clears the flag on the other addresses of its user.
+type AddressRepository interface {
+	getAddresses(userID int) ([]Address, error)
+	getAddress(addressID int) (*Address, error)
+	addAddress(address Address) (int, error)
+	updateAddress(address Address) error
+	removeAddress(addressID int) error
+}
+
+type MySQLAddressRepository struct {
+	db *sql.DB
+}
+
+func NewMySQLAddressRepository(db *sql.DB) *MySQLAddressRepository {
+	return &MySQLAddressRepository{db: db}
+}
+
+// getAddresses returns the address book of a user, oldest first
+func (repo *MySQLAddressRepository) getAddresses(userID int) ([]Address, error) {
+	rows, err := repo.db.Query(`SELECT `+addressColumns+` FROM addresses WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := make([]Address, 0)
+	for rows.Next() {
+		var address Address
+		if err := scanAddress(rows, &address); err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, rows.Err()
+}
+
+// getAddress returns an address, nil if there is none
+func (repo *MySQLAddressRepository) getAddress(addressID int) (*Address, error) {
+	address := &Address{}
+	err := scanAddress(repo.db.QueryRow(`SELECT `+addressColumns+` FROM addresses WHERE id = ?`, addressID), address)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return address, nil
+}
+
+// addAddress adds an address to the book of its user. The first address of a user becomes both
+// their default shipping and billing address.
+func (repo *MySQLAddressRepository) addAddress(address Address) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin address transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// lock the address book of the user so concurrent additions agree on which address is the first
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM addresses WHERE user_id = ? FOR UPDATE`, address.UserID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		address.IsDefaultShipping = true
+		address.IsDefaultBilling = true
+	}
+	if err := clearDefaults(ctx, tx, address, 0); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO addresses (user_id, label, full_name, line1, line2, city, region, postal_code, country, phone,
+			is_default_shipping, is_default_billing)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		address.UserID, address.Label, address.FullName, address.Line1, address.Line2, address.City, address.Region,
+		address.PostalCode, address.Country, address.Phone, address.IsDefaultShipping, address.IsDefaultBilling)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create address: %v", err)
+	}
+	addressID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit address: %v", err)
+	}
+	return int(addressID), nil
+}
+
+// updateAddress changes an address of a user
+func (repo *MySQLAddressRepository) updateAddress(address Address) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin address transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := clearDefaults(ctx, tx, address, address.ID); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE addresses SET label = ?, full_name = ?, line1 = ?, line2 = ?, city = ?, region = ?, postal_code = ?, country = ?,
+			phone = ?, is_default_shipping = ?, is_default_billing = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ?`,
+		address.Label, address.FullName, address.Line1, address.Line2, address.City, address.Region, address.PostalCode,
+		address.Country, address.Phone, address.IsDefaultShipping, address.IsDefaultBilling, address.ID, address.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to update address %d: %v", address.ID, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != 1 {
+		return ErrAddressNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit address: %v", err)
+	}
+	return nil
+}
+
+// removeAddress deletes an address, orders keep their own copy of the addresses they were placed with.
+// When the address was a default, the oldest remaining address of the user takes over its flags.
+func (repo *MySQLAddressRepository) removeAddress(addressID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin address transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var removed Address
+	err = tx.QueryRowContext(ctx, `SELECT user_id, is_default_shipping, is_default_billing FROM addresses WHERE id = ? FOR UPDATE`, addressID).
+		Scan(&removed.UserID, &removed.IsDefaultShipping, &removed.IsDefaultBilling)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	// lock the address book of the user so a concurrent change doesn't leave it with two or no defaults
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM addresses WHERE user_id = ? FOR UPDATE`, removed.UserID).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM addresses WHERE id = ?`, addressID)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	if removed.IsDefaultShipping {
+		_, err := tx.ExecContext(ctx, `UPDATE addresses SET is_default_shipping = 1 WHERE user_id = ? ORDER BY id LIMIT 1`, removed.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to promote the default shipping address of user %d: %v", removed.UserID, err)
+		}
+	}
+	if removed.IsDefaultBilling {
+		_, err := tx.ExecContext(ctx, `UPDATE addresses SET is_default_billing = 1 WHERE user_id = ? ORDER BY id LIMIT 1`, removed.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to promote the default billing address of user %d: %v", removed.UserID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit address removal: %v", err)
+	}
+	return nil
+}
+
+// helper functions
+
+// scanAddress scans a row of the addressColumns into address
+func scanAddress(row utils.RowScanner, address *Address) error {
+	return row.Scan(
+		&address.ID,
+		&address.UserID,
+		&address.Label,
+		&address.FullName,
+		&address.Line1,
+		&address.Line2,
+		&address.City,
+		&address.Region,
+		&address.PostalCode,
+		&address.Country,
+		&address.Phone,
+		&address.IsDefaultShipping,
+		&address.IsDefaultBilling,
+		&address.CreatedAt,
+		&address.UpdatedAt)
+}
+
+// clearDefaults takes the default flags the address is given off the other addresses of its user,
+// inside the given transaction. addressID is the address itself, 0 for an address being added.
+func clearDefaults(ctx context.Context, tx *sql.Tx, address Address, addressID int) error {
+	if address.IsDefaultShipping {
+		_, err := tx.ExecContext(ctx, `UPDATE addresses SET is_default_shipping = 0 WHERE user_id = ? AND id <> ?`, address.UserID, addressID)
+		if err != nil {
+			return fmt.Errorf("failed to clear the default shipping address of user %d: %v", address.UserID, err)
+		}
+	}
+	if address.IsDefaultBilling {
+		_, err := tx.ExecContext(ctx, `UPDATE addresses SET is_default_billing = 0 WHERE user_id = ? AND id <> ?`, address.UserID, addressID)
+		if err != nil {
+			return fmt.Errorf("failed to clear the default billing address of user %d: %v", address.UserID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package address
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/utils"
+)
+
+// countryPattern matches an ISO 3166-1 alpha-2 country code
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// AddressService handles business logic for address-related operations.
+type AddressService struct {
+	Repo AddressRepository
+}
+
+// NewAddressService creates a new AddressService
+func NewAddressService(repo AddressRepository) *AddressService {
+	return &AddressService{
+		Repo: repo,
+	}
+}
+
+// getAddressesService returns the address book of the user
+func (s *AddressService) getAddressesService(userID int) ([]Address, error) {
+	return s.Repo.getAddresses(userID)
+}
+
+// getAddressService returns an address of the user
+func (s *AddressService) getAddressService(addressID, userID int) (*Address, error) {
+	address, err := s.Repo.getAddress(addressID)
+	if err != nil {
+		return nil, err
+	}
+	if address == nil || address.UserID != userID {
+		return nil, ErrAddressNotFound
+	}
+	return address, nil
+}
+
+// addAddressService adds an address to the book of the user
+func (s *AddressService) addAddressService(address Address, userID int) (*Address, error) {
+	address.UserID = userID
+	if err := validate(&address); err != nil {
+		return nil, err
+	}
+
+	addressID, err := s.Repo.addAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	return s.Repo.getAddress(addressID)
+}
+
+// updateAddressService changes an address of the user
+func (s *AddressService) updateAddressService(address Address, userID int) (*Address, error) {
+	if _, err := s.getAddressService(address.ID, userID); err != nil {
+		return nil, err
+	}
+
+	address.UserID = userID
+	if err := validate(&address); err != nil {
+		return nil, err
+	}
+
+	if err := s.Repo.updateAddress(address); err != nil {
+		return nil, err
+	}
+	return s.Repo.getAddress(address.ID)
+}
+
+// removeAddressService deletes an address of the user
+func (s *AddressService) removeAddressService(addressID, userID int) error {
+	if _, err := s.getAddressService(addressID, userID); err != nil {
+		return err
+	}
+	return s.Repo.removeAddress(addressID)
+}
+
+// Address returns an address of the user, for the services shipping to it
+func (s *AddressService) Address(userID, addressID int) (*Address, error) {
+	return s.getAddressService(addressID, userID)
+}
+
+// DefaultShipping returns the default shipping address of the user, nil if they have none
+func (s *AddressService) DefaultShipping(userID int) (*Address, error) {
+	return s.findDefault(userID, func(a Address) bool { return a.IsDefaultShipping })
+}
+
+// DefaultBilling returns the default billing address of the user, nil if they have none
+func (s *AddressService) DefaultBilling(userID int) (*Address, error) {
+	return s.findDefault(userID, func(a Address) bool { return a.IsDefaultBilling })
+}
+
+// helper functions
+
+// findDefault returns the first address of the user matching isDefault, nil if there is none
+func (s *AddressService) findDefault(userID int, isDefault func(Address) bool) (*Address, error) {
+	addresses, err := s.Repo.getAddresses(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, address := range addresses {
+		if isDefault(address) {
+			return &address, nil
+		}
+	}
+	return nil, nil
+}
+
+// validate normalizes an address and checks it against the validate tags and the rules of its country
+func validate(address *Address) error {
+	address.normalize()
+
+	fields := utils.Validate(address)
+	if fields == nil {
+		fields = make(map[string]string)
+	}
+	if _, ok := fields["country"]; !ok && !countryPattern.MatchString(address.Country) {
+		fields["country"] = "must be a two-letter country code"
+	}
+
+	if rule, ok := countryRules[address.Country]; ok {
+		if rule.RegionRequired && address.Region == "" {
+			fields["region"] = fmt.Sprintf("is required in %s", address.Country)
+		} else if _, known := rule.regionCode(address.Region); rule.Regions != nil && !known {
+			fields["region"] = fmt.Sprintf("must be a state or province code of %s, e.g. %s", address.Country, rule.RegionExample)
+		}
+		if _, invalid := fields["postal_code"]; !invalid && rule.PostalCode != nil && !rule.PostalCode.MatchString(address.PostalCode) {
+			fields["postal_code"] = fmt.Sprintf("must be a valid postal code in %s, e.g. %s", address.Country, rule.PostalExample)
+		}
+	}
+
+	if len(fields) > 0 {
+		return response.Validation(fields)
+	}
+	return nil
+}
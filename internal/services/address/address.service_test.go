@@ -0,0 +1,120 @@
+package address
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/core/response"
+)
+
+const userID = 3
+
+// addTestAddress adds an address in the given US state to the book of userID
+func addTestAddress(t *testing.T, s *AddressService, region string, isDefaultShipping bool) *Address {
+	t.Helper()
+	added, err := s.addAddressService(Address{
+		FullName: "Ann Smith", Line1: "1 Main St", City: "Springfield", Region: region, PostalCode: "12345", Country: "US",
+		IsDefaultShipping: isDefaultShipping,
+	}, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return added
+}
+
+func TestRemoveDefaultAddressPromotesOldest(t *testing.T) {
+	s := NewAddressService(NewMemoryAddressRepository(memory.New()))
+
+	first := addTestAddress(t, s, "CA", false)
+	second := addTestAddress(t, s, "OR", false)
+	third := addTestAddress(t, s, "WA", true)
+
+	// first keeps the default billing flag, third took the default shipping flag off it
+	if err := s.removeAddressService(third.ID, userID); err != nil {
+		t.Fatal(err)
+	}
+	shipping, err := s.DefaultShipping(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shipping == nil || shipping.ID != first.ID {
+		t.Fatalf("default shipping address = %+v, want address %d", shipping, first.ID)
+	}
+
+	if err := s.removeAddressService(first.ID, userID); err != nil {
+		t.Fatal(err)
+	}
+	for name, find := range map[string]func(int) (*Address, error){"shipping": s.DefaultShipping, "billing": s.DefaultBilling} {
+		found, err := find(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found == nil || found.ID != second.ID {
+			t.Errorf("default %s address = %+v, want address %d", name, found, second.ID)
+		}
+	}
+
+	if err := s.removeAddressService(second.ID, userID); err != nil {
+		t.Fatal(err)
+	}
+	if shipping, err := s.DefaultShipping(userID); err != nil || shipping != nil {
+		t.Errorf("default shipping address of an empty book = %+v, %v", shipping, err)
+	}
+}
+
+func TestValidateRegion(t *testing.T) {
+	tests := []struct {
+		country, region, postalCode string
+		want                        string // region stored
+		refused                     bool
+	}{
+		{"US", "CA", "94105", "CA", false},
+		{"US", "ca", "94105", "CA", false},
+		{"US", "California", "94105", "CA", false},
+		{"US", " new york ", "10001", "NY", false},
+		{"US", "Calif.", "94105", "", true},
+		{"US", "ZZ", "94105", "", true},
+		{"US", "", "94105", "", true},
+		{"CA", "Quebec", "H2X 1Y4", "QC", false},
+		{"AU", "nsw", "2000", "NSW", false},
+		{"AU", "CA", "2000", "", true},
+		{"GB", "Greater London", "SW1A 1AA", "Greater London", false},
+		{"GB", "", "SW1A 1AA", "", false},
+	}
+	for _, tt := range tests {
+		address := Address{FullName: "Ann Smith", Line1: "1 Main St", City: "Springfield", Region: tt.region, PostalCode: tt.postalCode, Country: tt.country}
+		err := validate(&address)
+		switch {
+		case tt.refused:
+			if response.From(err).Fields["region"] == "" {
+				t.Errorf("%s address in %q: err = %v, want the region refused", tt.country, tt.region, err)
+			}
+		case err != nil:
+			t.Errorf("%s address in %q: %v %v", tt.country, tt.region, err, response.From(err).Fields)
+		case address.Region != tt.want:
+			t.Errorf("%s address in %q: region stored as %q, want %q", tt.country, tt.region, address.Region, tt.want)
+		}
+	}
+}
+
+func TestPricingRegion(t *testing.T) {
+	tests := []struct {
+		address Address
+		want    string
+		wantErr error
+	}{
+		{Address{Country: "US", Region: "CA"}, "US-CA", nil},
+		{Address{Country: "US", Region: "California"}, "US-CA", nil}, // saved before regions were checked
+		{Address{Country: "US", Region: "Calif."}, "", ErrRegionUnknown},
+		{Address{Country: "AU", Region: "NSW"}, "AU-NSW", nil},
+		{Address{Country: "GB", Region: "Greater London"}, "GB", nil},
+		{Address{Country: "DE"}, "DE", nil},
+	}
+	for _, tt := range tests {
+		got, err := tt.address.PricingRegion()
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("PricingRegion of %s %q = %q, %v, want %q, %v", tt.address.Country, tt.address.Region, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -1,410 +1,571 @@
-package authentication
-
-import (
-	"encoding/json"
-	"errors"
-	"fmt"
-	"html/template"
-	"io/ioutil"
-	"log"
-	"net/http"
-	"time"
-
-	"github.com/ecommerce/internal/core/session"
-	"github.com/ecommerce/internal/services/user"
-
-	"github.com/gorilla/mux"
-)
-
-const (
-	authBasePath = "auth"
-	prodBasePath = "prod"
-	apiBasePath  = "api"
-)
-
-// SetupRoutes :
-func SetupAuthRoutes(r *mux.Router, s *AuthService) {
-	apiUrlPath := fmt.Sprintf("/%s/%s", apiBasePath, authBasePath)
-	authRouter := r.PathPrefix(apiUrlPath).Subrouter()
-	authRouter.HandleFunc("/login", loginHandler(s))
-	authRouter.HandleFunc("/register", registerHandler(s))
-
-	// -------------------------PROD----------------------
-	prodUrlPath := fmt.Sprintf("/%s/%s", prodBasePath, authBasePath)
-	prodAuthRouter := r.PathPrefix(prodUrlPath).Subrouter()
-	prodAuthRouter.HandleFunc("/login", loginProdHandler(s))
-	prodAuthRouter.HandleFunc("/register", registerProdHandler(s))
-	prodAuthRouter.HandleFunc("/logout", logoutProdHandler(s))
-}
-
-func registerProdHandler(s *AuthService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Parse the template file (adjust path if necessary)
-		tmpl, err := template.ParseFiles("template/register.html")
-		if err != nil {
-			log.Println("Template parsing error:", err)
-			http.Error(w, "Error loading register page", http.StatusInternalServerError)
-			return
-		}
-		switch r.Method {
-		case http.MethodGet:
-			// Execute the template, sending data if needed (or nil if not)
-			err = tmpl.Execute(w, nil)
-			if err != nil {
-				log.Println("Template execution error:", err)
-				http.Error(w, "Error rendering register page", http.StatusInternalServerError)
-			}
-		case http.MethodPost:
-
-			sess, err := session.GetSessionFromContext(r)
-			if sess == nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			err = r.ParseForm()
-			if err != nil {
-				err := errors.New("Error parsing form data")
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			// extracting data of form values
-			email := r.FormValue("email")
-			password := r.FormValue("password")
-			confirmPassword := r.FormValue("confirm_password")
-
-			// email and pass empty validation
-			if email == "" || password == "" {
-				err := errors.New("email and password are required")
-				log.Println(err)
-				tmpl.Execute(w, map[string]string{"Error": err.Error()})
-				return
-			}
-
-			// pass and confirm pass validation
-			if password != confirmPassword {
-				err := errors.New("password and confirm password is not same")
-				log.Println(err)
-				tmpl.Execute(w, map[string]string{"Error": err.Error()})
-				return
-			}
-
-			//register user
-			newUser := user.User{Email: email, Password: password}
-			userID, res, err := s.registerUserService(newUser)
-
-			if err != nil {
-				log.Println(res, ": ", err)
-				tmpl.Execute(w, map[string]string{"Error": err.Error()})
-				return
-			}
-
-			//storing user in session
-			user, res, err := s.UserService.GetUserByEmailService(email)
-
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), res)
-				return
-			}
-
-			userObj := session.User{
-				UserID: user.UserID, Email: user.Email,
-				Password: user.Password, IsAdmin: user.IsAdmin}
-
-			sess.Values["user"] = &userObj
-			sess.Values["userId"] = user.UserID
-
-			time.Sleep(10 * time.Microsecond)
-			// Now, create a cart for the user
-			cartID, status, err := s.UserService.CreateCartForUserService(userID)
-
-			if err != nil {
-				log.Println("Error creating cart:", err)
-				http.Error(w, err.Error(), status)
-				return
-			}
-
-			//storing cart in session
-			cartObj := session.Cart{
-				CartID: cartID}
-
-			sess.Values["cart"] = &cartObj
-
-			// saving session
-			err = sess.Save(r, w)
-
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			// If register is successful, redirect
-			// Redirect to dashboard page on successful login
-			log.Println("redirect-to-dashboard")
-			http.Redirect(w, r, "/prod/users/dashboard", http.StatusSeeOther) // 302 Found
-		case http.MethodOptions:
-			return
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	}
-}
-
-func loginProdHandler(s *AuthService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Parse the template file (adjust path if necessary)
-		tmpl, err := template.ParseFiles("template/login.html")
-		if err != nil {
-			log.Println("Template parsing error:", err)
-			http.Error(w, "Error loading login page", http.StatusInternalServerError)
-			return
-		}
-
-		switch r.Method {
-		case http.MethodGet:
-			// Execute the template, sending data if needed (or nil if not)
-			err = tmpl.Execute(w, nil)
-			if err != nil {
-				log.Println("Template execution error:", err)
-				http.Error(w, "Error rendering login page", http.StatusInternalServerError)
-				return
-			}
-		case http.MethodPost:
-			sess, err := session.GetSessionFromContext(r)
-			if sess == nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			err = r.ParseForm()
-			if err != nil {
-				log.Println(err)
-				http.Error(w, "Error parsing form data", http.StatusBadRequest)
-				return
-			}
-
-			// extracting data of form values
-			email := r.FormValue("email")
-			password := r.FormValue("password")
-
-			// Simple validation
-			if email == "" || password == "" {
-				err := errors.New("email and password are required")
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			//login user
-			existingUser := user.User{Email: email, Password: password}
-			res, err := s.loginUserService(existingUser)
-
-			if err != nil {
-				log.Println(err)
-				tmpl.Execute(w, map[string]string{"Error": err.Error()})
-				return
-			}
-
-			//storing user in session
-			user, res, err := s.UserService.GetUserByEmailService(email)
-
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), res)
-				return
-			}
-
-			userObj := session.User{
-				UserID: user.UserID, Email: user.Email,
-				Password: user.Password, IsAdmin: user.IsAdmin}
-
-			sess.Values["user"] = &userObj
-			sess.Values["userId"] = user.UserID
-
-			//storing cart in session
-			cartID, err := s.UserService.Repo.GetCartForUser(user.UserID)
-			if err != nil {
-				log.Println("Error fetching cart:", err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			cartObj := session.Cart{
-				CartID: cartID}
-
-			sess.Values["cart"] = &cartObj
-
-			err = sess.Save(r, w)
-
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			// If login is successful, redirect
-			// Redirect to dashboard page on successful login
-			log.Println("redirect-to-dashboard")
-			http.Redirect(w, r, "/prod/users/dashboard", http.StatusSeeOther) // 303
-		case http.MethodOptions:
-			return
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	}
-}
-
-func logoutProdHandler(s *AuthService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Parse the template file (adjust path if necessary)
-		tmpl, err := template.ParseFiles("template/logout.html")
-		if err != nil {
-			log.Println("Template parsing error:", err)
-			http.Error(w, "Error loading logout page", http.StatusInternalServerError)
-			return
-		}
-
-		switch r.Method {
-		case http.MethodGet:
-			// Execute the template, sending data if needed (or nil if not)
-			err = tmpl.Execute(w, nil)
-			if err != nil {
-				log.Println("Template execution error:", err)
-				http.Error(w, "Error rendering logout page", http.StatusInternalServerError)
-			}
-		case http.MethodPost:
-			session, err := session.GetSessionFromContext(r)
-			if session == nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			// Clear session values
-			session.Values = nil
-
-			//delete session before logout
-			session.Options.MaxAge = -1
-
-			// Save the session to apply the deletion
-			err = session.Save(r, w)
-
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			// Check if the session was deleted
-			deletedSession, err := session.Store().Get(r, "session-name")
-
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			if len(deletedSession.Values) == 0 {
-				log.Println("Session successfully deleted.")
-			} else {
-				log.Fatalln("Failed to delete session.")
-			}
-
-			// If logout is successful, redirect
-			// Redirect to home page on successful logout
-			log.Println("redirect-to-homepage")
-			http.Redirect(w, r, "/prod/auth/logout", http.StatusSeeOther) // 303
-		case http.MethodOptions:
-			return
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	}
-}
-
-func registerHandler(s *AuthService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodPost:
-			// add a new user to the list
-			var newUser user.User
-			bodyBytes, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
-
-			err = json.Unmarshal(bodyBytes, &newUser)
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
-
-			if newUser.UserID != 0 {
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
-
-			//register user
-			_, res, err := s.registerUserService(newUser)
-
-			if err == nil {
-				w.WriteHeader(res)
-				return
-			}
-
-			w.WriteHeader(http.StatusCreated)
-			return
-		case http.MethodOptions:
-			return
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	}
-}
-
-func loginHandler(s *AuthService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodPost:
-			// add a new product to the list
-			var existingUser user.User
-			bodyBytes, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
-
-			err = json.Unmarshal(bodyBytes, &existingUser)
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
-
-			if existingUser.UserID != 0 {
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
-
-			//login user
-			res, err := s.loginUserService(existingUser)
-
-			if err != nil {
-				w.WriteHeader(res)
-				return
-			}
-
-			w.WriteHeader(http.StatusOK)
-			return
-		case http.MethodOptions:
-			return
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	}
-}
+package authentication
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/core/session"
+	"github.com/ecommerce/internal/services/user"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	authBasePath = "auth"
+	prodBasePath = "prod"
+	apiBasePath  = "api"
+)
+
+var (
+	errAuthRequired = response.Unauthorized("authentication required")
+	errUserIDSet    = response.BadRequest("userId must not be set")
+)
+
+// SetupRoutes :
+func SetupAuthRoutes(r *mux.Router, s *AuthService) {
+	apiUrlPath := fmt.Sprintf("/%s/%s", apiBasePath, authBasePath)
+	authRouter := r.PathPrefix(apiUrlPath).Subrouter()
+	authRouter.HandleFunc("/login", loginHandler(s))
+	authRouter.HandleFunc("/register", registerHandler(s))
+	authRouter.HandleFunc("/token/refresh", refreshTokenHandler(s))
+	authRouter.HandleFunc("/token/revoke", revokeTokenHandler(s))
+	authRouter.HandleFunc("/logoutAll", logoutAllHandler(s))
+
+	// -------------------------PROD----------------------
+	prodUrlPath := fmt.Sprintf("/%s/%s", prodBasePath, authBasePath)
+	prodAuthRouter := r.PathPrefix(prodUrlPath).Subrouter()
+	prodAuthRouter.HandleFunc("/login", loginProdHandler(s))
+	prodAuthRouter.HandleFunc("/register", registerProdHandler(s))
+	prodAuthRouter.HandleFunc("/logout", logoutProdHandler(s))
+}
+
+func registerProdHandler(s *AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the template file (adjust path if necessary)
+		tmpl, err := template.ParseFiles("template/register.html")
+		if err != nil {
+			log.Println("Template parsing error:", err)
+			http.Error(w, "Error loading register page", http.StatusInternalServerError)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			// the form starts empty, without field errors
+			err = tmpl.Execute(w, map[string]interface{}{"Errors": map[string]string{}})
+			if err != nil {
+				log.Println("Template execution error:", err)
+				http.Error(w, "Error rendering register page", http.StatusInternalServerError)
+			}
+		case http.MethodPost:
+
+			sess, err := session.GetSessionFromContext(r)
+			if sess == nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			err = r.ParseForm()
+			if err != nil {
+				err := errors.New("Error parsing form data")
+				log.Println(err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			// extracting data of form values
+			email := r.FormValue("email")
+			password := r.FormValue("password")
+			confirmPassword := r.FormValue("confirm_password")
+
+			// pass and confirm pass validation
+			if password != confirmPassword {
+				err := response.Validation(map[string]string{"confirm_password": "doesn't match the password"})
+				log.Println(err)
+				renderRegisterErrors(tmpl, w, email, err)
+				return
+			}
+
+			//register user
+			newUser := user.User{Email: email, Password: password}
+			userID, err := s.registerUserService(newUser)
+
+			if err != nil {
+				log.Println(err)
+				renderRegisterErrors(tmpl, w, email, err)
+				return
+			}
+
+			//storing user in session
+			user, err := s.UserService.GetUserByEmailService(email)
+
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			userObj := session.User{
+				UserID: user.UserID, Email: user.Email,
+				IsAdmin: user.IsAdmin}
+
+			// the signed in user gets a new session ID, not the one the browser came with
+			err = session.RenewID(sess)
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			sess.Values["user"] = &userObj
+			sess.Values["userId"] = user.UserID
+
+			// the cart was created along with the user
+			cartID, err := s.UserService.Repo.GetCartForUser(userID)
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			//storing cart in session
+			cartObj := session.Cart{
+				CartID: cartID}
+
+			sess.Values["cart"] = &cartObj
+
+			// saving session
+			err = sess.Save(r, w)
+
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			// If register is successful, redirect
+			// Redirect to dashboard page on successful login
+			log.Println("redirect-to-dashboard")
+			http.Redirect(w, r, "/prod/users/dashboard", http.StatusSeeOther) // 302 Found
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func loginProdHandler(s *AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the template file (adjust path if necessary)
+		tmpl, err := template.ParseFiles("template/login.html")
+		if err != nil {
+			log.Println("Template parsing error:", err)
+			http.Error(w, "Error loading login page", http.StatusInternalServerError)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			// Execute the template, sending data if needed (or nil if not)
+			err = tmpl.Execute(w, nil)
+			if err != nil {
+				log.Println("Template execution error:", err)
+				http.Error(w, "Error rendering login page", http.StatusInternalServerError)
+				return
+			}
+		case http.MethodPost:
+			sess, err := session.GetSessionFromContext(r)
+			if sess == nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			err = r.ParseForm()
+			if err != nil {
+				log.Println(err)
+				http.Error(w, "Error parsing form data", http.StatusBadRequest)
+				return
+			}
+
+			// extracting data of form values
+			email := r.FormValue("email")
+			password := r.FormValue("password")
+
+			// Simple validation
+			if email == "" || password == "" {
+				err := errors.New("email and password are required")
+				log.Println(err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			//login user
+			existingUser := user.User{Email: email, Password: password}
+			user, err := s.loginUserService(existingUser)
+
+			if err != nil {
+				log.Println(err)
+				tmpl.Execute(w, map[string]string{"Error": response.From(err).Message})
+				return
+			}
+
+			//storing user in session
+
+			userObj := session.User{
+				UserID: user.UserID, Email: user.Email,
+				IsAdmin: user.IsAdmin}
+
+			// the signed in user gets a new session ID, not the one the browser came with
+			err = session.RenewID(sess)
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			sess.Values["user"] = &userObj
+			sess.Values["userId"] = user.UserID
+
+			//storing cart in session
+			cartID, err := s.UserService.Repo.GetCartForUser(user.UserID)
+			if err != nil {
+				log.Println("Error fetching cart:", err)
+				response.PageError(w, err)
+				return
+			}
+
+			cartObj := session.Cart{
+				CartID: cartID}
+
+			sess.Values["cart"] = &cartObj
+
+			err = sess.Save(r, w)
+
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			// If login is successful, redirect
+			// Redirect to dashboard page on successful login
+			log.Println("redirect-to-dashboard")
+			http.Redirect(w, r, "/prod/users/dashboard", http.StatusSeeOther) // 303
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func logoutProdHandler(s *AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the template file (adjust path if necessary)
+		tmpl, err := template.ParseFiles("template/logout.html")
+		if err != nil {
+			log.Println("Template parsing error:", err)
+			http.Error(w, "Error loading logout page", http.StatusInternalServerError)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			// Execute the template, sending data if needed (or nil if not)
+			err = tmpl.Execute(w, nil)
+			if err != nil {
+				log.Println("Template execution error:", err)
+				http.Error(w, "Error rendering logout page", http.StatusInternalServerError)
+			}
+		case http.MethodPost:
+			sess, err := session.GetSessionFromContext(r)
+			if sess == nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			// "log out everywhere" also ends the user's other sessions and tokens
+			if r.FormValue("everywhere") != "" {
+				if user, err := session.GetSessionUser(sess); err == nil {
+					err := s.logoutEverywhereService(user.UserID, sess.Store())
+					if err != nil {
+						log.Println(err)
+						response.PageError(w, err)
+						return
+					}
+				}
+			}
+
+			// Clear session values
+			sess.Values = nil
+
+			//delete session before logout
+			sess.Options.MaxAge = -1
+
+			// Save the session to apply the deletion
+			err = sess.Save(r, w)
+
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			// Check if the session was deleted
+			deletedSession, err := sess.Store().Get(r, "session-name")
+
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+			if len(deletedSession.Values) == 0 {
+				log.Println("Session successfully deleted.")
+			} else {
+				log.Fatalln("Failed to delete session.")
+			}
+
+			// If logout is successful, redirect
+			// Redirect to home page on successful logout
+			log.Println("redirect-to-homepage")
+			http.Redirect(w, r, "/prod/auth/logout", http.StatusSeeOther) // 303
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func registerHandler(s *AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			// add a new user to the list
+			var newUser user.User
+			err := json.NewDecoder(r.Body).Decode(&newUser)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if newUser.UserID != 0 {
+				response.WriteError(w, errUserIDSet)
+				return
+			}
+
+			//register user
+			_, err = s.registerUserService(newUser)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			w.WriteHeader(http.StatusCreated)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func loginHandler(s *AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var existingUser user.User
+			err := json.NewDecoder(r.Body).Decode(&existingUser)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if existingUser.UserID != 0 {
+				response.WriteError(w, errUserIDSet)
+				return
+			}
+
+			//login user
+			loggedInUser, err := s.loginUserService(existingUser)
+			if err != nil {
+				response.WriteError(w, err)
+				return
+			}
+
+			// issue bearer tokens so API clients don't depend on the cookie session
+			pair, err := s.issueTokensService(loggedInUser.UserID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			writeTokenPair(w, pair)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// refreshTokenHandler exchanges a refresh token for a new access/refresh pair
+func refreshTokenHandler(s *AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var payload tokenPayload
+			err := json.NewDecoder(r.Body).Decode(&payload)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+			if payload.RefreshToken == "" {
+				response.WriteError(w, response.Validation(map[string]string{"refresh_token": "is required"}))
+				return
+			}
+
+			pair, err := s.refreshTokensService(payload.RefreshToken)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			writeTokenPair(w, pair)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// revokeTokenHandler revokes the given token along with every token rotated from the same login
+func revokeTokenHandler(s *AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var payload tokenPayload
+			err := json.NewDecoder(r.Body).Decode(&payload)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+			token := payload.Token
+			if token == "" {
+				token = payload.RefreshToken
+			}
+			if token == "" {
+				response.WriteError(w, response.Validation(map[string]string{"token": "is required"}))
+				return
+			}
+
+			err = s.revokeTokenService(token)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// logoutAllHandler ends every session and revokes every token of the logged in user
+func logoutAllHandler(s *AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			user, err := session.GetUserFromContext(r)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, errAuthRequired)
+				return
+			}
+
+			sess, err := session.GetSessionFromContext(r)
+			if sess == nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			err = s.logoutEverywhereService(user.UserID, sess.Store())
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			// drop the session of this request as well
+			sess.Values = nil
+			sess.Options.MaxAge = -1
+			err = sess.Save(r, w)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// tokenPayload is the request body of the refresh and revoke endpoints
+type tokenPayload struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// helper functions
+
+// renderRegisterErrors shows the register form again with the email filled in, the message of err
+// and, for validation errors, the problem of each field under its input
+func renderRegisterErrors(tmpl *template.Template, w http.ResponseWriter, email string, err error) {
+	appErr := response.From(err)
+	data := map[string]interface{}{"Email": email, "Errors": appErr.Fields}
+	if appErr.Fields == nil {
+		data["Error"] = appErr.Message
+	}
+
+	w.WriteHeader(appErr.Status)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("Template execution error:", err)
+	}
+}
+
+func writeTokenPair(w http.ResponseWriter, pair *TokenPair) {
+	// tokens must never be cached by intermediaries
+	w.Header().Set("Cache-Control", "no-store")
+	response.JSON(w, http.StatusOK, pair)
+}
@@ -0,0 +1,44 @@
+package authentication
+
+import "time"
+
+// TokenKind tells access tokens, used on every API call, from refresh tokens, used to get a new pair
+type TokenKind string
+
+const (
+	AccessToken  TokenKind = "access"
+	RefreshToken TokenKind = "refresh"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// Token is an issued bearer token. Only the SHA-256 hash of the token is stored.
+// Every token issued from the same login shares a FamilyID so that a whole chain of
+// rotated tokens can be revoked at once.
+type Token struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	FamilyID  string     `json:"family_id"`
+	Kind      TokenKind  `json:"kind"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TokenPair is returned to API clients on login and on refresh
+type TokenPair struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`         // access token lifetime in seconds
+	RefreshExpiresIn int    `json:"refresh_expires_in"` // refresh token lifetime in seconds
+}
+
+// IsActive reports whether the token is neither revoked nor expired
+func (t *Token) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,88 @@
+package authentication
+
+import (
+	"time"
+
+	"github.com/ecommerce/database/memory"
+)
+
+// MemoryTokenRepository is a TokenRepository keeping tokens in a memory.DB
+type MemoryTokenRepository struct {
+	mem *memory.DB
+}
+
+func NewMemoryTokenRepository(mem *memory.DB) *MemoryTokenRepository {
+	return &MemoryTokenRepository{mem: mem}
+}
+
+func (repo *MemoryTokenRepository) getTokenByHash(tokenHash string) (*Token, error) {
+	var token *Token
+	err := repo.mem.View(func() error {
+		if found, ok := repo.tokens().First(func(t Token) bool { return t.TokenHash == tokenHash }); ok {
+			token = &found
+		}
+		return nil
+	})
+	return token, err
+}
+
+// storeTokens inserts newly issued tokens
+func (repo *MemoryTokenRepository) storeTokens(tokens ...*Token) error {
+	return repo.mem.Update(func() error {
+		repo.insertTokens(tokens...)
+		return nil
+	})
+}
+
+// rotateToken revokes a refresh token and stores its replacements, failing with ErrTokenReused
+// when the old token was already revoked
+func (repo *MemoryTokenRepository) rotateToken(old *Token, tokens ...*Token) error {
+	return repo.mem.Update(func() error {
+		current, ok := repo.tokens().Get(old.ID)
+		if !ok || current.RevokedAt != nil {
+			return ErrTokenReused
+		}
+
+		now := time.Now()
+		current.RevokedAt = &now
+		repo.tokens().Put(current.ID, current)
+
+		repo.insertTokens(tokens...)
+		return nil
+	})
+}
+
+// revokeFamily revokes every token issued from the same login
+func (repo *MemoryTokenRepository) revokeFamily(familyID string) error {
+	return repo.revokeWhere(func(t Token) bool { return t.FamilyID == familyID })
+}
+
+// RevokeUserTokens revokes every token issued to a user
+func (repo *MemoryTokenRepository) RevokeUserTokens(userID int) error {
+	return repo.revokeWhere(func(t Token) bool { return t.UserID == userID })
+}
+
+// revokeWhere revokes the unrevoked tokens matching keep
+func (repo *MemoryTokenRepository) revokeWhere(keep func(Token) bool) error {
+	return repo.mem.Update(func() error {
+		now := time.Now()
+		repo.tokens().Update(func(t Token) bool { return t.RevokedAt == nil && keep(t) }, func(t Token) Token {
+			t.RevokedAt = &now
+			return t
+		})
+		return nil
+	})
+}
+
+// insertTokens assigns ids to the tokens and stores them, the caller must hold the write lock
+func (repo *MemoryTokenRepository) insertTokens(tokens ...*Token) {
+	for _, token := range tokens {
+		token.ID = repo.tokens().NextID()
+		token.CreatedAt = time.Now()
+		repo.tokens().Put(token.ID, *token)
+	}
+}
+
+func (repo *MemoryTokenRepository) tokens() *memory.Table[Token] {
+	return memory.TableOf[Token](repo.mem, TABLE_NAME)
+}
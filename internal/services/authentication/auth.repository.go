@@ -0,0 +1,164 @@
+package authentication
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const TABLE_NAME = "auth_tokens"
+
+var ErrTokenReused = errors.New("refresh token has already been used")
+
+// TokenRepository stores API tokens. MySQLTokenRepository is the production implementation,
+// MemoryTokenRepository keeps everything in process for demos and tests.
+type TokenRepository interface {
+	getTokenByHash(tokenHash string) (*Token, error)
+	storeTokens(tokens ...*Token) error
+	rotateToken(old *Token, tokens ...*Token) error
+	revokeFamily(familyID string) error
+	RevokeUserTokens(userID int) error
+}
+
+type MySQLTokenRepository struct {
+	db *sql.DB
+}
+
+func NewMySQLTokenRepository(db *sql.DB) *MySQLTokenRepository {
+	return &MySQLTokenRepository{db: db}
+}
+
+func (repo *MySQLTokenRepository) getTokenByHash(tokenHash string) (*Token, error) {
+	row := repo.db.QueryRow(`SELECT
+	id,
+	user_id,
+	family_id,
+	kind,
+	token_hash,
+	expires_at,
+	revoked_at,
+	created_at
+	FROM auth_tokens
+	WHERE token_hash = ?`, tokenHash)
+
+	token := &Token{}
+	var revokedAt sql.NullTime
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.Kind,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&revokedAt,
+		&token.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return token, nil
+}
+
+// storeTokens inserts newly issued tokens
+func (repo *MySQLTokenRepository) storeTokens(tokens ...*Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertTokens(ctx, tx, tokens...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// rotateToken revokes a refresh token and stores its replacements in one transaction.
+// The revoke only succeeds while the old token is still unrevoked, so two concurrent
+// refreshes with the same token can't both get a new pair.
+func (repo *MySQLTokenRepository) rotateToken(old *Token, tokens ...*Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE auth_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now(), old.ID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token %d: %v", old.ID, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTokenReused
+	}
+
+	if err := insertTokens(ctx, tx, tokens...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// revokeFamily revokes every token issued from the same login
+func (repo *MySQLTokenRepository) revokeFamily(familyID string) error {
+	_, err := repo.db.Exec(`UPDATE auth_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL`, time.Now(), familyID)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+// RevokeUserTokens revokes every token issued to a user
+func (repo *MySQLTokenRepository) RevokeUserTokens(userID int) error {
+	_, err := repo.db.Exec(`UPDATE auth_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, time.Now(), userID)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+// helper functions
+
+func insertTokens(ctx context.Context, tx *sql.Tx, tokens ...*Token) error {
+	for _, token := range tokens {
+		result, err := tx.ExecContext(ctx, `INSERT INTO auth_tokens
+		(user_id,
+		family_id,
+		kind,
+		token_hash,
+		expires_at) VALUES (?, ?, ?, ?, ?)`,
+			token.UserID,
+			token.FamilyID,
+			token.Kind,
+			token.TokenHash,
+			token.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to store %s token for user %d: %v", token.Kind, token.UserID, err)
+		}
+
+		tokenID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		token.ID = int(tokenID)
+	}
+	return nil
+}
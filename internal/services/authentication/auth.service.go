@@ -1,41 +1,230 @@
-package authentication
-
-import (
-	"log"
-	"net/http"
-
-	"github.com/ecommerce/internal/services/cart"
-	"github.com/ecommerce/internal/services/user"
-)
-
-// AuthService handles business logic for auth-related operations.
-type AuthService struct {
-	UserService *user.UserService
-	CartService *cart.CartService
-}
-
-// NewAuthService creates a new AuthService.
-func NewAuthService(userService *user.UserService, cartService *cart.CartService) *AuthService {
-	return &AuthService{
-		UserService: userService,
-		CartService: cartService,
-	}
-}
-
-func (s *AuthService) registerUserService(newUser user.User) (int, int, error) {
-	insertID, err := s.UserService.Repo.RegisterUser(newUser)
-	if err != nil {
-		log.Print(err)
-		return 0, http.StatusBadRequest, nil
-	}
-	return insertID, http.StatusOK, err
-}
-
-func (s *AuthService) loginUserService(existingUser user.User) (int, error) {
-	res, err := s.UserService.Repo.LoginUser(existingUser)
-	if err != nil {
-		log.Print(err)
-		return res, err
-	}
-	return res, nil
-}
+package authentication
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/core/session"
+	"github.com/ecommerce/internal/services/cart"
+	"github.com/ecommerce/internal/services/user"
+	"github.com/ecommerce/utils"
+	"github.com/gorilla/sessions"
+)
+
+var ErrInvalidToken = response.New(http.StatusUnauthorized, "invalid_token", "invalid or expired token")
+
+// AuthService handles business logic for auth-related operations.
+type AuthService struct {
+	UserService *user.UserService
+	CartService *cart.CartService
+	Tokens      TokenRepository
+}
+
+// NewAuthService creates a new AuthService.
+func NewAuthService(userService *user.UserService, cartService *cart.CartService, tokens TokenRepository) *AuthService {
+	return &AuthService{
+		UserService: userService,
+		CartService: cartService,
+		Tokens:      tokens,
+	}
+}
+
+// registerUserService validates and registers a new user, along with the cart their tokens resolve to
+func (s *AuthService) registerUserService(newUser user.User) (int, error) {
+	if fields := utils.Validate(newUser); fields != nil {
+		return 0, response.Validation(fields)
+	}
+
+	insertID, err := s.UserService.Repo.RegisterUser(newUser)
+	if err != nil {
+		log.Print(err)
+		return 0, err
+	}
+	return insertID, nil
+}
+
+// loginUserService checks the credentials and returns the account they belong to
+func (s *AuthService) loginUserService(existingUser user.User) (*user.User, error) {
+	if err := requireCredentials(existingUser); err != nil {
+		return nil, err
+	}
+
+	loggedInUser, err := s.UserService.Repo.LoginUser(existingUser)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	return loggedInUser, nil
+}
+
+// issueTokensService starts a new token family for the user and returns its first access/refresh pair.
+func (s *AuthService) issueTokensService(userID int) (*TokenPair, error) {
+	familyID, err := utils.GenerateToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	pair, tokens, err := newTokenPair(userID, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Tokens.storeTokens(tokens...)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	return pair, nil
+}
+
+// refreshTokensService exchanges a refresh token for a new pair, revoking the one presented.
+// Presenting a refresh token that was already rotated means it leaked, so the whole family is revoked.
+func (s *AuthService) refreshTokensService(rawToken string) (*TokenPair, error) {
+	token, err := s.Tokens.getTokenByHash(utils.HashToken(rawToken))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || token.Kind != RefreshToken || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	if token.RevokedAt != nil {
+		return nil, s.handleTokenReuse(token)
+	}
+
+	pair, tokens, err := newTokenPair(token.UserID, token.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Tokens.rotateToken(token, tokens...)
+	if errors.Is(err, ErrTokenReused) {
+		return nil, s.handleTokenReuse(token)
+	} else if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	return pair, nil
+}
+
+// revokeTokenService revokes the family of the given access or refresh token.
+func (s *AuthService) revokeTokenService(rawToken string) error {
+	token, err := s.Tokens.getTokenByHash(utils.HashToken(rawToken))
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return ErrInvalidToken
+	}
+
+	return s.Tokens.revokeFamily(token.FamilyID)
+}
+
+// logoutEverywhereService revokes every token of the user and, when the session store supports it,
+// deletes every session of the user. Cookie sessions can't be reached server side and stay valid.
+func (s *AuthService) logoutEverywhereService(userID int, store sessions.Store) error {
+	err := s.Tokens.RevokeUserTokens(userID)
+	if err != nil {
+		return err
+	}
+
+	deleter, ok := store.(session.UserSessionDeleter)
+	if !ok {
+		log.Printf("Session store %T can't end the other sessions of user %d", store, userID)
+		return nil
+	}
+
+	return deleter.DeleteUserSessions(userID)
+}
+
+// LogoutEverywhere revokes every token and deletes every database session of the user,
+// for the services ending them without a request such as a password reset
+func (s *AuthService) LogoutEverywhere(userID int, store sessions.Store) error {
+	return s.logoutEverywhereService(userID, store)
+}
+
+// AuthenticateToken resolves an access token to the user it was issued to and the user's cart.
+func (s *AuthService) AuthenticateToken(rawToken string) (*session.User, *session.Cart, error) {
+	token, err := s.Tokens.getTokenByHash(utils.HashToken(rawToken))
+	if err != nil {
+		return nil, nil, err
+	}
+	if token == nil || token.Kind != AccessToken || !token.IsActive(time.Now()) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	existingUser, err := s.UserService.GetUserByIDService(token.UserID)
+	if err != nil || existingUser == nil {
+		return nil, nil, ErrInvalidToken
+	}
+
+	cartID, err := s.UserService.Repo.GetCartForUser(existingUser.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userObj := &session.User{
+		UserID: existingUser.UserID, Email: existingUser.Email,
+		IsAdmin: existingUser.IsAdmin}
+	return userObj, &session.Cart{CartID: cartID}, nil
+}
+
+// handleTokenReuse revokes the family of a refresh token that was presented after being rotated
+func (s *AuthService) handleTokenReuse(token *Token) error {
+	log.Printf("Refresh token %d of user %d reused, revoking token family", token.ID, token.UserID)
+	if err := s.Tokens.revokeFamily(token.FamilyID); err != nil {
+		return err
+	}
+	return ErrInvalidToken
+}
+
+// helper functions
+
+// requireCredentials fails with a validation error naming the missing email and password fields
+func requireCredentials(u user.User) error {
+	fields := map[string]string{}
+	if u.Email == "" {
+		fields["email"] = "is required"
+	}
+	if u.Password == "" {
+		fields["password"] = "is required"
+	}
+	if len(fields) > 0 {
+		return response.Validation(fields)
+	}
+	return nil
+}
+
+// newTokenPair generates an access and a refresh token in the given family
+func newTokenPair(userID int, familyID string) (*TokenPair, []*Token, error) {
+	now := time.Now()
+	pair := &TokenPair{
+		TokenType:        "Bearer",
+		ExpiresIn:        int(AccessTokenTTL.Seconds()),
+		RefreshExpiresIn: int(RefreshTokenTTL.Seconds()),
+	}
+
+	var tokens []*Token
+	for _, t := range []struct {
+		kind TokenKind
+		ttl  time.Duration
+		raw  *string
+	}{{AccessToken, AccessTokenTTL, &pair.AccessToken}, {RefreshToken, RefreshTokenTTL, &pair.RefreshToken}} {
+		raw, err := utils.GenerateToken(32)
+		if err != nil {
+			return nil, nil, err
+		}
+		*t.raw = raw
+		tokens = append(tokens, &Token{
+			UserID:    userID,
+			FamilyID:  familyID,
+			Kind:      t.kind,
+			TokenHash: utils.HashToken(raw),
+			ExpiresAt: now.Add(t.ttl),
+		})
+	}
+	return pair, tokens, nil
+}
@@ -0,0 +1,88 @@
+package authentication
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/core/mailer"
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/services/cart"
+	"github.com/ecommerce/internal/services/user"
+)
+
+// newAuthService returns an auth service over the memory repositories
+func newAuthService() *AuthService {
+	mem := memory.New()
+	users := user.NewUserService(user.NewMemoryUserRepository(mem), &mailer.LogMailer{}, "http://localhost")
+	carts := cart.NewCartService(cart.NewMemoryCartRepository(mem), nil, nil, nil)
+	return NewAuthService(users, carts, NewMemoryTokenRepository(mem))
+}
+
+func TestRegisterUserService(t *testing.T) {
+	s := newAuthService()
+
+	userID, err := s.registerUserService(user.User{Email: "ann@example.com", Password: "longenough"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID == 0 {
+		t.Fatal("no user ID returned")
+	}
+	if _, err := s.UserService.Repo.GetCartForUser(userID); err != nil {
+		t.Errorf("registered user without a cart: %v", err)
+	}
+
+	_, err = s.registerUserService(user.User{Email: "ann@example.com", Password: "longenough"})
+	if !errors.Is(err, user.ErrEmailTaken) {
+		t.Errorf("same email twice: err = %v, want %v", err, user.ErrEmailTaken)
+	}
+
+	_, err = s.registerUserService(user.User{Email: "not-an-email", Password: "short"})
+	apiErr := response.From(err)
+	if apiErr.Status != http.StatusUnprocessableEntity || apiErr.Fields["email"] == "" || apiErr.Fields["password"] == "" {
+		t.Errorf("invalid email and password: err = %v %v, want validation errors on both", err, apiErr.Fields)
+	}
+}
+
+func TestLoginUserService(t *testing.T) {
+	s := newAuthService()
+	userID, err := s.registerUserService(user.User{Email: "ann@example.com", Password: "longenough"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loggedIn, err := s.loginUserService(user.User{Email: "ann@example.com", Password: "longenough"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loggedIn.UserID != userID {
+		t.Errorf("logged in as user %d, want %d", loggedIn.UserID, userID)
+	}
+
+	for _, credentials := range []user.User{
+		{Email: "ann@example.com", Password: "wrongpassword"},
+		{Email: "bob@example.com", Password: "longenough"},
+	} {
+		if _, err := s.loginUserService(credentials); !errors.Is(err, user.ErrInvalidCredentials) {
+			t.Errorf("login as %s: err = %v, want %v", credentials.Email, err, user.ErrInvalidCredentials)
+		}
+	}
+
+	// the access token issued at login stands for the user and their cart
+	pair, err := s.issueTokensService(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionUser, sessionCart, err := s.AuthenticateToken(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessionUser.UserID != userID || sessionCart.CartID == 0 {
+		t.Errorf("token resolved to user %d with cart %d", sessionUser.UserID, sessionCart.CartID)
+	}
+	if _, _, err := s.AuthenticateToken(pair.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("refresh token used as access token: err = %v, want %v", err, ErrInvalidToken)
+	}
+}
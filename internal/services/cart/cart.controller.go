@@ -1,86 +1,405 @@
-package cart
-
-import (
-	"encoding/json"
-	"fmt"
-	"log"
-	"net/http"
-	"strconv"
-
-	"github.com/ecommerce/internal/core/session"
-	"github.com/gorilla/mux"
-)
-
-const (
-	cartBasePath = "cart"
-	prodBasePath = "prod"
-	apiBasePath  = "api"
-)
-
-// SetupRoutes :
-func SetupCartRoutes(r *mux.Router, s *CartService) {
-	// -------------------------PROD----------------------
-	prodUrlPath := fmt.Sprintf("/%s/%s", prodBasePath, cartBasePath)
-	prodCartRouter := r.PathPrefix(prodUrlPath).Subrouter()
-
-	prodCartRouter.HandleFunc("/{id}", addToCartProdHandler(s)).Methods(http.MethodPost)
-}
-
-func addToCartProdHandler(s *CartService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Get session
-		sess, err := session.GetSessionFromContext(r)
-		if sess == nil {
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		log.Println("cart-sess.Values[\"user\"]: ", sess.Values["user"])
-
-		// Validate cart
-		cart, ok := sess.Values["cart"].(*session.Cart)
-		if !ok || cart == nil {
-			http.Error(w, `{"success": false, "error": "Cart not found"}`, http.StatusBadRequest)
-			return
-		}
-
-		switch r.Method {
-		case http.MethodPost:
-			//Get cart ID from session
-			cartID := cart.CartID
-			// Get product ID from URL
-			productID, err := strconv.Atoi(mux.Vars(r)["id"])
-			if err != nil {
-				log.Println("Invalid product ID:", err)
-				http.Error(w, fmt.Sprintf(`{"success": false, "error": "%v"}`, err), http.StatusNotFound)
-				return
-			}
-			// hardcoded quantity set to 1
-			quantity := 1
-			log.Println("cart-productId", productID)
-			log.Println("cart-cartID", cartID)
-
-			// Call the AddOrUpdateCartItem method
-			status, err := s.addOrUpdateCartItemService(cartID, productID, quantity)
-			if err != nil {
-				// Handle the error (e.g., return an error response)
-				log.Println("Error adding/updating cart item:", err)
-				http.Error(w, fmt.Sprintf(`{"success": false, "error": "%v"}`, err), status)
-				return
-			}
-
-			// Success response
-			// Set response content type
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": true,
-				"message": "Cart item added/updated successfully",
-			})
-
-		case http.MethodOptions:
-			return
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	}
-}
+package cart
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/core/session"
+	"github.com/ecommerce/internal/services/address"
+	"github.com/gorilla/mux"
+)
+
+const (
+	cartBasePath = "cart"
+	prodBasePath = "prod"
+	apiBasePath  = "api"
+)
+
+// SetupRoutes :
+func SetupCartRoutes(r *mux.Router, s *CartService) {
+	apiUrlPath := fmt.Sprintf("/%s/%s", apiBasePath, cartBasePath)
+	cartRouter := r.PathPrefix(apiUrlPath).Subrouter()
+
+	cartRouter.HandleFunc("", cartHandler(s))
+	cartRouter.HandleFunc("/coupon", cartCouponHandler(s))
+	cartRouter.HandleFunc("/region", cartRegionHandler(s))
+	cartRouter.HandleFunc("/{id}", cartItemHandler(s))
+
+	// -------------------------PROD----------------------
+	prodUrlPath := fmt.Sprintf("/%s/%s", prodBasePath, cartBasePath)
+	prodCartRouter := r.PathPrefix(prodUrlPath).Subrouter()
+
+	prodCartRouter.HandleFunc("", cartProdHandler(s)).Methods(http.MethodGet)
+	prodCartRouter.HandleFunc("/coupon", cartCouponHandler(s)).Methods(http.MethodPost, http.MethodDelete)
+	prodCartRouter.HandleFunc("/region", cartRegionHandler(s)).Methods(http.MethodPut)
+	prodCartRouter.HandleFunc("/{id}", addToCartProdHandler(s)).Methods(http.MethodPost)
+	prodCartRouter.HandleFunc("/{id}", cartItemHandler(s)).Methods(http.MethodPut, http.MethodDelete)
+}
+
+func cartProdHandler(s *CartService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cartID, userID, err := getSessionCart(r)
+		if err != nil {
+			log.Println(err)
+			response.PageError(w, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			tmpl, err := template.ParseFiles("template/cart.html")
+			if err != nil {
+				log.Println("Template parsing error:", err)
+				http.Error(w, "Error loading cart page", http.StatusInternalServerError)
+				return
+			}
+
+			addressID, err := getAddressID(r)
+			if err != nil {
+				log.Println("Invalid address ID:", err)
+				response.PageError(w, address.ErrAddressNotFound)
+				return
+			}
+
+			cart, err := s.getCartService(cartID, userID, addressID)
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			err = tmpl.Execute(w, map[string]interface{}{"Cart": cart, "Regions": s.Pricing.Regions()})
+			if err != nil {
+				log.Println("Template execution error:", err)
+				http.Error(w, "Error rendering cart page", http.StatusInternalServerError)
+				return
+			}
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func cartHandler(s *CartService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			cartID, userID, err := getSessionCart(r)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			// quote the cart for the address checkout will be given
+			addressID, err := getAddressID(r)
+			if err != nil {
+				log.Println("Invalid address ID:", err)
+				response.WriteError(w, address.ErrAddressNotFound)
+				return
+			}
+
+			cart, err := s.getCartService(cartID, userID, addressID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, cart)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// cartCouponHandler applies a coupon code to the session cart (POST) or removes it (DELETE),
+// answering with the cart and the discount the coupon gives
+func cartCouponHandler(s *CartService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			return
+		}
+
+		cartID, userID, err := getSessionCart(r)
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, err)
+			return
+		}
+
+		var cart *CartView
+		switch r.Method {
+		case http.MethodPost:
+			var payload couponPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+			cart, err = s.applyCouponService(cartID, userID, payload.Code)
+		case http.MethodDelete:
+			cart, err = s.removeCouponService(cartID, userID)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err != nil {
+			log.Println("Error changing cart coupon:", err)
+			response.WriteError(w, err)
+			return
+		}
+
+		response.JSON(w, http.StatusOK, cart)
+	}
+}
+
+// cartRegionHandler sets the region the session cart ships to (PUT), answering with the cart
+// quoted for that region
+func cartRegionHandler(s *CartService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			cartID, userID, err := getSessionCart(r)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			var payload regionPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			cart, err := s.setRegionService(cartID, userID, payload.Region)
+			if err != nil {
+				log.Println("Error changing cart region:", err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, cart)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// cartItemHandler adds (POST), sets the quantity of (PUT) or removes (DELETE) a product in the session cart.
+// The optional variant query parameter picks a variant of the product, the default variant otherwise.
+func cartItemHandler(s *CartService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			return
+		}
+
+		cartID, err := getSessionCartID(r)
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, err)
+			return
+		}
+
+		productID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			log.Println("Invalid product ID:", err)
+			response.WriteError(w, ErrProductNotFound)
+			return
+		}
+
+		variantID, err := getVariantID(r)
+		if err != nil {
+			log.Println("Invalid variant ID:", err)
+			response.WriteError(w, ErrVariantNotFound)
+			return
+		}
+
+		var message string
+		switch r.Method {
+		case http.MethodPost:
+			// quantity is optional when adding, defaults to a single unit
+			payload := cartItemPayload{Quantity: 1}
+			if r.ContentLength != 0 {
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+					log.Println(err)
+					response.WriteError(w, response.InvalidBody(err))
+					return
+				}
+			}
+			err = s.addOrUpdateCartItemService(cartID, productID, variantID, payload.Quantity)
+			message = "Cart item added/updated successfully"
+		case http.MethodPut:
+			var payload cartItemPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+			err = s.updateCartItemService(cartID, productID, variantID, payload.Quantity)
+			message = "Cart item quantity updated successfully"
+		case http.MethodDelete:
+			err = s.removeCartItemService(cartID, productID, variantID)
+			message = "Cart item removed successfully"
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err != nil {
+			log.Println("Error changing cart item:", err)
+			response.WriteError(w, err)
+			return
+		}
+
+		response.JSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": message,
+		})
+	}
+}
+
+func addToCartProdHandler(s *CartService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get session
+		sess, err := session.GetSessionFromContext(r)
+		if sess == nil {
+			log.Println(err)
+			response.WriteError(w, err)
+			return
+		}
+		log.Println("cart-sess.Values[\"user\"]: ", sess.Values["user"])
+
+		// Validate cart
+		cart, ok := sess.Values["cart"].(*session.Cart)
+		if !ok || cart == nil {
+			response.WriteError(w, ErrCartNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			//Get cart ID from session
+			cartID := cart.CartID
+			// Get product ID from URL
+			productID, err := strconv.Atoi(mux.Vars(r)["id"])
+			if err != nil {
+				log.Println("Invalid product ID:", err)
+				response.WriteError(w, ErrProductNotFound)
+				return
+			}
+			variantID, err := getVariantID(r)
+			if err != nil {
+				log.Println("Invalid variant ID:", err)
+				response.WriteError(w, ErrVariantNotFound)
+				return
+			}
+			// hardcoded quantity set to 1
+			quantity := 1
+			log.Println("cart-productId", productID)
+			log.Println("cart-cartID", cartID)
+
+			// Call the AddOrUpdateCartItem method
+			err = s.addOrUpdateCartItemService(cartID, productID, variantID, quantity)
+			if err != nil {
+				// Handle the error (e.g., return an error response)
+				log.Println("Error adding/updating cart item:", err)
+				response.WriteError(w, err)
+				return
+			}
+
+			// Success response
+			response.JSON(w, http.StatusOK, map[string]interface{}{
+				"success": true,
+				"message": "Cart item added/updated successfully",
+			})
+
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// cartItemPayload is the request body accepted when adding or updating a cart line
+type cartItemPayload struct {
+	Quantity int `json:"quantity"`
+}
+
+// couponPayload is the request body accepted when applying a coupon to the cart
+type couponPayload struct {
+	Code string `json:"code"`
+}
+
+// regionPayload is the request body accepted when setting the region of the cart
+type regionPayload struct {
+	Region string `json:"region"`
+}
+
+// helper functions
+
+// getSessionCartID returns the id of the cart stored in the request session
+func getSessionCartID(r *http.Request) (int, error) {
+	sess, err := session.GetSessionFromContext(r)
+	if sess == nil {
+		return 0, err
+	}
+
+	cart, ok := sess.Values["cart"].(*session.Cart)
+	if !ok || cart == nil {
+		return 0, ErrCartNotFound
+	}
+	return cart.CartID, nil
+}
+
+// getSessionCart returns the id of the cart stored in the request session along with the id of its user
+func getSessionCart(r *http.Request) (int, int, error) {
+	cartID, err := getSessionCartID(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sess, _ := session.GetSessionFromContext(r)
+	userID, err := session.GetSessionUserID(sess)
+	if err != nil {
+		return 0, 0, err
+	}
+	return cartID, userID, nil
+}
+
+// getVariantID returns the variant query parameter of the request, 0 for the default variant when it is missing
+func getVariantID(r *http.Request) (int, error) {
+	variant := r.URL.Query().Get("variant")
+	if variant == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(variant)
+}
+
+// getAddressID returns the address_id query parameter of the request, 0 for the default shipping address when it is missing
+func getAddressID(r *http.Request) (int, error) {
+	addressID := r.URL.Query().Get("address_id")
+	if addressID == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(addressID)
+}
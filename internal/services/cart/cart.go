@@ -1,20 +1,70 @@
-package cart
-
-import "time"
-
-type Cart struct {
-	ID        int        `json:"id"`
-	UserID    int        `json:"user_id"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	Items     []CartItem // One-to-many relationship
-}
-
-type CartItem struct {
-	ID        int       `json:"id"`
-	CartID    int       `json:"cart_id"`
-	ProductID int       `json:"product_id"`
-	Quantity  int       `json:"quantity"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-}
+package cart
+
+import (
+	"time"
+
+	"github.com/ecommerce/internal/services/address"
+	"github.com/ecommerce/internal/services/pricing"
+)
+
+type Cart struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	CouponCode string     `json:"coupon_code"` // empty when no coupon is applied
+	Region     string     `json:"region"`      // region the cart is quoted for until its user adds an address, empty for the default region
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Items      []CartItem // One-to-many relationship
+}
+
+// CartItem is a cart line, one per product variant
+type CartItem struct {
+	ID        int       `json:"id"`
+	CartID    int       `json:"cart_id"`
+	ProductID int       `json:"product_id"`
+	VariantID int       `json:"variant_id"`
+	Quantity  int       `json:"quantity"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CartItemDetail is a cart line joined with its product and variant. SKU falls back to that of the
+// product for a variant without its own, Variant describes the attributes of the variant and is
+// empty for the default variant of a product.
+type CartItemDetail struct {
+	ProductID    int     `json:"product_id"`
+	VariantID    int     `json:"variant_id"`
+	SKU          string  `json:"sku"`
+	Variant      string  `json:"variant"`
+	ProductName  string  `json:"product_name"`
+	PricePerUnit float64 `json:"price_per_unit"`
+	WeightGrams  int     `json:"weight_grams"` // weight of one unit
+	Quantity     int     `json:"quantity"`
+	LineTotal    float64 `json:"line_total"`
+}
+
+// Where the region a cart is quoted for comes from. Checkout ships to an address and prices the order
+// for its region, so only a cart quoted for an address is quoted for what checkout charges; the other
+// quotes are estimates for users who have no address yet.
+const (
+	RegionFromAddress = "address" // the region of the shipping address
+	RegionChosen      = "cart"    // the region picked for the cart
+	RegionDefault     = "default" // the default region of the pricing configuration
+)
+
+// CartView is the cart as shown to the user, with line totals and the quote checkout would charge:
+// subtotal, discount, tax, shipping and the grand total, which TotalAmount repeats. A coupon that no
+// longer applies, e.g. after items were removed, stays on the cart with the reason in CouponError and
+// gives no discount.
+type CartView struct {
+	CartID          int              `json:"cart_id"`
+	Items           []CartItemDetail `json:"items"`
+	TotalItems      int              `json:"total_items"`
+	Region          string           `json:"region"`
+	RegionSource    string           `json:"region_source"`              // one of RegionFromAddress, RegionChosen and RegionDefault
+	ShippingAddress *address.Address `json:"shipping_address,omitempty"` // address the cart is quoted for, if any
+	CouponCode      string           `json:"coupon_code,omitempty"`
+	CouponError     string           `json:"coupon_error,omitempty"`
+	Quote           *pricing.Quote   `json:"quote"`
+	TotalAmount     float64          `json:"total_amount"`
+}
@@ -0,0 +1,276 @@
+package cart
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/services/product"
+)
+
+// MemoryCartRepository is a CartRepository keeping carts in a memory.DB
+type MemoryCartRepository struct {
+	mem *memory.DB
+}
+
+func NewMemoryCartRepository(mem *memory.DB) *MemoryCartRepository {
+	return &MemoryCartRepository{mem: mem}
+}
+
+// ------------CART-ITEM RELATED------------
+func (repo *MemoryCartRepository) addOrUpdateCartItem(cartID, productID, variantID, quantity int) error {
+	return repo.mem.Update(func() error {
+		variant, err := repo.findVariant(productID, variantID)
+		if err != nil {
+			return err
+		}
+
+		items := ItemsOf(repo.mem)
+		item, found := items.First(func(i CartItem) bool { return i.CartID == cartID && i.VariantID == variant.ID })
+
+		// reserve the stock for the whole line before touching the cart
+		err = repo.reserveStock(cartID, variant, item.Quantity+quantity)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if !found {
+			item = CartItem{ID: items.NextID(), CartID: cartID, ProductID: productID, VariantID: variant.ID, CreatedAt: now}
+		}
+		item.Quantity += quantity
+		item.UpdatedAt = now
+		items.Put(item.ID, item)
+		return nil
+	})
+}
+
+// get all products of the cart joined with their product and variant
+func (repo *MemoryCartRepository) getAllCartItem(cartID int) ([]CartItemDetail, error) {
+	details := make([]CartItemDetail, 0)
+	err := repo.mem.View(func() error {
+		products := product.ProductsOf(repo.mem)
+		variants := product.VariantsOf(repo.mem)
+		for _, item := range ItemsOf(repo.mem).Filter(func(i CartItem) bool { return i.CartID == cartID }) {
+			p, ok := products.Get(item.ProductID)
+			if !ok {
+				continue
+			}
+			variant, ok := variants.Get(item.VariantID)
+			if !ok {
+				continue
+			}
+			if variant.SKU == "" {
+				variant.SKU = p.SKU
+			}
+			details = append(details, CartItemDetail{
+				ProductID:    item.ProductID,
+				VariantID:    variant.ID,
+				SKU:          variant.SKU,
+				Variant:      variant.Attributes.String(),
+				ProductName:  p.ProductName,
+				PricePerUnit: variant.Price(p),
+				WeightGrams:  p.WeightGrams,
+				Quantity:     item.Quantity,
+			})
+		}
+		return nil
+	})
+	return details, err
+}
+
+// set an explicit quantity on an existing cart line
+func (repo *MemoryCartRepository) updateCartItemQuantity(cartID, productID, variantID, quantity int) error {
+	return repo.mem.Update(func() error {
+		variant, err := repo.findVariant(productID, variantID)
+		if err != nil {
+			return err
+		}
+
+		items := ItemsOf(repo.mem)
+		item, found := items.First(func(i CartItem) bool { return i.CartID == cartID && i.VariantID == variant.ID })
+		if !found {
+			return ErrCartItemNotFound
+		}
+
+		err = repo.reserveStock(cartID, variant, quantity)
+		if err != nil {
+			return err
+		}
+
+		item.Quantity = quantity
+		item.UpdatedAt = time.Now()
+		items.Put(item.ID, item)
+		return nil
+	})
+}
+
+// remove a single line from the cart and release its stock reservation
+func (repo *MemoryCartRepository) removeCartItem(cartID, productID, variantID int) error {
+	return repo.mem.Update(func() error {
+		variant, err := repo.findVariant(productID, variantID)
+		if err != nil {
+			return err
+		}
+
+		removed := ItemsOf(repo.mem).DeleteWhere(func(i CartItem) bool { return i.CartID == cartID && i.VariantID == variant.ID })
+		if removed == 0 {
+			return ErrCartItemNotFound
+		}
+
+		product.ReservationsOf(repo.mem).DeleteWhere(func(r product.StockReservation) bool {
+			return r.CartID == cartID && r.VariantID == variant.ID
+		})
+		return nil
+	})
+}
+
+// ------------CART RELATED------------
+func (repo *MemoryCartRepository) getCartByID(cartID int) (*Cart, error) {
+	cart, err := repo.findCart(func(c Cart) bool { return c.ID == cartID })
+	if err == nil && cart == nil {
+		return nil, fmt.Errorf("no cart found with cartID %d", cartID)
+	}
+	return cart, err
+}
+
+func (repo *MemoryCartRepository) getCartByUserID(userID int) (*Cart, error) {
+	cart, err := repo.findCart(func(c Cart) bool { return c.UserID == userID })
+	if err == nil && cart == nil {
+		return nil, fmt.Errorf("no cart found with userID %d", userID)
+	}
+	return cart, err
+}
+
+// getCouponCode returns the coupon applied to the cart, an empty string if there is none
+func (repo *MemoryCartRepository) getCouponCode(cartID int) (string, error) {
+	var code string
+	err := repo.mem.View(func() error {
+		cart, ok := CartsOf(repo.mem).Get(cartID)
+		if !ok {
+			return ErrCartNotFound
+		}
+		code = cart.CouponCode
+		return nil
+	})
+	return code, err
+}
+
+// setCouponCode applies a coupon to the cart, an empty code removes it
+func (repo *MemoryCartRepository) setCouponCode(cartID int, code string) error {
+	return repo.mem.Update(func() error {
+		cart, ok := CartsOf(repo.mem).Get(cartID)
+		if !ok {
+			return ErrCartNotFound
+		}
+		cart.CouponCode = code
+		cart.UpdatedAt = time.Now()
+		CartsOf(repo.mem).Put(cart.ID, cart)
+		return nil
+	})
+}
+
+// getRegion returns the region the cart ships to, an empty string if none was picked
+func (repo *MemoryCartRepository) getRegion(cartID int) (string, error) {
+	var region string
+	err := repo.mem.View(func() error {
+		cart, ok := CartsOf(repo.mem).Get(cartID)
+		if !ok {
+			return ErrCartNotFound
+		}
+		region = cart.Region
+		return nil
+	})
+	return region, err
+}
+
+// setRegion sets the region the cart ships to, an empty region goes back to the default one
+func (repo *MemoryCartRepository) setRegion(cartID int, region string) error {
+	return repo.mem.Update(func() error {
+		cart, ok := CartsOf(repo.mem).Get(cartID)
+		if !ok {
+			return ErrCartNotFound
+		}
+		cart.Region = region
+		cart.UpdatedAt = time.Now()
+		CartsOf(repo.mem).Put(cart.ID, cart)
+		return nil
+	})
+}
+
+// findCart returns the first cart matching keep along with its items, nil if there is none
+func (repo *MemoryCartRepository) findCart(keep func(Cart) bool) (*Cart, error) {
+	var cart *Cart
+	err := repo.mem.View(func() error {
+		found, ok := CartsOf(repo.mem).First(keep)
+		if !ok {
+			return nil
+		}
+		found.Items = ItemsOf(repo.mem).Filter(func(i CartItem) bool { return i.CartID == found.ID })
+		cart = &found
+		return nil
+	})
+	return cart, err
+}
+
+// ------------STOCK RESERVATION RELATED------------
+
+// findVariant is the in-memory counterpart of the MySQL lockVariant, the caller must hold the write lock
+func (repo *MemoryCartRepository) findVariant(productID, variantID int) (product.Variant, error) {
+	variant, ok := product.VariantsOf(repo.mem).First(func(v product.Variant) bool {
+		return v.ProductID == productID && (v.ID == variantID || variantID == 0 && v.IsDefault)
+	})
+	if !ok && variantID == 0 {
+		// every product has a default variant
+		return variant, ErrProductNotFound
+	} else if !ok {
+		return variant, ErrVariantNotFound
+	}
+	return variant, nil
+}
+
+// reserveStock is the in-memory counterpart of the MySQL reserveStock, the caller must hold the write lock
+func (repo *MemoryCartRepository) reserveStock(cartID int, variant product.Variant, quantity int) error {
+	now := time.Now()
+	reservations := product.ReservationsOf(repo.mem)
+
+	// drop expired reservations of this variant so the table doesn't grow unbounded
+	reservations.DeleteWhere(func(r product.StockReservation) bool {
+		return r.VariantID == variant.ID && !r.ExpiresAt.After(now)
+	})
+
+	reservedByOthers := 0
+	for _, r := range reservations.Filter(func(r product.StockReservation) bool {
+		return r.VariantID == variant.ID && r.CartID != cartID
+	}) {
+		reservedByOthers += r.Quantity
+	}
+
+	available := variant.StockQuantity - reservedByOthers
+	if quantity > available {
+		return ErrInsufficientStock.Withf("insufficient stock for product %d: requested %d, available %d", variant.ProductID, quantity, available)
+	}
+
+	reservation, found := reservations.First(func(r product.StockReservation) bool {
+		return r.CartID == cartID && r.VariantID == variant.ID
+	})
+	if !found {
+		reservation = product.StockReservation{ID: reservations.NextID(), CartID: cartID, ProductID: variant.ProductID, VariantID: variant.ID}
+	}
+	reservation.Quantity = quantity
+	reservation.ExpiresAt = now.Add(ReservationTTL)
+	reservations.Put(reservation.ID, reservation)
+	return nil
+}
+
+// functions for memory repositories outside cart pkg
+
+// CartsOf returns the carts table of an in-memory database
+func CartsOf(mem *memory.DB) *memory.Table[Cart] {
+	return memory.TableOf[Cart](mem, TABLE_NAME)
+}
+
+// ItemsOf returns the cart items table of an in-memory database
+func ItemsOf(mem *memory.DB) *memory.Table[CartItem] {
+	return memory.TableOf[CartItem](mem, CART_ITEMS_TABLE)
+}
@@ -1,201 +1,457 @@
-package cart
-
-import (
-	"context"
-	"database/sql"
-	"fmt"
-	"log"
-	"time"
-)
-
-const (
-	CART_ID    = "id"
-	TABLE_NAME = "carts"
-)
-
-type CartRepository struct {
-	db *sql.DB
-}
-
-func NewCartRepository(db *sql.DB) *CartRepository {
-	return &CartRepository{db: db}
-}
-
-// ------------CART-ITEM RELATED------------
-func (repo *CartRepository) addOrUpdateCartItem(cartID, productID, quantity int) error {
-	// Upsert query: Insert if the product doesn't exist in the cart, or update the quantity if it does
-	query := `
-		INSERT INTO cart_items (cart_id, product_id, quantity)
-		VALUES (?, ?, ?)
-		ON DUPLICATE KEY UPDATE quantity = quantity + VALUES(quantity), updated_at = CURRENT_TIMESTAMP
-	`
-	_, err := repo.db.Exec(query, cartID, productID, quantity)
-	if err != nil {
-		return fmt.Errorf("failed to add/update cart item: %v", err)
-	}
-	return nil
-}
-
-// get all products from cart_items JOIN products table
-func (repo *CartRepository) getAllCartItem() error {
-	return nil
-}
-
-// ------------CART RELATED------------
-func (repo *CartRepository) getCartByID(cartID int) (*Cart, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-	query := `
-        SELECT
-            c.ID AS cart_id,
-            c.UserID,
-            c.CreatedAt AS cart_created_at,
-            c.UpdatedAt AS cart_updated_at,
-            ci.ID AS item_id,
-            ci.CartID,
-            ci.ProductID,
-            ci.Quantity,
-            ci.CreatedAt AS item_created_at,
-            ci.UpdatedAt AS item_updated_at
-        FROM
-            carts c
-        LEFT JOIN
-            cart_items ci ON c.ID = ci.CartID
-        WHERE
-            c.ID = ?`
-
-	rows, err := repo.db.QueryContext(ctx, query, cartID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var cart Cart
-	var items []CartItem
-
-	for rows.Next() {
-		var cartID, userID, itemID, productID, quantity int
-		var cartCreatedAt, cartUpdatedAt, itemCreatedAt, itemUpdatedAt time.Time
-
-		err := rows.Scan(
-			&cartID,
-			&userID,
-			&cartCreatedAt,
-			&cartUpdatedAt,
-			&itemID,
-			&cartID,
-			&productID,
-			&quantity,
-			&itemCreatedAt,
-			&itemUpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		if cart.ID == 0 {
-			cart.ID = cartID
-			cart.UserID = userID
-			cart.CreatedAt = cartCreatedAt
-			cart.UpdatedAt = cartUpdatedAt
-		}
-
-		item := CartItem{
-			ID:        itemID,
-			CartID:    cartID,
-			ProductID: productID,
-			Quantity:  quantity,
-			CreatedAt: itemCreatedAt,
-			UpdatedAt: itemUpdatedAt,
-		}
-		items = append(items, item)
-	}
-
-	if len(items) > 0 {
-		cart.Items = items
-	} else {
-		return nil, fmt.Errorf("no cart found with cartID %d: %v", cartID, err)
-	}
-
-	log.Println("Cart data coming from database")
-	return &cart, nil
-}
-
-func (repo *CartRepository) getCartByUserID(userID int) (*Cart, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	query := `
-        SELECT
-            c.ID AS cart_id,
-            c.UserID,
-            c.CreatedAt AS cart_created_at,
-            c.UpdatedAt AS cart_updated_at,
-            ci.ID AS item_id,
-            ci.CartID,
-            ci.ProductID,
-            ci.Quantity,
-            ci.CreatedAt AS item_created_at,
-            ci.UpdatedAt AS item_updated_at
-        FROM
-            carts c
-        LEFT JOIN
-            cart_items ci ON c.ID = ci.CartID
-        WHERE
-            c.UserID = ?`
-
-	rows, err := repo.db.QueryContext(ctx, query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var cart Cart
-	var items []CartItem
-
-	for rows.Next() {
-		var cartID, userID, itemID, productID, quantity int
-		var cartCreatedAt, cartUpdatedAt, itemCreatedAt, itemUpdatedAt time.Time
-
-		err := rows.Scan(
-			&cartID,
-			&userID,
-			&cartCreatedAt,
-			&cartUpdatedAt,
-			&itemID,
-			&cartID,
-			&productID,
-			&quantity,
-			&itemCreatedAt,
-			&itemUpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		if cart.ID == 0 {
-			cart.ID = cartID
-			cart.UserID = userID
-			cart.CreatedAt = cartCreatedAt
-			cart.UpdatedAt = cartUpdatedAt
-		}
-
-		item := CartItem{
-			ID:        itemID,
-			CartID:    cartID,
-			ProductID: productID,
-			Quantity:  quantity,
-			CreatedAt: itemCreatedAt,
-			UpdatedAt: itemUpdatedAt,
-		}
-		items = append(items, item)
-	}
-	if len(items) > 0 {
-		cart.Items = items
-	} else {
-		return nil, fmt.Errorf("no cart found with userID %d: %v", userID, err) // No cart found or no items in the cart for the given user
-	}
-
-	log.Println("Cart data for user coming from database")
-	return &cart, nil
-}
+package cart
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/services/product"
+)
+
+const (
+	CART_ID          = "id"
+	TABLE_NAME       = "carts"
+	CART_ITEMS_TABLE = "cart_items"
+)
+
+// ReservationTTL is how long stock stays reserved for a cart after its last change
+const ReservationTTL = 15 * time.Minute
+
+var (
+	ErrCartItemNotFound  = response.New(http.StatusNotFound, "cart_item_not_found", "product not found in cart")
+	ErrProductNotFound   = response.New(http.StatusNotFound, "product_not_found", "product not found")
+	ErrVariantNotFound   = response.New(http.StatusNotFound, "variant_not_found", "variant not found")
+	ErrInsufficientStock = response.New(http.StatusConflict, "insufficient_stock", "insufficient stock")
+	ErrCartNotFound      = response.New(http.StatusBadRequest, "cart_not_found", "cart not found")
+)
+
+// CartRepository stores cart lines and the stock they reserve. MySQLCartRepository is the
+// production implementation, MemoryCartRepository keeps everything in process for demos and tests.
+// Cart lines are about a variant of a product, a variantID of 0 stands for the default variant.
+type CartRepository interface {
+	addOrUpdateCartItem(cartID, productID, variantID, quantity int) error
+	getAllCartItem(cartID int) ([]CartItemDetail, error)
+	updateCartItemQuantity(cartID, productID, variantID, quantity int) error
+	removeCartItem(cartID, productID, variantID int) error
+	getCartByID(cartID int) (*Cart, error)
+	getCartByUserID(userID int) (*Cart, error)
+	getCouponCode(cartID int) (string, error)
+	setCouponCode(cartID int, code string) error
+	getRegion(cartID int) (string, error)
+	setRegion(cartID int, region string) error
+}
+
+type MySQLCartRepository struct {
+	db *sql.DB
+}
+
+func NewMySQLCartRepository(db *sql.DB) *MySQLCartRepository {
+	return &MySQLCartRepository{db: db}
+}
+
+// ------------CART-ITEM RELATED------------
+func (repo *MySQLCartRepository) addOrUpdateCartItem(cartID, productID, variantID, quantity int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin cart transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	variantID, stockQuantity, err := lockVariant(ctx, tx, productID, variantID)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = tx.QueryRowContext(ctx, `SELECT quantity FROM cart_items WHERE cart_id = ? AND variant_id = ?`, cartID, variantID).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	// reserve the stock for the whole line before touching the cart
+	err = reserveStock(ctx, tx, cartID, productID, variantID, stockQuantity, current+quantity)
+	if err != nil {
+		return err
+	}
+
+	// Upsert query: Insert if the variant doesn't exist in the cart, or update the quantity if it does
+	query := `
+		INSERT INTO cart_items (cart_id, product_id, variant_id, quantity)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE quantity = quantity + VALUES(quantity), updated_at = CURRENT_TIMESTAMP
+	`
+	_, err = tx.ExecContext(ctx, query, cartID, productID, variantID, quantity)
+	if err != nil {
+		return fmt.Errorf("failed to add/update cart item: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// get all products from cart_items JOIN products and product_variants tables
+func (repo *MySQLCartRepository) getAllCartItem(cartID int) ([]CartItemDetail, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	query := `
+		SELECT
+			ci.product_id,
+			ci.variant_id,
+			COALESCE(NULLIF(v.sku, ''), p.sku),
+			v.attributes,
+			p.productName,
+			COALESCE(v.price_override, p.pricePerUnit),
+			p.weightGrams,
+			ci.quantity
+		FROM
+			cart_items ci
+		JOIN
+			products p ON p.productId = ci.product_id
+		JOIN
+			product_variants v ON v.id = ci.variant_id
+		WHERE
+			ci.cart_id = ?
+		ORDER BY
+			ci.created_at`
+
+	rows, err := repo.db.QueryContext(ctx, query, cartID)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]CartItemDetail, 0)
+	for rows.Next() {
+		var item CartItemDetail
+		var attributes product.Attributes
+		err := rows.Scan(
+			&item.ProductID,
+			&item.VariantID,
+			&item.SKU,
+			&attributes,
+			&item.ProductName,
+			&item.PricePerUnit,
+			&item.WeightGrams,
+			&item.Quantity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		item.Variant = attributes.String()
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// set an explicit quantity on an existing cart line
+func (repo *MySQLCartRepository) updateCartItemQuantity(cartID, productID, variantID, quantity int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin cart transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	variantID, stockQuantity, err := lockVariant(ctx, tx, productID, variantID)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = tx.QueryRowContext(ctx, `SELECT quantity FROM cart_items WHERE cart_id = ? AND variant_id = ? FOR UPDATE`, cartID, variantID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return ErrCartItemNotFound
+	} else if err != nil {
+		return err
+	}
+
+	err = reserveStock(ctx, tx, cartID, productID, variantID, stockQuantity, quantity)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE cart_items SET quantity = ?, updated_at = CURRENT_TIMESTAMP WHERE cart_id = ? AND variant_id = ?`
+	_, err = tx.ExecContext(ctx, query, quantity, cartID, variantID)
+	if err != nil {
+		return fmt.Errorf("failed to update cart item: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// remove a single line from the cart and release its stock reservation
+func (repo *MySQLCartRepository) removeCartItem(cartID, productID, variantID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin cart transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	variantID, _, err = lockVariant(ctx, tx, productID, variantID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM cart_items WHERE cart_id = ? AND variant_id = ?`, cartID, variantID)
+	if err != nil {
+		return fmt.Errorf("failed to remove cart item: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCartItemNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM stock_reservations WHERE cart_id = ? AND variant_id = ?`, cartID, variantID)
+	if err != nil {
+		return fmt.Errorf("failed to release stock reservation: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// ------------CART RELATED------------
+func (repo *MySQLCartRepository) getCartByID(cartID int) (*Cart, error) {
+	cart, err := repo.queryCart(`c.id = ?`, cartID)
+	if err != nil {
+		return nil, err
+	}
+	if cart == nil {
+		return nil, fmt.Errorf("no cart found with cartID %d", cartID)
+	}
+
+	log.Println("Cart data coming from database")
+	return cart, nil
+}
+
+func (repo *MySQLCartRepository) getCartByUserID(userID int) (*Cart, error) {
+	cart, err := repo.queryCart(`c.user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	if cart == nil {
+		return nil, fmt.Errorf("no cart found with userID %d", userID)
+	}
+
+	log.Println("Cart data for user coming from database")
+	return cart, nil
+}
+
+// getCouponCode returns the coupon applied to the cart, an empty string if there is none
+func (repo *MySQLCartRepository) getCouponCode(cartID int) (string, error) {
+	var code string
+	err := repo.db.QueryRow(`SELECT COALESCE(coupon_code, '') FROM carts WHERE id = ?`, cartID).Scan(&code)
+	if err == sql.ErrNoRows {
+		return "", ErrCartNotFound
+	} else if err != nil {
+		log.Println(err)
+		return "", err
+	}
+	return code, nil
+}
+
+// setCouponCode applies a coupon to the cart, an empty code removes it
+func (repo *MySQLCartRepository) setCouponCode(cartID int, code string) error {
+	result, err := repo.db.Exec(`UPDATE carts SET coupon_code = NULLIF(?, '') WHERE id = ?`, code, cartID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	// MySQL reports 0 affected rows when the code doesn't change, so only a missing cart is an error
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		if _, err := repo.getCouponCode(cartID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getRegion returns the region the cart ships to, an empty string if none was picked
+func (repo *MySQLCartRepository) getRegion(cartID int) (string, error) {
+	var region string
+	err := repo.db.QueryRow(`SELECT COALESCE(region, '') FROM carts WHERE id = ?`, cartID).Scan(&region)
+	if err == sql.ErrNoRows {
+		return "", ErrCartNotFound
+	} else if err != nil {
+		log.Println(err)
+		return "", err
+	}
+	return region, nil
+}
+
+// setRegion sets the region the cart ships to, an empty region goes back to the default one
+func (repo *MySQLCartRepository) setRegion(cartID int, region string) error {
+	result, err := repo.db.Exec(`UPDATE carts SET region = NULLIF(?, '') WHERE id = ?`, region, cartID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	// MySQL reports 0 affected rows when the region doesn't change, so only a missing cart is an error
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		if _, err := repo.getRegion(cartID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryCart loads the first cart matching the condition along with its items, nil if there is none
+func (repo *MySQLCartRepository) queryCart(condition string, args ...interface{}) (*Cart, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	query := `
+        SELECT
+            c.id,
+            c.user_id,
+            COALESCE(c.coupon_code, ''),
+            COALESCE(c.region, ''),
+            c.created_at,
+            c.updated_at,
+            ci.id,
+            ci.product_id,
+            ci.variant_id,
+            ci.quantity,
+            ci.created_at,
+            ci.updated_at
+        FROM
+            carts c
+        LEFT JOIN
+            cart_items ci ON c.id = ci.cart_id
+        WHERE
+            ` + condition + `
+        ORDER BY
+            c.id, ci.id`
+
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cart *Cart
+	for rows.Next() {
+		var current Cart
+		// item columns are NULL for a cart without items
+		var itemID, productID, variantID, quantity sql.NullInt64
+		var itemCreatedAt, itemUpdatedAt sql.NullTime
+
+		err := rows.Scan(
+			&current.ID,
+			&current.UserID,
+			&current.CouponCode,
+			&current.Region,
+			&current.CreatedAt,
+			&current.UpdatedAt,
+			&itemID,
+			&productID,
+			&variantID,
+			&quantity,
+			&itemCreatedAt,
+			&itemUpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if cart == nil {
+			cart = &current
+			cart.Items = make([]CartItem, 0)
+		} else if current.ID != cart.ID {
+			// a user with several carts: only the first one is returned
+			break
+		}
+
+		if itemID.Valid {
+			cart.Items = append(cart.Items, CartItem{
+				ID:        int(itemID.Int64),
+				CartID:    cart.ID,
+				ProductID: int(productID.Int64),
+				VariantID: int(variantID.Int64),
+				Quantity:  int(quantity.Int64),
+				CreatedAt: itemCreatedAt.Time,
+				UpdatedAt: itemUpdatedAt.Time,
+			})
+		}
+	}
+	return cart, rows.Err()
+}
+
+// ------------STOCK RESERVATION RELATED------------
+
+// lockVariant locks the variant of a product a cart line is about, its default variant when variantID is 0,
+// so concurrent carts are checked against the same stock. It returns the id and the stock of the variant.
+func lockVariant(ctx context.Context, tx *sql.Tx, productID, variantID int) (int, int, error) {
+	var stockQuantity int
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, stock_quantity
+		FROM product_variants
+		WHERE product_id = ? AND (id = ? OR ? = 0 AND is_default = 1)
+		FOR UPDATE`, productID, variantID, variantID).Scan(&variantID, &stockQuantity)
+	if err == sql.ErrNoRows && variantID == 0 {
+		// every product has a default variant
+		return 0, 0, ErrProductNotFound
+	} else if err == sql.ErrNoRows {
+		return 0, 0, ErrVariantNotFound
+	} else if err != nil {
+		return 0, 0, err
+	}
+	return variantID, stockQuantity, nil
+}
+
+// reserveStock sets the reservation of the cart for a variant to quantity units and extends its expiry.
+// The variant row must be locked by lockVariant, the reservation fails when the stock of the variant
+// left after other carts' active reservations is too low.
+func reserveStock(ctx context.Context, tx *sql.Tx, cartID, productID, variantID, stockQuantity, quantity int) error {
+	now := time.Now()
+
+	// drop expired reservations of this variant so the table doesn't grow unbounded
+	_, err := tx.ExecContext(ctx, `DELETE FROM stock_reservations WHERE variant_id = ? AND expires_at <= ?`, variantID, now)
+	if err != nil {
+		return fmt.Errorf("failed to clear expired reservations: %v", err)
+	}
+
+	var reservedByOthers int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(quantity), 0)
+		FROM stock_reservations
+		WHERE variant_id = ? AND cart_id <> ? AND expires_at > ?`,
+		variantID, cartID, now).Scan(&reservedByOthers)
+	if err != nil {
+		return err
+	}
+
+	available := stockQuantity - reservedByOthers
+	if quantity > available {
+		return ErrInsufficientStock.Withf("insufficient stock for product %d: requested %d, available %d", productID, quantity, available)
+	}
+
+	query := `
+		INSERT INTO stock_reservations (cart_id, product_id, variant_id, quantity, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE quantity = VALUES(quantity), expires_at = VALUES(expires_at)
+	`
+	_, err = tx.ExecContext(ctx, query, cartID, productID, variantID, quantity, now.Add(ReservationTTL))
+	if err != nil {
+		return fmt.Errorf("failed to reserve stock: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package cart
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ecommerce/database/databasetest"
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/services/product"
+)
+
+const (
+	concurrentShoppers = 20 // carts reserving a unit at the same time
+	unitsInStock       = 5  // units of the product they all reserve
+)
+
+// reservationFixture is a product with unitsInStock units in its only variant and an empty cart per shopper
+type reservationFixture struct {
+	repo       CartRepository
+	productID  int
+	shoppers   []databasetest.Buyer
+	reservedOf func() (reserved, carted int, err error)
+}
+
+func newMemoryReservationFixture(t *testing.T) reservationFixture {
+	mem := memory.New()
+	product.NewMemoryProductRepository(mem).Seed([]product.Product{
+		{ProductName: "Concurrency test", ProductBrand: "Test", PricePerUnit: 10, StockQuantity: unitsInStock},
+	})
+
+	var productID int
+	var shoppers []databasetest.Buyer
+	mem.Update(func() error {
+		p, _ := product.ProductsOf(mem).First(func(product.Product) bool { return true })
+		productID = p.ProductID
+		for userID := 1; userID <= concurrentShoppers; userID++ {
+			c := Cart{ID: CartsOf(mem).NextID(), UserID: userID}
+			CartsOf(mem).Put(c.ID, c)
+			shoppers = append(shoppers, databasetest.Buyer{UserID: userID, CartID: c.ID})
+		}
+		return nil
+	})
+
+	return reservationFixture{
+		repo:      NewMemoryCartRepository(mem),
+		productID: productID,
+		shoppers:  shoppers,
+		reservedOf: func() (int, int, error) {
+			var reserved, carted int
+			err := mem.View(func() error {
+				for _, r := range product.ReservationsOf(mem).Rows() {
+					reserved += r.Quantity
+				}
+				for _, i := range ItemsOf(mem).Rows() {
+					carted += i.Quantity
+				}
+				return nil
+			})
+			return reserved, carted, err
+		},
+	}
+}
+
+func newMySQLReservationFixture(t *testing.T) reservationFixture {
+	db := databasetest.Open(t)
+	stock := databasetest.InsertStock(t, db, unitsInStock, concurrentShoppers)
+
+	return reservationFixture{
+		repo:      NewMySQLCartRepository(db),
+		productID: stock.ProductID,
+		shoppers:  stock.Buyers,
+		reservedOf: func() (int, int, error) {
+			var reserved, carted int
+			err := db.QueryRow(`SELECT
+				(SELECT COALESCE(SUM(quantity), 0) FROM stock_reservations WHERE product_id = ? AND expires_at > NOW()),
+				(SELECT COALESCE(SUM(quantity), 0) FROM cart_items WHERE product_id = ?)`, stock.ProductID, stock.ProductID).Scan(&reserved, &carted)
+			return reserved, carted, err
+		},
+	}
+}
+
+func TestConcurrentReservationsMemory(t *testing.T) {
+	testConcurrentReservations(t, newMemoryReservationFixture(t))
+}
+
+func TestConcurrentReservationsMySQL(t *testing.T) {
+	testConcurrentReservations(t, newMySQLReservationFixture(t))
+}
+
+// testConcurrentReservations adds a unit of the product to every cart of the fixture at once:
+// exactly unitsInStock carts get one, the others fail for lack of stock and no more units than
+// the stock are ever reserved
+func testConcurrentReservations(t *testing.T, f reservationFixture) {
+	// watch the reservations while the carts fill
+	done := make(chan struct{})
+	watched := make(chan int)
+	go func() {
+		highest := 0
+		for {
+			select {
+			case <-done:
+				watched <- highest
+				return
+			default:
+			}
+			if reserved, _, err := f.reservedOf(); err == nil {
+				highest = max(highest, reserved)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(f.shoppers))
+	for i, s := range f.shoppers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = f.repo.addOrUpdateCartItem(s.CartID, f.productID, 0, 1)
+		}()
+	}
+	wg.Wait()
+	close(done)
+
+	added := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			added++
+		case errors.Is(err, ErrInsufficientStock):
+		default:
+			t.Errorf("adding to cart %d: %v", f.shoppers[i].CartID, err)
+		}
+	}
+	if added != unitsInStock {
+		t.Errorf("%d carts got a unit, want %d", added, unitsInStock)
+	}
+
+	if highest := <-watched; highest > unitsInStock {
+		t.Errorf("%d units reserved at once, only %d in stock", highest, unitsInStock)
+	}
+	reserved, carted, err := f.reservedOf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reserved != unitsInStock || carted != unitsInStock {
+		t.Errorf("%d units reserved and %d in carts, want %d", reserved, carted, unitsInStock)
+	}
+}
@@ -1,34 +1,236 @@
-package cart
-
-import (
-	"fmt"
-	"net/http"
-)
-
-// CartService handles business logic for product-related operations.
-type CartService struct {
-	Repo *CartRepository
-}
-
-// NewCartService creates a new CartService.
-func NewCartService(repo *CartRepository) *CartService {
-	return &CartService{
-		Repo: repo,
-	}
-}
-
-// AddOrUpdateCartItem adds a product to the cart or updates the quantity if it already exists in the cart.
-func (s *CartService) addOrUpdateCartItemService(cartID, productID, quantity int) (int, error) {
-	// Ensure the quantity is greater than zero
-	if quantity <= 0 {
-		return http.StatusBadRequest, fmt.Errorf("invalid quantity: must be greater than zero")
-	}
-
-	// Call the repository to perform the upsert
-	err := s.Repo.addOrUpdateCartItem(cartID, productID, quantity)
-	if err != nil {
-		return http.StatusBadRequest, fmt.Errorf("failed to add or update cart item: %v", err)
-	}
-
-	return http.StatusOK, nil
-}
+package cart
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/services/address"
+	"github.com/ecommerce/internal/services/pricing"
+	"github.com/ecommerce/internal/services/promotion"
+	"github.com/ecommerce/utils"
+)
+
+// ErrInvalidQuantity is returned when a cart line is given zero or fewer units
+var ErrInvalidQuantity = response.New(http.StatusBadRequest, "invalid_quantity", "invalid quantity: must be greater than zero")
+
+// errCouponRequired is returned when applying a coupon without a code
+var errCouponRequired = response.Validation(map[string]string{"code": "is required"})
+
+// errInvalidRegion is returned when a cart is given a region that isn't a region code
+var errInvalidRegion = response.Validation(map[string]string{"region": "must be a country code, optionally followed by a subdivision, e.g. US-CA"})
+
+// errRegionFromAddress is returned when picking a region for the cart of a user with a shipping address,
+// whose cart is quoted for the region of the address
+var errRegionFromAddress = response.New(http.StatusConflict, "region_from_address", "the cart is quoted for your shipping address, change the address to ship elsewhere")
+
+// regionPattern matches an ISO 3166 country code, optionally followed by a subdivision code
+var regionPattern = regexp.MustCompile(`^[A-Z]{2}(-[A-Z0-9]{1,3})?$`)
+
+// CartService handles business logic for product-related operations.
+type CartService struct {
+	Repo       CartRepository
+	Promotions *promotion.PromotionService
+	Pricing    *pricing.Pipeline
+	Addresses  *address.AddressService
+}
+
+// NewCartService creates a new CartService, promotions price the coupon applied to a cart
+// and the pricing pipeline quotes what checkout would charge for it, shipped to the default
+// shipping address of the user when they have one.
+func NewCartService(repo CartRepository, promotions *promotion.PromotionService, pipeline *pricing.Pipeline, addresses *address.AddressService) *CartService {
+	return &CartService{
+		Repo:       repo,
+		Promotions: promotions,
+		Pricing:    pipeline,
+		Addresses:  addresses,
+	}
+}
+
+// AddOrUpdateCartItem adds a variant of a product to the cart or updates the quantity if it already exists in the cart.
+// A variantID of 0 stands for the default variant of the product.
+func (s *CartService) addOrUpdateCartItemService(cartID, productID, variantID, quantity int) error {
+	// Ensure the quantity is greater than zero
+	if quantity <= 0 {
+		return ErrInvalidQuantity
+	}
+
+	// Call the repository to perform the upsert
+	err := s.Repo.addOrUpdateCartItem(cartID, productID, variantID, quantity)
+	if err != nil {
+		return fmt.Errorf("failed to add or update cart item: %w", err)
+	}
+
+	return nil
+}
+
+// getCartService returns the cart lines joined with their products along with line totals and the
+// quote of the cart: the discount the applied coupon gives the user, tax and shipping to its region.
+// The cart is quoted for the region of the address of the user with addressID, the one checkout is
+// given, or of their default shipping address when addressID is 0 and they have one.
+func (s *CartService) getCartService(cartID, userID, addressID int) (*CartView, error) {
+	items, err := s.Repo.getAllCartItem(cartID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch cart items: %w", err)
+	}
+
+	cart := &CartView{CartID: cartID, Items: items}
+	for i := range cart.Items {
+		cart.Items[i].LineTotal = utils.RoundAmount(cart.Items[i].PricePerUnit * float64(cart.Items[i].Quantity))
+		cart.TotalItems += cart.Items[i].Quantity
+	}
+
+	cart.Region, err = s.Repo.getRegion(cartID)
+	if err != nil {
+		return nil, err
+	}
+	if addressID != 0 {
+		cart.ShippingAddress, err = s.Addresses.Address(userID, addressID)
+	} else {
+		cart.ShippingAddress, err = s.Addresses.DefaultShipping(userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case cart.ShippingAddress != nil:
+		cart.Region, err = cart.ShippingAddress.PricingRegion()
+		if err != nil {
+			return nil, err
+		}
+		cart.RegionSource = RegionFromAddress
+	case cart.Region != "":
+		cart.RegionSource = RegionChosen
+	default:
+		cart.RegionSource = RegionDefault
+	}
+	cart.CouponCode, err = s.Repo.getCouponCode(cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	input := pricing.Input{Lines: pricingLines(cart.Items), Region: cart.Region}
+	if cart.CouponCode != "" {
+		input.Offer, err = s.Promotions.Offer(cart.CouponCode, userID)
+		if cart.CouponError, err = couponError(err); err != nil {
+			return nil, err
+		}
+	}
+
+	quote, err := s.Pricing.Quote(input)
+	if err != nil && input.Offer != nil {
+		if cart.CouponError, err = couponError(err); err != nil {
+			return nil, err
+		}
+		input.Offer = nil
+		quote, err = s.Pricing.Quote(input)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cart.Quote = quote
+	cart.Region = quote.Region
+	cart.TotalAmount = quote.GrandTotal
+	return cart, nil
+}
+
+// setRegionService sets the region the cart is quoted for, which its tax and shipping depend on, until the
+// user adds a shipping address. An empty region goes back to the default one.
+func (s *CartService) setRegionService(cartID, userID int, region string) (*CartView, error) {
+	region = pricing.NormalizeRegion(region)
+	if region != "" && !regionPattern.MatchString(region) {
+		return nil, errInvalidRegion
+	}
+
+	shipping, err := s.Addresses.DefaultShipping(userID)
+	if err != nil {
+		return nil, err
+	}
+	if shipping != nil {
+		return nil, errRegionFromAddress
+	}
+
+	if err := s.Repo.setRegion(cartID, region); err != nil {
+		return nil, err
+	}
+	return s.getCartService(cartID, userID, 0)
+}
+
+// applyCouponService applies a coupon to the cart if it gives the user a discount on the cart as it is,
+// replacing the coupon applied before. Checkout redeems it.
+func (s *CartService) applyCouponService(cartID, userID int, code string) (*CartView, error) {
+	code = promotion.NormalizeCode(code)
+	if code == "" {
+		return nil, errCouponRequired
+	}
+
+	items, err := s.Repo.getAllCartItem(cartID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch cart items: %w", err)
+	}
+	if _, err := s.Promotions.Preview(code, userID, promotionLines(items)); err != nil {
+		return nil, err
+	}
+
+	if err := s.Repo.setCouponCode(cartID, code); err != nil {
+		return nil, err
+	}
+	return s.getCartService(cartID, userID, 0)
+}
+
+// removeCouponService removes the coupon applied to the cart, if any
+func (s *CartService) removeCouponService(cartID, userID int) (*CartView, error) {
+	if err := s.Repo.setCouponCode(cartID, ""); err != nil {
+		return nil, err
+	}
+	return s.getCartService(cartID, userID, 0)
+}
+
+// updateCartItemService sets the quantity of a variant that is already in the cart.
+func (s *CartService) updateCartItemService(cartID, productID, variantID, quantity int) error {
+	if quantity <= 0 {
+		return ErrInvalidQuantity
+	}
+
+	return s.Repo.updateCartItemQuantity(cartID, productID, variantID, quantity)
+}
+
+// removeCartItemService removes a variant of a product from the cart.
+func (s *CartService) removeCartItemService(cartID, productID, variantID int) error {
+	return s.Repo.removeCartItem(cartID, productID, variantID)
+}
+
+// helper functions
+
+// promotionLines returns the cart lines a promotion is evaluated against
+func promotionLines(items []CartItemDetail) []promotion.Line {
+	lines := make([]promotion.Line, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, promotion.Line{ProductID: item.ProductID, Quantity: item.Quantity, UnitPrice: item.PricePerUnit})
+	}
+	return lines
+}
+
+// pricingLines returns the cart lines the pricing pipeline quotes
+func pricingLines(items []CartItemDetail) []pricing.Line {
+	lines := make([]pricing.Line, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, pricing.Line{ProductID: item.ProductID, Quantity: item.Quantity, UnitPrice: item.PricePerUnit, WeightGrams: item.WeightGrams})
+	}
+	return lines
+}
+
+// couponError returns why the coupon of a cart gives no discount. A coupon that doesn't apply stays on
+// the cart as it may apply again once the cart changes, err is only returned when it isn't about the coupon.
+func couponError(err error) (string, error) {
+	if err == nil {
+		return "", nil
+	}
+	appErr := response.From(err)
+	if appErr.Status >= http.StatusInternalServerError {
+		return "", err
+	}
+	return appErr.Message, nil
+}
@@ -0,0 +1,193 @@
+package category
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/ecommerce/internal/core/middleware"
+	"github.com/ecommerce/internal/core/response"
+	"github.com/gorilla/mux"
+)
+
+const (
+	categoriesBasePath = "categories"
+	apiBasePath        = "api"
+)
+
+var (
+	errCategoryIDSet      = response.BadRequest("id must not be set when adding a category")
+	errCategoryIDMismatch = response.BadRequest("id of the payload doesn't match the URL")
+)
+
+// SetupRoutes :
+func SetupCategoryRoutes(r *mux.Router, s *CategoryService) {
+	apiUrlPath := fmt.Sprintf("/%s/%s", apiBasePath, categoriesBasePath)
+	categoryRouter := r.PathPrefix(apiUrlPath).Subrouter()
+
+	// every logged in user can browse the taxonomy, only admins can change it
+	writeMethods := []string{http.MethodPost, http.MethodPut, http.MethodDelete}
+
+	categoryRouter.HandleFunc("", middleware.RequireRole(middleware.RoleAdmin, categoriesHandler(s), writeMethods...))
+	categoryRouter.HandleFunc("/tree", categoryTreeHandler(s))
+	categoryRouter.HandleFunc("/{id}", middleware.RequireRole(middleware.RoleAdmin, categoryHandler(s), writeMethods...))
+	categoryRouter.HandleFunc("/{id}/path", categoryPathHandler(s))
+}
+
+func categoriesHandler(s *CategoryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			categories, err := s.getCategoriesService()
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, categories)
+			return
+		case http.MethodPost:
+			var newCategory Category
+			err := json.NewDecoder(r.Body).Decode(&newCategory)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if newCategory.ID != 0 {
+				log.Println(errCategoryIDSet)
+				response.WriteError(w, errCategoryIDSet)
+				return
+			}
+
+			newCategory.ID, err = s.addCategoryService(newCategory)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			response.JSON(w, http.StatusCreated, newCategory)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// categoryTreeHandler returns the root categories with their nested subcategories
+func categoryTreeHandler(s *CategoryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			tree, err := s.Tree()
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, tree)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func categoryHandler(s *CategoryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		categoryID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, ErrCategoryNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			category, err := s.getCategoryService(categoryID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, category)
+			return
+		case http.MethodPut:
+			// rename the category or move it under another parent
+			var updatedCategory Category
+			err := json.NewDecoder(r.Body).Decode(&updatedCategory)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if updatedCategory.ID != categoryID {
+				log.Println(errCategoryIDMismatch)
+				response.WriteError(w, errCategoryIDMismatch)
+				return
+			}
+
+			err = s.updateCategoryService(updatedCategory)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			response.JSON(w, http.StatusOK, updatedCategory)
+			return
+		case http.MethodDelete:
+			err := s.removeCategoryService(categoryID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// categoryPathHandler returns a category along with its ancestors, from the root down
+func categoryPathHandler(s *CategoryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			categoryID, err := strconv.Atoi(mux.Vars(r)["id"])
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, ErrCategoryNotFound)
+				return
+			}
+
+			path, err := s.Path(categoryID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, path)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package category
+
+import "sort"
+
+// Category is a node of the catalog taxonomy. Root categories have a ParentID of 0,
+// names are unique among the children of a parent.
+type Category struct {
+	ID       int    `json:"id"`
+	ParentID int    `json:"parentId" validate:"min=0"`
+	Name     string `json:"name" validate:"required,max=100"`
+}
+
+// CategoryNode is a category along with its subcategories
+type CategoryNode struct {
+	Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// ProductCategory links a product to one of its categories
+type ProductCategory struct {
+	ID         int `json:"id"`
+	ProductID  int `json:"product_id"`
+	CategoryID int `json:"category_id"`
+}
+
+// tree indexes a flat list of categories by id and by parent
+type tree struct {
+	byID     map[int]Category
+	children map[int][]Category // parent id -> subcategories ordered by name, 0 for the roots
+}
+
+// newTree indexes categories, subcategories are ordered by name
+func newTree(categories []Category) *tree {
+	t := &tree{byID: make(map[int]Category, len(categories)), children: make(map[int][]Category)}
+	for _, category := range categories {
+		t.byID[category.ID] = category
+		t.children[category.ParentID] = append(t.children[category.ParentID], category)
+	}
+	for _, children := range t.children {
+		sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	}
+	return t
+}
+
+// nodes returns the subtrees of the children of parentID, the whole tree for 0
+func (t *tree) nodes(parentID int) []*CategoryNode {
+	nodes := make([]*CategoryNode, 0, len(t.children[parentID]))
+	for _, child := range t.children[parentID] {
+		nodes = append(nodes, &CategoryNode{Category: child, Children: t.nodes(child.ID)})
+	}
+	return nodes
+}
+
+// subtree returns the id of a category followed by the ids of all its descendants
+func (t *tree) subtree(categoryID int) []int {
+	ids := []int{categoryID}
+	for _, child := range t.children[categoryID] {
+		ids = append(ids, t.subtree(child.ID)...)
+	}
+	return ids
+}
+
+// path returns the ancestors of a category from its root down to the category itself
+func (t *tree) path(categoryID int) []Category {
+	var path []Category
+	// the length check stops on a cycle, which the service never lets in
+	for category, ok := t.byID[categoryID]; ok && len(path) <= len(t.byID); category, ok = t.byID[category.ParentID] {
+		path = append([]Category{category}, path...)
+	}
+	return path
+}
@@ -0,0 +1,192 @@
+package category
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/ecommerce/database/memory"
+)
+
+// MemoryCategoryRepository is a CategoryRepository keeping categories in a memory.DB
+type MemoryCategoryRepository struct {
+	mem *memory.DB
+}
+
+func NewMemoryCategoryRepository(mem *memory.DB) *MemoryCategoryRepository {
+	return &MemoryCategoryRepository{mem: mem}
+}
+
+// getCategories returns every category, ordered by name
+func (repo *MemoryCategoryRepository) getCategories() ([]Category, error) {
+	var categories []Category
+	err := repo.mem.View(func() error {
+		categories = repo.categories().Rows()
+		return nil
+	})
+	sortByName(categories)
+	return categories, err
+}
+
+func (repo *MemoryCategoryRepository) getCategory(categoryID int) (*Category, error) {
+	var category *Category
+	err := repo.mem.View(func() error {
+		if found, ok := repo.categories().Get(categoryID); ok {
+			category = &found
+		}
+		return nil
+	})
+	return category, err
+}
+
+func (repo *MemoryCategoryRepository) addCategory(category Category) (int, error) {
+	err := repo.mem.Update(func() error {
+		if repo.nameTaken(category) {
+			return ErrCategoryNameTaken
+		}
+		category.ID = repo.categories().NextID()
+		repo.categories().Put(category.ID, category)
+		return nil
+	})
+	return category.ID, err
+}
+
+func (repo *MemoryCategoryRepository) updateCategory(category Category) error {
+	return repo.mem.Update(func() error {
+		if _, ok := repo.categories().Get(category.ID); !ok {
+			return ErrCategoryNotFound
+		}
+		if repo.nameTaken(category) {
+			return ErrCategoryNameTaken
+		}
+		repo.categories().Put(category.ID, category)
+		return nil
+	})
+}
+
+// removeCategory deletes a category along with its product links
+func (repo *MemoryCategoryRepository) removeCategory(categoryID int) error {
+	return repo.mem.Update(func() error {
+		if _, hasChildren := repo.categories().First(func(c Category) bool { return c.ParentID == categoryID }); hasChildren {
+			return ErrCategoryNotEmpty
+		}
+		repo.categories().Delete(categoryID)
+		LinksOf(repo.mem).DeleteWhere(func(l ProductCategory) bool { return l.CategoryID == categoryID })
+		return nil
+	})
+}
+
+// getProductCategories returns the categories a product is in, ordered by name
+func (repo *MemoryCategoryRepository) getProductCategories(productID int) ([]Category, error) {
+	categories := make([]Category, 0)
+	err := repo.mem.View(func() error {
+		for _, link := range LinksOf(repo.mem).Filter(func(l ProductCategory) bool { return l.ProductID == productID }) {
+			if category, ok := repo.categories().Get(link.CategoryID); ok {
+				categories = append(categories, category)
+			}
+		}
+		return nil
+	})
+	sortByName(categories)
+	return categories, err
+}
+
+func (repo *MemoryCategoryRepository) setProductCategories(productID int, categoryIDs []int) error {
+	return repo.mem.Update(func() error {
+		links := LinksOf(repo.mem)
+		links.DeleteWhere(func(l ProductCategory) bool { return l.ProductID == productID })
+		for _, categoryID := range categoryIDs {
+			link := ProductCategory{ID: links.NextID(), ProductID: productID, CategoryID: categoryID}
+			links.Put(link.ID, link)
+		}
+		return nil
+	})
+}
+
+// getProductIDs returns the ids of the products in any of the given categories
+func (repo *MemoryCategoryRepository) getProductIDs(categoryIDs []int) ([]int, error) {
+	productIDs := make([]int, 0)
+	err := repo.mem.View(func() error {
+		productIDs = ProductIDsOf(repo.mem, categoryIDs)
+		return nil
+	})
+	return productIDs, err
+}
+
+// nameTaken reports whether a sibling of category already has its name, the categories table has a unique key on it
+func (repo *MemoryCategoryRepository) nameTaken(category Category) bool {
+	_, taken := repo.categories().First(func(c Category) bool {
+		return c.ParentID == category.ParentID && c.Name == category.Name && c.ID != category.ID
+	})
+	return taken
+}
+
+func (repo *MemoryCategoryRepository) categories() *memory.Table[Category] {
+	return memory.TableOf[Category](repo.mem, TABLE_NAME)
+}
+
+// Seed adds the given categories with their ids, then puts products in them, e.g. DemoCategories
+// and DemoProductCategories so the in-memory storefront can be browsed by category
+func (repo *MemoryCategoryRepository) Seed(categories []Category, productCategories map[int][]int) {
+	repo.mem.Update(func() error {
+		for _, category := range categories {
+			repo.categories().Put(category.ID, category)
+		}
+		return nil
+	})
+	for productID, categoryIDs := range productCategories {
+		repo.setProductCategories(productID, categoryIDs)
+	}
+}
+
+// DemoCategories is the taxonomy of the in-memory storefront
+var DemoCategories = []Category{
+	{ID: 1, Name: "Electronics"},
+	{ID: 2, ParentID: 1, Name: "Phones"},
+	{ID: 3, ParentID: 1, Name: "Computers"},
+	{ID: 4, ParentID: 3, Name: "Laptops"},
+	{ID: 5, Name: "Accessories"},
+	{ID: 6, ParentID: 5, Name: "Audio"},
+	{ID: 7, ParentID: 5, Name: "Peripherals"},
+}
+
+// DemoProductCategories puts the product.DemoProducts, which are seeded with ids 1 to 6, in DemoCategories
+var DemoProductCategories = map[int][]int{
+	1: {2},
+	2: {2},
+	3: {4},
+	4: {6},
+	5: {7},
+	6: {7},
+}
+
+// helper functions
+
+// sortByName orders categories by name, then id, like the MySQL repository
+func sortByName(categories []Category) {
+	sort.SliceStable(categories, func(i, j int) bool {
+		if categories[i].Name != categories[j].Name {
+			return categories[i].Name < categories[j].Name
+		}
+		return categories[i].ID < categories[j].ID
+	})
+}
+
+// functions for memory repositories outside category pkg
+
+// LinksOf returns the product categories table of an in-memory database
+func LinksOf(mem *memory.DB) *memory.Table[ProductCategory] {
+	return memory.TableOf[ProductCategory](mem, PRODUCT_CATEGORIES_TABLE)
+}
+
+// ProductIDsOf returns the ids of the products in any of the given categories, in ascending order.
+// The caller must hold a lock of the database.
+func ProductIDsOf(mem *memory.DB, categoryIDs []int) []int {
+	productIDs := make([]int, 0)
+	for _, link := range LinksOf(mem).Filter(func(l ProductCategory) bool { return slices.Contains(categoryIDs, l.CategoryID) }) {
+		if !slices.Contains(productIDs, link.ProductID) {
+			productIDs = append(productIDs, link.ProductID)
+		}
+	}
+	sort.Ints(productIDs)
+	return productIDs
+}
@@ -0,0 +1,208 @@
+package category
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/utils"
+)
+
+const (
+	TABLE_NAME               = "categories"
+	PRODUCT_CATEGORIES_TABLE = "product_categories"
+)
+
+var (
+	ErrCategoryNotFound  = response.New(http.StatusNotFound, "category_not_found", "no category found")
+	ErrCategoryNameTaken = response.New(http.StatusConflict, "category_name_taken", "a category with this name already exists under the same parent")
+	ErrCategoryCycle     = response.New(http.StatusConflict, "category_cycle", "a category cannot be moved under itself or one of its subcategories")
+	ErrCategoryNotEmpty  = response.New(http.StatusConflict, "category_not_empty", "the category has subcategories, move or remove them first")
+)
+
+// CategoryRepository stores categories and the categories of products. MySQLCategoryRepository is the
+// production implementation, MemoryCategoryRepository keeps everything in process for demos and tests.
+type CategoryRepository interface {
+	getCategories() ([]Category, error)
+	getCategory(categoryID int) (*Category, error)
+	addCategory(category Category) (int, error)
+	updateCategory(category Category) error
+	removeCategory(categoryID int) error
+	getProductCategories(productID int) ([]Category, error)
+	setProductCategories(productID int, categoryIDs []int) error
+	getProductIDs(categoryIDs []int) ([]int, error)
+}
+
+type MySQLCategoryRepository struct {
+	db *sql.DB
+}
+
+func NewMySQLCategoryRepository(db *sql.DB) *MySQLCategoryRepository {
+	return &MySQLCategoryRepository{db: db}
+}
+
+// getCategories returns every category, ordered by name
+func (repo *MySQLCategoryRepository) getCategories() ([]Category, error) {
+	rows, err := repo.db.Query(`SELECT id, COALESCE(parent_id, 0), name FROM categories ORDER BY name, id`)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	return scanCategories(rows)
+}
+
+func (repo *MySQLCategoryRepository) getCategory(categoryID int) (*Category, error) {
+	category := &Category{}
+	row := repo.db.QueryRow(`SELECT id, COALESCE(parent_id, 0), name FROM categories WHERE id = ?`, categoryID)
+	err := row.Scan(&category.ID, &category.ParentID, &category.Name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return category, nil
+}
+
+func (repo *MySQLCategoryRepository) addCategory(category Category) (int, error) {
+	result, err := repo.db.Exec(`INSERT INTO categories (parent_id, name) VALUES (NULLIF(?, 0), ?)`, category.ParentID, category.Name)
+	if utils.IsDuplicateEntry(err) {
+		return 0, ErrCategoryNameTaken
+	} else if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	insertID, err := result.LastInsertId()
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	return int(insertID), nil
+}
+
+func (repo *MySQLCategoryRepository) updateCategory(category Category) error {
+	_, err := repo.db.Exec(`UPDATE categories SET parent_id = NULLIF(?, 0), name = ? WHERE id = ?`, category.ParentID, category.Name, category.ID)
+	if utils.IsDuplicateEntry(err) {
+		return ErrCategoryNameTaken
+	} else if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+// removeCategory deletes a category, its product links go with it. The parent_id foreign key
+// refuses to delete a category that still has subcategories.
+func (repo *MySQLCategoryRepository) removeCategory(categoryID int) error {
+	_, err := repo.db.Exec(`DELETE FROM categories WHERE id = ?`, categoryID)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+// getProductCategories returns the categories a product is in, ordered by name
+func (repo *MySQLCategoryRepository) getProductCategories(productID int) ([]Category, error) {
+	rows, err := repo.db.Query(`
+		SELECT
+			c.id,
+			COALESCE(c.parent_id, 0),
+			c.name
+		FROM
+			product_categories pc
+		JOIN
+			categories c ON c.id = pc.category_id
+		WHERE
+			pc.product_id = ?
+		ORDER BY
+			c.name, c.id`, productID)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	return scanCategories(rows)
+}
+
+// setProductCategories replaces the categories of a product in a single transaction
+func (repo *MySQLCategoryRepository) setProductCategories(productID int, categoryIDs []int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin product categories transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM product_categories WHERE product_id = ?`, productID)
+	if err != nil {
+		return fmt.Errorf("failed to clear categories of product %d: %v", productID, err)
+	}
+
+	for _, categoryID := range categoryIDs {
+		_, err = tx.ExecContext(ctx, `INSERT INTO product_categories (product_id, category_id) VALUES (?, ?)`, productID, categoryID)
+		if err != nil {
+			return fmt.Errorf("failed to add product %d to category %d: %v", productID, categoryID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit product categories: %v", err)
+	}
+	return nil
+}
+
+// getProductIDs returns the ids of the products in any of the given categories
+func (repo *MySQLCategoryRepository) getProductIDs(categoryIDs []int) ([]int, error) {
+	productIDs := make([]int, 0)
+	if len(categoryIDs) == 0 {
+		return productIDs, nil
+	}
+
+	placeholders := make([]string, len(categoryIDs))
+	args := make([]interface{}, len(categoryIDs))
+	for i, categoryID := range categoryIDs {
+		placeholders[i] = "?"
+		args[i] = categoryID
+	}
+	query := fmt.Sprintf(`SELECT DISTINCT product_id FROM product_categories WHERE category_id IN (%s) ORDER BY product_id`, strings.Join(placeholders, ", "))
+
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int
+		if err := rows.Scan(&productID); err != nil {
+			return nil, err
+		}
+		productIDs = append(productIDs, productID)
+	}
+	return productIDs, rows.Err()
+}
+
+// helper functions
+
+// scanCategories reads id, parent id and name rows and closes them
+func scanCategories(rows *sql.Rows) ([]Category, error) {
+	defer rows.Close()
+
+	categories := make([]Category, 0)
+	for rows.Next() {
+		var category Category
+		if err := rows.Scan(&category.ID, &category.ParentID, &category.Name); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
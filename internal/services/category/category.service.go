@@ -0,0 +1,203 @@
+package category
+
+import (
+	"log"
+	"slices"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/utils"
+)
+
+// CategoryService handles business logic for category-related operations.
+type CategoryService struct {
+	Repo CategoryRepository
+}
+
+// NewCategoryService creates a new CategoryService.
+func NewCategoryService(repo CategoryRepository) *CategoryService {
+	return &CategoryService{
+		Repo: repo,
+	}
+}
+
+func (s *CategoryService) getCategoriesService() ([]Category, error) {
+	categories, err := s.Repo.getCategories()
+	if err != nil {
+		log.Printf("Error fetching categories: %v", err)
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+func (s *CategoryService) getCategoryService(categoryID int) (*Category, error) {
+	category, err := s.Repo.getCategory(categoryID)
+	if err != nil {
+		return nil, err
+	}
+	if category == nil {
+		return nil, ErrCategoryNotFound
+	}
+
+	return category, nil
+}
+
+// addCategoryService stores a valid category under an existing parent and returns its new ID
+func (s *CategoryService) addCategoryService(newCategory Category) (int, error) {
+	if fields := utils.Validate(newCategory); fields != nil {
+		return 0, response.Validation(fields)
+	}
+	if newCategory.ParentID != 0 {
+		parent, err := s.Repo.getCategory(newCategory.ParentID)
+		if err != nil {
+			return 0, err
+		}
+		if parent == nil {
+			return 0, ErrCategoryNotFound.Withf("parent category %d not found", newCategory.ParentID)
+		}
+	}
+
+	categoryID, err := s.Repo.addCategory(newCategory)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return categoryID, nil
+}
+
+// updateCategoryService renames a category or moves it under another parent,
+// which can't be the category itself or one of its subcategories
+func (s *CategoryService) updateCategoryService(updatedCategory Category) error {
+	if fields := utils.Validate(updatedCategory); fields != nil {
+		return response.Validation(fields)
+	}
+
+	t, err := s.loadTree()
+	if err != nil {
+		return err
+	}
+	if _, ok := t.byID[updatedCategory.ID]; !ok {
+		return ErrCategoryNotFound
+	}
+	if updatedCategory.ParentID != 0 {
+		if _, ok := t.byID[updatedCategory.ParentID]; !ok {
+			return ErrCategoryNotFound.Withf("parent category %d not found", updatedCategory.ParentID)
+		}
+		if slices.Contains(t.subtree(updatedCategory.ID), updatedCategory.ParentID) {
+			return ErrCategoryCycle
+		}
+	}
+
+	err = s.Repo.updateCategory(updatedCategory)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// removeCategoryService deletes a category without subcategories, its products stay in their other categories
+func (s *CategoryService) removeCategoryService(categoryID int) error {
+	t, err := s.loadTree()
+	if err != nil {
+		return err
+	}
+	if _, ok := t.byID[categoryID]; !ok {
+		return ErrCategoryNotFound
+	}
+	if len(t.children[categoryID]) > 0 {
+		return ErrCategoryNotEmpty
+	}
+
+	return s.Repo.removeCategory(categoryID)
+}
+
+// Tree returns the root categories with their subcategories, every level ordered by name
+func (s *CategoryService) Tree() ([]*CategoryNode, error) {
+	t, err := s.loadTree()
+	if err != nil {
+		return nil, err
+	}
+	return t.nodes(0), nil
+}
+
+// Subtree returns the id of a category followed by the ids of all its descendants
+func (s *CategoryService) Subtree(categoryID int) ([]int, error) {
+	t, err := s.loadTree()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := t.byID[categoryID]; !ok {
+		return nil, ErrCategoryNotFound.Withf("category %d not found", categoryID)
+	}
+	return t.subtree(categoryID), nil
+}
+
+// Path returns a category along with its ancestors, from the root down, for breadcrumbs
+func (s *CategoryService) Path(categoryID int) ([]Category, error) {
+	t, err := s.loadTree()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := t.byID[categoryID]; !ok {
+		return nil, ErrCategoryNotFound.Withf("category %d not found", categoryID)
+	}
+	return t.path(categoryID), nil
+}
+
+// ProductIDs returns the ids of the products in any of the given categories
+func (s *CategoryService) ProductIDs(categoryIDs []int) ([]int, error) {
+	productIDs, err := s.Repo.getProductIDs(categoryIDs)
+	if err != nil {
+		log.Printf("Error fetching products of categories %v: %v", categoryIDs, err)
+		return nil, err
+	}
+	return productIDs, nil
+}
+
+// ProductCategories returns the categories a product is in, ordered by name
+func (s *CategoryService) ProductCategories(productID int) ([]Category, error) {
+	categories, err := s.Repo.getProductCategories(productID)
+	if err != nil {
+		log.Printf("Error fetching categories of product %d: %v", productID, err)
+		return nil, err
+	}
+	return categories, nil
+}
+
+// SetProductCategories replaces the categories of a product, which must all exist, and returns them.
+// The caller checks that the product exists.
+func (s *CategoryService) SetProductCategories(productID int, categoryIDs []int) ([]Category, error) {
+	t, err := s.loadTree()
+	if err != nil {
+		return nil, err
+	}
+
+	unique := make([]int, 0, len(categoryIDs))
+	for _, categoryID := range categoryIDs {
+		if _, ok := t.byID[categoryID]; !ok {
+			return nil, ErrCategoryNotFound.Withf("category %d not found", categoryID)
+		}
+		if !slices.Contains(unique, categoryID) {
+			unique = append(unique, categoryID)
+		}
+	}
+
+	err = s.Repo.setProductCategories(productID, unique)
+	if err != nil {
+		log.Printf("Error setting categories of product %d: %v", productID, err)
+		return nil, err
+	}
+	return s.ProductCategories(productID)
+}
+
+// helper functions
+
+// loadTree loads every category, the taxonomy is small enough to be walked in memory
+func (s *CategoryService) loadTree() (*tree, error) {
+	categories, err := s.getCategoriesService()
+	if err != nil {
+		return nil, err
+	}
+	return newTree(categories), nil
+}
@@ -0,0 +1,389 @@
+package order
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/ecommerce/internal/core/middleware"
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/core/session"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	ordersBasePath = "orders"
+	prodBasePath   = "prod"
+	apiBasePath    = "api"
+)
+
+var errAuthRequired = response.Unauthorized("authentication required")
+
+// SetupRoutes :
+func SetupOrderRoutes(r *mux.Router, s *OrderService) {
+	apiUrlPath := fmt.Sprintf("/%s/%s", apiBasePath, ordersBasePath)
+	orderRouter := r.PathPrefix(apiUrlPath).Subrouter()
+
+	orderRouter.HandleFunc("", ordersHandler(s))
+	orderRouter.HandleFunc("/checkout", checkoutHandler(s))
+	orderRouter.HandleFunc("/{id}", orderHandler(s))
+	orderRouter.HandleFunc("/{id}/status", middleware.RequireRole(middleware.RoleAdmin, orderStatusHandler(s)))
+	orderRouter.HandleFunc("/{id}/timeline", orderTimelineHandler(s))
+
+	// -------------------------PROD----------------------
+	prodUrlPath := fmt.Sprintf("/%s/%s", prodBasePath, ordersBasePath)
+	prodOrderRouter := r.PathPrefix(prodUrlPath).Subrouter()
+
+	prodOrderRouter.HandleFunc("", ordersProdHandler(s)).Methods(http.MethodGet)
+	prodOrderRouter.HandleFunc("/checkout", checkoutProdHandler(s))
+	prodOrderRouter.HandleFunc("/{id}", orderProdHandler(s)).Methods(http.MethodGet)
+}
+
+// ordersProdHandler renders the order history of the user
+func ordersProdHandler(s *OrderService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := session.GetUserFromContext(r)
+		if err != nil {
+			log.Println(err)
+			response.PageError(w, errAuthRequired)
+			return
+		}
+
+		tmpl, err := template.ParseFiles("template/orders.html")
+		if err != nil {
+			log.Println("Template parsing error:", err)
+			http.Error(w, "Error loading orders page", http.StatusInternalServerError)
+			return
+		}
+
+		orders, err := s.getOrdersService(user.UserID)
+		if err != nil {
+			log.Println(err)
+			response.PageError(w, err)
+			return
+		}
+
+		err = tmpl.Execute(w, map[string]interface{}{"Orders": orders})
+		if err != nil {
+			log.Println("Template execution error:", err)
+			http.Error(w, "Error rendering orders page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// orderProdHandler renders one of the user's orders with its items and status timeline
+func orderProdHandler(s *OrderService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := session.GetUserFromContext(r)
+		if err != nil {
+			log.Println(err)
+			response.PageError(w, errAuthRequired)
+			return
+		}
+
+		orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			log.Println(err)
+			response.PageError(w, ErrOrderNotFound)
+			return
+		}
+
+		tmpl, err := template.ParseFiles("template/order_details.html")
+		if err != nil {
+			log.Println("Template parsing error:", err)
+			http.Error(w, "Error loading order page", http.StatusInternalServerError)
+			return
+		}
+
+		order, err := s.getOrderService(orderID, user.UserID, user.IsAdmin == 1)
+		if err != nil {
+			log.Println(err)
+			response.PageError(w, err)
+			return
+		}
+
+		history, err := s.getOrderTimelineService(orderID, user.UserID, user.IsAdmin == 1)
+		if err != nil {
+			log.Println(err)
+			response.PageError(w, err)
+			return
+		}
+
+		err = tmpl.Execute(w, map[string]interface{}{"Order": order, "History": history})
+		if err != nil {
+			log.Println("Template execution error:", err)
+			http.Error(w, "Error rendering order page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func checkoutProdHandler(s *OrderService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, err := session.GetSessionFromContext(r)
+		if sess == nil {
+			log.Println(err)
+			response.PageError(w, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			userID, cartID, err := getSessionUserAndCart(sess)
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			tmpl, err := template.ParseFiles("template/order_confirmation.html")
+			if err != nil {
+				log.Println("Template parsing error:", err)
+				http.Error(w, "Error loading order confirmation page", http.StatusInternalServerError)
+				return
+			}
+
+			// the cart page may pick another address of the user than the default shipping address
+			addressID, _ := strconv.Atoi(r.FormValue("address_id"))
+			order, err := s.checkoutService(userID, cartID, addressID)
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			err = tmpl.Execute(w, map[string]interface{}{"Order": order})
+			if err != nil {
+				log.Println("Template execution error:", err)
+				http.Error(w, "Error rendering order confirmation page", http.StatusInternalServerError)
+				return
+			}
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func checkoutHandler(s *OrderService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			sess, err := session.GetSessionFromContext(r)
+			if sess == nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			userID, cartID, err := getSessionUserAndCart(sess)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			var payload checkoutPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			order, err := s.checkoutService(userID, cartID, payload.AddressID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusCreated, order)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// ordersHandler returns the orders of the user with their items, the newest first
+func ordersHandler(s *OrderService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			user, err := session.GetUserFromContext(r)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, errAuthRequired)
+				return
+			}
+
+			orders, err := s.getOrdersService(user.UserID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, orders)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// orderHandler returns one of the user's orders with its items
+func orderHandler(s *OrderService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			user, err := session.GetUserFromContext(r)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, errAuthRequired)
+				return
+			}
+
+			orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, ErrOrderNotFound)
+				return
+			}
+
+			order, err := s.getOrderService(orderID, user.UserID, user.IsAdmin == 1)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, order)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// orderStatusHandler lets admins advance an order through its status transitions.
+func orderStatusHandler(s *OrderService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			user, err := session.GetUserFromContext(r)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, errAuthRequired)
+				return
+			}
+
+			orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, ErrOrderNotFound)
+				return
+			}
+
+			var payload statusPayload
+			err = json.NewDecoder(r.Body).Decode(&payload)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			change, err := s.Transition(orderID, payload.Status, UserActor(user.UserID), payload.Note)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, change)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// orderTimelineHandler returns the status history of one of the user's orders.
+func orderTimelineHandler(s *OrderService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			user, err := session.GetUserFromContext(r)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, errAuthRequired)
+				return
+			}
+
+			orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, ErrOrderNotFound)
+				return
+			}
+
+			history, err := s.getOrderTimelineService(orderID, user.UserID, user.IsAdmin == 1)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, history)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// checkoutPayload is the optional request body accepted when checking out
+type checkoutPayload struct {
+	AddressID int `json:"address_id"` // 0 ships to the default shipping address, GET /api/cart?address_id= quotes the others
+}
+
+// statusPayload is the request body accepted when changing an order status
+type statusPayload struct {
+	Status Status `json:"status"`
+	Note   string `json:"note"`
+}
+
+// helper functions
+
+// getSessionUserAndCart extracts the logged in user id and the cart id from the session
+func getSessionUserAndCart(sess *sessions.Session) (int, int, error) {
+	userID, err := session.GetSessionUserID(sess)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cart, ok := sess.Values["cart"].(*session.Cart)
+	if !ok || cart == nil {
+		return 0, 0, ErrCartNotFound
+	}
+
+	return userID, cart.CartID, nil
+}
@@ -1,24 +1,131 @@
-package order
-
-import "time"
-
-type Order struct {
-	ID          int         `json:"id"`
-	UserID      int         `json:"user_id"`
-	TotalAmount float64     `json:"total_amount"`
-	Status      string      `json:"status"` // 'pending', 'completed', 'cancelled'
-	CreatedAt   time.Time   `json:"created_at"`
-	UpdatedAt   time.Time   `json:"updated_at"`
-	Items       []OrderItem // One-to-many relationship
-}
-
-type OrderItem struct {
-	ID           int       `json:"id"`
-	OrderID      int       `json:"order_id"`
-	ProductID    int       `json:"product_id"`
-	Quantity     int       `json:"quantity"`
-	PricePerUnit float64   `json:"price_per_unit"`
-	TotalPrice   float64   `json:"total_price"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-}
+package order
+
+import (
+	"time"
+
+	"github.com/ecommerce/internal/services/address"
+	"github.com/ecommerce/internal/services/pricing"
+)
+
+// Status is the lifecycle state of an order
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusPaid      Status = "paid"
+	StatusShipped   Status = "shipped"
+	StatusDelivered Status = "delivered"
+	StatusCancelled Status = "cancelled"
+	StatusRefunded  Status = "refunded"
+)
+
+// transitions lists the statuses an order may move to from each status.
+// cancelled and refunded are terminal.
+var transitions = map[Status][]Status{
+	StatusPending:   {StatusPaid, StatusCancelled},
+	StatusPaid:      {StatusShipped, StatusRefunded},
+	StatusShipped:   {StatusDelivered},
+	StatusDelivered: {StatusRefunded},
+}
+
+// Order is a placed cart along with the quote it was placed at. TotalAmount is what the customer pays,
+// the SubtotalAmount of the items less the DiscountAmount given by the coupon the order was placed with,
+// if any, plus the TaxAmount of its Region and the ShippingAmount. The order keeps a copy of the addresses
+// it was placed with, orders placed before addresses existed have none.
+type Order struct {
+	ID              int               `json:"id"`
+	UserID          int               `json:"user_id"`
+	SubtotalAmount  float64           `json:"subtotal_amount"`
+	DiscountAmount  float64           `json:"discount_amount"`
+	CouponCode      string            `json:"coupon_code,omitempty"`
+	Region          string            `json:"region"`
+	TaxRate         float64           `json:"tax_rate"` // percent
+	TaxAmount       float64           `json:"tax_amount"`
+	ShippingMethod  string            `json:"shipping_method"`
+	ShippingAmount  float64           `json:"shipping_amount"`
+	ShippingAddress *address.Snapshot `json:"shipping_address,omitempty"`
+	BillingAddress  *address.Snapshot `json:"billing_address,omitempty"`
+	TotalAmount     float64           `json:"total_amount"`
+	Status          Status            `json:"status"`
+	CreatedAt       time.Time         `json:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at"`
+	Items           []OrderItem       // One-to-many relationship
+}
+
+type OrderItem struct {
+	ID           int       `json:"id"`
+	OrderID      int       `json:"order_id"`
+	ProductID    int       `json:"product_id"`
+	VariantID    int       `json:"variant_id"` // 0 for items ordered before products had variants
+	Quantity     int       `json:"quantity"`
+	PricePerUnit float64   `json:"price_per_unit"`
+	TotalPrice   float64   `json:"total_price"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// StatusChange is one entry of an order's status timeline
+type StatusChange struct {
+	ID         int       `json:"id"`
+	OrderID    int       `json:"order_id"`
+	FromStatus Status    `json:"from_status"`
+	ToStatus   Status    `json:"to_status"`
+	Actor      string    `json:"actor"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// applyQuote sets the price breakdown of the order to that of the quote its items were priced at
+func (o *Order) applyQuote(quote *pricing.Quote) {
+	o.SubtotalAmount = quote.Subtotal
+	o.DiscountAmount = quote.DiscountAmount
+	if quote.Discount != nil {
+		o.CouponCode = quote.Discount.Code
+	}
+	o.Region = quote.Region
+	o.TaxRate = quote.TaxRate
+	o.TaxAmount = quote.TaxAmount
+	o.ShippingMethod = quote.ShippingMethod
+	o.ShippingAmount = quote.ShippingAmount
+	o.TotalAmount = quote.GrandTotal
+}
+
+// TotalItems returns the number of units ordered across the items of the order
+func (o Order) TotalItems() int {
+	total := 0
+	for _, item := range o.Items {
+		total += item.Quantity
+	}
+	return total
+}
+
+// IsValid reports whether s is one of the known order statuses
+func (s Status) IsValid() bool {
+	switch s {
+	case StatusPending, StatusPaid, StatusShipped, StatusDelivered, StatusCancelled, StatusRefunded:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether an order in status s may move to next
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// releasesOrder reports whether an order moving to s gives back the stock it took and the coupon use
+// it redeemed at checkout. Orders are only cancelled before they are paid and refunded before they
+// ship, so their units never left.
+func (s Status) releasesOrder() bool {
+	return s == StatusCancelled || s == StatusRefunded
+}
+
+// NextStatuses returns the statuses an order in status s may move to
+func (s Status) NextStatuses() []Status {
+	return transitions[s]
+}
@@ -0,0 +1,307 @@
+package order
+
+import (
+	"log"
+	"time"
+
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/services/cart"
+	"github.com/ecommerce/internal/services/pricing"
+	"github.com/ecommerce/internal/services/product"
+	"github.com/ecommerce/internal/services/promotion"
+	"github.com/ecommerce/utils"
+)
+
+// MemoryOrderRepository is an OrderRepository keeping orders in a memory.DB
+type MemoryOrderRepository struct {
+	mem *memory.DB
+}
+
+func NewMemoryOrderRepository(mem *memory.DB) *MemoryOrderRepository {
+	return &MemoryOrderRepository{mem: mem}
+}
+
+// getCartCoupon returns the coupon applied to a cart, an empty string if there is none
+func (repo *MemoryOrderRepository) getCartCoupon(cartID int) (string, error) {
+	var code string
+	err := repo.mem.View(func() error {
+		c, ok := cart.CartsOf(repo.mem).Get(cartID)
+		if !ok {
+			return ErrCartNotFound
+		}
+		code = c.CouponCode
+		return nil
+	})
+	return code, err
+}
+
+// checkout is the in-memory counterpart of the MySQL checkout: everything is validated
+// before the first write since the memory database has no rollback. placed holds the user placing
+// the order and the addresses it is placed with.
+func (repo *MemoryOrderRepository) checkout(placed Order, cartID int, actor string, pipeline *pricing.Pipeline, in pricing.Input) (*Order, error) {
+	var order *Order
+	err := repo.mem.Update(func() error {
+		products := product.ProductsOf(repo.mem)
+		variants := product.VariantsOf(repo.mem)
+		reservations := product.ReservationsOf(repo.mem)
+		cartItems := cart.ItemsOf(repo.mem)
+		now := time.Now()
+
+		var items []OrderItem
+		for _, line := range cartItems.Filter(func(i cart.CartItem) bool { return i.CartID == cartID }) {
+			p, ok := products.Get(line.ProductID)
+			if !ok {
+				continue
+			}
+			variant, ok := variants.Get(line.VariantID)
+			if !ok {
+				continue
+			}
+
+			// the cart may only take stock that isn't held by other carts' active reservations
+			reservedByOthers := 0
+			for _, r := range reservations.Filter(func(r product.StockReservation) bool {
+				return r.VariantID == line.VariantID && r.CartID != cartID && r.ExpiresAt.After(now)
+			}) {
+				reservedByOthers += r.Quantity
+			}
+			available := variant.StockQuantity - reservedByOthers
+			if line.Quantity > available {
+				return ErrInsufficientStock.Withf("insufficient stock for product %d: requested %d, available %d", line.ProductID, line.Quantity, available)
+			}
+
+			item := OrderItem{
+				ProductID:    line.ProductID,
+				VariantID:    line.VariantID,
+				Quantity:     line.Quantity,
+				PricePerUnit: variant.Price(p),
+				TotalPrice:   utils.RoundAmount(variant.Price(p) * float64(line.Quantity)),
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			items = append(items, item)
+			in.Lines = append(in.Lines, pricing.Line{ProductID: item.ProductID, Quantity: item.Quantity, UnitPrice: item.PricePerUnit, WeightGrams: p.WeightGrams})
+		}
+
+		if len(items) == 0 {
+			return ErrEmptyCart
+		}
+
+		quote, err := pipeline.Quote(in)
+		if err != nil {
+			return err
+		}
+		order = &placed
+		order.Status, order.CreatedAt, order.UpdatedAt = StatusPending, now, now
+		order.applyQuote(quote)
+
+		discount := quote.Discount
+		if discount != nil {
+			if err := repo.redeemOffer(discount, order.UserID); err != nil {
+				return err
+			}
+		}
+
+		order.ID = repo.orders().NextID()
+		repo.orders().Put(order.ID, *order)
+
+		if discount != nil {
+			promotions := promotion.PromotionsOf(repo.mem)
+			p, _ := promotions.Get(discount.PromotionID)
+			p.Uses++
+			promotions.Put(p.ID, p)
+
+			redemptions := promotion.RedemptionsOf(repo.mem)
+			redemption := promotion.Redemption{ID: redemptions.NextID(), PromotionID: p.ID, UserID: order.UserID, OrderID: order.ID, Amount: discount.Amount, CreatedAt: now}
+			redemptions.Put(redemption.ID, redemption)
+		}
+
+		for i := range items {
+			items[i].ID = repo.items().NextID()
+			items[i].OrderID = order.ID
+			repo.items().Put(items[i].ID, items[i])
+
+			variant, _ := variants.Get(items[i].VariantID)
+			variant.StockQuantity -= items[i].Quantity
+			variants.Put(variant.ID, variant)
+
+			// the stock of a product is the total stock of its variants
+			p, _ := products.Get(items[i].ProductID)
+			p.StockQuantity -= items[i].Quantity
+			p.Version++
+			products.Put(p.ProductID, p)
+		}
+		order.Items = items
+
+		cartItems.DeleteWhere(func(i cart.CartItem) bool { return i.CartID == cartID })
+		if c, ok := cart.CartsOf(repo.mem).Get(cartID); ok {
+			c.CouponCode = ""
+			cart.CartsOf(repo.mem).Put(c.ID, c)
+		}
+		reservations.DeleteWhere(func(r product.StockReservation) bool { return r.CartID == cartID })
+
+		repo.insertStatusChange(&StatusChange{OrderID: order.ID, ToStatus: StatusPending, Actor: actor, Note: "order placed"})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Order %d created from cart %d for user %d", order.ID, cartID, order.UserID)
+	return order, nil
+}
+
+func (repo *MemoryOrderRepository) getOrder(orderID int) (*Order, error) {
+	var order *Order
+	err := repo.mem.View(func() error {
+		found, ok := repo.orders().Get(orderID)
+		if !ok {
+			return nil
+		}
+		found.Items = repo.items().Filter(func(i OrderItem) bool { return i.OrderID == orderID })
+		order = &found
+		return nil
+	})
+	return order, err
+}
+
+// getUserOrders returns the orders of a user with their items, the newest first
+func (repo *MemoryOrderRepository) getUserOrders(userID int) ([]Order, error) {
+	orders := make([]Order, 0)
+	err := repo.mem.View(func() error {
+		rows := repo.orders().Filter(func(o Order) bool { return o.UserID == userID })
+		for i := len(rows) - 1; i >= 0; i-- {
+			order := rows[i]
+			order.Items = repo.items().Filter(func(item OrderItem) bool { return item.OrderID == order.ID })
+			orders = append(orders, order)
+		}
+		return nil
+	})
+	return orders, err
+}
+
+// transitionStatus moves an order to a new status and records the change in the status history.
+// The guards take the lock themselves, e.g. to read payments, so they run before the write lock is
+// taken and the transition starts over when the database changed in between. A cancelled or refunded
+// order gives its stock and coupon use back.
+func (repo *MemoryOrderRepository) transitionStatus(orderID int, to Status, actor, note string, guards []TransitionGuard) (*StatusChange, error) {
+	for {
+		version := repo.mem.Version()
+		order, err := repo.getOrder(orderID)
+		if err != nil {
+			return nil, err
+		}
+		if order == nil {
+			return nil, ErrOrderNotFound
+		}
+		if !order.Status.CanTransitionTo(to) {
+			return nil, ErrIllegalTransition.Withf("illegal order status transition: %s -> %s", order.Status, to)
+		}
+		if err := checkGuards(guards, order, to); err != nil {
+			return nil, err
+		}
+
+		var change *StatusChange
+		err = repo.mem.Update(func() error {
+			if repo.mem.Version() != version {
+				return nil
+			}
+
+			from := order.Status
+			order.Status = to
+			order.UpdatedAt = time.Now()
+			order.Items = nil
+			repo.orders().Put(order.ID, *order)
+			if to.releasesOrder() {
+				repo.releaseOrder(orderID)
+			}
+
+			change = &StatusChange{OrderID: orderID, FromStatus: from, ToStatus: to, Actor: actor, Note: note}
+			repo.insertStatusChange(change)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if change == nil {
+			continue // changed since the guards checked the order
+		}
+
+		log.Printf("Order %d moved from %s to %s by %s", orderID, change.FromStatus, to, actor)
+		return change, nil
+	}
+}
+
+// getStatusHistory returns the status timeline of an order, oldest first
+func (repo *MemoryOrderRepository) getStatusHistory(orderID int) ([]StatusChange, error) {
+	var history []StatusChange
+	err := repo.mem.View(func() error {
+		history = repo.history().Filter(func(c StatusChange) bool { return c.OrderID == orderID })
+		return nil
+	})
+	return history, err
+}
+
+// redeemOffer is the in-memory counterpart of the MySQL redeemOffer, it only checks the usage limits
+// against the current promotion and leaves counting the use to the caller. The caller must hold the write lock.
+func (repo *MemoryOrderRepository) redeemOffer(discount *promotion.Discount, userID int) error {
+	p, ok := promotion.PromotionsOf(repo.mem).Get(discount.PromotionID)
+	if !ok || !p.Active || p.Exhausted() {
+		return promotion.ErrCouponExhausted
+	}
+	if p.MaxUsesPerUser > 0 && promotion.CountRedemptionsOf(repo.mem, p.ID, userID) >= p.MaxUsesPerUser {
+		return promotion.ErrCouponUserLimit
+	}
+	return nil
+}
+
+// releaseOrder is the in-memory counterpart of the MySQL releaseOrder, the caller must hold the write lock
+func (repo *MemoryOrderRepository) releaseOrder(orderID int) {
+	variants, products := product.VariantsOf(repo.mem), product.ProductsOf(repo.mem)
+	for _, item := range repo.items().Filter(func(i OrderItem) bool { return i.OrderID == orderID }) {
+		if variant, ok := variants.Get(item.VariantID); ok {
+			variant.StockQuantity += item.Quantity
+			variants.Put(variant.ID, variant)
+		}
+		if p, ok := products.Get(item.ProductID); ok {
+			p.StockQuantity += item.Quantity
+			p.Version++
+			products.Put(p.ProductID, p)
+		}
+	}
+
+	redemptions, promotions := promotion.RedemptionsOf(repo.mem), promotion.PromotionsOf(repo.mem)
+	for _, r := range redemptions.Filter(func(r promotion.Redemption) bool { return r.OrderID == orderID }) {
+		redemptions.Delete(r.ID)
+		if p, ok := promotions.Get(r.PromotionID); ok && p.Uses > 0 {
+			p.Uses--
+			promotions.Put(p.ID, p)
+		}
+	}
+}
+
+// insertStatusChange writes a status history row, the caller must hold the write lock
+func (repo *MemoryOrderRepository) insertStatusChange(change *StatusChange) {
+	change.ID = repo.history().NextID()
+	change.CreatedAt = time.Now()
+	repo.history().Put(change.ID, *change)
+}
+
+func (repo *MemoryOrderRepository) orders() *memory.Table[Order] {
+	return OrdersOf(repo.mem)
+}
+
+func (repo *MemoryOrderRepository) items() *memory.Table[OrderItem] {
+	return memory.TableOf[OrderItem](repo.mem, ORDER_ITEMS_TABLE)
+}
+
+func (repo *MemoryOrderRepository) history() *memory.Table[StatusChange] {
+	return memory.TableOf[StatusChange](repo.mem, STATUS_HISTORY_TABLE)
+}
+
+// functions for memory repositories outside order pkg
+
+// OrdersOf returns the orders table of an in-memory database
+func OrdersOf(mem *memory.DB) *memory.Table[Order] {
+	return memory.TableOf[Order](mem, TABLE_NAME)
+}
@@ -0,0 +1,595 @@
+package order
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/services/pricing"
+	"github.com/ecommerce/internal/services/promotion"
+	"github.com/ecommerce/utils"
+)
+
+const (
+	ORDER_ID             = "id"
+	TABLE_NAME           = "orders"
+	ORDER_ITEMS_TABLE    = "order_items"
+	STATUS_HISTORY_TABLE = "order_status_history"
+)
+
+// orderColumns are the columns scanned by scanOrder
+const orderColumns = `id, user_id, subtotal_amount, discount_amount, coupon_code, region, tax_rate, tax_amount,
+	shipping_method, shipping_amount, shipping_address, billing_address, total_amount, status, created_at, updated_at`
+
+// orderItemColumns are the columns scanned by scanOrderItem
+const orderItemColumns = `id, order_id, product_id, COALESCE(variant_id, 0), quantity, price_per_unit, total_price, created_at, updated_at`
+
+var (
+	ErrEmptyCart         = response.New(http.StatusBadRequest, "cart_empty", "cart is empty")
+	ErrInsufficientStock = response.New(http.StatusConflict, "insufficient_stock", "insufficient stock")
+	ErrOrderNotFound     = response.New(http.StatusNotFound, "order_not_found", "order not found")
+	ErrIllegalTransition = response.New(http.StatusConflict, "illegal_transition", "illegal order status transition")
+	ErrUnknownStatus     = response.New(http.StatusBadRequest, "unknown_status", "unknown order status")
+	ErrCartNotFound      = response.New(http.StatusBadRequest, "cart_not_found", "cart not found in session")
+)
+
+// OrderRepository stores orders and their status history. MySQLOrderRepository is the
+// production implementation, MemoryOrderRepository keeps everything in process for demos and tests.
+type OrderRepository interface {
+	getCartCoupon(cartID int) (string, error)
+	checkout(placed Order, cartID int, actor string, pipeline *pricing.Pipeline, in pricing.Input) (*Order, error)
+	getOrder(orderID int) (*Order, error)
+	getUserOrders(userID int) ([]Order, error)
+	transitionStatus(orderID int, to Status, actor, note string, guards []TransitionGuard) (*StatusChange, error)
+	getStatusHistory(orderID int) ([]StatusChange, error)
+}
+
+type MySQLOrderRepository struct {
+	db *sql.DB
+}
+
+func NewMySQLOrderRepository(db *sql.DB) *MySQLOrderRepository {
+	return &MySQLOrderRepository{db: db}
+}
+
+// getCartCoupon returns the coupon applied to a cart, an empty string if there is none
+func (repo *MySQLOrderRepository) getCartCoupon(cartID int) (string, error) {
+	var code string
+	err := repo.db.QueryRow(`SELECT COALESCE(coupon_code, '') FROM carts WHERE id = ?`, cartID).Scan(&code)
+	if err == sql.ErrNoRows {
+		return "", ErrCartNotFound
+	} else if err != nil {
+		log.Println(err)
+		return "", err
+	}
+	return code, nil
+}
+
+// checkout turns every cart_items row of the cart into an order in a single transaction:
+// items are priced at the current variant price and quoted by the pipeline for the region and offer of in,
+// the offer of the cart coupon is redeemed, stock is decremented, the cart is emptied and its stock
+// reservations are released. placed holds the user placing the order and the addresses it is placed with.
+func (repo *MySQLOrderRepository) checkout(placed Order, cartID int, actor string, pipeline *pricing.Pipeline, in pricing.Input) (*Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin checkout transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// lock the cart lines and their variants so concurrent checkouts see a consistent stock
+	rows, err := tx.QueryContext(ctx, `
+		SELECT
+			ci.product_id,
+			ci.variant_id,
+			ci.quantity,
+			COALESCE(v.price_override, p.pricePerUnit),
+			p.weightGrams,
+			v.stock_quantity
+		FROM
+			cart_items ci
+		JOIN
+			products p ON p.productId = ci.product_id
+		JOIN
+			product_variants v ON v.id = ci.variant_id
+		WHERE
+			ci.cart_id = ?
+		FOR UPDATE`, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []OrderItem
+	stockByVariant := make(map[int]int)
+	for rows.Next() {
+		var item OrderItem
+		var weightGrams, stockQuantity int
+		err := rows.Scan(
+			&item.ProductID,
+			&item.VariantID,
+			&item.Quantity,
+			&item.PricePerUnit,
+			&weightGrams,
+			&stockQuantity,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		stockByVariant[item.VariantID] = stockQuantity
+		item.TotalPrice = utils.RoundAmount(item.PricePerUnit * float64(item.Quantity))
+		items = append(items, item)
+		in.Lines = append(in.Lines, pricing.Line{ProductID: item.ProductID, Quantity: item.Quantity, UnitPrice: item.PricePerUnit, WeightGrams: weightGrams})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return nil, ErrEmptyCart
+	}
+
+	// the cart may only take stock that isn't held by other carts' active reservations
+	now := time.Now()
+	for _, item := range items {
+		var reservedByOthers int
+		err := tx.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(quantity), 0)
+			FROM stock_reservations
+			WHERE variant_id = ? AND cart_id <> ? AND expires_at > ?`,
+			item.VariantID, cartID, now).Scan(&reservedByOthers)
+		if err != nil {
+			return nil, err
+		}
+
+		available := stockByVariant[item.VariantID] - reservedByOthers
+		if item.Quantity > available {
+			return nil, ErrInsufficientStock.Withf("insufficient stock for product %d: requested %d, available %d", item.ProductID, item.Quantity, available)
+		}
+	}
+
+	quote, err := pipeline.Quote(in)
+	if err != nil {
+		return nil, err
+	}
+	order := &placed
+	order.Status = StatusPending
+	order.applyQuote(quote)
+
+	discount := quote.Discount
+	if discount != nil {
+		err = redeemOffer(ctx, tx, in.Offer, discount, order.UserID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO orders (user_id, subtotal_amount, discount_amount, coupon_code, region, tax_rate, tax_amount,
+			shipping_method, shipping_amount, shipping_address, billing_address, total_amount, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		order.UserID, order.SubtotalAmount, order.DiscountAmount, order.CouponCode, order.Region, order.TaxRate, order.TaxAmount,
+		order.ShippingMethod, order.ShippingAmount, order.ShippingAddress, order.BillingAddress, order.TotalAmount, order.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %v", err)
+	}
+	orderID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	order.ID = int(orderID)
+
+	if discount != nil {
+		_, err = tx.ExecContext(ctx, `INSERT INTO promotion_redemptions (promotion_id, user_id, order_id, amount) VALUES (?, ?, ?, ?)`,
+			discount.PromotionID, order.UserID, order.ID, discount.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to redeem promotion %d: %v", discount.PromotionID, err)
+		}
+	}
+
+	for i := range items {
+		items[i].OrderID = order.ID
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO order_items (order_id, product_id, variant_id, quantity, price_per_unit, total_price)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			items[i].OrderID, items[i].ProductID, items[i].VariantID, items[i].Quantity, items[i].PricePerUnit, items[i].TotalPrice)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create order item: %v", err)
+		}
+		itemID, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		items[i].ID = int(itemID)
+
+		// conditional decrement: never lets the stock go below zero even if the row lock was bypassed
+		result, err = tx.ExecContext(ctx, `UPDATE product_variants SET stock_quantity = stock_quantity - ? WHERE id = ? AND stock_quantity >= ?`,
+			items[i].Quantity, items[i].VariantID, items[i].Quantity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update stock for product %d: %v", items[i].ProductID, err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if affected != 1 {
+			return nil, ErrInsufficientStock.Withf("insufficient stock for product %d", items[i].ProductID)
+		}
+
+		// the stock of a product is the total stock of its variants
+		_, err = tx.ExecContext(ctx, `UPDATE products SET stockQuantity = stockQuantity - ?, version = version + 1 WHERE productId = ?`,
+			items[i].Quantity, items[i].ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update stock for product %d: %v", items[i].ProductID, err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM cart_items WHERE cart_id = ?`, cartID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to empty cart %d: %v", cartID, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE carts SET coupon_code = NULL WHERE id = ?`, cartID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove the coupon of cart %d: %v", cartID, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM stock_reservations WHERE cart_id = ?`, cartID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release reservations of cart %d: %v", cartID, err)
+	}
+
+	err = insertStatusChange(ctx, tx, &StatusChange{OrderID: order.ID, ToStatus: StatusPending, Actor: actor, Note: "order placed"})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit checkout: %v", err)
+	}
+
+	order.CreatedAt = now
+	order.UpdatedAt = now
+	for i := range items {
+		items[i].CreatedAt = now
+		items[i].UpdatedAt = now
+	}
+	order.Items = items
+
+	log.Printf("Order %d created from cart %d for user %d", order.ID, cartID, order.UserID)
+	return order, nil
+}
+
+// getOrder returns an order with its items, nil if there is none
+func (repo *MySQLOrderRepository) getOrder(orderID int) (*Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	order := &Order{}
+	err := scanOrder(repo.db.QueryRowContext(ctx, `SELECT `+orderColumns+` FROM orders WHERE id = ?`, orderID), order)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	rows, err := repo.db.QueryContext(ctx, `SELECT `+orderItemColumns+` FROM order_items WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item OrderItem
+		if err := scanOrderItem(rows, &item); err != nil {
+			return nil, err
+		}
+		order.Items = append(order.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// getUserOrders returns the orders of a user with their items, the newest first
+func (repo *MySQLOrderRepository) getUserOrders(userID int) ([]Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	rows, err := repo.db.QueryContext(ctx, `SELECT `+orderColumns+` FROM orders WHERE user_id = ? ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]Order, 0)
+	byID := make(map[int]int) // order id -> index in orders
+	for rows.Next() {
+		var order Order
+		if err := scanOrder(rows, &order); err != nil {
+			return nil, err
+		}
+		byID[order.ID] = len(orders)
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return orders, nil
+	}
+
+	// every item of the user's orders at once rather than a query per order
+	itemRows, err := repo.db.QueryContext(ctx, `
+		SELECT `+orderItemColumns+`
+		FROM order_items
+		WHERE order_id IN (SELECT id FROM orders WHERE user_id = ?)
+		ORDER BY order_id, id`, userID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var item OrderItem
+		if err := scanOrderItem(itemRows, &item); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[item.OrderID]; ok {
+			orders[i].Items = append(orders[i].Items, item)
+		}
+	}
+	return orders, itemRows.Err()
+}
+
+// transitionStatus moves an order to a new status and records the change in the status history.
+// The order is locked before the guards check it, so concurrent transitions and payments are applied
+// one after the other. A cancelled or refunded order gives its stock and coupon use back.
+func (repo *MySQLOrderRepository) transitionStatus(orderID int, to Status, actor, note string, guards []TransitionGuard) (*StatusChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin status transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	order := &Order{}
+	err = scanOrder(tx.QueryRowContext(ctx, `SELECT `+orderColumns+` FROM orders WHERE id = ? FOR UPDATE`, orderID), order)
+	if err == sql.ErrNoRows {
+		return nil, ErrOrderNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	from := order.Status
+
+	if !from.CanTransitionTo(to) {
+		return nil, ErrIllegalTransition.Withf("illegal order status transition: %s -> %s", from, to)
+	}
+	if err := checkGuards(guards, order, to); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE orders SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, to, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update status of order %d: %v", orderID, err)
+	}
+
+	if to.releasesOrder() {
+		if err := releaseOrder(ctx, tx, orderID); err != nil {
+			return nil, err
+		}
+	}
+
+	change := &StatusChange{OrderID: orderID, FromStatus: from, ToStatus: to, Actor: actor, Note: note}
+	err = insertStatusChange(ctx, tx, change)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit status transition: %v", err)
+	}
+
+	log.Printf("Order %d moved from %s to %s by %s", orderID, from, to, actor)
+	return change, nil
+}
+
+// getStatusHistory returns the status timeline of an order, oldest first
+func (repo *MySQLOrderRepository) getStatusHistory(orderID int) ([]StatusChange, error) {
+	rows, err := repo.db.Query(`
+		SELECT
+			id,
+			order_id,
+			from_status,
+			to_status,
+			actor,
+			note,
+			created_at
+		FROM
+			order_status_history
+		WHERE
+			order_id = ?
+		ORDER BY
+			created_at, id`, orderID)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]StatusChange, 0)
+	for rows.Next() {
+		var change StatusChange
+		err := rows.Scan(
+			&change.ID,
+			&change.OrderID,
+			&change.FromStatus,
+			&change.ToStatus,
+			&change.Actor,
+			&change.Note,
+			&change.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// helper functions
+
+// releaseOrder gives the stock taken by the items of an order back to their variants and products,
+// and deletes the redemption of its coupon along with the use it counted, inside the given transaction
+func releaseOrder(ctx context.Context, tx *sql.Tx, orderID int) error {
+	rows, err := tx.QueryContext(ctx, `SELECT `+orderItemColumns+` FROM order_items WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return err
+	}
+	var items []OrderItem
+	for rows.Next() {
+		var item OrderItem
+		if err := scanOrderItem(rows, &item); err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		// items of orders placed before variants existed have none
+		if item.VariantID != 0 {
+			_, err := tx.ExecContext(ctx, `UPDATE product_variants SET stock_quantity = stock_quantity + ? WHERE id = ?`, item.Quantity, item.VariantID)
+			if err != nil {
+				return fmt.Errorf("failed to restock variant %d: %v", item.VariantID, err)
+			}
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE products SET stockQuantity = stockQuantity + ?, version = version + 1 WHERE productId = ?`,
+			item.Quantity, item.ProductID)
+		if err != nil {
+			return fmt.Errorf("failed to restock product %d: %v", item.ProductID, err)
+		}
+	}
+
+	var promotionID int
+	err = tx.QueryRowContext(ctx, `SELECT promotion_id FROM promotion_redemptions WHERE order_id = ? FOR UPDATE`, orderID).Scan(&promotionID)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM promotion_redemptions WHERE order_id = ?`, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to release the coupon of order %d: %v", orderID, err)
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE promotions SET uses = uses - 1 WHERE id = ? AND uses > 0`, promotionID)
+	if err != nil {
+		return fmt.Errorf("failed to release a use of promotion %d: %v", promotionID, err)
+	}
+	return nil
+}
+
+// scanOrder scans a row of the orderColumns into order
+func scanOrder(row utils.RowScanner, order *Order) error {
+	return row.Scan(
+		&order.ID,
+		&order.UserID,
+		&order.SubtotalAmount,
+		&order.DiscountAmount,
+		&order.CouponCode,
+		&order.Region,
+		&order.TaxRate,
+		&order.TaxAmount,
+		&order.ShippingMethod,
+		&order.ShippingAmount,
+		&order.ShippingAddress,
+		&order.BillingAddress,
+		&order.TotalAmount,
+		&order.Status,
+		&order.CreatedAt,
+		&order.UpdatedAt)
+}
+
+// scanOrderItem scans a row of the orderItemColumns into item
+func scanOrderItem(row utils.RowScanner, item *OrderItem) error {
+	return row.Scan(
+		&item.ID,
+		&item.OrderID,
+		&item.ProductID,
+		&item.VariantID,
+		&item.Quantity,
+		&item.PricePerUnit,
+		&item.TotalPrice,
+		&item.CreatedAt,
+		&item.UpdatedAt)
+}
+
+// insertStatusChange writes a status history row inside the given transaction
+func insertStatusChange(ctx context.Context, tx *sql.Tx, change *StatusChange) error {
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO order_status_history (order_id, from_status, to_status, actor, note)
+		VALUES (?, ?, ?, ?, ?)`,
+		change.OrderID, change.FromStatus, change.ToStatus, change.Actor, change.Note)
+	if err != nil {
+		return fmt.Errorf("failed to record status change of order %d: %v", change.OrderID, err)
+	}
+
+	changeID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	change.ID = int(changeID)
+	change.CreatedAt = time.Now()
+	return nil
+}
+
+// redeemOffer counts one more use of the promotion of the offer that gave the discount, inside the checkout
+// transaction. The conditional increment enforces the overall usage limit and locks the promotion,
+// so concurrent checkouts of the same user count its redemptions one after the other.
+func redeemOffer(ctx context.Context, tx *sql.Tx, offer *promotion.Offer, discount *promotion.Discount, userID int) error {
+	result, err := tx.ExecContext(ctx, `
+		UPDATE promotions SET uses = uses + 1
+		WHERE id = ? AND active = 1 AND (max_uses = 0 OR uses < max_uses)`, discount.PromotionID)
+	if err != nil {
+		return fmt.Errorf("failed to count a use of promotion %d: %v", discount.PromotionID, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != 1 {
+		return promotion.ErrCouponExhausted
+	}
+
+	if offer.Promotion.MaxUsesPerUser > 0 {
+		var used int
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM promotion_redemptions WHERE promotion_id = ? AND user_id = ?`,
+			discount.PromotionID, userID).Scan(&used)
+		if err != nil {
+			return err
+		}
+		if used >= offer.Promotion.MaxUsesPerUser {
+			return promotion.ErrCouponUserLimit
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package order
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ecommerce/database/databasetest"
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/services/cart"
+	"github.com/ecommerce/internal/services/pricing"
+	"github.com/ecommerce/internal/services/product"
+)
+
+const (
+	concurrentBuyers = 20 // carts checked out at the same time
+	unitsInStock     = 5  // units of the product they all hold in their cart
+)
+
+// stockFixture is a product with unitsInStock units in its only variant and one cart per buyer
+// holding a unit of it, without a reservation so that checkout alone guards the stock
+type stockFixture struct {
+	repo    OrderRepository
+	buyers  []databasetest.Buyer
+	stockOf func() (variantStock, productStock int, err error)
+}
+
+func newMemoryStockFixture(t *testing.T) stockFixture {
+	mem := memory.New()
+	product.NewMemoryProductRepository(mem).Seed([]product.Product{
+		{ProductName: "Concurrency test", ProductBrand: "Test", PricePerUnit: 10, StockQuantity: unitsInStock},
+	})
+
+	var productID, variantID int
+	var buyers []databasetest.Buyer
+	mem.Update(func() error {
+		variant, _ := product.VariantsOf(mem).First(func(product.Variant) bool { return true })
+		productID, variantID = variant.ProductID, variant.ID
+
+		carts, items := cart.CartsOf(mem), cart.ItemsOf(mem)
+		for userID := 1; userID <= concurrentBuyers; userID++ {
+			c := cart.Cart{ID: carts.NextID(), UserID: userID}
+			carts.Put(c.ID, c)
+			item := cart.CartItem{ID: items.NextID(), CartID: c.ID, ProductID: productID, VariantID: variantID, Quantity: 1}
+			items.Put(item.ID, item)
+			buyers = append(buyers, databasetest.Buyer{UserID: userID, CartID: c.ID})
+		}
+		return nil
+	})
+
+	return stockFixture{
+		repo:   NewMemoryOrderRepository(mem),
+		buyers: buyers,
+		stockOf: func() (int, int, error) {
+			var variantStock, productStock int
+			err := mem.View(func() error {
+				variant, _ := product.VariantsOf(mem).Get(variantID)
+				p, _ := product.ProductsOf(mem).Get(productID)
+				variantStock, productStock = variant.StockQuantity, p.StockQuantity
+				return nil
+			})
+			return variantStock, productStock, err
+		},
+	}
+}
+
+func newMySQLStockFixture(t *testing.T) stockFixture {
+	db := databasetest.Open(t)
+	stock := databasetest.InsertStock(t, db, unitsInStock, concurrentBuyers)
+	for _, b := range stock.Buyers {
+		databasetest.Exec(t, db, `INSERT INTO cart_items (cart_id, product_id, variant_id, quantity) VALUES (?, ?, ?, 1)`, b.CartID, stock.ProductID, stock.VariantID)
+	}
+
+	return stockFixture{
+		repo:   NewMySQLOrderRepository(db),
+		buyers: stock.Buyers,
+		stockOf: func() (int, int, error) {
+			var variantStock, productStock int
+			err := db.QueryRow(`SELECT v.stock_quantity, p.stockQuantity FROM product_variants v JOIN products p ON p.productId = v.product_id
+				WHERE v.id = ?`, stock.VariantID).Scan(&variantStock, &productStock)
+			return variantStock, productStock, err
+		},
+	}
+}
+
+func TestConcurrentCheckoutsMemory(t *testing.T) {
+	testConcurrentCheckouts(t, newMemoryStockFixture(t))
+}
+
+func TestConcurrentCheckoutsMySQL(t *testing.T) {
+	testConcurrentCheckouts(t, newMySQLStockFixture(t))
+}
+
+// testConcurrentCheckouts checks out every cart of the fixture at once: exactly unitsInStock orders
+// are placed, the others fail for lack of stock and the stock never goes below zero
+func testConcurrentCheckouts(t *testing.T, f stockFixture) {
+	pipeline := pricing.NewPipeline("US", pricing.SubtotalCalculator{})
+
+	// watch the stock while the checkouts run
+	done := make(chan struct{})
+	watched := make(chan int)
+	go func() {
+		lowest := unitsInStock
+		for {
+			select {
+			case <-done:
+				watched <- lowest
+				return
+			default:
+			}
+			variantStock, productStock, err := f.stockOf()
+			if err == nil {
+				lowest = min(lowest, variantStock, productStock)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(f.buyers))
+	for i, b := range f.buyers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = f.repo.checkout(Order{UserID: b.UserID}, b.CartID, UserActor(b.UserID), pipeline, pricing.Input{})
+		}()
+	}
+	wg.Wait()
+	close(done)
+
+	sold := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			sold++
+		case errors.Is(err, ErrInsufficientStock):
+		default:
+			t.Errorf("checkout of cart %d: %v", f.buyers[i].CartID, err)
+		}
+	}
+	if sold != unitsInStock {
+		t.Errorf("%d orders placed, want %d", sold, unitsInStock)
+	}
+
+	if lowest := <-watched; lowest < 0 {
+		t.Errorf("stock went down to %d", lowest)
+	}
+	variantStock, productStock, err := f.stockOf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if variantStock != 0 || productStock != 0 {
+		t.Errorf("stock left: variant %d, product %d, want 0", variantStock, productStock)
+	}
+}
@@ -0,0 +1,186 @@
+package order
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/ecommerce/internal/services/address"
+	"github.com/ecommerce/internal/services/pricing"
+	"github.com/ecommerce/internal/services/promotion"
+)
+
+// OrderService handles business logic for order-related operations.
+type OrderService struct {
+	Repo       OrderRepository
+	Promotions *promotion.PromotionService
+	Pricing    *pricing.Pipeline
+	Addresses  *address.AddressService
+
+	// Guards may refuse a status transition before it is made, e.g. the payment service
+	// refuses to cancel an order that has a payment in progress or collected. The repository
+	// runs them with the order locked, so nothing they check changes before the status does.
+	Guards []TransitionGuard
+}
+
+// TransitionGuard returns an error when the order may not move to the status to
+type TransitionGuard func(order *Order, to Status) error
+
+// checkGuards runs the guards of a transition and returns the error of the first one refusing it
+func checkGuards(guards []TransitionGuard, order *Order, to Status) error {
+	for _, guard := range guards {
+		if err := guard(order, to); err != nil {
+			log.Printf("Refused to move order %d to %s: %v", order.ID, to, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// NewOrderService creates a new OrderService, promotions price the coupon applied to the cart at checkout
+// and the pricing pipeline quotes the order the way the cart page did. Orders ship to an address of the
+// user's address book.
+func NewOrderService(repo OrderRepository, promotions *promotion.PromotionService, pipeline *pricing.Pipeline, addresses *address.AddressService) *OrderService {
+	return &OrderService{
+		Repo:       repo,
+		Promotions: promotions,
+		Pricing:    pipeline,
+		Addresses:  addresses,
+	}
+}
+
+// checkoutService places an order for everything in the user's cart, shipped to the address of the user
+// with addressID or to their default shipping address when addressID is 0, and billed to their default
+// billing address, the shipping address if they have none. The order is priced for the region of the
+// shipping address and redeems the coupon applied to the cart. A coupon that no longer applies fails the
+// checkout rather than silently charging the full price.
+func (s *OrderService) checkoutService(userID, cartID, addressID int) (*Order, error) {
+	shipping, billing, err := s.checkoutAddresses(userID, addressID)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := s.Repo.getCartCoupon(cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := shipping.PricingRegion()
+	if err != nil {
+		return nil, err
+	}
+
+	in := pricing.Input{Region: region}
+	if code != "" {
+		in.Offer, err = s.Promotions.Offer(code, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	placed := Order{UserID: userID, ShippingAddress: shipping.Snapshot(), BillingAddress: billing.Snapshot()}
+	order, err := s.Repo.checkout(placed, cartID, UserActor(userID), s.Pricing, in)
+	if err != nil {
+		log.Printf("Error checking out cart %d: %v", cartID, err)
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// getOrderService returns an order with its items. Customers can only see their own orders.
+func (s *OrderService) getOrderService(orderID, userID int, isAdmin bool) (*Order, error) {
+	order, err := s.Repo.getOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil || (!isAdmin && order.UserID != userID) {
+		return nil, ErrOrderNotFound
+	}
+
+	return order, nil
+}
+
+// getOrdersService returns the orders of the user with their items, the newest first
+func (s *OrderService) getOrdersService(userID int) ([]Order, error) {
+	orders, err := s.Repo.getUserOrders(userID)
+	if err != nil {
+		log.Printf("Error fetching orders of user %d: %v", userID, err)
+		return nil, err
+	}
+	return orders, nil
+}
+
+// Order returns an order with its items, for the services acting on orders
+func (s *OrderService) Order(orderID int) (*Order, error) {
+	order, err := s.Repo.getOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	return order, nil
+}
+
+// getOrderTimelineService returns the status history of an order visible to the user.
+func (s *OrderService) getOrderTimelineService(orderID, userID int, isAdmin bool) ([]StatusChange, error) {
+	_, err := s.getOrderService(orderID, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.Repo.getStatusHistory(orderID)
+	if err != nil {
+		log.Printf("Error fetching status history of order %d: %v", orderID, err)
+		return nil, err
+	}
+	return history, nil
+}
+
+// Transition moves an order to the given status if the transition table and the guards allow it,
+// recording who made the change in the order status history. A cancelled or refunded order gives
+// its stock and its coupon use back.
+func (s *OrderService) Transition(orderID int, to Status, actor, note string) (*StatusChange, error) {
+	if !to.IsValid() {
+		return nil, ErrUnknownStatus.Withf("unknown order status %q", to)
+	}
+
+	change, err := s.Repo.transitionStatus(orderID, to, actor, note, s.Guards)
+	if err != nil {
+		log.Printf("Error moving order %d to %s: %v", orderID, to, err)
+		return nil, err
+	}
+
+	return change, nil
+}
+
+// checkoutAddresses returns the addresses of the user an order is shipped and billed to
+func (s *OrderService) checkoutAddresses(userID, addressID int) (*address.Address, *address.Address, error) {
+	var shipping *address.Address
+	var err error
+	if addressID != 0 {
+		shipping, err = s.Addresses.Address(userID, addressID)
+	} else {
+		shipping, err = s.Addresses.DefaultShipping(userID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if shipping == nil {
+		return nil, nil, address.ErrAddressRequired
+	}
+
+	billing, err := s.Addresses.DefaultBilling(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if billing == nil {
+		billing = shipping
+	}
+	return shipping, billing, nil
+}
+
+// UserActor is the actor recorded in the status history for changes made by a user
+func UserActor(userID int) string {
+	return fmt.Sprintf("user:%d", userID)
+}
@@ -0,0 +1,150 @@
+package order
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/services/cart"
+	"github.com/ecommerce/internal/services/pricing"
+	"github.com/ecommerce/internal/services/product"
+	"github.com/ecommerce/internal/services/promotion"
+)
+
+const (
+	customerID = 3
+	inStock    = 5 // units of the product before checkout
+	ordered    = 2 // units of the product in the order
+)
+
+// placedOrder is a pending order of ordered units, placed with a coupon, on the memory database
+type placedOrder struct {
+	s                    *OrderService
+	mem                  *memory.DB
+	orderID              int
+	productID, variantID int
+	promotionID          int
+}
+
+func newPlacedOrder(t *testing.T) placedOrder {
+	t.Helper()
+	mem := memory.New()
+	product.NewMemoryProductRepository(mem).Seed([]product.Product{
+		{ProductName: "Release test", ProductBrand: "Test", PricePerUnit: 10, StockQuantity: inStock},
+	})
+
+	o := placedOrder{s: NewOrderService(NewMemoryOrderRepository(mem), nil, nil, nil), mem: mem}
+	var cartID int
+	var coupon promotion.Promotion
+	mem.Update(func() error {
+		variant, _ := product.VariantsOf(mem).First(func(product.Variant) bool { return true })
+		o.productID, o.variantID = variant.ProductID, variant.ID
+
+		carts, items := cart.CartsOf(mem), cart.ItemsOf(mem)
+		c := cart.Cart{ID: carts.NextID(), UserID: customerID}
+		carts.Put(c.ID, c)
+		item := cart.CartItem{ID: items.NextID(), CartID: c.ID, ProductID: o.productID, VariantID: o.variantID, Quantity: ordered}
+		items.Put(item.ID, item)
+		cartID = c.ID
+
+		promotions := promotion.PromotionsOf(mem)
+		coupon = promotion.Promotion{ID: promotions.NextID(), Code: "TENOFF", Kind: promotion.KindPercentOff, Value: 10, Active: true}
+		promotions.Put(coupon.ID, coupon)
+		o.promotionID = coupon.ID
+		return nil
+	})
+
+	pipeline := pricing.NewPipeline("US", pricing.SubtotalCalculator{}, pricing.DiscountCalculator{})
+	placed, err := o.s.Repo.checkout(Order{UserID: customerID}, cartID, UserActor(customerID), pipeline, pricing.Input{Offer: &promotion.Offer{Promotion: coupon}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.orderID = placed.ID
+	return o
+}
+
+// state returns the stock of the product and its variant, the uses of the coupon and its redemptions
+func (o placedOrder) state() (variantStock, productStock, uses, redemptions int) {
+	o.mem.View(func() error {
+		variant, _ := product.VariantsOf(o.mem).Get(o.variantID)
+		p, _ := product.ProductsOf(o.mem).Get(o.productID)
+		coupon, _ := promotion.PromotionsOf(o.mem).Get(o.promotionID)
+		variantStock, productStock, uses = variant.StockQuantity, p.StockQuantity, coupon.Uses
+		redemptions = promotion.CountRedemptionsOf(o.mem, o.promotionID, customerID)
+		return nil
+	})
+	return
+}
+
+func TestTransitionReleasesOrder(t *testing.T) {
+	tests := []struct {
+		path    []Status
+		release bool
+	}{
+		{[]Status{StatusCancelled}, true},
+		{[]Status{StatusPaid, StatusRefunded}, true},
+		{[]Status{StatusPaid}, false},
+		{[]Status{StatusPaid, StatusShipped, StatusDelivered}, false},
+	}
+	for _, tt := range tests {
+		o := newPlacedOrder(t)
+		if variantStock, productStock, uses, redemptions := o.state(); variantStock != inStock-ordered || productStock != inStock-ordered || uses != 1 || redemptions != 1 {
+			t.Fatalf("after checkout: stock %d/%d, %d uses, %d redemptions", variantStock, productStock, uses, redemptions)
+		}
+
+		for _, to := range tt.path {
+			if _, err := o.s.Transition(o.orderID, to, UserActor(1), ""); err != nil {
+				t.Fatalf("%v: %v", tt.path, err)
+			}
+		}
+
+		wantStock, wantUses := inStock-ordered, 1
+		if tt.release {
+			wantStock, wantUses = inStock, 0
+		}
+		variantStock, productStock, uses, redemptions := o.state()
+		if variantStock != wantStock || productStock != wantStock {
+			t.Errorf("%v: stock %d, product stock %d, want %d", tt.path, variantStock, productStock, wantStock)
+		}
+		if uses != wantUses || redemptions != wantUses {
+			t.Errorf("%v: coupon used %d times with %d redemptions, want %d", tt.path, uses, redemptions, wantUses)
+		}
+	}
+}
+
+func TestTransitionGuardSeesWritesBeforeTheTransition(t *testing.T) {
+	o := newPlacedOrder(t)
+
+	// the guard refuses to cancel a paid order, the payment lands right after its first check
+	errPaid := errors.New("order has a payment")
+	paid, checks := false, 0
+	o.s.Guards = []TransitionGuard{func(order *Order, to Status) error {
+		checks++
+		var isPaid bool
+		o.mem.View(func() error {
+			isPaid = paid
+			return nil
+		})
+		if isPaid {
+			return errPaid
+		}
+		if checks == 1 {
+			o.mem.Update(func() error {
+				paid = true
+				return nil
+			})
+		}
+		return nil
+	}}
+
+	if _, err := o.s.Transition(o.orderID, StatusCancelled, UserActor(customerID), ""); !errors.Is(err, errPaid) {
+		t.Fatalf("cancel after the payment: err = %v, want the guard to refuse", err)
+	}
+	order, err := o.s.Order(o.orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != StatusPending || checks != 2 {
+		t.Errorf("order %s after %d guard checks, want it pending after 2", order.Status, checks)
+	}
+}
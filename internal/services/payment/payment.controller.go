@@ -0,0 +1,264 @@
+package payment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/ecommerce/internal/core/middleware"
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/core/session"
+	"github.com/ecommerce/internal/services/order"
+	"github.com/gorilla/mux"
+)
+
+const (
+	paymentsBasePath = "payments"
+	prodBasePath     = "prod"
+	apiBasePath      = "api"
+)
+
+// maxWebhookSize is the largest webhook body accepted
+const maxWebhookSize = 64 << 10
+
+var (
+	errAuthRequired   = response.Unauthorized("authentication required")
+	errOrderIDMissing = response.Validation(map[string]string{"order_id": "is required"})
+)
+
+// SetupRoutes :
+func SetupPaymentRoutes(r *mux.Router, s *PaymentService) {
+	apiUrlPath := fmt.Sprintf("/%s/%s", apiBasePath, paymentsBasePath)
+	paymentRouter := r.PathPrefix(apiUrlPath).Subrouter()
+
+	paymentRouter.HandleFunc("", paymentsHandler(s))
+	// public, the provider signs its webhooks
+	paymentRouter.HandleFunc("/webhook", webhookHandler(s))
+	paymentRouter.HandleFunc("/{id}", paymentHandler(s))
+	// only admins collect and refund payments
+	paymentRouter.HandleFunc("/{id}/capture", middleware.RequireRole(middleware.RoleAdmin, captureHandler(s)))
+	paymentRouter.HandleFunc("/{id}/refund", middleware.RequireRole(middleware.RoleAdmin, refundHandler(s)))
+
+	// -------------------------PROD----------------------
+	prodUrlPath := fmt.Sprintf("/%s/%s", prodBasePath, paymentsBasePath)
+	prodPaymentRouter := r.PathPrefix(prodUrlPath).Subrouter()
+
+	prodPaymentRouter.HandleFunc("", paymentsHandler(s)).Methods(http.MethodPost)
+	prodPaymentRouter.HandleFunc("/{id}", paymentHandler(s)).Methods(http.MethodGet)
+}
+
+// paymentsHandler pays one of the user's orders (POST) or lists the payments of an order (GET ?order_id=)
+func paymentsHandler(s *PaymentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			return
+		}
+
+		user, err := session.GetUserFromContext(r)
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, errAuthRequired)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			var payload payPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+			if payload.OrderID == 0 {
+				response.WriteError(w, errOrderIDMissing)
+				return
+			}
+
+			payment, err := s.payService(user.UserID, payload.OrderID, payload.Token)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusCreated, payment)
+			return
+		case http.MethodGet:
+			orderID, err := strconv.Atoi(r.URL.Query().Get("order_id"))
+			if err != nil {
+				response.WriteError(w, errOrderIDMissing)
+				return
+			}
+
+			payments, err := s.getOrderPaymentsService(orderID, user.UserID, user.IsAdmin == 1)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, payments)
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// paymentHandler returns a payment of one of the user's orders along with its history
+func paymentHandler(s *PaymentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			user, err := session.GetUserFromContext(r)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, errAuthRequired)
+				return
+			}
+
+			paymentID, err := strconv.Atoi(mux.Vars(r)["id"])
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, ErrPaymentNotFound)
+				return
+			}
+
+			payment, err := s.getPaymentService(paymentID, user.UserID, user.IsAdmin == 1)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, payment)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// captureHandler collects an authorized payment
+func captureHandler(s *PaymentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			user, err := session.GetUserFromContext(r)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, errAuthRequired)
+				return
+			}
+
+			paymentID, err := strconv.Atoi(mux.Vars(r)["id"])
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, ErrPaymentNotFound)
+				return
+			}
+
+			payment, err := s.captureService(paymentID, order.UserActor(user.UserID))
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, payment)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// refundHandler pays a captured payment back, in full unless the body gives an amount
+func refundHandler(s *PaymentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			user, err := session.GetUserFromContext(r)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, errAuthRequired)
+				return
+			}
+
+			paymentID, err := strconv.Atoi(mux.Vars(r)["id"])
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, ErrPaymentNotFound)
+				return
+			}
+
+			var payload refundPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			payment, err := s.refundService(paymentID, payload.Amount, order.UserActor(user.UserID))
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, payment)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// webhookHandler receives the events of the payment provider
+func webhookHandler(s *PaymentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			err = s.handleWebhookService(r.Header, payload)
+			if err != nil {
+				log.Println("Error handling payment webhook:", err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, map[string]interface{}{"success": true})
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// payPayload is the request body accepted when paying an order
+type payPayload struct {
+	OrderID int    `json:"order_id"`
+	Token   string `json:"token"` // payment method collected by the provider, see gateway.TokenSuccess for the fake gateway
+}
+
+// refundPayload is the request body accepted when refunding a payment
+type refundPayload struct {
+	Amount float64 `json:"amount"` // 0 refunds everything left
+}
@@ -0,0 +1,93 @@
+package payment
+
+import (
+	"time"
+
+	"github.com/ecommerce/internal/core/gateway"
+	"github.com/ecommerce/utils"
+)
+
+// Payment is a charge of an order through a payment provider. Amount is held when the payment is
+// authorized and collected as CapturedAmount on capture, refunds pay RefundedAmount back.
+// A partly refunded payment stays captured, it is refunded once all of it was paid back.
+type Payment struct {
+	ID             int            `json:"id"`
+	OrderID        int            `json:"order_id"`
+	UserID         int            `json:"user_id"`
+	Provider       string         `json:"provider"`
+	Reference      string         `json:"reference"` // id of the payment at the provider
+	Status         gateway.Status `json:"status"`
+	Amount         float64        `json:"amount"`
+	Currency       string         `json:"currency"`
+	CapturedAmount float64        `json:"captured_amount"`
+	RefundedAmount float64        `json:"refunded_amount"`
+	FailureReason  string         `json:"failure_reason,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	Events         []Event        `json:"events,omitempty"` // One-to-many relationship
+}
+
+// Event is an entry of the history of a payment, an outcome reported by its provider
+type Event struct {
+	ID        int            `json:"id"`
+	PaymentID int            `json:"payment_id"`
+	EventID   string         `json:"event_id,omitempty"` // id of the provider webhook, empty for synchronous outcomes
+	Status    gateway.Status `json:"status"`
+	Amount    float64        `json:"amount"`
+	Note      string         `json:"note,omitempty"`
+	Actor     string         `json:"actor"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// IsActive reports whether the payment is in progress or collected, an order has at most one active payment
+func (p Payment) IsActive() bool {
+	switch p.Status {
+	case gateway.StatusPending, gateway.StatusAuthorized, gateway.StatusCaptured:
+		return true
+	}
+	return false
+}
+
+// RefundableAmount returns what can still be refunded of the payment
+func (p Payment) RefundableAmount() float64 {
+	if p.Status != gateway.StatusCaptured {
+		return 0
+	}
+	return utils.RoundAmount(p.CapturedAmount - p.RefundedAmount)
+}
+
+// apply moves the payment along an outcome reported by its provider
+func (p *Payment) apply(result gateway.Result) error {
+	switch result.Status {
+	case gateway.StatusAuthorized:
+		if p.Status != gateway.StatusPending {
+			break
+		}
+		p.Status = gateway.StatusAuthorized
+		return nil
+	case gateway.StatusDeclined:
+		if p.Status != gateway.StatusPending {
+			break
+		}
+		p.Status = gateway.StatusDeclined
+		p.FailureReason = result.Reason
+		return nil
+	case gateway.StatusCaptured:
+		if p.Status != gateway.StatusAuthorized {
+			break
+		}
+		p.Status = gateway.StatusCaptured
+		p.CapturedAmount = result.Amount
+		return nil
+	case gateway.StatusRefunded:
+		if p.Status != gateway.StatusCaptured {
+			break
+		}
+		p.RefundedAmount = utils.RoundAmount(p.RefundedAmount + result.Amount)
+		if p.RefundedAmount >= p.CapturedAmount {
+			p.Status = gateway.StatusRefunded
+		}
+		return nil
+	}
+	return ErrIllegalTransition.Withf("illegal payment transition: %s -> %s", p.Status, result.Status)
+}
@@ -0,0 +1,135 @@
+package payment
+
+import (
+	"time"
+
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/services/order"
+)
+
+// MemoryPaymentRepository is a PaymentRepository keeping payments in a memory.DB
+type MemoryPaymentRepository struct {
+	mem *memory.DB
+}
+
+func NewMemoryPaymentRepository(mem *memory.DB) *MemoryPaymentRepository {
+	return &MemoryPaymentRepository{mem: mem}
+}
+
+// addPayment records a payment of a pending order along with the first event of its history,
+// an order has at most one active payment
+func (repo *MemoryPaymentRepository) addPayment(payment Payment, event Event) (int, error) {
+	err := repo.mem.Update(func() error {
+		o, ok := order.OrdersOf(repo.mem).Get(payment.OrderID)
+		if !ok {
+			return order.ErrOrderNotFound
+		}
+		if o.Status != order.StatusPending {
+			return ErrOrderNotPayable
+		}
+		if payment.IsActive() {
+			if _, active := repo.payments().First(func(p Payment) bool { return p.OrderID == payment.OrderID && p.IsActive() }); active {
+				return ErrOrderAlreadyPaid
+			}
+		}
+
+		now := time.Now()
+		payment.ID = repo.payments().NextID()
+		payment.CreatedAt = now
+		payment.UpdatedAt = now
+		payment.Events = nil
+		repo.payments().Put(payment.ID, payment)
+
+		event.PaymentID = payment.ID
+		repo.insertEvent(&event)
+		return nil
+	})
+	return payment.ID, err
+}
+
+// getPayment returns a payment along with its history, nil if there is none
+func (repo *MemoryPaymentRepository) getPayment(paymentID int) (*Payment, error) {
+	var payment *Payment
+	err := repo.mem.View(func() error {
+		found, ok := repo.payments().Get(paymentID)
+		if !ok {
+			return nil
+		}
+		found.Events = repo.events().Filter(func(e Event) bool { return e.PaymentID == paymentID })
+		payment = &found
+		return nil
+	})
+	return payment, err
+}
+
+// getPaymentByReference returns the payment a provider knows by reference, without its history, nil if there is none
+func (repo *MemoryPaymentRepository) getPaymentByReference(provider, reference string) (*Payment, error) {
+	var payment *Payment
+	err := repo.mem.View(func() error {
+		if found, ok := repo.payments().First(func(p Payment) bool { return p.Provider == provider && p.Reference == reference }); ok {
+			payment = &found
+		}
+		return nil
+	})
+	return payment, err
+}
+
+// getOrderPayments returns the payments of an order without their history, oldest first
+func (repo *MemoryPaymentRepository) getOrderPayments(orderID int) ([]Payment, error) {
+	var payments []Payment
+	err := repo.mem.View(func() error {
+		payments = repo.payments().Filter(func(p Payment) bool { return p.OrderID == orderID })
+		return nil
+	})
+	return payments, err
+}
+
+// updatePayment changes a payment with apply and records the event that changed it. An event the provider
+// delivered before is not applied again: the payment is returned as it is with false.
+func (repo *MemoryPaymentRepository) updatePayment(paymentID int, event Event, apply func(*Payment) error) (*Payment, bool, error) {
+	var payment Payment
+	var applied bool
+	err := repo.mem.Update(func() error {
+		var ok bool
+		payment, ok = repo.payments().Get(paymentID)
+		if !ok {
+			return ErrPaymentNotFound
+		}
+
+		if event.EventID != "" {
+			if _, seen := repo.events().First(func(e Event) bool { return e.PaymentID == paymentID && e.EventID == event.EventID }); seen {
+				return nil
+			}
+		}
+
+		if err := apply(&payment); err != nil {
+			return err
+		}
+		payment.UpdatedAt = time.Now()
+		repo.payments().Put(payment.ID, payment)
+
+		event.PaymentID = paymentID
+		repo.insertEvent(&event)
+		applied = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &payment, applied, nil
+}
+
+// insertEvent writes a payment history row, the caller must hold the write lock
+func (repo *MemoryPaymentRepository) insertEvent(event *Event) {
+	event.ID = repo.events().NextID()
+	event.CreatedAt = time.Now()
+	repo.events().Put(event.ID, *event)
+}
+
+func (repo *MemoryPaymentRepository) payments() *memory.Table[Payment] {
+	return memory.TableOf[Payment](repo.mem, TABLE_NAME)
+}
+
+func (repo *MemoryPaymentRepository) events() *memory.Table[Event] {
+	return memory.TableOf[Event](repo.mem, EVENTS_TABLE)
+}
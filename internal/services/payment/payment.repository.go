@@ -0,0 +1,272 @@
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/services/order"
+	"github.com/ecommerce/utils"
+)
+
+const (
+	TABLE_NAME   = "payments"
+	EVENTS_TABLE = "payment_events"
+)
+
+// paymentColumns are the columns scanned by scanPayment
+const paymentColumns = `id, order_id, user_id, provider, reference, status, amount, currency, captured_amount, refunded_amount,
+	failure_reason, created_at, updated_at`
+
+var (
+	ErrPaymentNotFound   = response.New(http.StatusNotFound, "payment_not_found", "payment not found")
+	ErrOrderNotPayable   = response.New(http.StatusConflict, "order_not_payable", "only pending orders can be paid")
+	ErrOrderAlreadyPaid  = response.New(http.StatusConflict, "order_already_paid", "the order already has a payment in progress or collected")
+	ErrOrderHasPayment   = response.New(http.StatusConflict, "order_has_payment", "the order has a payment in progress or collected")
+	ErrIllegalTransition = response.New(http.StatusConflict, "illegal_payment_transition", "illegal payment status transition")
+	ErrInvalidRefund     = response.New(http.StatusBadRequest, "invalid_refund_amount", "invalid refund amount")
+	ErrInvalidSignature  = response.New(http.StatusUnauthorized, "invalid_signature", "invalid webhook signature")
+)
+
+// PaymentRepository stores payments and their history. MySQLPaymentRepository is the production
+// implementation, MemoryPaymentRepository keeps everything in process for demos and tests.
+type PaymentRepository interface {
+	addPayment(payment Payment, event Event) (int, error)
+	getPayment(paymentID int) (*Payment, error)
+	getPaymentByReference(provider, reference string) (*Payment, error)
+	getOrderPayments(orderID int) ([]Payment, error)
+	updatePayment(paymentID int, event Event, apply func(*Payment) error) (*Payment, bool, error)
+}
+
+type MySQLPaymentRepository struct {
+	db *sql.DB
+}
+
+func NewMySQLPaymentRepository(db *sql.DB) *MySQLPaymentRepository {
+	return &MySQLPaymentRepository{db: db}
+}
+
+// addPayment records a payment of a pending order along with the first event of its history. The order is
+// locked so concurrent payments and status changes of an order are made one after the other and only one
+// payment is active.
+func (repo *MySQLPaymentRepository) addPayment(payment Payment, event Event) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin payment transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var status order.Status
+	err = tx.QueryRowContext(ctx, `SELECT status FROM orders WHERE id = ? FOR UPDATE`, payment.OrderID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return 0, order.ErrOrderNotFound
+	} else if err != nil {
+		return 0, err
+	}
+	if status != order.StatusPending {
+		return 0, ErrOrderNotPayable
+	}
+	if payment.IsActive() {
+		var active int
+		err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM payments WHERE order_id = ? AND status IN ('pending', 'authorized', 'captured')`,
+			payment.OrderID).Scan(&active)
+		if err != nil {
+			return 0, err
+		}
+		if active > 0 {
+			return 0, ErrOrderAlreadyPaid
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO payments (order_id, user_id, provider, reference, status, amount, currency, failure_reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		payment.OrderID, payment.UserID, payment.Provider, payment.Reference, payment.Status, payment.Amount, payment.Currency,
+		payment.FailureReason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create payment: %v", err)
+	}
+	paymentID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	event.PaymentID = int(paymentID)
+	if err := insertEvent(ctx, tx, &event); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit payment: %v", err)
+	}
+	return int(paymentID), nil
+}
+
+// getPayment returns a payment along with its history, nil if there is none
+func (repo *MySQLPaymentRepository) getPayment(paymentID int) (*Payment, error) {
+	payment := &Payment{}
+	err := scanPayment(repo.db.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE id = ?`, paymentID), payment)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	rows, err := repo.db.Query(`
+		SELECT id, payment_id, COALESCE(event_id, ''), status, amount, note, actor, created_at
+		FROM payment_events
+		WHERE payment_id = ?
+		ORDER BY created_at, id`, paymentID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event Event
+		err := rows.Scan(
+			&event.ID,
+			&event.PaymentID,
+			&event.EventID,
+			&event.Status,
+			&event.Amount,
+			&event.Note,
+			&event.Actor,
+			&event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		payment.Events = append(payment.Events, event)
+	}
+	return payment, rows.Err()
+}
+
+// getPaymentByReference returns the payment a provider knows by reference, without its history, nil if there is none
+func (repo *MySQLPaymentRepository) getPaymentByReference(provider, reference string) (*Payment, error) {
+	payment := &Payment{}
+	err := scanPayment(repo.db.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE provider = ? AND reference = ?`,
+		provider, reference), payment)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return payment, nil
+}
+
+// getOrderPayments returns the payments of an order without their history, oldest first
+func (repo *MySQLPaymentRepository) getOrderPayments(orderID int) ([]Payment, error) {
+	rows, err := repo.db.Query(`SELECT `+paymentColumns+` FROM payments WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := make([]Payment, 0)
+	for rows.Next() {
+		var payment Payment
+		if err := scanPayment(rows, &payment); err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+// updatePayment changes a payment with apply and records the event that changed it, in a single transaction
+// with the payment locked. An event the provider delivered before is not applied again: the payment is
+// returned as it is with false.
+func (repo *MySQLPaymentRepository) updatePayment(paymentID int, event Event, apply func(*Payment) error) (*Payment, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin payment transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	payment := &Payment{}
+	err = scanPayment(tx.QueryRowContext(ctx, `SELECT `+paymentColumns+` FROM payments WHERE id = ? FOR UPDATE`, paymentID), payment)
+	if err == sql.ErrNoRows {
+		return nil, false, ErrPaymentNotFound
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	event.PaymentID = paymentID
+	err = insertEvent(ctx, tx, &event)
+	if utils.IsDuplicateEntry(err) {
+		return payment, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if err := apply(payment); err != nil {
+		return nil, false, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE payments SET reference = ?, status = ?, captured_amount = ?, refunded_amount = ?, failure_reason = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		payment.Reference, payment.Status, payment.CapturedAmount, payment.RefundedAmount, payment.FailureReason, paymentID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to update payment %d: %v", paymentID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit payment: %v", err)
+	}
+	payment.UpdatedAt = time.Now()
+	return payment, true, nil
+}
+
+// helper functions
+
+// scanPayment scans a row of the paymentColumns into payment
+func scanPayment(row utils.RowScanner, payment *Payment) error {
+	return row.Scan(
+		&payment.ID,
+		&payment.OrderID,
+		&payment.UserID,
+		&payment.Provider,
+		&payment.Reference,
+		&payment.Status,
+		&payment.Amount,
+		&payment.Currency,
+		&payment.CapturedAmount,
+		&payment.RefundedAmount,
+		&payment.FailureReason,
+		&payment.CreatedAt,
+		&payment.UpdatedAt)
+}
+
+// insertEvent writes a payment history row inside the given transaction, the unique key on the
+// provider event id makes it fail with a duplicate entry for an event that was recorded before
+func insertEvent(ctx context.Context, tx *sql.Tx, event *Event) error {
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO payment_events (payment_id, event_id, status, amount, note, actor)
+		VALUES (?, NULLIF(?, ''), ?, ?, ?, ?)`,
+		event.PaymentID, event.EventID, event.Status, event.Amount, event.Note, event.Actor)
+	if err != nil {
+		return err
+	}
+	eventID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	event.ID = int(eventID)
+	event.CreatedAt = time.Now()
+	return nil
+}
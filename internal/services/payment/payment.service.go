@@ -0,0 +1,299 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ecommerce/internal/core/gateway"
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/services/order"
+	"github.com/ecommerce/utils"
+)
+
+// errTokenRequired is returned when paying without a payment token
+var errTokenRequired = response.Validation(map[string]string{"token": "is required"})
+
+// PaymentService handles business logic for payment-related operations.
+type PaymentService struct {
+	Repo     PaymentRepository
+	Provider gateway.PaymentProvider
+	Orders   *order.OrderService
+	Currency string
+}
+
+// NewPaymentService creates a new PaymentService charging orders through the provider, in the given currency.
+// Payment outcomes drive the status of their order through the order service.
+func NewPaymentService(repo PaymentRepository, provider gateway.PaymentProvider, orders *order.OrderService, currency string) *PaymentService {
+	return &PaymentService{
+		Repo:     repo,
+		Provider: provider,
+		Orders:   orders,
+		Currency: currency,
+	}
+}
+
+// payService authorizes the total of a pending order of the user with the payment method the token stands for.
+// The payment is recorded as pending before the provider is called, which holds the order: a concurrent payment
+// is refused and the order can't be cancelled meanwhile. The payment may be declined right away or stay pending
+// until the provider confirms it through a webhook, a declined payment lets the user try again.
+func (s *PaymentService) payService(userID, orderID int, token string) (*Payment, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, errTokenRequired
+	}
+
+	o, err := s.Orders.Order(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if o.UserID != userID {
+		return nil, order.ErrOrderNotFound
+	}
+	if o.Status != order.StatusPending {
+		return nil, ErrOrderNotPayable
+	}
+
+	// the provider assigns the reference of the payment, until it answers the payment has a local one
+	localReference, err := utils.GenerateToken(16)
+	if err != nil {
+		return nil, err
+	}
+	actor := order.UserActor(userID)
+	payment := Payment{
+		OrderID:   orderID,
+		UserID:    userID,
+		Provider:  s.Provider.Name(),
+		Reference: "local_" + localReference,
+		Status:    gateway.StatusPending,
+		Amount:    o.TotalAmount,
+		Currency:  s.Currency,
+	}
+	paymentID, err := s.Repo.addPayment(payment, Event{Status: gateway.StatusPending, Amount: o.TotalAmount, Note: "authorization requested", Actor: actor})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.Provider.Authorize(gateway.AuthorizeRequest{OrderID: orderID, Amount: o.TotalAmount, Currency: s.Currency, Token: token})
+	if err != nil {
+		// decline the payment so that it doesn't hold the order and the user can try again
+		declined := Event{Status: gateway.StatusDeclined, Amount: o.TotalAmount, Note: "authorization failed", Actor: actor}
+		_, _, declineErr := s.Repo.updatePayment(paymentID, declined, func(p *Payment) error {
+			return p.apply(gateway.Result{Status: gateway.StatusDeclined, Reason: declined.Note})
+		})
+		if declineErr != nil {
+			log.Printf("Error declining payment %d: %v", paymentID, declineErr)
+		}
+		return nil, fmt.Errorf("failed to authorize payment of order %d: %w", orderID, err)
+	}
+
+	event := Event{Status: result.Status, Amount: o.TotalAmount, Note: result.Reason, Actor: actor}
+	if result.Status == gateway.StatusPending {
+		event.Note = "awaiting the confirmation of the provider"
+	}
+	_, _, err = s.Repo.updatePayment(paymentID, event, func(p *Payment) error {
+		p.Reference = result.Reference
+		if result.Status == gateway.StatusPending {
+			return nil
+		}
+		return p.apply(*result)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Payment %d of order %d is %s", paymentID, orderID, result.Status)
+	return s.Repo.getPayment(paymentID)
+}
+
+// getPaymentService returns a payment with its history. Customers can only see the payments of their own orders.
+func (s *PaymentService) getPaymentService(paymentID, userID int, isAdmin bool) (*Payment, error) {
+	payment, err := s.Repo.getPayment(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment == nil || (!isAdmin && payment.UserID != userID) {
+		return nil, ErrPaymentNotFound
+	}
+	return payment, nil
+}
+
+// getOrderPaymentsService returns the payments of an order visible to the user
+func (s *PaymentService) getOrderPaymentsService(orderID, userID int, isAdmin bool) ([]Payment, error) {
+	o, err := s.Orders.Order(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin && o.UserID != userID {
+		return nil, order.ErrOrderNotFound
+	}
+	return s.Repo.getOrderPayments(orderID)
+}
+
+// captureService collects an authorized payment, which marks its order paid
+func (s *PaymentService) captureService(paymentID int, actor string) (*Payment, error) {
+	payment, err := s.Repo.getPayment(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment == nil {
+		return nil, ErrPaymentNotFound
+	}
+	if payment.Status != gateway.StatusAuthorized {
+		return nil, ErrIllegalTransition.Withf("only authorized payments can be captured, the payment is %s", payment.Status)
+	}
+	o, err := s.Orders.Order(payment.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if o.Status != order.StatusPending {
+		return nil, ErrOrderNotPayable.Withf("a %s order can't be charged", o.Status)
+	}
+
+	result, err := s.Provider.Capture(payment.Reference, payment.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture payment %d: %w", paymentID, err)
+	}
+	return s.applyResult(payment, *result, "", actor)
+}
+
+// refundService pays amount of a captured payment back, all that is left of it when amount is 0.
+// Refunding all of it marks its order refunded, which the order must allow.
+func (s *PaymentService) refundService(paymentID int, amount float64, actor string) (*Payment, error) {
+	payment, err := s.Repo.getPayment(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment == nil {
+		return nil, ErrPaymentNotFound
+	}
+	if payment.Status != gateway.StatusCaptured {
+		return nil, ErrIllegalTransition.Withf("only captured payments can be refunded, the payment is %s", payment.Status)
+	}
+
+	refundable := payment.RefundableAmount()
+	if amount == 0 {
+		amount = refundable
+	}
+	amount = utils.RoundAmount(amount)
+	if amount <= 0 || amount > refundable {
+		return nil, ErrInvalidRefund.Withf("the refund amount must be greater than 0 and at most %.2f", refundable)
+	}
+	if amount == refundable {
+		o, err := s.Orders.Order(payment.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		if !o.Status.CanTransitionTo(order.StatusRefunded) {
+			return nil, order.ErrIllegalTransition.Withf("a %s order can't be refunded", o.Status)
+		}
+	}
+
+	result, err := s.Provider.Refund(payment.Reference, amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refund payment %d: %w", paymentID, err)
+	}
+	return s.applyResult(payment, *result, "", actor)
+}
+
+// handleWebhookService applies an event the provider reports through a webhook. Events delivered again
+// and events about a payment that already moved on are acknowledged without changing anything, so the
+// provider stops delivering them.
+func (s *PaymentService) handleWebhookService(header http.Header, payload []byte) error {
+	event, err := s.Provider.VerifyWebhook(header, payload)
+	if err != nil {
+		log.Println(err)
+		return ErrInvalidSignature
+	}
+
+	payment, err := s.Repo.getPaymentByReference(s.Provider.Name(), event.Reference)
+	if err != nil {
+		return err
+	}
+	if payment == nil {
+		return ErrPaymentNotFound
+	}
+
+	_, err = s.applyResult(payment, event.Result, event.ID, ProviderActor(s.Provider.Name()))
+	if errors.Is(err, ErrIllegalTransition) {
+		log.Printf("Ignoring event %s of payment %d: %v", event.ID, payment.ID, err)
+		return nil
+	}
+	return err
+}
+
+// applyResult records an outcome of a payment and moves its order along: a captured payment marks the
+// order paid and a fully refunded one marks it refunded. The order was placed before it was paid, so
+// a failed order transition, e.g. of an order an admin moved on by hand, doesn't undo the payment,
+// except for a capture of an order that can't be paid anymore, which is refunded.
+func (s *PaymentService) applyResult(payment *Payment, result gateway.Result, eventID, actor string) (*Payment, error) {
+	event := Event{EventID: eventID, Status: result.Status, Amount: result.Amount, Note: result.Reason, Actor: actor}
+	updated, applied, err := s.Repo.updatePayment(payment.ID, event, func(p *Payment) error { return p.apply(result) })
+	if err != nil {
+		return nil, err
+	}
+	if !applied {
+		log.Printf("Event %s of payment %d was already applied", eventID, payment.ID)
+		return s.Repo.getPayment(payment.ID)
+	}
+
+	var to order.Status
+	switch updated.Status {
+	case gateway.StatusCaptured:
+		if result.Status == gateway.StatusCaptured {
+			to = order.StatusPaid
+		}
+	case gateway.StatusRefunded:
+		to = order.StatusRefunded
+	}
+	if to != "" {
+		note := fmt.Sprintf("payment %s %s", updated.Reference, updated.Status)
+		_, err := s.Orders.Transition(updated.OrderID, to, actor, note)
+		if err != nil {
+			log.Printf("Payment %d is %s but order %d stays as it is: %v", updated.ID, updated.Status, updated.OrderID, err)
+		}
+		if to == order.StatusPaid && errors.Is(err, order.ErrIllegalTransition) {
+			// the order was cancelled while the payment was in progress, don't keep the money
+			return s.refundCapture(updated, actor)
+		}
+	}
+
+	log.Printf("Payment %d of order %d is %s", updated.ID, updated.OrderID, updated.Status)
+	return s.Repo.getPayment(payment.ID)
+}
+
+// GuardOrderTransition refuses to cancel an order with a payment in progress or collected, a later
+// capture would charge an order that won't ship. It is a guard of the order service.
+func (s *PaymentService) GuardOrderTransition(o *order.Order, to order.Status) error {
+	if to != order.StatusCancelled {
+		return nil
+	}
+
+	payments, err := s.Repo.getOrderPayments(o.ID)
+	if err != nil {
+		return err
+	}
+	for _, p := range payments {
+		if p.IsActive() {
+			return ErrOrderHasPayment.Withf("order %d has a %s payment, it can't be cancelled", o.ID, p.Status)
+		}
+	}
+	return nil
+}
+
+// refundCapture pays all of a captured payment back
+func (s *PaymentService) refundCapture(payment *Payment, actor string) (*Payment, error) {
+	result, err := s.Provider.Refund(payment.Reference, payment.RefundableAmount())
+	if err != nil {
+		return nil, fmt.Errorf("failed to refund payment %d of order %d: %w", payment.ID, payment.OrderID, err)
+	}
+	log.Printf("Refunding payment %d, order %d can't be paid anymore", payment.ID, payment.OrderID)
+	return s.applyResult(payment, *result, "", actor)
+}
+
+// ProviderActor is the actor recorded in the histories for changes reported by a payment provider
+func ProviderActor(provider string) string {
+	return "gateway:" + provider
+}
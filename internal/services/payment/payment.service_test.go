@@ -0,0 +1,153 @@
+package payment
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/core/gateway"
+	"github.com/ecommerce/internal/services/order"
+)
+
+const buyerID = 7
+
+// newPaymentFixture returns a payment service over the memory repositories and the fake gateway,
+// with the order service guarded like in the application, and a pending order of buyerID. The memory
+// database is returned to change orders behind the services.
+func newPaymentFixture(t *testing.T) (*PaymentService, int, *memory.DB) {
+	t.Helper()
+	mem := memory.New()
+	orders := order.NewOrderService(order.NewMemoryOrderRepository(mem), nil, nil, nil)
+	s := NewPaymentService(NewMemoryPaymentRepository(mem), gateway.NewFakeGateway("secret", "", time.Hour), orders, "USD")
+	orders.Guards = append(orders.Guards, s.GuardOrderTransition)
+
+	var orderID int
+	mem.Update(func() error {
+		table := order.OrdersOf(mem)
+		o := order.Order{ID: table.NextID(), UserID: buyerID, TotalAmount: 42, Status: order.StatusPending}
+		table.Put(o.ID, o)
+		orderID = o.ID
+		return nil
+	})
+	return s, orderID, mem
+}
+
+func TestConcurrentPaymentsAuthorizeOnce(t *testing.T) {
+	s, orderID, _ := newPaymentFixture(t)
+
+	const attempts = 10
+	var wg sync.WaitGroup
+	errs := make([]error, attempts)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = s.payService(buyerID, orderID, gateway.TokenSuccess)
+		}()
+	}
+	wg.Wait()
+
+	paid := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			paid++
+		case errors.Is(err, ErrOrderAlreadyPaid):
+		default:
+			t.Errorf("pay: %v", err)
+		}
+	}
+	if paid != 1 {
+		t.Fatalf("%d payments went through, want 1", paid)
+	}
+
+	payments, err := s.Repo.getOrderPayments(orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 1 || payments[0].Status != gateway.StatusAuthorized {
+		t.Fatalf("payments = %+v, want a single authorized payment", payments)
+	}
+	if !strings.HasPrefix(payments[0].Reference, "fake_") {
+		t.Errorf("reference = %q, want the reference of the provider", payments[0].Reference)
+	}
+}
+
+func TestCancelRefusedWithActivePayment(t *testing.T) {
+	s, orderID, _ := newPaymentFixture(t)
+
+	payment, err := s.payService(buyerID, orderID, gateway.TokenSuccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Orders.Transition(orderID, order.StatusCancelled, order.UserActor(buyerID), ""); !errors.Is(err, ErrOrderHasPayment) {
+		t.Fatalf("cancel: err = %v, want %v", err, ErrOrderHasPayment)
+	}
+
+	// the order can still be paid
+	if _, err := s.captureService(payment.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	o, err := s.Orders.Order(orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Status != order.StatusPaid {
+		t.Errorf("order is %s, want %s", o.Status, order.StatusPaid)
+	}
+}
+
+func TestDeclinedPaymentAllowsCancel(t *testing.T) {
+	s, orderID, _ := newPaymentFixture(t)
+
+	payment, err := s.payService(buyerID, orderID, gateway.TokenDecline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Status != gateway.StatusDeclined {
+		t.Fatalf("payment is %s, want %s", payment.Status, gateway.StatusDeclined)
+	}
+	if _, err := s.Orders.Transition(orderID, order.StatusCancelled, order.UserActor(buyerID), ""); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if _, err := s.payService(buyerID, orderID, gateway.TokenSuccess); !errors.Is(err, ErrOrderNotPayable) {
+		t.Fatalf("pay a cancelled order: err = %v, want %v", err, ErrOrderNotPayable)
+	}
+}
+
+func TestCaptureOfCancelledOrder(t *testing.T) {
+	s, orderID, mem := newPaymentFixture(t)
+
+	payment, err := s.payService(buyerID, orderID, gateway.TokenSuccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the order was cancelled while the payment was being added
+	mem.Update(func() error {
+		o, _ := order.OrdersOf(mem).Get(orderID)
+		o.Status = order.StatusCancelled
+		order.OrdersOf(mem).Put(o.ID, o)
+		return nil
+	})
+
+	if _, err := s.captureService(payment.ID, "admin"); !errors.Is(err, ErrOrderNotPayable) {
+		t.Fatalf("capture: err = %v, want %v", err, ErrOrderNotPayable)
+	}
+
+	// a capture the provider reports anyway is paid back
+	result, err := s.Provider.Capture(payment.Reference, payment.Amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment, err = s.applyResult(payment, *result, "evt_capture", ProviderActor(s.Provider.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Status != gateway.StatusRefunded || payment.RefundedAmount != payment.Amount {
+		t.Errorf("payment is %s with %.2f refunded, want all of it refunded", payment.Status, payment.RefundedAmount)
+	}
+}
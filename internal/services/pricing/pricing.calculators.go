@@ -0,0 +1,152 @@
+package pricing
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ecommerce/configuration"
+	"github.com/ecommerce/internal/services/promotion"
+	"github.com/ecommerce/utils"
+)
+
+// SubtotalCalculator sums up the price of every line
+type SubtotalCalculator struct{}
+
+func (SubtotalCalculator) Apply(in *Input, q *Quote) error {
+	var subtotal float64
+	for _, line := range in.Lines {
+		subtotal += line.UnitPrice * float64(line.Quantity)
+	}
+	q.Subtotal = utils.RoundAmount(subtotal)
+	return nil
+}
+
+// DiscountCalculator takes the discount of the coupon off, its errors tell why the coupon doesn't apply
+type DiscountCalculator struct{}
+
+func (DiscountCalculator) Apply(in *Input, q *Quote) error {
+	if in.Offer == nil {
+		return nil
+	}
+
+	lines := make([]promotion.Line, 0, len(in.Lines))
+	for _, line := range in.Lines {
+		lines = append(lines, promotion.Line{ProductID: line.ProductID, Quantity: line.Quantity, UnitPrice: line.UnitPrice})
+	}
+	discount, err := in.Offer.Discount(lines)
+	if err != nil {
+		return err
+	}
+	q.Discount = discount
+	q.DiscountAmount = discount.Amount
+	return nil
+}
+
+// TaxCalculator charges the rate of the region on the subtotal after the discount. A region without a
+// rate of its own uses the one of its country, e.g. "US-CA" falls back to "US", and is untaxed without either.
+type TaxCalculator struct {
+	Rates map[string]float64 // percent by region
+}
+
+func (c TaxCalculator) Apply(in *Input, q *Quote) error {
+	q.TaxRate = c.Rate(in.Region)
+	q.TaxAmount = utils.RoundAmount((q.Subtotal - q.DiscountAmount) * q.TaxRate / 100)
+	return nil
+}
+
+// Rate returns the tax rate of a region in percent
+func (c TaxCalculator) Rate(region string) float64 {
+	if rate, ok := c.Rates[region]; ok {
+		return rate
+	}
+	if country, _, found := strings.Cut(region, "-"); found {
+		return c.Rates[country]
+	}
+	return 0
+}
+
+// FlatShipping charges the same rate for every order
+type FlatShipping struct {
+	Rate     float64
+	FreeOver float64 // orders costing at least this after the discount ship for free, 0 never does
+}
+
+func (c FlatShipping) Apply(in *Input, q *Quote) error {
+	q.ShippingMethod = "flat"
+	q.ShippingAmount = shippingAmount(in, q, c.FreeOver, c.Rate)
+	return nil
+}
+
+// WeightShipping charges a base rate plus a rate for every started kilogram of the order
+type WeightShipping struct {
+	BaseRate float64
+	PerKg    float64
+	FreeOver float64 // orders costing at least this after the discount ship for free, 0 never does
+}
+
+func (c WeightShipping) Apply(in *Input, q *Quote) error {
+	var grams int
+	for _, line := range in.Lines {
+		grams += line.WeightGrams * line.Quantity
+	}
+	kilograms := math.Ceil(float64(grams) / 1000)
+
+	q.ShippingMethod = "weight"
+	q.ShippingAmount = shippingAmount(in, q, c.FreeOver, c.BaseRate+kilograms*c.PerKg)
+	return nil
+}
+
+// NewConfiguredPipeline builds the pipeline described by the pricing configuration:
+// subtotal, discount, tax and then shipping
+func NewConfiguredPipeline(config *configuration.Config) *Pipeline {
+	pricing := config.Pricing
+
+	var shipping Calculator = FlatShipping{Rate: pricing.Shipping.FlatRate, FreeOver: pricing.Shipping.FreeOver}
+	if pricing.Shipping.Method == "weight" {
+		shipping = WeightShipping{BaseRate: pricing.Shipping.BaseRate, PerKg: pricing.Shipping.PerKg, FreeOver: pricing.Shipping.FreeOver}
+	}
+
+	return NewPipeline(pricing.DefaultRegion,
+		SubtotalCalculator{},
+		DiscountCalculator{},
+		TaxCalculator{Rates: pricing.TaxRates},
+		shipping,
+	)
+}
+
+// Regions returns the regions a cart can pick from: the default region and every region with a tax rate
+func (p *Pipeline) Regions() []string {
+	seen := make(map[string]bool)
+	var regions []string
+	add := func(region string) {
+		if region != "" && !seen[region] {
+			seen[region] = true
+			regions = append(regions, region)
+		}
+	}
+
+	add(p.DefaultRegion)
+	for _, calculator := range p.Calculators {
+		if tax, ok := calculator.(TaxCalculator); ok {
+			for region := range tax.Rates {
+				add(region)
+			}
+		}
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// helper functions
+
+// shippingAmount returns the rate, or nothing for an empty cart or one above the free shipping threshold
+func shippingAmount(in *Input, q *Quote, freeOver, rate float64) float64 {
+	if len(in.Lines) == 0 {
+		return 0
+	}
+	if freeOver > 0 && q.Subtotal-q.DiscountAmount >= freeOver {
+		return 0
+	}
+	return utils.RoundAmount(rate)
+}
@@ -0,0 +1,75 @@
+package pricing
+
+import (
+	"strings"
+
+	"github.com/ecommerce/internal/services/promotion"
+	"github.com/ecommerce/utils"
+)
+
+// Line is a cart line to price
+type Line struct {
+	ProductID   int
+	Quantity    int
+	UnitPrice   float64
+	WeightGrams int // weight of one unit
+}
+
+// Input is what a quote is computed from
+type Input struct {
+	Lines  []Line
+	Region string           // region the order ships to, e.g. "US-CA"
+	Offer  *promotion.Offer // coupon of the cart, nil when it has none
+}
+
+// Quote is the price breakdown of a cart. Tax is charged on the subtotal after the discount,
+// shipping is not taxed.
+type Quote struct {
+	Region         string              `json:"region"`
+	Subtotal       float64             `json:"subtotal"`
+	Discount       *promotion.Discount `json:"discount,omitempty"`
+	DiscountAmount float64             `json:"discount_amount"`
+	TaxRate        float64             `json:"tax_rate"` // percent
+	TaxAmount      float64             `json:"tax_amount"`
+	ShippingMethod string              `json:"shipping_method"`
+	ShippingAmount float64             `json:"shipping_amount"`
+	GrandTotal     float64             `json:"grand_total"`
+}
+
+// Calculator is one step of a pricing pipeline, it fills in its part of the quote.
+// Calculators run in order and may read what the previous ones computed.
+type Calculator interface {
+	Apply(in *Input, q *Quote) error
+}
+
+// Pipeline turns a cart into a quote by running its calculators in order
+type Pipeline struct {
+	Calculators   []Calculator
+	DefaultRegion string // region of inputs that have none
+}
+
+func NewPipeline(defaultRegion string, calculators ...Calculator) *Pipeline {
+	return &Pipeline{Calculators: calculators, DefaultRegion: NormalizeRegion(defaultRegion)}
+}
+
+// Quote prices the input, the grand total is the subtotal less the discount plus tax and shipping
+func (p *Pipeline) Quote(in Input) (*Quote, error) {
+	in.Region = NormalizeRegion(in.Region)
+	if in.Region == "" {
+		in.Region = p.DefaultRegion
+	}
+
+	q := &Quote{Region: in.Region}
+	for _, calculator := range p.Calculators {
+		if err := calculator.Apply(&in, q); err != nil {
+			return nil, err
+		}
+	}
+	q.GrandTotal = utils.RoundAmount(q.Subtotal - q.DiscountAmount + q.TaxAmount + q.ShippingAmount)
+	return q, nil
+}
+
+// NormalizeRegion returns a region the way rates are keyed
+func NormalizeRegion(region string) string {
+	return strings.ToUpper(strings.TrimSpace(region))
+}
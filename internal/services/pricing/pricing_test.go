@@ -0,0 +1,108 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/ecommerce/internal/services/promotion"
+)
+
+func TestTaxRate(t *testing.T) {
+	tax := TaxCalculator{Rates: map[string]float64{"US": 5, "US-CA": 7.25, "DE": 19}}
+
+	tests := []struct {
+		region string
+		want   float64
+	}{
+		{"US-CA", 7.25},
+		{"US-OR", 5}, // falls back to the country
+		{"US", 5},
+		{"DE-BE", 19},
+		{"FR-75", 0}, // neither the region nor the country has a rate
+		{"FR", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := tax.Rate(tt.region); got != tt.want {
+			t.Errorf("rate of %q = %v, want %v", tt.region, got, tt.want)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	pipeline := NewPipeline("us-ca",
+		SubtotalCalculator{},
+		DiscountCalculator{},
+		TaxCalculator{Rates: map[string]float64{"US": 10, "US-CA": 7.25}},
+		FlatShipping{Rate: 5},
+	)
+	twentyOff := &promotion.Offer{Promotion: promotion.Promotion{ID: 1, Kind: promotion.KindPercentOff, Value: 20}}
+
+	tests := []struct {
+		name string
+		in   Input
+		want Quote
+	}{
+		{
+			"tax on the subtotal after the discount",
+			Input{Lines: []Line{{ProductID: 1, Quantity: 2, UnitPrice: 50}}, Region: "US-NY", Offer: twentyOff},
+			Quote{Region: "US-NY", Subtotal: 100, DiscountAmount: 20, TaxRate: 10, TaxAmount: 8, ShippingAmount: 5, GrandTotal: 93},
+		},
+		{
+			"default region",
+			Input{Lines: []Line{{ProductID: 1, Quantity: 1, UnitPrice: 100}}},
+			Quote{Region: "US-CA", Subtotal: 100, TaxRate: 7.25, TaxAmount: 7.25, ShippingAmount: 5, GrandTotal: 112.25},
+		},
+		{
+			"rounded parts",
+			Input{Lines: []Line{{ProductID: 1, Quantity: 3, UnitPrice: 19.99}}, Region: " us-ca ", Offer: twentyOff},
+			// 59.97 less 11.994 is 47.976, taxed 3.47826
+			Quote{Region: "US-CA", Subtotal: 59.97, DiscountAmount: 11.99, TaxRate: 7.25, TaxAmount: 3.48, ShippingAmount: 5, GrandTotal: 56.46},
+		},
+		{
+			"cents adding up",
+			Input{Lines: []Line{{ProductID: 1, Quantity: 3, UnitPrice: 0.1}, {ProductID: 2, Quantity: 1, UnitPrice: 0.2}}, Region: "DE"},
+			Quote{Region: "DE", Subtotal: 0.5, ShippingAmount: 5, GrandTotal: 5.5},
+		},
+	}
+	for _, tt := range tests {
+		q, err := pipeline.Quote(tt.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		q.Discount, q.ShippingMethod = nil, ""
+		if *q != tt.want {
+			t.Errorf("%s: quote %+v, want %+v", tt.name, *q, tt.want)
+		}
+	}
+}
+
+func TestFreeShipping(t *testing.T) {
+	tenOff := &promotion.Offer{Promotion: promotion.Promotion{ID: 1, Kind: promotion.KindFixedOff, Value: 10}}
+	flat := FlatShipping{Rate: 5, FreeOver: 50}
+	weight := WeightShipping{BaseRate: 3, PerKg: 2, FreeOver: 50}
+
+	tests := []struct {
+		name     string
+		shipping Calculator
+		in       Input
+		want     float64
+	}{
+		{"below the threshold", flat, Input{Lines: []Line{{Quantity: 1, UnitPrice: 49.99}}}, 5},
+		{"at the threshold", flat, Input{Lines: []Line{{Quantity: 1, UnitPrice: 50}}}, 0},
+		{"below the threshold after the discount", flat, Input{Lines: []Line{{Quantity: 1, UnitPrice: 55}}, Offer: tenOff}, 5},
+		{"above the threshold after the discount", flat, Input{Lines: []Line{{Quantity: 1, UnitPrice: 60}}, Offer: tenOff}, 0},
+		{"no threshold", FlatShipping{Rate: 5}, Input{Lines: []Line{{Quantity: 10, UnitPrice: 100}}}, 5},
+		{"empty cart", flat, Input{}, 0},
+		{"every started kilogram", weight, Input{Lines: []Line{{Quantity: 3, UnitPrice: 10, WeightGrams: 500}}}, 7},
+		{"weight above the threshold", weight, Input{Lines: []Line{{Quantity: 5, UnitPrice: 10, WeightGrams: 500}}}, 0},
+	}
+	for _, tt := range tests {
+		q, err := NewPipeline("US", SubtotalCalculator{}, DiscountCalculator{}, tt.shipping).Quote(tt.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if q.ShippingAmount != tt.want {
+			t.Errorf("%s: shipping %.2f, want %.2f", tt.name, q.ShippingAmount, tt.want)
+		}
+	}
+}
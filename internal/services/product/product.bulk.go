@@ -0,0 +1,329 @@
+package product
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/utils"
+)
+
+// Formats of bulk imports and exports
+const (
+	FormatCSV    = "csv"    // a header row naming the columns, then one product per row
+	FormatNDJSON = "ndjson" // one JSON object per line
+)
+
+// MaxImportSize is the largest import accepted over HTTP
+const MaxImportSize = 10 << 20
+
+// Actions of the rows of an import report
+const (
+	ImportCreate = "create"
+	ImportUpdate = "update"
+	ImportError  = "error"
+)
+
+var (
+	ErrInvalidImport = response.New(http.StatusBadRequest, "invalid_import", "the import file can't be read")
+	ErrImportFailed  = response.New(http.StatusUnprocessableEntity, "import_failed", "some rows are invalid, nothing was imported")
+)
+
+// bulkColumns are the CSV columns, named and ordered like the json fields of Product
+var bulkColumns = strings.Split(utils.GetColumnNames(Product{}), ", ")
+
+// ImportReport tells row by row what an import did, or would have done for a dry run or when some rows are invalid
+type ImportReport struct {
+	DryRun  bool           `json:"dryRun"`
+	Created int            `json:"created"`
+	Updated int            `json:"updated"`
+	Failed  int            `json:"failed"`
+	Rows    []ImportResult `json:"rows"`
+}
+
+// ImportResult is the outcome of one row of an import
+type ImportResult struct {
+	Line      int               `json:"line"`
+	Action    string            `json:"action"`
+	ProductID int               `json:"productId,omitempty"`
+	SKU       string            `json:"sku,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+// importRow is one row of an import file as the JSON members it sets, or why it can't be read
+type importRow struct {
+	line      int
+	members   map[string]json.RawMessage
+	malformed string
+}
+
+// importPlan is the write an import makes for a valid row
+type importPlan struct {
+	line    int
+	create  bool
+	product Product
+	columns []string // columns an update writes
+}
+
+// ParseFormat returns the bulk format named by a format parameter, a media type or a file name,
+// e.g. "csv", "application/x-ndjson" or "products.jsonl"
+func ParseFormat(value string) (string, error) {
+	name, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(value)), ";")
+	name = strings.TrimSpace(name)
+	switch {
+	case strings.HasSuffix(name, "csv"):
+		return FormatCSV, nil
+	case strings.HasSuffix(name, "ndjson"), strings.HasSuffix(name, "jsonl"):
+		return FormatNDJSON, nil
+	}
+	return "", ErrInvalidQuery.Withf("unknown format %q: must be csv or ndjson", value)
+}
+
+// decodeImport reads the rows of an import file
+func decodeImport(r io.Reader, format string) ([]importRow, error) {
+	switch format {
+	case FormatCSV:
+		return decodeCSV(r)
+	case FormatNDJSON:
+		return decodeNDJSON(r)
+	}
+	return nil, ErrInvalidQuery.Withf("unknown format %q: must be csv or ndjson", format)
+}
+
+// decodeCSV reads a CSV file with a header row. Empty cells are left out of their row,
+// so a file can update a few columns without repeating the others.
+func decodeCSV(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, ErrInvalidImport.Withf("invalid CSV: %v", err).Wrap(err)
+	}
+	for i, column := range header {
+		header[i] = strings.TrimSpace(column)
+		if !slices.Contains(bulkColumns, header[i]) {
+			return nil, ErrInvalidImport.Withf("unknown CSV column %q: must be one of %s", column, strings.Join(bulkColumns, ", "))
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, ErrInvalidImport.Withf("invalid CSV: %v", err).Wrap(err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := importRow{line: line, members: make(map[string]json.RawMessage)}
+		if len(record) != len(header) {
+			row.malformed = fmt.Sprintf("has %d columns, the header has %d", len(record), len(header))
+			rows = append(rows, row)
+			continue
+		}
+		for i, cell := range record {
+			if cell == "" {
+				continue
+			}
+			if isStringColumn(header[i]) {
+				row.members[header[i]], _ = json.Marshal(cell)
+			} else {
+				// numbers are kept as written, ApplyMergePatch reports the ones that don't parse
+				row.members[header[i]] = json.RawMessage(strings.TrimSpace(cell))
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// decodeNDJSON reads one JSON object per line, blank lines are skipped
+func decodeNDJSON(r io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	var rows []importRow
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		row := importRow{line: line}
+		if err := json.Unmarshal([]byte(text), &row.members); err != nil || row.members == nil {
+			row.malformed = "is not a JSON object"
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, ErrInvalidImport.Withf("invalid NDJSON: %v", err).Wrap(err)
+	}
+	return rows, nil
+}
+
+// planImport decides what to do with every row and fills the report with it. Rows are matched to
+// existing products by productId, then by SKU, rows matching none create a product.
+func planImport(repo ProductRepository, rows []importRow, report *ImportReport) ([]importPlan, error) {
+	plans := make([]importPlan, 0, len(rows))
+	linesByID := make(map[int]int)
+	linesBySKU := make(map[string]int)
+
+	for _, row := range rows {
+		plan, fields, err := planRow(repo, row)
+		if err != nil {
+			return nil, err
+		}
+
+		// a product can only be written once per import
+		if fields == nil && !plan.create {
+			if line, ok := linesByID[plan.product.ProductID]; ok {
+				fields = map[string]string{"productId": fmt.Sprintf("is already imported on line %d", line)}
+			} else {
+				linesByID[plan.product.ProductID] = row.line
+			}
+		}
+		if fields == nil && plan.product.SKU != "" {
+			if line, ok := linesBySKU[plan.product.SKU]; ok {
+				fields = map[string]string{"sku": fmt.Sprintf("is already imported on line %d", line)}
+			} else {
+				linesBySKU[plan.product.SKU] = row.line
+			}
+		}
+
+		result := ImportResult{Line: row.line, ProductID: plan.product.ProductID, SKU: plan.product.SKU}
+		switch {
+		case fields != nil:
+			result.Action = ImportError
+			result.Errors = fields
+			report.Failed++
+		case plan.create:
+			result.Action = ImportCreate
+			report.Created++
+			plans = append(plans, plan)
+		default:
+			result.Action = ImportUpdate
+			report.Updated++
+			plans = append(plans, plan)
+		}
+		report.Rows = append(report.Rows, result)
+	}
+	return plans, nil
+}
+
+// planRow matches a row to the product it updates, if any, and checks the product it results in
+func planRow(repo ProductRepository, row importRow) (importPlan, map[string]string, error) {
+	plan := importPlan{line: row.line}
+	if row.malformed != "" {
+		return plan, map[string]string{"row": row.malformed}, nil
+	}
+
+	// what the row says on its own, to find the product it is about
+	columns, fields := utils.ApplyMergePatch(&plan.product, row.members)
+	if fields != nil {
+		return plan, fields, nil
+	}
+
+	var existing *Product
+	var err error
+	switch {
+	case plan.product.ProductID != 0:
+		existing, err = repo.getProduct(plan.product.ProductID)
+		if err != nil {
+			return plan, nil, err
+		}
+		if existing == nil {
+			return plan, map[string]string{"productId": "no product has this ID"}, nil
+		}
+		if plan.product.SKU != "" {
+			owner, err := repo.getProductBySKU(plan.product.SKU)
+			if err != nil {
+				return plan, nil, err
+			}
+			if owner != nil && owner.ProductID != existing.ProductID {
+				return plan, map[string]string{"sku": fmt.Sprintf("is already used by product %d", owner.ProductID)}, nil
+			}
+		}
+	case plan.product.SKU != "":
+		existing, err = repo.getProductBySKU(plan.product.SKU)
+		if err != nil {
+			return plan, nil, err
+		}
+	}
+
+	if existing == nil {
+		plan.create = true
+		plan.product.Version = 0
+	} else {
+		plan.product = *existing
+		utils.ApplyMergePatch(&plan.product, row.members)
+		// a version in the row must still be current, as with If-Match
+		if plan.product.Version != existing.Version {
+			return plan, map[string]string{"version": "the product was changed since this version"}, nil
+		}
+		plan.columns = slices.DeleteFunc(columns, func(column string) bool { return column == PRODUCT_ID || column == VERSION })
+	}
+	return plan, utils.Validate(plan.product), nil
+}
+
+// newProductWriter returns a function writing products one at a time in a bulk format,
+// and one writing out what is still buffered
+func newProductWriter(w io.Writer, format string) (func(Product) error, func() error, error) {
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(bulkColumns); err != nil {
+			return nil, nil, err
+		}
+
+		write := func(product Product) error {
+			var members map[string]json.RawMessage
+			encoded, err := json.Marshal(product)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(encoded, &members); err != nil {
+				return err
+			}
+
+			record := make([]string, len(bulkColumns))
+			for i, column := range bulkColumns {
+				record[i] = string(members[column])
+				if isStringColumn(column) {
+					json.Unmarshal(members[column], &record[i])
+				}
+			}
+			return writer.Write(record)
+		}
+		flush := func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+		return write, flush, nil
+	case FormatNDJSON:
+		encoder := json.NewEncoder(w)
+		return func(product Product) error { return encoder.Encode(product) }, func() error { return nil }, nil
+	}
+	return nil, nil, ErrInvalidQuery.Withf("unknown format %q: must be csv or ndjson", format)
+}
+
+// isStringColumn reports whether the Product field of a column holds text, which CSV cells hold unquoted
+func isStringColumn(column string) bool {
+	typ := reflect.TypeOf(Product{})
+	for i := 0; i < typ.NumField(); i++ {
+		if typ.Field(i).Tag.Get("json") == column {
+			return typ.Field(i).Type.Kind() == reflect.String
+		}
+	}
+	return false
+}
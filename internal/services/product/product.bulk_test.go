@@ -0,0 +1,205 @@
+package product
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ecommerce/internal/core/response"
+)
+
+// addBulkTestProducts adds the products MUG-1 and CUP-1 and returns their IDs
+func addBulkTestProducts(t *testing.T, s *ProductService) (mugID, cupID int) {
+	t.Helper()
+	mugID, err := s.addProductService(Product{SKU: "MUG-1", PricePerUnit: 12.5, ProductName: "Mug", ProductBrand: "Acme", Description: "Holds coffee", StockQuantity: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cupID, err = s.addProductService(Product{SKU: "CUP-1", PricePerUnit: 4, ProductName: "Cup", ProductBrand: "Acme", StockQuantity: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mugID, cupID
+}
+
+func TestDecodeCSV(t *testing.T) {
+	file := "sku,productName,pricePerUnit,description\n" +
+		"MUG-1,Mug, 12.50,\n" +
+		"CUP-1,,4,\"A cup, small\"\n" +
+		"PLATE-1,Plate\n"
+	rows, err := decodeCSV(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		line      int
+		members   map[string]string
+		malformed bool
+	}{
+		{2, map[string]string{"sku": `"MUG-1"`, "productName": `"Mug"`, "pricePerUnit": `12.50`}, false},
+		{3, map[string]string{"sku": `"CUP-1"`, "pricePerUnit": `4`, "description": `"A cup, small"`}, false},
+		{4, map[string]string{}, true},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("%d rows, want %d", len(rows), len(want))
+	}
+	for i, w := range want {
+		row := rows[i]
+		if row.line != w.line || (row.malformed != "") != w.malformed {
+			t.Errorf("row %d: line %d, malformed %q", i, row.line, row.malformed)
+		}
+		if len(row.members) != len(w.members) {
+			t.Errorf("line %d: members %v, want %v without the empty cells", row.line, row.members, w.members)
+		}
+		for column, value := range w.members {
+			if string(row.members[column]) != value {
+				t.Errorf("line %d: %s = %s, want %s", row.line, column, row.members[column], value)
+			}
+		}
+	}
+
+	if _, err := decodeCSV(strings.NewReader("sku,colour\nMUG-1,red\n")); !errors.Is(err, ErrInvalidImport) {
+		t.Errorf("unknown column: err = %v, want %v", err, ErrInvalidImport)
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	s := newProductService(t)
+	mugID, cupID := addBulkTestProducts(t, s)
+
+	lines := []string{
+		"productId,sku,productName,productBrand,pricePerUnit,version",
+		fmt.Sprintf("%d,,Big Mug,,,1", mugID), // line 2: update by productId
+		",CUP-1,,,5,",                         // line 3: update by SKU
+		",BOWL-1,Bowl,Acme,8,",                // line 4: create
+		fmt.Sprintf("%d,,,,13,", mugID),       // line 5: the mug again
+		",BOWL-1,Other bowl,Acme,9,",          // line 6: the new SKU again
+		fmt.Sprintf("%d,,,,,7", cupID),        // line 7: stale version
+		"999,,Ghost,Acme,1,",                  // line 8: unknown product
+		fmt.Sprintf("%d,MUG-1,,,,", cupID),    // line 9: SKU of the mug
+		",,,Acme,1,",                          // line 10: create without a name
+		",,Plate,Acme,abc,",                   // line 11: price isn't a number
+		",,Plate",                             // line 12: too few cells
+	}
+	file := strings.Join(lines, "\n") + "\n"
+	rows, err := decodeCSV(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &ImportReport{}
+	plans, err := planImport(s.Repo, rows, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		action string
+		field  string // field of the error
+	}{
+		{ImportUpdate, ""},
+		{ImportUpdate, ""},
+		{ImportCreate, ""},
+		{ImportError, "productId"},
+		{ImportError, "sku"},
+		{ImportError, "version"},
+		{ImportError, "productId"},
+		{ImportError, "sku"},
+		{ImportError, "productName"},
+		{ImportError, "pricePerUnit"},
+		{ImportError, "row"},
+	}
+	if len(report.Rows) != len(want) {
+		t.Fatalf("%d rows reported, want %d", len(report.Rows), len(want))
+	}
+	for i, w := range want {
+		result := report.Rows[i]
+		if result.Action != w.action || (w.field != "" && result.Errors[w.field] == "") {
+			t.Errorf("line %d: %s %v, want %s of %q", result.Line, result.Action, result.Errors, w.action, w.field)
+		}
+	}
+	if report.Created != 1 || report.Updated != 2 || report.Failed != 8 || len(plans) != 3 {
+		t.Errorf("report %d created, %d updated, %d failed with %d plans", report.Created, report.Updated, report.Failed, len(plans))
+	}
+
+	// an update only writes the columns of its row
+	if columns := strings.Join(plans[0].columns, ","); columns != "productName" {
+		t.Errorf("update of line 2 writes %s, want productName", columns)
+	}
+	if plans[1].product.ProductID != cupID || plans[1].product.ProductName != "Cup" || plans[1].product.PricePerUnit != 5 {
+		t.Errorf("update of line 3 = %+v, want the cup at 5", plans[1].product)
+	}
+}
+
+func TestImportWritesNothingWithAnInvalidRow(t *testing.T) {
+	s := newProductService(t)
+	mugID, _ := addBulkTestProducts(t, s)
+
+	file := "productId,sku,productName,productBrand,pricePerUnit\n" +
+		fmt.Sprintf("%d,,Big Mug,,\n", mugID) +
+		",BOWL-1,Bowl,Acme,8\n" +
+		",PLATE-1,Plate,Acme,-1\n"
+	report, err := s.ImportProductsService(strings.NewReader(file), FormatCSV, false)
+	if !errors.Is(err, ErrImportFailed) {
+		t.Fatalf("err = %v, want %v", err, ErrImportFailed)
+	}
+	if report.Failed != 1 || report.Rows[2].Errors["pricePerUnit"] == "" {
+		t.Errorf("report = %+v, want the price of line 4 refused", report)
+	}
+
+	mug, err := s.getProductService(mugID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mug.ProductName != "Mug" || mug.Version != 1 {
+		t.Errorf("mug = %+v after a failed import", mug)
+	}
+	if bowl, err := s.Repo.getProductBySKU("BOWL-1"); err != nil || bowl != nil {
+		t.Errorf("bowl created by a failed import: %+v, %v", bowl, err)
+	}
+
+	// a dry run reports the same rows without writing them either
+	file = strings.Replace(file, "Acme,-1", "Acme,3", 1)
+	report, err = s.ImportProductsService(strings.NewReader(file), FormatCSV, true)
+	if err != nil {
+		t.Fatalf("dry run: %v %v", err, response.From(err).Details)
+	}
+	if report.Created != 2 || report.Updated != 1 {
+		t.Errorf("dry run report = %+v", report)
+	}
+	if bowl, err := s.Repo.getProductBySKU("BOWL-1"); err != nil || bowl != nil {
+		t.Errorf("bowl created by a dry run: %+v, %v", bowl, err)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+		s := newProductService(t)
+		mugID, cupID := addBulkTestProducts(t, s)
+
+		var exported bytes.Buffer
+		if err := s.ExportProductsService(&exported, format); err != nil {
+			t.Fatal(err)
+		}
+		report, err := s.ImportProductsService(bytes.NewReader(exported.Bytes()), format, false)
+		if err != nil {
+			t.Fatalf("%s: %v %v", format, err, response.From(err).Details)
+		}
+		if report.Created != 0 || report.Updated != 2 || report.Failed != 0 {
+			t.Errorf("%s: reimport %d created, %d updated, %d failed, want every product updated", format, report.Created, report.Updated, report.Failed)
+		}
+
+		mug, _ := s.getProductService(mugID)
+		cup, _ := s.getProductService(cupID)
+		if mug.SKU != "MUG-1" || mug.PricePerUnit != 12.5 || mug.Description != "Holds coffee" || cup.StockQuantity != 10 {
+			t.Errorf("%s: after the round trip %+v and %+v", format, mug, cup)
+		}
+
+		// the export is stale once the products changed
+		if _, err := s.ImportProductsService(bytes.NewReader(exported.Bytes()), format, false); !errors.Is(err, ErrImportFailed) {
+			t.Errorf("%s: stale reimport: err = %v, want %v", format, err, ErrImportFailed)
+		}
+	}
+}
@@ -1,345 +1,1239 @@
-package product
-
-import (
-	"encoding/json"
-	"errors"
-	"fmt"
-	"html/template"
-	"io/ioutil"
-	"log"
-	"net/http"
-	"strconv"
-
-	"github.com/ecommerce/internal/core/session"
-	"github.com/gorilla/mux"
-)
-
-const (
-	productsBasePath = "products"
-	prodBasePath     = "prod"
-	apiBasePath      = "api"
-)
-
-// SetupRoutes :
-func SetupProductRoutes(r *mux.Router, s *ProductService) {
-	apiUrlPath := fmt.Sprintf("/%s/%s", apiBasePath, productsBasePath)
-	productRouter := r.PathPrefix(apiUrlPath).Subrouter()
-
-	productRouter.HandleFunc("", productsHandler(s))
-	productRouter.HandleFunc("/{id}", productHandler(s))
-
-	// -------------------------PROD----------------------
-	prodUrlPath := fmt.Sprintf("/%s/%s", prodBasePath, productsBasePath)
-	prodUsersRouter := r.PathPrefix(prodUrlPath).Subrouter()
-
-	prodUsersRouter.HandleFunc("", productsProdHandler(s))
-	prodUsersRouter.HandleFunc("/{id}", productProdHandler(s))
-}
-
-func productsProdHandler(s *ProductService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		sess, err := session.GetSessionFromContext(r)
-		if sess == nil {
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		user := sess.Values["user"].(*session.User)
-
-		switch r.Method {
-		case http.MethodGet:
-			tmpl, err := template.ParseFiles("template/product_list.html")
-			if err != nil {
-				log.Println("Template parsing error:", err)
-				http.Error(w, "Error loading product list page", http.StatusInternalServerError)
-				return
-			}
-
-			productList, res, err := s.getAllProductsService()
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), res)
-				return
-			}
-
-			err = tmpl.Execute(w, map[string]interface{}{"Products": productList, "IsAdmin": user.IsAdmin})
-			if err != nil {
-				log.Println("Template execution error:", err)
-				http.Error(w, "Error rendering product list page", http.StatusInternalServerError)
-				return
-			}
-			return
-		case http.MethodPost:
-			// add a new product to the list
-			var newProduct Product
-			bodyBytes, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			err = json.Unmarshal(bodyBytes, &newProduct)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			if newProduct.ProductID != 0 {
-				err := errors.New("ProductId cannot be zero")
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			res, err := s.addProductService(newProduct)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), res)
-				return
-			}
-			w.WriteHeader(http.StatusCreated)
-			return
-		case http.MethodOptions:
-			return
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	}
-}
-
-func productProdHandler(s *ProductService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-
-		sess, err := session.GetSessionFromContext(r)
-		if sess == nil {
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		user := sess.Values["user"].(*session.User)
-
-		vars := mux.Vars(r)
-		productID, err := strconv.Atoi(vars["id"])
-
-		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-		product, res, err := s.getProductService(productID)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), res)
-			return
-		}
-
-		switch r.Method {
-		case http.MethodGet:
-			// Parse the product details template
-			tmpl, err := template.ParseFiles("template/product_details.html")
-			if err != nil {
-				log.Println("Template parsing error:", err)
-				http.Error(w, "Error loading product details page", http.StatusInternalServerError)
-				return
-			}
-
-			err = tmpl.Execute(w, map[string]interface{}{"Product": product, "IsAdmin": user.IsAdmin})
-			if err != nil {
-				log.Println("Template execution error:", err)
-				http.Error(w, "Error rendering product details page", http.StatusInternalServerError)
-				return
-			}
-			return
-		case http.MethodPut:
-			//update product in the list
-			var updatedProduct Product
-			bodyBytes, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			err = json.Unmarshal(bodyBytes, &updatedProduct)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			if updatedProduct.ProductID != productID {
-				err := errors.New("Payload Product Id Mismatch")
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			res, err = s.updateProductService(updatedProduct)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), res)
-				return
-			}
-			w.WriteHeader(http.StatusOK)
-			return
-		case http.MethodDelete:
-			res, err := s.removeProductService(productID)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), res)
-				return
-			}
-			w.WriteHeader(http.StatusOK)
-			return
-		case http.MethodOptions:
-			return
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	}
-}
-
-func productsHandler(s *ProductService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			productList, res, err := s.getAllProductsService()
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), res)
-				return
-			}
-			productsJson, err := json.Marshal(productList)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(productsJson)
-			return
-		case http.MethodPost:
-			// add a new product to the list
-			var newProduct Product
-			bodyBytes, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			err = json.Unmarshal(bodyBytes, &newProduct)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			if newProduct.ProductID != 0 {
-				err := errors.New("ProductId cannot be zero")
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			// adding product
-			res, err := s.addProductService(newProduct)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), res)
-				return
-			}
-			w.WriteHeader(http.StatusCreated)
-			return
-		case http.MethodOptions:
-			return
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	}
-}
-
-func productHandler(s *ProductService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		productID, err := strconv.Atoi(vars["id"])
-
-		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-		product, res, err := s.getProductService(productID)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), res)
-			return
-		}
-
-		switch r.Method {
-		case http.MethodGet:
-			//return single product
-			productJson, err := json.Marshal(product)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(productJson)
-			return
-		case http.MethodPut:
-			//update product in the list
-			var updatedProduct Product
-			bodyBytes, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			err = json.Unmarshal(bodyBytes, &updatedProduct)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			if updatedProduct.ProductID != productID {
-				err := errors.New("Payload Product Id Mismatch")
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			// update product cred
-			res, err = s.updateProductService(updatedProduct)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), res)
-				return
-			}
-			w.WriteHeader(http.StatusOK)
-			return
-		case http.MethodDelete:
-			res, err := s.removeProductService(productID)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), res)
-				return
-			}
-			w.WriteHeader(http.StatusOK)
-			return
-		case http.MethodOptions:
-			return
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	}
-}
+package product
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ecommerce/internal/core/middleware"
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/core/session"
+	"github.com/ecommerce/internal/services/category"
+	"github.com/ecommerce/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	productsBasePath = "products"
+	prodBasePath     = "prod"
+	apiBasePath      = "api"
+)
+
+// exportContentTypes are the media types of the export formats
+var exportContentTypes = map[string]string{
+	FormatCSV:    "text/csv; charset=utf-8",
+	FormatNDJSON: "application/x-ndjson",
+}
+
+var (
+	errProductIDSet      = response.BadRequest("productId must not be set when adding a product")
+	errProductIDMismatch = response.BadRequest("productId of the payload doesn't match the URL")
+	errVariantIDSet      = response.BadRequest("id must not be set when adding a variant")
+	errVariantIDMismatch = response.BadRequest("id or productId of the payload doesn't match the URL")
+)
+
+// SetupRoutes :
+func SetupProductRoutes(r *mux.Router, s *ProductService) {
+	apiUrlPath := fmt.Sprintf("/%s/%s", apiBasePath, productsBasePath)
+	productRouter := r.PathPrefix(apiUrlPath).Subrouter()
+
+	// every logged in user can browse the catalog, only admins can change it
+	writeMethods := []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+	productRouter.HandleFunc("", middleware.RequireRole(middleware.RoleAdmin, productsHandler(s), writeMethods...))
+	productRouter.HandleFunc("/search", searchProductsHandler(s))
+	productRouter.HandleFunc("/import", middleware.RequireRole(middleware.RoleAdmin, importProductsHandler(s)))
+	productRouter.HandleFunc("/export", middleware.RequireRole(middleware.RoleAdmin, exportProductsHandler(s)))
+	productRouter.HandleFunc("/{id}", middleware.RequireRole(middleware.RoleAdmin, productHandler(s), writeMethods...))
+	productRouter.HandleFunc("/{id}/categories", middleware.RequireRole(middleware.RoleAdmin, productCategoriesHandler(s), writeMethods...))
+	productRouter.HandleFunc("/{id}/variants", middleware.RequireRole(middleware.RoleAdmin, variantsHandler(s), writeMethods...))
+	productRouter.HandleFunc("/{id}/variants/{variantId}", middleware.RequireRole(middleware.RoleAdmin, variantHandler(s), writeMethods...))
+	productRouter.HandleFunc("/{id}/images", middleware.RequireRole(middleware.RoleAdmin, imagesHandler(s), writeMethods...))
+	productRouter.HandleFunc("/{id}/images/{imageId}", middleware.RequireRole(middleware.RoleAdmin, imageHandler(s), writeMethods...))
+	productRouter.HandleFunc("/{id}/images/{imageId}/thumbnail", thumbnailHandler(s))
+
+	// -------------------------PROD----------------------
+	prodUrlPath := fmt.Sprintf("/%s/%s", prodBasePath, productsBasePath)
+	prodUsersRouter := r.PathPrefix(prodUrlPath).Subrouter()
+
+	prodUsersRouter.HandleFunc("", middleware.RequireRole(middleware.RoleAdmin, productsProdHandler(s), writeMethods...))
+	// the form pages are registered before /{id} so "new" isn't taken for a product ID
+	prodUsersRouter.HandleFunc("/new", middleware.RequireRole(middleware.RoleAdmin, productFormProdHandler(s)))
+	prodUsersRouter.HandleFunc("/{id}/edit", middleware.RequireRole(middleware.RoleAdmin, productFormProdHandler(s)))
+	prodUsersRouter.HandleFunc("/{id}", middleware.RequireRole(middleware.RoleAdmin, productProdHandler(s), writeMethods...))
+}
+
+func productsProdHandler(s *ProductService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, err := session.GetSessionFromContext(r)
+		if sess == nil {
+			log.Println(err)
+			response.PageError(w, err)
+			return
+		}
+
+		user := sess.Values["user"].(*session.User)
+
+		switch r.Method {
+		case http.MethodGet:
+			tmpl, err := template.ParseFiles("template/product_list.html")
+			if err != nil {
+				log.Println("Template parsing error:", err)
+				http.Error(w, "Error loading product list page", http.StatusInternalServerError)
+				return
+			}
+
+			query, err := parseProductQuery(r.URL.Query())
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			var page *ProductPage
+			if query.Search != "" {
+				page, err = searchPage(s, query)
+			} else {
+				page, err = s.getProductsService(query)
+			}
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			// the category sidebar, and the breadcrumb of the category being browsed
+			categories, err := s.Categories.Tree()
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+			var breadcrumb []category.Category
+			if query.Category != 0 {
+				breadcrumb, err = s.Categories.Path(query.Category)
+				if err != nil {
+					log.Println(err)
+					response.PageError(w, err)
+					return
+				}
+			}
+
+			err = tmpl.Execute(w, map[string]interface{}{
+				"Products":   page.Products,
+				"IsAdmin":    user.IsAdmin,
+				"Page":       page,
+				"Query":      r.URL.Query(),
+				"PrevURL":    pageURL(r.URL, page.Page-1, page.TotalPages),
+				"NextURL":    pageURL(r.URL, page.Page+1, page.TotalPages),
+				"Categories": categories,
+				"Breadcrumb": breadcrumb,
+			})
+			if err != nil {
+				log.Println("Template execution error:", err)
+				http.Error(w, "Error rendering product list page", http.StatusInternalServerError)
+				return
+			}
+			return
+		case http.MethodPost:
+			// add a new product to the list
+			var newProduct Product
+			err := json.NewDecoder(r.Body).Decode(&newProduct)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if newProduct.ProductID != 0 {
+				log.Println(errProductIDSet)
+				response.WriteError(w, errProductIDSet)
+				return
+			}
+
+			_, err = s.addProductService(newProduct)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func productProdHandler(s *ProductService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		sess, err := session.GetSessionFromContext(r)
+		if sess == nil {
+			log.Println(err)
+			response.PageError(w, err)
+			return
+		}
+
+		user := sess.Values["user"].(*session.User)
+
+		vars := mux.Vars(r)
+		productID, err := strconv.Atoi(vars["id"])
+
+		if err != nil {
+			log.Println(err)
+			response.PageError(w, ErrProductNotFound)
+			return
+		}
+		product, err := s.getProductService(productID)
+		if err != nil {
+			log.Println(err)
+			response.PageError(w, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			// Parse the product details template
+			tmpl, err := template.ParseFiles("template/product_details.html")
+			if err != nil {
+				log.Println("Template parsing error:", err)
+				http.Error(w, "Error loading product details page", http.StatusInternalServerError)
+				return
+			}
+
+			variants, err := s.getVariantsService(productID)
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			images, err := s.getImagesService(productID)
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+
+			err = tmpl.Execute(w, map[string]interface{}{"Product": product, "Variants": variants, "Images": images, "IsAdmin": user.IsAdmin})
+			if err != nil {
+				log.Println("Template execution error:", err)
+				http.Error(w, "Error rendering product details page", http.StatusInternalServerError)
+				return
+			}
+			return
+		case http.MethodPut:
+			//update product in the list
+			var updatedProduct Product
+			err := json.NewDecoder(r.Body).Decode(&updatedProduct)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if updatedProduct.ProductID != productID {
+				log.Println(errProductIDMismatch)
+				response.WriteError(w, errProductIDMismatch)
+				return
+			}
+
+			// If-Match pins the update to the version the client has
+			if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+				if !matchesIfMatch(ifMatch, productETag(*product)) {
+					log.Println(ErrVersionConflict)
+					response.WriteError(w, ErrVersionConflict)
+					return
+				}
+				updatedProduct.Version = product.Version
+			}
+
+			updated, err := s.updateProductService(updatedProduct)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.Header().Set("ETag", productETag(*updated))
+			w.WriteHeader(http.StatusOK)
+			return
+		case http.MethodDelete:
+			err := s.removeProductService(productID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// productFormProdHandler serves the add and edit product form. Invalid submissions render the
+// form again with what was typed and the problem of each field under its input.
+func productFormProdHandler(s *ProductService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tmpl, err := template.ParseFiles("template/product_form.html")
+		if err != nil {
+			log.Println("Template parsing error:", err)
+			http.Error(w, "Error loading product form page", http.StatusInternalServerError)
+			return
+		}
+
+		// without an id in the URL the form adds a new product
+		data := map[string]interface{}{
+			"Action": "/prod/products/new",
+			"Form":   map[string]string{},
+			"Errors": map[string]string{},
+		}
+		var productID int
+		if id, ok := mux.Vars(r)["id"]; ok {
+			productID, err = strconv.Atoi(id)
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, ErrProductNotFound)
+				return
+			}
+			product, err := s.getProductService(productID)
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, err)
+				return
+			}
+			data["ProductID"] = productID
+			data["Action"] = fmt.Sprintf("/prod/products/%d/edit", productID)
+			data["Form"] = productFormValues(*product)
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			renderProductForm(tmpl, w, http.StatusOK, data)
+			return
+		case http.MethodPost:
+			err := r.ParseForm()
+			if err != nil {
+				log.Println(err)
+				response.PageError(w, response.InvalidBody(err))
+				return
+			}
+
+			product, fields := productFromForm(r.PostForm)
+			if fields != nil {
+				err = response.Validation(fields)
+			} else if productID == 0 {
+				productID, err = s.addProductService(product)
+			} else {
+				product.ProductID = productID
+				_, err = s.updateProductService(product)
+			}
+			if err != nil {
+				log.Println(err)
+				appErr := response.From(err)
+				data["Form"] = map[string]string{
+					"sku":           r.PostForm.Get("sku"),
+					"productName":   r.PostForm.Get("productName"),
+					"productBrand":  r.PostForm.Get("productBrand"),
+					"pricePerUnit":  r.PostForm.Get("pricePerUnit"),
+					"stockQuantity": r.PostForm.Get("stockQuantity"),
+					"weightGrams":   r.PostForm.Get("weightGrams"),
+					"description":   r.PostForm.Get("description"),
+					"version":       r.PostForm.Get("version"),
+				}
+				if appErr.Fields != nil {
+					data["Errors"] = appErr.Fields
+				} else {
+					data["Error"] = appErr.Message
+				}
+				renderProductForm(tmpl, w, appErr.Status, data)
+				return
+			}
+
+			http.Redirect(w, r, fmt.Sprintf("/prod/products/%d", productID), http.StatusSeeOther)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// searchProductsHandler ranks products matching the q parameter by name, brand and description.
+// The brand, price and stock filters of the listing can be combined with the search.
+func searchProductsHandler(s *ProductService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			query, err := parseProductQuery(r.URL.Query())
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			results, err := s.searchProductsService(query)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, results)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// importProductsHandler creates or updates products from a CSV or NDJSON body, in the format of the
+// format parameter or else of the Content-Type. With dryRun=true it only reports what would change.
+func importProductsHandler(s *ProductService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			format := r.URL.Query().Get("format")
+			if format == "" {
+				format = r.Header.Get("Content-Type")
+			}
+			format, err := ParseFormat(format)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			dryRun := false
+			if value := r.URL.Query().Get("dryRun"); value != "" {
+				dryRun, err = strconv.ParseBool(value)
+				if err != nil {
+					log.Println(err)
+					response.WriteError(w, ErrInvalidQuery.Withf("invalid dryRun %q: must be true or false", value))
+					return
+				}
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, MaxImportSize)
+			report, err := s.ImportProductsService(r.Body, format, dryRun)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			response.JSON(w, http.StatusOK, report)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// exportProductsHandler streams the catalog as CSV or NDJSON, in the format of the format parameter,
+// else of the Accept header, else as CSV
+func exportProductsHandler(s *ProductService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			format := r.URL.Query().Get("format")
+			if format == "" {
+				format = FormatCSV
+				if accepted, err := ParseFormat(r.Header.Get("Accept")); err == nil {
+					format = accepted
+				}
+			}
+			format, err := ParseFormat(format)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			w.Header().Set("Content-Type", exportContentTypes[format])
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="products.%s"`, format))
+			// the status is sent with the first rows, a later failure can only cut the file short
+			err = s.ExportProductsService(w, format)
+			if err != nil {
+				log.Println("Error streaming product export:", err)
+			}
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// productCategoriesHandler lists the categories of a product, PUT replaces them with
+// the categories of a {"categoryIds": [...]} body
+func productCategoriesHandler(s *ProductService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		productID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, ErrProductNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			categories, err := s.getProductCategoriesService(productID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, categories)
+			return
+		case http.MethodPut:
+			var payload categoriesPayload
+			err := json.NewDecoder(r.Body).Decode(&payload)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			categories, err := s.setProductCategoriesService(productID, payload.CategoryIDs)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, categories)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// variantsHandler lists the variants of a product, POST adds one
+func variantsHandler(s *ProductService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		productID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, ErrProductNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			variants, err := s.getVariantsService(productID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, variants)
+			return
+		case http.MethodPost:
+			var newVariant Variant
+			err := json.NewDecoder(r.Body).Decode(&newVariant)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if newVariant.ID != 0 {
+				log.Println(errVariantIDSet)
+				response.WriteError(w, errVariantIDSet)
+				return
+			}
+			if newVariant.ProductID != 0 && newVariant.ProductID != productID {
+				log.Println(errVariantIDMismatch)
+				response.WriteError(w, errVariantIDMismatch)
+				return
+			}
+
+			newVariant.ID, err = s.addVariantService(productID, newVariant)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			newVariant.ProductID = productID
+			response.JSON(w, http.StatusCreated, newVariant)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func variantHandler(s *ProductService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		productID, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, ErrProductNotFound)
+			return
+		}
+		variantID, err := strconv.Atoi(vars["variantId"])
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, ErrVariantNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			variant, err := s.getVariantService(productID, variantID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, variant)
+			return
+		case http.MethodPut:
+			var updatedVariant Variant
+			err := json.NewDecoder(r.Body).Decode(&updatedVariant)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if updatedVariant.ID != variantID || updatedVariant.ProductID != 0 && updatedVariant.ProductID != productID {
+				log.Println(errVariantIDMismatch)
+				response.WriteError(w, errVariantIDMismatch)
+				return
+			}
+			updatedVariant.ProductID = productID
+
+			err = s.updateVariantService(updatedVariant)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			response.JSON(w, http.StatusOK, updatedVariant)
+			return
+		case http.MethodDelete:
+			err := s.removeVariantService(productID, variantID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// imagesHandler lists the images of a product, POST uploads one as the image field of a multipart form
+func imagesHandler(s *ProductService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		productID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, ErrProductNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			images, err := s.getImagesService(productID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, images)
+			return
+		case http.MethodPost:
+			data, err := readImageUpload(w, r, s.MaxImageSize)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			image, err := s.addImageService(productID, data)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			response.JSON(w, http.StatusCreated, image)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// imageHandler serves the file of an image of a product, DELETE removes the image
+func imageHandler(s *ProductService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			serveImage(w, r, s, false)
+			return
+		case http.MethodDelete:
+			productID, imageID, err := imageIDs(r)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			err = s.removeImageService(productID, imageID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// thumbnailHandler serves the thumbnail of an image of a product
+func thumbnailHandler(s *ProductService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			serveImage(w, r, s, true)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// categoriesPayload is the request body accepted when setting the categories of a product
+type categoriesPayload struct {
+	CategoryIDs []int `json:"categoryIds"`
+}
+
+func productsHandler(s *ProductService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			query, err := parseProductQuery(r.URL.Query())
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			page, err := s.getProductsService(query)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			// the body stays a plain array; paging metadata travels in headers
+			w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+			w.Header().Set("X-Page", strconv.Itoa(page.Page))
+			w.Header().Set("X-Per-Page", strconv.Itoa(page.Limit))
+			w.Header().Set("X-Total-Pages", strconv.Itoa(page.TotalPages))
+			if links := paginationLinks(r.URL, page); links != "" {
+				w.Header().Set("Link", links)
+			}
+
+			etag := pageETag(page)
+			w.Header().Set("ETag", etag)
+			if matchesIfNoneMatch(r.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			details, err := s.withImagesService(page.Products...)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			response.JSON(w, http.StatusOK, details)
+			return
+		case http.MethodPost:
+			// add a new product to the list
+			var newProduct Product
+			err := json.NewDecoder(r.Body).Decode(&newProduct)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if newProduct.ProductID != 0 {
+				log.Println(errProductIDSet)
+				response.WriteError(w, errProductIDSet)
+				return
+			}
+
+			// adding product
+			_, err = s.addProductService(newProduct)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func productHandler(s *ProductService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		productID, err := strconv.Atoi(vars["id"])
+
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, ErrProductNotFound)
+			return
+		}
+		product, err := s.getProductService(productID)
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			//return single product, or 304 when the client's copy is still current
+			etag := productETag(*product)
+			w.Header().Set("ETag", etag)
+			if matchesIfNoneMatch(r.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			details, err := s.withImagesService(*product)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			response.JSON(w, http.StatusOK, details[0])
+			return
+		case http.MethodPut:
+			//update product in the list
+			var updatedProduct Product
+			err := json.NewDecoder(r.Body).Decode(&updatedProduct)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if updatedProduct.ProductID != productID {
+				log.Println(errProductIDMismatch)
+				response.WriteError(w, errProductIDMismatch)
+				return
+			}
+
+			// If-Match pins the update to the version the client has
+			if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+				if !matchesIfMatch(ifMatch, productETag(*product)) {
+					log.Println(ErrVersionConflict)
+					response.WriteError(w, ErrVersionConflict)
+					return
+				}
+				updatedProduct.Version = product.Version
+			}
+
+			// update product cred
+			updated, err := s.updateProductService(updatedProduct)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.Header().Set("ETag", productETag(*updated))
+			w.WriteHeader(http.StatusOK)
+			return
+		case http.MethodPatch:
+			// update only the fields present in the body (JSON Merge Patch)
+			var patch map[string]json.RawMessage
+			err := json.NewDecoder(r.Body).Decode(&patch)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			// If-Match pins the update to the version the client has
+			version := 0
+			if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+				if !matchesIfMatch(ifMatch, productETag(*product)) {
+					log.Println(ErrVersionConflict)
+					response.WriteError(w, ErrVersionConflict)
+					return
+				}
+				version = product.Version
+			}
+
+			patched, err := s.patchProductService(productID, version, patch)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.Header().Set("ETag", productETag(*patched))
+			response.JSON(w, http.StatusOK, patched)
+			return
+		case http.MethodDelete:
+			err := s.removeProductService(productID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// helper functions
+
+// productFromForm reads a product from the fields of the product form. Numbers that can't be
+// parsed are reported along with the validation errors of the other fields.
+func productFromForm(values url.Values) (Product, map[string]string) {
+	product := Product{
+		SKU:          strings.TrimSpace(values.Get("sku")),
+		ProductName:  strings.TrimSpace(values.Get("productName")),
+		ProductBrand: strings.TrimSpace(values.Get("productBrand")),
+		Description:  strings.TrimSpace(values.Get("description")),
+	}
+
+	parseErrs := map[string]string{}
+	if price := strings.TrimSpace(values.Get("pricePerUnit")); price != "" {
+		n, err := strconv.ParseFloat(price, 64)
+		if err != nil {
+			parseErrs["pricePerUnit"] = "must be a number"
+		}
+		product.PricePerUnit = n
+	}
+	if stock := strings.TrimSpace(values.Get("stockQuantity")); stock != "" {
+		n, err := strconv.Atoi(stock)
+		if err != nil {
+			parseErrs["stockQuantity"] = "must be a whole number"
+		}
+		product.StockQuantity = n
+	}
+	if weight := strings.TrimSpace(values.Get("weightGrams")); weight != "" {
+		n, err := strconv.Atoi(weight)
+		if err != nil {
+			parseErrs["weightGrams"] = "must be a whole number"
+		}
+		product.WeightGrams = n
+	}
+
+	// the version the form was filled with, so saving over someone else's changes fails
+	if version, err := strconv.Atoi(values.Get("version")); err == nil {
+		product.Version = version
+	}
+
+	if len(parseErrs) == 0 {
+		return product, nil
+	}
+	fields := utils.Validate(product)
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	for name, message := range parseErrs {
+		fields[name] = message
+	}
+	return product, fields
+}
+
+// readImageUpload reads the image field of a multipart upload. The body may be a little larger than
+// maxSize for the multipart headers, the size of the image itself is checked by the product service.
+func readImageUpload(w http.ResponseWriter, r *http.Request, maxSize int64) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+64<<10)
+
+	file, _, err := r.FormFile("image")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, ErrImageTooLarge.Withf("the image is too large: at most %d bytes", maxSize)
+	} else if err != nil {
+		return nil, response.BadRequest(fmt.Sprintf("expected a multipart form with an image field: %v", err))
+	}
+	defer file.Close()
+
+	// one byte more than allowed is enough to tell the image is too large
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if errors.As(err, &tooLarge) {
+		return nil, ErrImageTooLarge.Withf("the image is too large: at most %d bytes", maxSize)
+	} else if err != nil {
+		return nil, response.InvalidBody(err)
+	}
+	return data, nil
+}
+
+// serveImage writes the file of an image, or of its thumbnail. The file of an image never changes,
+// a new upload gets a new id, so clients may cache it for good; it is private as it needs a login.
+func serveImage(w http.ResponseWriter, r *http.Request, s *ProductService, thumb bool) {
+	productID, imageID, err := imageIDs(r)
+	if err != nil {
+		log.Println(err)
+		response.WriteError(w, err)
+		return
+	}
+
+	image, file, err := s.openImageService(productID, imageID, thumb)
+	if err != nil {
+		log.Println(err)
+		response.WriteError(w, err)
+		return
+	}
+	defer file.Close()
+
+	contentType, etag := image.ContentType, fmt.Sprintf(`"%s"`, image.Checksum)
+	if thumb {
+		contentType, etag = image.ThumbnailType(), fmt.Sprintf(`"%s-thumb"`, image.Checksum)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// ServeContent answers conditional and range requests from the ETag and the modification time
+	http.ServeContent(w, r, "", image.CreatedAt, file)
+}
+
+// imageIDs returns the product and image ids of an image URL
+func imageIDs(r *http.Request) (int, int, error) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return 0, 0, ErrProductNotFound
+	}
+	imageID, err := strconv.Atoi(vars["imageId"])
+	if err != nil {
+		return 0, 0, ErrImageNotFound
+	}
+	return productID, imageID, nil
+}
+
+// productETag is the entity tag of a product, it changes with every version of the product
+func productETag(product Product) string {
+	return fmt.Sprintf(`"%d-%d"`, product.ProductID, product.Version)
+}
+
+// pageETag is the weak entity tag of a listing page, it changes when any product on the page
+// changes or when the listing grows or shrinks
+func pageETag(page *ProductPage) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d", page.Total)
+	for _, product := range page.Products {
+		fmt.Fprintf(hash, ",%d-%d", product.ProductID, product.Version)
+	}
+	return fmt.Sprintf(`W/"%x"`, hash.Sum(nil)[:16])
+}
+
+// matchesIfMatch reports whether an If-Match header lists etag, using the strong comparison of RFC 9110
+func matchesIfMatch(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag && !strings.HasPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesIfNoneMatch reports whether an If-None-Match header lists etag, using the weak comparison of RFC 9110,
+// in which case the client's copy is still current
+func matchesIfNoneMatch(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// productFormValues fills the product form with an existing product
+func productFormValues(product Product) map[string]string {
+	return map[string]string{
+		"sku":           product.SKU,
+		"productName":   product.ProductName,
+		"productBrand":  product.ProductBrand,
+		"pricePerUnit":  strconv.FormatFloat(product.PricePerUnit, 'f', -1, 64),
+		"stockQuantity": strconv.Itoa(product.StockQuantity),
+		"weightGrams":   strconv.Itoa(product.WeightGrams),
+		"description":   product.Description,
+		"version":       strconv.Itoa(product.Version),
+	}
+}
+
+// renderProductForm writes the product form page with the given status
+func renderProductForm(tmpl *template.Template, w http.ResponseWriter, status int, data map[string]interface{}) {
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("Template execution error:", err)
+	}
+}
+
+// parseProductQuery reads the q, page, limit, sort, order, brand, minPrice, maxPrice, inStock and category query parameters
+func parseProductQuery(values url.Values) (ProductQuery, error) {
+	query := ProductQuery{Page: 1, Limit: DefaultPageLimit, Search: strings.TrimSpace(values.Get("q"))}
+
+	if page := values.Get("page"); page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return query, ErrInvalidQuery.Withf("invalid page %q: must be a positive number", page)
+		}
+		query.Page = n
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxPageLimit {
+			return query, ErrInvalidQuery.Withf("invalid limit %q: must be between 1 and %d", limit, MaxPageLimit)
+		}
+		query.Limit = n
+	}
+
+	if sort := values.Get("sort"); sort != "" {
+		if _, ok := sortColumns[sort]; !ok {
+			return query, ErrInvalidQuery.Withf("invalid sort %q: must be one of price, name or stock", sort)
+		}
+		query.Sort = sort
+	}
+
+	switch order := values.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return query, ErrInvalidQuery.Withf("invalid order %q: must be asc or desc", order)
+	}
+
+	query.Brand = values.Get("brand")
+
+	for _, param := range []struct {
+		name  string
+		value **float64
+	}{{"minPrice", &query.MinPrice}, {"maxPrice", &query.MaxPrice}} {
+		if raw := values.Get(param.name); raw != "" {
+			price, err := strconv.ParseFloat(raw, 64)
+			if err != nil || price < 0 {
+				return query, ErrInvalidQuery.Withf("invalid %s %q: must be a non-negative number", param.name, raw)
+			}
+			*param.value = &price
+		}
+	}
+
+	if inStock := values.Get("inStock"); inStock != "" {
+		b, err := strconv.ParseBool(inStock)
+		if err != nil {
+			return query, ErrInvalidQuery.Withf("invalid inStock %q: must be true or false", inStock)
+		}
+		query.InStock = b
+	}
+
+	if categoryID := values.Get("category"); categoryID != "" {
+		n, err := strconv.Atoi(categoryID)
+		if err != nil || n < 1 {
+			return query, ErrInvalidQuery.Withf("invalid category %q: must be a category ID", categoryID)
+		}
+		query.Category = n
+	}
+
+	return query, nil
+}
+
+// searchPage runs a search and wraps its results in a single page for the product list template
+func searchPage(s *ProductService, query ProductQuery) (*ProductPage, error) {
+	results, err := s.searchProductsService(query)
+	if err != nil {
+		return nil, err
+	}
+
+	products := make([]Product, len(results))
+	for i, result := range results {
+		products[i] = result.Product
+	}
+	return &ProductPage{Products: products, Page: 1, Limit: query.Limit, Total: len(products), TotalPages: 1}, nil
+}
+
+// pageURL returns the listing URL for the given page keeping every other query parameter,
+// or an empty string when the page is out of range
+func pageURL(u *url.URL, page, totalPages int) string {
+	if page < 1 || page > totalPages {
+		return ""
+	}
+	values := u.Query()
+	values.Set("page", strconv.Itoa(page))
+	return u.Path + "?" + values.Encode()
+}
+
+// paginationLinks builds an RFC 8288 Link header with the first, prev, next and last pages
+func paginationLinks(u *url.URL, page *ProductPage) string {
+	var links []string
+	for _, link := range []struct {
+		rel  string
+		page int
+	}{{"first", 1}, {"prev", page.Page - 1}, {"next", page.Page + 1}, {"last", page.TotalPages}} {
+		if target := pageURL(u, link.page, page.TotalPages); target != "" {
+			links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, target, link.rel))
+		}
+	}
+	return strings.Join(links, ", ")
+}
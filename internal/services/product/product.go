@@ -1,10 +1,93 @@
-package product
-
-type Product struct {
-	ProductID     int     `json:"productId"`
-	PricePerUnit  float64 `json:"pricePerUnit"`
-	ProductName   string  `json:"productName"`
-	ProductBrand  string  `json:"productBrand"`
-	Description   string  `json:"description"`
-	StockQuantity int     `json:"stockQuantity"`
-}
+package product
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ecommerce/internal/core/response"
+)
+
+// Product is validated with utils.Validate before it is stored, see the validate tags.
+// Version is bumped by every change, updates carrying a non-zero Version only apply to that version.
+// SKU is optional, but unique among the products that have one. WeightGrams is the shipping weight
+// of one unit, 0 when unknown.
+type Product struct {
+	ProductID     int     `json:"productId"`
+	SKU           string  `json:"sku" validate:"max=64"`
+	PricePerUnit  float64 `json:"pricePerUnit" validate:"gt=0"`
+	ProductName   string  `json:"productName" validate:"required,max=255"`
+	ProductBrand  string  `json:"productBrand" validate:"required,max=255"`
+	Description   string  `json:"description" validate:"max=2000"`
+	StockQuantity int     `json:"stockQuantity" validate:"min=0"`
+	WeightGrams   int     `json:"weightGrams" validate:"min=0"`
+	Version       int     `json:"version"`
+}
+
+// StockReservation holds units of a product variant for a cart until it expires.
+// Carts create them, checkout consumes them and stock updates may not go below them.
+type StockReservation struct {
+	ID        int       `json:"id"`
+	CartID    int       `json:"cart_id"`
+	ProductID int       `json:"product_id"`
+	VariantID int       `json:"variant_id"`
+	Quantity  int       `json:"quantity"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// ErrInvalidQuery is returned for listing and search parameters that can't be used
+var ErrInvalidQuery = response.New(http.StatusBadRequest, "invalid_query", "invalid query parameters")
+
+// ProductQuery holds the paging, sorting and filtering options of a product listing
+type ProductQuery struct {
+	Search   string // full-text search terms, results are ordered by relevance instead of Sort
+	Page     int
+	Limit    int
+	Sort     string // price, name or stock
+	Desc     bool
+	Brand    string
+	MinPrice *float64
+	MaxPrice *float64
+	InStock  bool
+	Category int // products of this category or of any of its subcategories
+
+	// CategoryIDs is Category followed by its subcategories, filled in by the product service
+	CategoryIDs []int
+}
+
+// ProductPage is one page of a product listing
+type ProductPage struct {
+	Products   []Product `json:"products"`
+	Page       int       `json:"page"`
+	Limit      int       `json:"limit"`
+	Total      int       `json:"total"`
+	TotalPages int       `json:"totalPages"`
+}
+
+// sortColumns maps the accepted sort keys to product columns
+var sortColumns = map[string]string{
+	"price": "pricePerUnit",
+	"name":  "productName",
+	"stock": "stockQuantity",
+}
+
+// matches reports whether a product passes the brand, price and stock filters of the query
+func (q ProductQuery) matches(product Product) bool {
+	if q.Brand != "" && product.ProductBrand != q.Brand {
+		return false
+	}
+	if q.MinPrice != nil && product.PricePerUnit < *q.MinPrice {
+		return false
+	}
+	if q.MaxPrice != nil && product.PricePerUnit > *q.MaxPrice {
+		return false
+	}
+	if q.InStock && product.StockQuantity <= 0 {
+		return false
+	}
+	return true
+}
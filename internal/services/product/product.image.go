@@ -0,0 +1,149 @@
+package product
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // registers the GIF decoder with image.Decode
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"time"
+
+	"github.com/ecommerce/internal/core/response"
+)
+
+const (
+	// thumbnailSize is the longest side of a thumbnail in pixels
+	thumbnailSize = 300
+	// maxImagePixels keeps small files that decode to huge images out
+	maxImagePixels = 40_000_000
+)
+
+var (
+	ErrImageNotFound    = response.New(http.StatusNotFound, "image_not_found", "no image found")
+	ErrImageTooLarge    = response.New(http.StatusRequestEntityTooLarge, "image_too_large", "the image is too large")
+	ErrUnsupportedImage = response.New(http.StatusUnsupportedMediaType, "unsupported_image", "images must be JPEG, PNG or GIF files")
+	ErrImageExists      = response.New(http.StatusConflict, "image_exists", "the product already has this image")
+)
+
+// imageExtensions are the file extensions of the accepted image types, as sniffed by http.DetectContentType
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Image is a picture of a product. The image and its thumbnail are kept in the blob store under
+// BlobKey and ThumbnailKey, and served from URL and ThumbnailURL.
+type Image struct {
+	ID           int       `json:"id"`
+	ProductID    int       `json:"productId"`
+	ContentType  string    `json:"contentType"`
+	Size         int64     `json:"size"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnailUrl"`
+	CreatedAt    time.Time `json:"createdAt"`
+
+	BlobKey      string `json:"-"`
+	ThumbnailKey string `json:"-"`
+	Checksum     string `json:"-"` // hex SHA-256 of the image, unique among the images of a product
+}
+
+// ProductDetail is a product along with its images, as products are served by the API
+type ProductDetail struct {
+	Product
+	Images []Image `json:"images"`
+}
+
+// ThumbnailType is the content type of the thumbnail: JPEG for JPEG images, PNG otherwise so transparency is kept
+func (i Image) ThumbnailType() string {
+	if i.ContentType == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// withURLs sets the URLs the image and its thumbnail are served from
+func (i *Image) withURLs() {
+	i.URL = fmt.Sprintf("/%s/%s/%d/images/%d", apiBasePath, productsBasePath, i.ProductID, i.ID)
+	i.ThumbnailURL = i.URL + "/thumbnail"
+}
+
+// newImage checks that data is a JPEG, PNG or GIF image of a product and makes its thumbnail.
+// The content type is sniffed from the data, the name or the declared type of the upload are not trusted.
+func newImage(productID int, data []byte) (*Image, []byte, error) {
+	contentType := http.DetectContentType(data)
+	extension, ok := imageExtensions[contentType]
+	if !ok {
+		return nil, nil, ErrUnsupportedImage
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, ErrUnsupportedImage.Withf("the image can't be read: %v", err)
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, nil, ErrImageTooLarge.Withf("the image is too large: at most %d pixels", maxImagePixels)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, ErrUnsupportedImage.Withf("the image can't be read: %v", err)
+	}
+
+	sum := sha256.Sum256(data)
+	img := &Image{
+		ProductID:   productID,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Width:       config.Width,
+		Height:      config.Height,
+		Checksum:    hex.EncodeToString(sum[:]),
+	}
+	img.BlobKey = fmt.Sprintf("products/%d/%s%s", productID, img.Checksum, extension)
+
+	var thumb bytes.Buffer
+	if img.ThumbnailType() == "image/jpeg" {
+		err = jpeg.Encode(&thumb, thumbnail(decoded), &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&thumb, thumbnail(decoded))
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	img.ThumbnailKey = fmt.Sprintf("products/%d/%s-thumb%s", productID, img.Checksum, imageExtensions[img.ThumbnailType()])
+
+	return img, thumb.Bytes(), nil
+}
+
+// thumbnail scales img down to fit in a square of thumbnailSize pixels, each pixel of the thumbnail
+// is the average of the pixels it covers. Images that already fit keep their size.
+func thumbnail(img image.Image) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	scale := max(float64(max(width, height))/thumbnailSize, 1)
+	thumbWidth, thumbHeight := max(int(float64(width)/scale), 1), max(int(float64(height)/scale), 1)
+
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := 0; y < thumbHeight; y++ {
+		y0, y1 := bounds.Min.Y+y*height/thumbHeight, bounds.Min.Y+(y+1)*height/thumbHeight
+		for x := 0; x < thumbWidth; x++ {
+			x0, x1 := bounds.Min.X+x*width/thumbWidth, bounds.Min.X+(x+1)*width/thumbWidth
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			thumb.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return thumb
+}
@@ -0,0 +1,445 @@
+package product
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/services/category"
+	"github.com/ecommerce/utils"
+)
+
+// MemoryProductRepository is a ProductRepository keeping products in a memory.DB
+type MemoryProductRepository struct {
+	mem    *memory.DB
+	locked bool // set on the repository handed to withTransaction functions, which hold the lock already
+}
+
+func NewMemoryProductRepository(mem *memory.DB) *MemoryProductRepository {
+	return &MemoryProductRepository{mem: mem}
+}
+
+func (repo *MemoryProductRepository) getProduct(productID int) (*Product, error) {
+	var product *Product
+	err := repo.view(func() error {
+		if found, ok := repo.products().Get(productID); ok {
+			product = &found
+		}
+		return nil
+	})
+	return product, err
+}
+
+func (repo *MemoryProductRepository) getProductBySKU(sku string) (*Product, error) {
+	var product *Product
+	err := repo.view(func() error {
+		if found, ok := repo.products().First(func(p Product) bool { return p.SKU == sku }); ok {
+			product = &found
+		}
+		return nil
+	})
+	return product, err
+}
+
+// removeProduct deletes the product along with its variants, images, the stock reserved for it and its category links
+func (repo *MemoryProductRepository) removeProduct(productID int) error {
+	return repo.update(func() error {
+		repo.products().Delete(productID)
+		VariantsOf(repo.mem).DeleteWhere(func(v Variant) bool { return v.ProductID == productID })
+		repo.images().DeleteWhere(func(i Image) bool { return i.ProductID == productID })
+		ReservationsOf(repo.mem).DeleteWhere(func(r StockReservation) bool { return r.ProductID == productID })
+		category.LinksOf(repo.mem).DeleteWhere(func(l category.ProductCategory) bool { return l.ProductID == productID })
+		return nil
+	})
+}
+
+func (repo *MemoryProductRepository) getAllProducts() ([]Product, error) {
+	var products []Product
+	err := repo.view(func() error {
+		products = repo.products().Rows()
+		return nil
+	})
+	return products, err
+}
+
+func (repo *MemoryProductRepository) getProductsByIDs(productIDs []int) ([]Product, error) {
+	products := make([]Product, 0, len(productIDs))
+	err := repo.view(func() error {
+		for _, productID := range productIDs {
+			if product, ok := repo.products().Get(productID); ok {
+				products = append(products, product)
+			}
+		}
+		return nil
+	})
+	return products, err
+}
+
+// getProducts returns one page of products matching the query filters, along with the total number of matches
+func (repo *MemoryProductRepository) getProducts(q ProductQuery) ([]Product, int, error) {
+	var matches []Product
+	err := repo.view(func() error {
+		matches = repo.products().Filter(q.matches)
+		if len(q.CategoryIDs) > 0 {
+			inCategory := category.ProductIDsOf(repo.mem, q.CategoryIDs)
+			matches = slices.DeleteFunc(matches, func(p Product) bool { return !slices.Contains(inCategory, p.ProductID) })
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// same order as the MySQL repository: the sort column, then productId
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if q.Desc {
+			a, b = b, a
+		}
+		switch q.Sort {
+		case "price":
+			if a.PricePerUnit != b.PricePerUnit {
+				return a.PricePerUnit < b.PricePerUnit
+			}
+		case "name":
+			if a.ProductName != b.ProductName {
+				return a.ProductName < b.ProductName
+			}
+		case "stock":
+			if a.StockQuantity != b.StockQuantity {
+				return a.StockQuantity < b.StockQuantity
+			}
+		}
+		return matches[i].ProductID < matches[j].ProductID
+	})
+
+	start := min((q.Page-1)*q.Limit, len(matches))
+	end := min(start+q.Limit, len(matches))
+	return matches[start:end], len(matches), nil
+}
+
+func (repo *MemoryProductRepository) updateProduct(product Product, columns ...string) (int, error) {
+	err := repo.update(func() error {
+		current, ok := repo.products().Get(product.ProductID)
+		if !ok {
+			return ErrProductNotFound
+		}
+		if product.Version != 0 && product.Version != current.Version {
+			return ErrVersionConflict
+		}
+
+		if updatesColumn(columns, STOCK_QUANTITY) {
+			reserved := 0
+			now := time.Now()
+			for _, reservation := range ReservationsOf(repo.mem).Filter(func(r StockReservation) bool {
+				return r.ProductID == product.ProductID && r.ExpiresAt.After(now)
+			}) {
+				reserved += reservation.Quantity
+			}
+			if product.StockQuantity < reserved {
+				return ErrStockBelowReserved.Withf("stock quantity cannot be lower than the %d units reserved in carts", reserved)
+			}
+		}
+
+		if repo.skuTaken(product) {
+			return ErrSKUTaken
+		}
+
+		// the stock of a product is the stock of its variants, it can only be set directly through a single one
+		if updatesColumn(columns, STOCK_QUANTITY) && product.StockQuantity != current.StockQuantity {
+			variants := VariantsOf(repo.mem).Filter(func(v Variant) bool { return v.ProductID == product.ProductID })
+			if len(variants) > 1 {
+				return ErrStockByVariant
+			}
+			for _, variant := range variants {
+				variant.StockQuantity = product.StockQuantity
+				VariantsOf(repo.mem).Put(variant.ID, variant)
+			}
+		}
+
+		version := current.Version + 1
+		utils.CopyColumns(&current, product, columns...)
+		current.Version = version
+		repo.products().Put(product.ProductID, current)
+		product.Version = version
+		return nil
+	})
+	return product.Version, err
+}
+
+func (repo *MemoryProductRepository) addProduct(product Product) (int, error) {
+	err := repo.update(func() error {
+		if repo.skuTaken(product) {
+			return ErrSKUTaken
+		}
+
+		product.ProductID = repo.products().NextID()
+		product.Version = 1
+		repo.products().Put(product.ProductID, product)
+
+		// the default variant holds all the stock of a new product
+		variant := Variant{ID: VariantsOf(repo.mem).NextID(), ProductID: product.ProductID, Attributes: Attributes{}, StockQuantity: product.StockQuantity, IsDefault: true}
+		VariantsOf(repo.mem).Put(variant.ID, variant)
+		return nil
+	})
+	return product.ProductID, err
+}
+
+// getVariants returns the variants of a product, the default variant first
+func (repo *MemoryProductRepository) getVariants(productID int) ([]Variant, error) {
+	var variants []Variant
+	err := repo.view(func() error {
+		variants = VariantsOf(repo.mem).Filter(func(v Variant) bool { return v.ProductID == productID })
+		return nil
+	})
+	sort.SliceStable(variants, func(i, j int) bool { return variants[i].IsDefault && !variants[j].IsDefault })
+	return variants, err
+}
+
+func (repo *MemoryProductRepository) getVariant(variantID int) (*Variant, error) {
+	var variant *Variant
+	err := repo.view(func() error {
+		if found, ok := VariantsOf(repo.mem).Get(variantID); ok {
+			variant = &found
+		}
+		return nil
+	})
+	return variant, err
+}
+
+// addVariant is the in-memory counterpart of the MySQL addVariant
+func (repo *MemoryProductRepository) addVariant(variant Variant) (int, error) {
+	err := repo.update(func() error {
+		if _, ok := repo.products().Get(variant.ProductID); !ok {
+			return ErrProductNotFound
+		}
+		if repo.variantSKUTaken(variant) {
+			return ErrSKUTaken.Withf("another variant already uses this SKU")
+		}
+
+		if variant.IsDefault {
+			repo.clearDefaultVariant(variant.ProductID)
+		}
+		variant.ID = VariantsOf(repo.mem).NextID()
+		VariantsOf(repo.mem).Put(variant.ID, variant)
+		repo.addProductStock(variant.ProductID, variant.StockQuantity)
+		return nil
+	})
+	return variant.ID, err
+}
+
+// updateVariant is the in-memory counterpart of the MySQL updateVariant
+func (repo *MemoryProductRepository) updateVariant(variant Variant) error {
+	return repo.update(func() error {
+		current, ok := VariantsOf(repo.mem).Get(variant.ID)
+		if !ok || current.ProductID != variant.ProductID {
+			return ErrVariantNotFound
+		}
+		if current.IsDefault && !variant.IsDefault {
+			return ErrDefaultVariant
+		}
+
+		reserved := 0
+		now := time.Now()
+		for _, reservation := range ReservationsOf(repo.mem).Filter(func(r StockReservation) bool {
+			return r.VariantID == variant.ID && r.ExpiresAt.After(now)
+		}) {
+			reserved += reservation.Quantity
+		}
+		if variant.StockQuantity < reserved {
+			return ErrStockBelowReserved.Withf("stock quantity cannot be lower than the %d units reserved in carts", reserved)
+		}
+		if repo.variantSKUTaken(variant) {
+			return ErrSKUTaken.Withf("another variant already uses this SKU")
+		}
+
+		if variant.IsDefault && !current.IsDefault {
+			repo.clearDefaultVariant(variant.ProductID)
+		}
+		VariantsOf(repo.mem).Put(variant.ID, variant)
+		repo.addProductStock(variant.ProductID, variant.StockQuantity-current.StockQuantity)
+		return nil
+	})
+}
+
+// removeVariant is the in-memory counterpart of the MySQL removeVariant. Cart lines of the variant are
+// left behind like those of removed products, carts skip them.
+func (repo *MemoryProductRepository) removeVariant(productID, variantID int) error {
+	return repo.update(func() error {
+		current, ok := VariantsOf(repo.mem).Get(variantID)
+		if !ok || current.ProductID != productID {
+			return ErrVariantNotFound
+		}
+		if current.IsDefault {
+			return ErrDefaultVariant
+		}
+
+		VariantsOf(repo.mem).Delete(variantID)
+		ReservationsOf(repo.mem).DeleteWhere(func(r StockReservation) bool { return r.VariantID == variantID })
+		repo.addProductStock(productID, -current.StockQuantity)
+		return nil
+	})
+}
+
+// getImages returns the images of the given products, oldest first
+func (repo *MemoryProductRepository) getImages(productIDs ...int) ([]Image, error) {
+	images := make([]Image, 0)
+	err := repo.view(func() error {
+		images = append(images, repo.images().Filter(func(i Image) bool { return slices.Contains(productIDs, i.ProductID) })...)
+		return nil
+	})
+	return images, err
+}
+
+func (repo *MemoryProductRepository) getImage(imageID int) (*Image, error) {
+	var image *Image
+	err := repo.view(func() error {
+		if found, ok := repo.images().Get(imageID); ok {
+			image = &found
+		}
+		return nil
+	})
+	return image, err
+}
+
+// addImage stores an image of a product and bumps the version of the product, its images are part of it
+func (repo *MemoryProductRepository) addImage(image Image) (int, error) {
+	err := repo.update(func() error {
+		if _, ok := repo.products().Get(image.ProductID); !ok {
+			return ErrProductNotFound
+		}
+		if _, exists := repo.images().First(func(i Image) bool { return i.ProductID == image.ProductID && i.Checksum == image.Checksum }); exists {
+			return ErrImageExists
+		}
+
+		image.ID = repo.images().NextID()
+		image.CreatedAt = time.Now()
+		repo.images().Put(image.ID, image)
+		repo.bumpVersion(image.ProductID)
+		return nil
+	})
+	return image.ID, err
+}
+
+// removeImage deletes an image of a product and bumps the version of the product
+func (repo *MemoryProductRepository) removeImage(productID, imageID int) error {
+	return repo.update(func() error {
+		current, ok := repo.images().Get(imageID)
+		if !ok || current.ProductID != productID {
+			return ErrImageNotFound
+		}
+
+		repo.images().Delete(imageID)
+		repo.bumpVersion(productID)
+		return nil
+	})
+}
+
+// withTransaction runs fn with the database locked. There is no rollback, so fn must check
+// everything it can before it writes.
+func (repo *MemoryProductRepository) withTransaction(fn func(repo ProductRepository) error) error {
+	return repo.mem.Update(func() error {
+		return fn(&MemoryProductRepository{mem: repo.mem, locked: true})
+	})
+}
+
+// skuTaken reports whether another product already has the SKU of product, the products table has a unique key on it
+func (repo *MemoryProductRepository) skuTaken(product Product) bool {
+	if product.SKU == "" {
+		return false
+	}
+	_, taken := repo.products().First(func(p Product) bool { return p.SKU == product.SKU && p.ProductID != product.ProductID })
+	return taken
+}
+
+// variantSKUTaken reports whether another variant already has the SKU of variant, the product_variants table has a unique key on it
+func (repo *MemoryProductRepository) variantSKUTaken(variant Variant) bool {
+	if variant.SKU == "" {
+		return false
+	}
+	_, taken := VariantsOf(repo.mem).First(func(v Variant) bool { return v.SKU == variant.SKU && v.ID != variant.ID })
+	return taken
+}
+
+// clearDefaultVariant makes no variant of a product the default one, the caller must hold the write lock
+func (repo *MemoryProductRepository) clearDefaultVariant(productID int) {
+	VariantsOf(repo.mem).Update(func(v Variant) bool { return v.ProductID == productID }, func(v Variant) Variant {
+		v.IsDefault = false
+		return v
+	})
+}
+
+// addProductStock adds the change of the stock of one of its variants to the stock of a product, and bumps its version.
+// The caller must hold the write lock.
+func (repo *MemoryProductRepository) addProductStock(productID, delta int) {
+	if product, ok := repo.products().Get(productID); ok {
+		product.StockQuantity += delta
+		product.Version++
+		repo.products().Put(productID, product)
+	}
+}
+
+// bumpVersion bumps the version of a product whose images changed, the caller must hold the write lock
+func (repo *MemoryProductRepository) bumpVersion(productID int) {
+	if product, ok := repo.products().Get(productID); ok {
+		product.Version++
+		repo.products().Put(productID, product)
+	}
+}
+
+func (repo *MemoryProductRepository) view(fn func() error) error {
+	if repo.locked {
+		return fn()
+	}
+	return repo.mem.View(fn)
+}
+
+func (repo *MemoryProductRepository) update(fn func() error) error {
+	if repo.locked {
+		return fn()
+	}
+	return repo.mem.Update(fn)
+}
+
+func (repo *MemoryProductRepository) products() *memory.Table[Product] {
+	return ProductsOf(repo.mem)
+}
+
+func (repo *MemoryProductRepository) images() *memory.Table[Image] {
+	return memory.TableOf[Image](repo.mem, IMAGES_TABLE)
+}
+
+// Seed adds the given products, e.g. DemoProducts so an in-memory storefront isn't empty
+func (repo *MemoryProductRepository) Seed(products []Product) {
+	for _, product := range products {
+		repo.addProduct(product)
+	}
+}
+
+// DemoProducts is the catalog of the in-memory storefront
+var DemoProducts = []Product{
+	{SKU: "SAM-S23", PricePerUnit: 799.99, ProductName: "Galaxy S23", ProductBrand: "Samsung", Description: "6.1 inch smartphone with a triple camera", StockQuantity: 25, WeightGrams: 168},
+	{SKU: "APL-IP15", PricePerUnit: 999.00, ProductName: "iPhone 15", ProductBrand: "Apple", Description: "6.1 inch smartphone with USB-C", StockQuantity: 30, WeightGrams: 171},
+	{SKU: "APL-MBA13", PricePerUnit: 1299.00, ProductName: "MacBook Air 13", ProductBrand: "Apple", Description: "Lightweight laptop with an M2 chip", StockQuantity: 10, WeightGrams: 1240},
+	{SKU: "SNY-XM5", PricePerUnit: 349.99, ProductName: "WH-1000XM5", ProductBrand: "Sony", Description: "Wireless noise cancelling headphones", StockQuantity: 40, WeightGrams: 250},
+	{SKU: "LOG-MX3S", PricePerUnit: 49.99, ProductName: "MX Master 3S", ProductBrand: "Logitech", Description: "Wireless mouse with quiet clicks", StockQuantity: 100, WeightGrams: 141},
+	{SKU: "LOG-K380", PricePerUnit: 129.99, ProductName: "K380 Keyboard", ProductBrand: "Logitech", Description: "Compact bluetooth keyboard for multiple devices", StockQuantity: 0, WeightGrams: 423},
+}
+
+// functions for memory repositories outside product pkg
+
+// ProductsOf returns the products table of an in-memory database
+func ProductsOf(mem *memory.DB) *memory.Table[Product] {
+	return memory.TableOf[Product](mem, TABLE_NAME)
+}
+
+// VariantsOf returns the product variants table of an in-memory database
+func VariantsOf(mem *memory.DB) *memory.Table[Variant] {
+	return memory.TableOf[Variant](mem, VARIANTS_TABLE)
+}
+
+// ReservationsOf returns the stock reservations table of an in-memory database
+func ReservationsOf(mem *memory.DB) *memory.Table[StockReservation] {
+	return memory.TableOf[StockReservation](mem, RESERVATIONS_TABLE)
+}
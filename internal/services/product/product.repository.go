@@ -1,111 +1,746 @@
-package product
-
-import (
-	"database/sql"
-	"fmt"
-	"log"
-
-	"github.com/ecommerce/utils"
-)
-
-const (
-	PRODUCT_ID = "productId"
-	TABLE_NAME = "products"
-)
-
-type ProductRepository struct {
-	db *sql.DB
-}
-
-func NewProductRepository(db *sql.DB) *ProductRepository {
-	return &ProductRepository{db: db}
-}
-
-func (repo *ProductRepository) getProduct(productID int) (*Product, error) {
-	product := &Product{}
-	whereClause := fmt.Sprintf("%s = ?", PRODUCT_ID)
-	query := utils.BuildSelectQuery(TABLE_NAME, product, whereClause)
-
-	row := repo.db.QueryRow(query, productID)
-	err := row.Scan(
-		&product.ProductID,
-		&product.PricePerUnit,
-		&product.ProductName,
-		&product.ProductBrand,
-		&product.Description,
-		&product.StockQuantity)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	} else if err != nil {
-		log.Println(err)
-		return nil, err
-	}
-	return product, nil
-}
-
-func (repo *ProductRepository) removeProduct(productID int) error {
-	whereClause := fmt.Sprintf("%s = ?", PRODUCT_ID)
-	query := utils.BuildDeleteQuery(TABLE_NAME, whereClause)
-
-	_, err := repo.db.Exec(query, productID)
-	if err != nil {
-		log.Println(err.Error())
-		return err
-	}
-	return nil
-}
-
-func (repo *ProductRepository) getAllProducts() ([]Product, error) {
-	query := utils.BuildSelectQuery(TABLE_NAME, &Product{}, "")
-	results, err := repo.db.Query(query)
-	if err != nil {
-		log.Println(err.Error())
-		return nil, err
-	}
-	defer results.Close()
-	products := make([]Product, 0)
-	for results.Next() {
-		var product Product
-		results.Scan(&product.ProductID,
-			&product.PricePerUnit,
-			&product.ProductName,
-			&product.ProductBrand,
-			&product.Description,
-			&product.StockQuantity)
-
-		products = append(products, product)
-	}
-	return products, nil
-}
-
-func (repo *ProductRepository) updateProduct(product Product) error {
-	whereClause := fmt.Sprintf("%s = %d", PRODUCT_ID, product.ProductID)
-	query, args := utils.BuildUpdateQuery(TABLE_NAME, product, whereClause)
-
-	// Log the query and arguments to inspect them
-	log.Println("Query:", query)
-	log.Println("Args:", fmt.Sprintln(args...))
-
-	_, err := repo.db.Exec(query, args...)
-	if err != nil {
-		log.Println(err.Error())
-		return err
-	}
-	return nil
-}
-
-func (repo *ProductRepository) addProduct(product Product) (int, error) {
-	query, args := utils.BuildInsertQuery(TABLE_NAME, product)
-	result, err := repo.db.Exec(query, args...)
-
-	if err != nil {
-		log.Println(err.Error())
-		return 0, err
-	}
-	insertID, err := result.LastInsertId()
-	if err != nil {
-		log.Println(err.Error())
-		return 0, err
-	}
-	return int(insertID), nil
-}
+package product
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/utils"
+)
+
+const (
+	PRODUCT_ID         = "productId"
+	STOCK_QUANTITY     = "stockQuantity"
+	VERSION            = "version"
+	TABLE_NAME         = "products"
+	RESERVATIONS_TABLE = "stock_reservations"
+	VARIANTS_TABLE     = "product_variants"
+	IMAGES_TABLE       = "product_images"
+)
+
+// variantColumns are the columns scanned by scanVariant
+const variantColumns = `id, product_id, sku, attributes, price_override, stock_quantity, is_default`
+
+// imageColumns are the columns scanned by scanImage
+const imageColumns = `id, product_id, blob_key, thumbnail_key, content_type, size_bytes, width, height, checksum, created_at`
+
+var (
+	ErrProductNotFound    = response.New(http.StatusNotFound, "product_not_found", "no product found")
+	ErrStockBelowReserved = response.New(http.StatusConflict, "stock_below_reserved", "stock quantity cannot be lower than the reserved quantity")
+	ErrSKUTaken           = response.New(http.StatusConflict, "sku_taken", "another product already uses this SKU")
+	ErrVersionConflict    = response.New(http.StatusPreconditionFailed, "version_conflict", "the product was changed since it was read, reload it and try again")
+)
+
+// ProductRepository stores products. MySQLProductRepository is the production implementation,
+// MemoryProductRepository keeps everything in process for demos and tests.
+type ProductRepository interface {
+	getProduct(productID int) (*Product, error)
+	removeProduct(productID int) error
+	getAllProducts() ([]Product, error)
+	getProductsByIDs(productIDs []int) ([]Product, error)
+	getProducts(q ProductQuery) ([]Product, int, error)
+	getProductBySKU(sku string) (*Product, error)
+	updateProduct(product Product, columns ...string) (int, error)
+	addProduct(product Product) (int, error)
+
+	// the variants of a product, whose stock makes up the stock of the product
+	getVariants(productID int) ([]Variant, error)
+	getVariant(variantID int) (*Variant, error)
+	addVariant(variant Variant) (int, error)
+	updateVariant(variant Variant) error
+	removeVariant(productID, variantID int) error
+
+	// the images of a product, whose files are kept in the blob store
+	getImages(productIDs ...int) ([]Image, error)
+	getImage(imageID int) (*Image, error)
+	addImage(image Image) (int, error)
+	removeImage(productID, imageID int) error
+
+	// withTransaction runs fn with a repository whose changes are only kept if fn succeeds
+	withTransaction(fn func(repo ProductRepository) error) error
+}
+
+type MySQLProductRepository struct {
+	db *sql.DB
+	tx *sql.Tx // set on the repository handed to withTransaction functions
+}
+
+func NewMySQLProductRepository(db *sql.DB) *MySQLProductRepository {
+	return &MySQLProductRepository{db: db}
+}
+
+func (repo *MySQLProductRepository) getProduct(productID int) (*Product, error) {
+	product := &Product{}
+	whereClause := fmt.Sprintf("%s = ?", PRODUCT_ID)
+	query := utils.BuildSelectQuery(TABLE_NAME, product, whereClause)
+
+	row := repo.conn().QueryRow(query, productID)
+	err := scanProduct(row, product)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return product, nil
+}
+
+// getProductBySKU returns the product with the given SKU, nil if there is none
+func (repo *MySQLProductRepository) getProductBySKU(sku string) (*Product, error) {
+	product := &Product{}
+	query := utils.BuildSelectQuery(TABLE_NAME, product, "sku = ?")
+
+	row := repo.conn().QueryRow(query, sku)
+	err := scanProduct(row, product)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return product, nil
+}
+
+func (repo *MySQLProductRepository) removeProduct(productID int) error {
+	whereClause := fmt.Sprintf("%s = ?", PRODUCT_ID)
+	query := utils.BuildDeleteQuery(TABLE_NAME, whereClause)
+
+	_, err := repo.db.Exec(query, productID)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (repo *MySQLProductRepository) getAllProducts() ([]Product, error) {
+	query := utils.BuildSelectQuery(TABLE_NAME, &Product{}, "")
+	results, err := repo.db.Query(query)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	products := make([]Product, 0)
+	for results.Next() {
+		var product Product
+		scanProduct(results, &product)
+
+		products = append(products, product)
+	}
+	return products, nil
+}
+
+// getProductsByIDs returns the products with the given ids, in no particular order
+func (repo *MySQLProductRepository) getProductsByIDs(productIDs []int) ([]Product, error) {
+	products := make([]Product, 0, len(productIDs))
+	if len(productIDs) == 0 {
+		return products, nil
+	}
+
+	placeholders, args := inList(productIDs)
+	whereClause := fmt.Sprintf("%s IN (%s)", PRODUCT_ID, placeholders)
+	query := utils.BuildSelectQuery(TABLE_NAME, &Product{}, whereClause)
+
+	results, err := repo.db.Query(query, args...)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+
+	for results.Next() {
+		var product Product
+		err := scanProduct(results, &product)
+		if err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, results.Err()
+}
+
+// getProducts returns one page of products matching the query filters, along with the total number of matches
+func (repo *MySQLProductRepository) getProducts(q ProductQuery) ([]Product, int, error) {
+	var conditions []string
+	var args []interface{}
+	if q.Brand != "" {
+		conditions = append(conditions, "productBrand = ?")
+		args = append(args, q.Brand)
+	}
+	if q.MinPrice != nil {
+		conditions = append(conditions, "pricePerUnit >= ?")
+		args = append(args, *q.MinPrice)
+	}
+	if q.MaxPrice != nil {
+		conditions = append(conditions, "pricePerUnit <= ?")
+		args = append(args, *q.MaxPrice)
+	}
+	if q.InStock {
+		conditions = append(conditions, "stockQuantity > 0")
+	}
+	if len(q.CategoryIDs) > 0 {
+		placeholders, categoryArgs := inList(q.CategoryIDs)
+		conditions = append(conditions, fmt.Sprintf("%s IN (SELECT product_id FROM product_categories WHERE category_id IN (%s))", PRODUCT_ID, placeholders))
+		args = append(args, categoryArgs...)
+	}
+	whereClause := strings.Join(conditions, " AND ")
+
+	var total int
+	err := repo.db.QueryRow(utils.BuildCountQuery(TABLE_NAME, whereClause), args...).Scan(&total)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, 0, err
+	}
+
+	// sort keys are mapped through a whitelist; productId keeps the order stable between pages
+	orderBy := PRODUCT_ID
+	if column, ok := sortColumns[q.Sort]; ok {
+		direction := "ASC"
+		if q.Desc {
+			direction = "DESC"
+		}
+		orderBy = fmt.Sprintf("%s %s, %s", column, direction, PRODUCT_ID)
+	}
+
+	opts := utils.SelectOptions{OrderBy: orderBy, Limit: q.Limit, Offset: (q.Page - 1) * q.Limit}
+	query := utils.BuildSelectQuery(TABLE_NAME, &Product{}, whereClause, opts)
+	results, err := repo.db.Query(query, args...)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, 0, err
+	}
+	defer results.Close()
+
+	products := make([]Product, 0)
+	for results.Next() {
+		var product Product
+		err := scanProduct(results, &product)
+		if err != nil {
+			log.Println(err.Error())
+			return nil, 0, err
+		}
+		products = append(products, product)
+	}
+	return products, total, results.Err()
+}
+
+// updateProduct writes the given columns of the product, all of them when none are given,
+// and returns the new version of the product
+func (repo *MySQLProductRepository) updateProduct(product Product, columns ...string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	err := repo.transaction(ctx, func(tx *sql.Tx) error {
+		// lock the product so carts can't reserve stock while it is being changed
+		var version, stockQuantity int
+		err := tx.QueryRowContext(ctx, `SELECT version, stockQuantity FROM products WHERE productId = ? FOR UPDATE`, product.ProductID).Scan(&version, &stockQuantity)
+		if err == sql.ErrNoRows {
+			return ErrProductNotFound
+		} else if err != nil {
+			return err
+		}
+		if product.Version != 0 && product.Version != version {
+			return ErrVersionConflict
+		}
+
+		if updatesColumn(columns, STOCK_QUANTITY) {
+			var reserved int
+			err = tx.QueryRowContext(ctx, `
+				SELECT COALESCE(SUM(quantity), 0)
+				FROM stock_reservations
+				WHERE product_id = ? AND expires_at > ?`, product.ProductID, time.Now()).Scan(&reserved)
+			if err != nil {
+				return err
+			}
+
+			if product.StockQuantity < reserved {
+				return ErrStockBelowReserved.Withf("stock quantity cannot be lower than the %d units reserved in carts", reserved)
+			}
+
+			// the stock of a product is the stock of its variants, it can only be set directly through a single one
+			if product.StockQuantity != stockQuantity {
+				var variants int
+				err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM product_variants WHERE product_id = ?`, product.ProductID).Scan(&variants)
+				if err != nil {
+					return err
+				}
+				if variants > 1 {
+					return ErrStockByVariant
+				}
+				_, err = tx.ExecContext(ctx, `UPDATE product_variants SET stock_quantity = ? WHERE product_id = ?`, product.StockQuantity, product.ProductID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		product.Version = version + 1
+		if len(columns) > 0 {
+			columns = append(slices.Clip(columns), VERSION)
+		}
+		whereClause := fmt.Sprintf("%s = %d", PRODUCT_ID, product.ProductID)
+		query, args := utils.BuildUpdateQuery(TABLE_NAME, product, whereClause, columns...)
+
+		// Log the query and arguments to inspect them
+		log.Println("Query:", query)
+		log.Println("Args:", fmt.Sprintln(args...))
+
+		_, err = tx.ExecContext(ctx, query, args...)
+		if utils.IsDuplicateEntry(err) {
+			return ErrSKUTaken
+		}
+		return err
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	return product.Version, nil
+}
+
+// addProduct inserts a product along with its default variant, which holds all of its stock
+func (repo *MySQLProductRepository) addProduct(product Product) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	err := repo.transaction(ctx, func(tx *sql.Tx) error {
+		product.Version = 1
+		query, args := utils.BuildInsertQuery(TABLE_NAME, product)
+		result, err := tx.ExecContext(ctx, query, args...)
+		if utils.IsDuplicateEntry(err) {
+			return ErrSKUTaken
+		} else if err != nil {
+			return err
+		}
+		insertID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		product.ProductID = int(insertID)
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO product_variants (product_id, attributes, stock_quantity, is_default)
+			VALUES (?, JSON_OBJECT(), ?, 1)`, product.ProductID, product.StockQuantity)
+		return err
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	return product.ProductID, nil
+}
+
+// getVariants returns the variants of a product, the default variant first
+func (repo *MySQLProductRepository) getVariants(productID int) ([]Variant, error) {
+	rows, err := repo.conn().Query(`SELECT `+variantColumns+` FROM product_variants WHERE product_id = ? ORDER BY is_default DESC, id`, productID)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := make([]Variant, 0)
+	for rows.Next() {
+		var variant Variant
+		if err := scanVariant(rows, &variant); err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	return variants, rows.Err()
+}
+
+func (repo *MySQLProductRepository) getVariant(variantID int) (*Variant, error) {
+	variant := &Variant{}
+	row := repo.conn().QueryRow(`SELECT `+variantColumns+` FROM product_variants WHERE id = ?`, variantID)
+	err := scanVariant(row, variant)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return variant, nil
+}
+
+// addVariant inserts a variant and adds its stock to the stock of its product.
+// A new default variant takes over from the previous one.
+func (repo *MySQLProductRepository) addVariant(variant Variant) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	err := repo.transaction(ctx, func(tx *sql.Tx) error {
+		if err := lockProduct(ctx, tx, variant.ProductID); err != nil {
+			return err
+		}
+
+		if variant.IsDefault {
+			_, err := tx.ExecContext(ctx, `UPDATE product_variants SET is_default = 0 WHERE product_id = ?`, variant.ProductID)
+			if err != nil {
+				return err
+			}
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO product_variants (product_id, sku, attributes, price_override, stock_quantity, is_default)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			variant.ProductID, variant.SKU, variant.Attributes, variant.PriceOverride, variant.StockQuantity, variant.IsDefault)
+		if utils.IsDuplicateEntry(err) {
+			return ErrSKUTaken.Withf("another variant already uses this SKU")
+		} else if err != nil {
+			return err
+		}
+		insertID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		variant.ID = int(insertID)
+
+		return addProductStock(ctx, tx, variant.ProductID, variant.StockQuantity)
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	return variant.ID, nil
+}
+
+// updateVariant writes a variant and moves the stock of its product by the change of its stock.
+// The stock can't go below what carts hold, and the default variant can only be replaced by making
+// another variant the default.
+func (repo *MySQLProductRepository) updateVariant(variant Variant) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	err := repo.transaction(ctx, func(tx *sql.Tx) error {
+		if err := lockProduct(ctx, tx, variant.ProductID); err != nil {
+			return err
+		}
+
+		var stockQuantity int
+		var isDefault bool
+		err := tx.QueryRowContext(ctx, `SELECT stock_quantity, is_default FROM product_variants WHERE id = ? AND product_id = ? FOR UPDATE`,
+			variant.ID, variant.ProductID).Scan(&stockQuantity, &isDefault)
+		if err == sql.ErrNoRows {
+			return ErrVariantNotFound
+		} else if err != nil {
+			return err
+		}
+		if isDefault && !variant.IsDefault {
+			return ErrDefaultVariant
+		}
+
+		var reserved int
+		err = tx.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(quantity), 0)
+			FROM stock_reservations
+			WHERE variant_id = ? AND expires_at > ?`, variant.ID, time.Now()).Scan(&reserved)
+		if err != nil {
+			return err
+		}
+		if variant.StockQuantity < reserved {
+			return ErrStockBelowReserved.Withf("stock quantity cannot be lower than the %d units reserved in carts", reserved)
+		}
+
+		if variant.IsDefault && !isDefault {
+			_, err = tx.ExecContext(ctx, `UPDATE product_variants SET is_default = 0 WHERE product_id = ?`, variant.ProductID)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE product_variants
+			SET sku = ?, attributes = ?, price_override = ?, stock_quantity = ?, is_default = ?
+			WHERE id = ?`,
+			variant.SKU, variant.Attributes, variant.PriceOverride, variant.StockQuantity, variant.IsDefault, variant.ID)
+		if utils.IsDuplicateEntry(err) {
+			return ErrSKUTaken.Withf("another variant already uses this SKU")
+		} else if err != nil {
+			return err
+		}
+
+		return addProductStock(ctx, tx, variant.ProductID, variant.StockQuantity-stockQuantity)
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+// removeVariant deletes a variant other than the default one, along with the cart lines and
+// reservations of the variant, and takes its stock off the stock of its product
+func (repo *MySQLProductRepository) removeVariant(productID, variantID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	err := repo.transaction(ctx, func(tx *sql.Tx) error {
+		if err := lockProduct(ctx, tx, productID); err != nil {
+			return err
+		}
+
+		var stockQuantity int
+		var isDefault bool
+		err := tx.QueryRowContext(ctx, `SELECT stock_quantity, is_default FROM product_variants WHERE id = ? AND product_id = ? FOR UPDATE`,
+			variantID, productID).Scan(&stockQuantity, &isDefault)
+		if err == sql.ErrNoRows {
+			return ErrVariantNotFound
+		} else if err != nil {
+			return err
+		}
+		if isDefault {
+			return ErrDefaultVariant
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM product_variants WHERE id = ?`, variantID)
+		if err != nil {
+			return err
+		}
+		return addProductStock(ctx, tx, productID, -stockQuantity)
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+// getImages returns the images of the given products, oldest first
+func (repo *MySQLProductRepository) getImages(productIDs ...int) ([]Image, error) {
+	images := make([]Image, 0)
+	if len(productIDs) == 0 {
+		return images, nil
+	}
+
+	placeholders, args := inList(productIDs)
+	rows, err := repo.conn().Query(`SELECT `+imageColumns+` FROM product_images WHERE product_id IN (`+placeholders+`) ORDER BY id`, args...)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var image Image
+		if err := scanImage(rows, &image); err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+func (repo *MySQLProductRepository) getImage(imageID int) (*Image, error) {
+	image := &Image{}
+	row := repo.conn().QueryRow(`SELECT `+imageColumns+` FROM product_images WHERE id = ?`, imageID)
+	err := scanImage(row, image)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return image, nil
+}
+
+// addImage stores an image of a product and bumps the version of the product, its images are part of it
+func (repo *MySQLProductRepository) addImage(image Image) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	err := repo.transaction(ctx, func(tx *sql.Tx) error {
+		if err := lockProduct(ctx, tx, image.ProductID); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO product_images (product_id, blob_key, thumbnail_key, content_type, size_bytes, width, height, checksum)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			image.ProductID, image.BlobKey, image.ThumbnailKey, image.ContentType, image.Size, image.Width, image.Height, image.Checksum)
+		if utils.IsDuplicateEntry(err) {
+			return ErrImageExists
+		} else if err != nil {
+			return err
+		}
+		insertID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		image.ID = int(insertID)
+
+		return bumpVersion(ctx, tx, image.ProductID)
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	return image.ID, nil
+}
+
+// removeImage deletes an image of a product and bumps the version of the product
+func (repo *MySQLProductRepository) removeImage(productID, imageID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	err := repo.transaction(ctx, func(tx *sql.Tx) error {
+		if err := lockProduct(ctx, tx, productID); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `DELETE FROM product_images WHERE id = ? AND product_id = ?`, imageID, productID)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrImageNotFound
+		}
+
+		return bumpVersion(ctx, tx, productID)
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+// withTransaction runs fn in a single transaction, committed only if fn succeeds
+func (repo *MySQLProductRepository) withTransaction(fn func(repo ProductRepository) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	return repo.transaction(ctx, func(tx *sql.Tx) error {
+		return fn(&MySQLProductRepository{db: repo.db, tx: tx})
+	})
+}
+
+// transaction runs fn in the transaction of the repository if it has one,
+// otherwise in a new transaction committed when fn succeeds
+func (repo *MySQLProductRepository) transaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if repo.tx != nil {
+		return fn(repo.tx)
+	}
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// conn returns the transaction of the repository if it has one, the database otherwise
+func (repo *MySQLProductRepository) conn() querier {
+	if repo.tx != nil {
+		return repo.tx
+	}
+	return repo.db
+}
+
+// helper functions
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// updatesColumn reports whether an update of the given columns writes column, every update without columns does
+func updatesColumn(columns []string, column string) bool {
+	return len(columns) == 0 || slices.Contains(columns, column)
+}
+
+// inList returns the placeholders of an IN list of ids along with their arguments
+func inList(ids []int) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	return strings.Join(placeholders, ", "), args
+}
+
+// lockProduct locks a product row for the rest of the transaction, so the stock of its variants
+// and of the product change together
+func lockProduct(ctx context.Context, tx *sql.Tx, productID int) error {
+	var version int
+	err := tx.QueryRowContext(ctx, `SELECT version FROM products WHERE productId = ? FOR UPDATE`, productID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return ErrProductNotFound
+	}
+	return err
+}
+
+// addProductStock adds the change of the stock of one of its variants to the stock of a product, and bumps its version
+func addProductStock(ctx context.Context, tx *sql.Tx, productID, delta int) error {
+	_, err := tx.ExecContext(ctx, `UPDATE products SET stockQuantity = stockQuantity + ?, version = version + 1 WHERE productId = ?`, delta, productID)
+	return err
+}
+
+// bumpVersion bumps the version of a product whose images changed
+func bumpVersion(ctx context.Context, tx *sql.Tx, productID int) error {
+	_, err := tx.ExecContext(ctx, `UPDATE products SET version = version + 1 WHERE productId = ?`, productID)
+	return err
+}
+
+// scanProduct scans a row selected with utils.BuildSelectQuery into product
+func scanProduct(row utils.RowScanner, product *Product) error {
+	return row.Scan(
+		&product.ProductID,
+		&product.SKU,
+		&product.PricePerUnit,
+		&product.ProductName,
+		&product.ProductBrand,
+		&product.Description,
+		&product.StockQuantity,
+		&product.WeightGrams,
+		&product.Version)
+}
+
+// scanVariant scans a row of variantColumns into variant
+func scanVariant(row utils.RowScanner, variant *Variant) error {
+	return row.Scan(
+		&variant.ID,
+		&variant.ProductID,
+		&variant.SKU,
+		&variant.Attributes,
+		&variant.PriceOverride,
+		&variant.StockQuantity,
+		&variant.IsDefault)
+}
+
+// scanImage scans a row of imageColumns into image
+func scanImage(row utils.RowScanner, image *Image) error {
+	return row.Scan(
+		&image.ID,
+		&image.ProductID,
+		&image.BlobKey,
+		&image.ThumbnailKey,
+		&image.ContentType,
+		&image.Size,
+		&image.Width,
+		&image.Height,
+		&image.Checksum,
+		&image.CreatedAt)
+}
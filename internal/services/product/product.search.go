@@ -0,0 +1,199 @@
+package product
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// field weights used to rank search hits: a match in the name counts more than one in the description
+const (
+	nameWeight        = 3.0
+	brandWeight       = 2.0
+	descriptionWeight = 1.0
+	prefixFactor      = 0.5 // a term that only prefixes an indexed word scores half
+
+	// IndexRefreshInterval is how long the index is trusted before it is rebuilt from the database,
+	// so that writes made outside this process (e.g. another instance) eventually show up
+	IndexRefreshInterval = 5 * time.Minute
+)
+
+// SearchResult is a product matched by a search along with its relevance score
+type SearchResult struct {
+	Product
+	Score float64 `json:"score"`
+}
+
+// SearchIndex is an in-process inverted index over product names, brands and descriptions.
+// It is built lazily from the repository and kept up to date by the product service on every write.
+type SearchIndex struct {
+	mu       sync.RWMutex
+	builtAt  time.Time
+	postings map[string]map[int]float64 // term -> productId -> weight
+	terms    map[int][]string           // productId -> indexed terms, used to drop stale postings
+	names    map[int]string             // productId -> name, used to break ties
+}
+
+// NewSearchIndex creates an empty SearchIndex.
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		postings: make(map[string]map[int]float64),
+		terms:    make(map[int][]string),
+		names:    make(map[int]string),
+	}
+}
+
+// NeedsRebuild reports whether the index was never built or is older than IndexRefreshInterval
+func (idx *SearchIndex) NeedsRebuild() bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.builtAt.IsZero() || time.Since(idx.builtAt) > IndexRefreshInterval
+}
+
+// Build replaces the whole index with the given products
+func (idx *SearchIndex) Build(products []Product) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.postings = make(map[string]map[int]float64)
+	idx.terms = make(map[int][]string)
+	idx.names = make(map[int]string)
+	for _, product := range products {
+		idx.add(product)
+	}
+	idx.builtAt = time.Now()
+}
+
+// Invalidate forces the next search to rebuild the index from the repository
+func (idx *SearchIndex) Invalidate() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.builtAt = time.Time{}
+}
+
+// Upsert (re)indexes a single product
+func (idx *SearchIndex) Upsert(product Product) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(product.ProductID)
+	idx.add(product)
+}
+
+// Remove drops a product from the index
+func (idx *SearchIndex) Remove(productID int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(productID)
+}
+
+// Search returns the products matching the query, best match first. Products matching more of the
+// query terms rank above products with a higher score on fewer terms. Only ProductID and ProductName
+// are set on the returned products; callers load the rest from the repository.
+func (idx *SearchIndex) Search(query string) []SearchResult {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	scores := make(map[int]float64)
+	matched := make(map[int]int)
+	for _, term := range uniqueTerms(tokenize(query)) {
+		hits := make(map[int]float64)
+		for indexed, postings := range idx.postings {
+			factor := 0.0
+			if indexed == term {
+				factor = 1
+			} else if strings.HasPrefix(indexed, term) {
+				factor = prefixFactor
+			} else {
+				continue
+			}
+			for productID, weight := range postings {
+				if score := weight * factor; score > hits[productID] {
+					hits[productID] = score
+				}
+			}
+		}
+		for productID, score := range hits {
+			scores[productID] += score
+			matched[productID]++
+		}
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for productID, score := range scores {
+		results = append(results, SearchResult{Product: Product{ProductID: productID, ProductName: idx.names[productID]}, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if matched[a.ProductID] != matched[b.ProductID] {
+			return matched[a.ProductID] > matched[b.ProductID]
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.ProductName < b.ProductName
+	})
+	return results
+}
+
+// add indexes a product, caller must hold the write lock
+func (idx *SearchIndex) add(product Product) {
+	fields := []struct {
+		text   string
+		weight float64
+	}{
+		{product.ProductName, nameWeight},
+		{product.ProductBrand, brandWeight},
+		{product.Description, descriptionWeight},
+	}
+
+	for _, field := range fields {
+		for _, term := range tokenize(field.text) {
+			if idx.postings[term] == nil {
+				idx.postings[term] = make(map[int]float64)
+			}
+			if idx.postings[term][product.ProductID] == 0 {
+				idx.terms[product.ProductID] = append(idx.terms[product.ProductID], term)
+			}
+			idx.postings[term][product.ProductID] += field.weight
+		}
+	}
+	idx.names[product.ProductID] = product.ProductName
+}
+
+// remove drops every posting of a product, caller must hold the write lock
+func (idx *SearchIndex) remove(productID int) {
+	for _, term := range idx.terms[productID] {
+		delete(idx.postings[term], productID)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.terms, productID)
+	delete(idx.names, productID)
+}
+
+// helper functions
+
+// tokenize lower-cases text and splits it into letter/digit words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// uniqueTerms removes duplicate terms keeping their first occurrence
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool)
+	unique := terms[:0]
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+	return unique
+}
@@ -1,69 +1,590 @@
-package product
-
-import (
-	"errors"
-	"log"
-	"net/http"
-)
-
-// ProductService handles business logic for product-related operations.
-type ProductService struct {
-	Repo *ProductRepository
-}
-
-// NewProductService creates a new ProductService.
-func NewProductService(repo *ProductRepository) *ProductService {
-	return &ProductService{
-		Repo: repo,
-	}
-}
-
-func (s *ProductService) getAllProductsService() ([]Product, int, error) {
-	productList, err := s.Repo.getAllProducts()
-	if err != nil {
-		log.Printf("Error fetching products: %v", err)
-		return nil, http.StatusInternalServerError, err
-	}
-
-	return productList, http.StatusOK, nil
-}
-
-func (s *ProductService) getProductService(productID int) (*Product, int, error) {
-	product, err := s.Repo.getProduct(productID)
-
-	if err != nil {
-		return nil, http.StatusInternalServerError, err
-	}
-	if product == nil {
-		return nil, http.StatusNotFound, errors.New("No Product Found")
-	}
-
-	return product, http.StatusOK, nil
-}
-
-func (s *ProductService) addProductService(newProduct Product) (int, error) {
-	_, err := s.Repo.addProduct(newProduct)
-	if err != nil {
-		log.Print(err)
-		return http.StatusBadRequest, err
-	}
-	return http.StatusOK, nil
-}
-
-func (s *ProductService) updateProductService(updatedProduct Product) (int, error) {
-	err := s.Repo.updateProduct(updatedProduct)
-
-	if err != nil {
-		log.Println(err)
-		return http.StatusBadRequest, err
-	}
-	return http.StatusOK, nil
-}
-
-func (s *ProductService) removeProductService(productID int) (int, error) {
-	err := s.Repo.removeProduct(productID)
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
-	return http.StatusOK, nil
-}
+package product
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/ecommerce/internal/core/blob"
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/services/category"
+	"github.com/ecommerce/utils"
+)
+
+// searchBatchSize is how many search hits are loaded from the repository at a time
+const searchBatchSize = 100
+
+// ProductService handles business logic for product-related operations.
+type ProductService struct {
+	Repo         ProductRepository
+	Index        *SearchIndex
+	Categories   *category.CategoryService
+	Blobs        blob.BlobStore // keeps the files of product images
+	MaxImageSize int64          // largest accepted image upload in bytes
+}
+
+// NewProductService creates a new ProductService.
+func NewProductService(repo ProductRepository, categories *category.CategoryService, blobs blob.BlobStore, maxImageSize int64) *ProductService {
+	return &ProductService{
+		Repo:         repo,
+		Index:        NewSearchIndex(),
+		Categories:   categories,
+		Blobs:        blobs,
+		MaxImageSize: maxImageSize,
+	}
+}
+
+func (s *ProductService) getAllProductsService() ([]Product, error) {
+	productList, err := s.Repo.getAllProducts()
+	if err != nil {
+		log.Printf("Error fetching products: %v", err)
+		return nil, err
+	}
+
+	return productList, nil
+}
+
+func (s *ProductService) getProductsService(q ProductQuery) (*ProductPage, error) {
+	q, err := s.resolveCategory(q)
+	if err != nil {
+		return nil, err
+	}
+
+	products, total, err := s.Repo.getProducts(q)
+	if err != nil {
+		log.Printf("Error fetching products: %v", err)
+		return nil, err
+	}
+
+	page := &ProductPage{
+		Products:   products,
+		Page:       q.Page,
+		Limit:      q.Limit,
+		Total:      total,
+		TotalPages: (total + q.Limit - 1) / q.Limit,
+	}
+	return page, nil
+}
+
+// searchProductsService ranks products by how well their name, brand and description match q.Search,
+// keeping the ones that pass the other filters of the query, up to q.Limit results.
+func (s *ProductService) searchProductsService(q ProductQuery) ([]SearchResult, error) {
+	if strings.TrimSpace(q.Search) == "" {
+		return nil, ErrInvalidQuery.Withf("search query cannot be empty")
+	}
+
+	q, err := s.resolveCategory(q)
+	if err != nil {
+		return nil, err
+	}
+	var inCategory []int
+	if q.Category != 0 {
+		inCategory, err = s.Categories.ProductIDs(q.CategoryIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Index.NeedsRebuild() {
+		products, err := s.Repo.getAllProducts()
+		if err != nil {
+			log.Printf("Error building search index: %v", err)
+			return nil, err
+		}
+		s.Index.Build(products)
+	}
+
+	hits := s.Index.Search(q.Search)
+	results := make([]SearchResult, 0, q.Limit)
+	for start := 0; start < len(hits) && len(results) < q.Limit; start += searchBatchSize {
+		batch := hits[start:min(start+searchBatchSize, len(hits))]
+		ids := make([]int, len(batch))
+		for i, hit := range batch {
+			ids[i] = hit.ProductID
+		}
+
+		products, err := s.Repo.getProductsByIDs(ids)
+		if err != nil {
+			log.Printf("Error loading search results: %v", err)
+			return nil, err
+		}
+		byID := make(map[int]Product, len(products))
+		for _, product := range products {
+			byID[product.ProductID] = product
+		}
+
+		// keep the relevance order of the index; products deleted elsewhere are skipped
+		for _, hit := range batch {
+			product, ok := byID[hit.ProductID]
+			if !ok || !q.matches(product) {
+				continue
+			}
+			if q.Category != 0 && !slices.Contains(inCategory, product.ProductID) {
+				continue
+			}
+			results = append(results, SearchResult{Product: product, Score: hit.Score})
+			if len(results) == q.Limit {
+				break
+			}
+		}
+	}
+
+	return results, nil
+}
+
+func (s *ProductService) getProductService(productID int) (*Product, error) {
+	product, err := s.Repo.getProduct(productID)
+
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrProductNotFound
+	}
+
+	return product, nil
+}
+
+// addProductService stores a valid product and returns its new ID
+func (s *ProductService) addProductService(newProduct Product) (int, error) {
+	if fields := utils.Validate(newProduct); fields != nil {
+		return 0, response.Validation(fields)
+	}
+
+	productID, err := s.Repo.addProduct(newProduct)
+	if err != nil {
+		log.Print(err)
+		return 0, err
+	}
+	newProduct.ProductID = productID
+	s.Index.Upsert(newProduct)
+	return productID, nil
+}
+
+// updateProductService replaces a product. A non-zero Version must be the current version of the product.
+func (s *ProductService) updateProductService(updatedProduct Product) (*Product, error) {
+	if fields := utils.Validate(updatedProduct); fields != nil {
+		return nil, response.Validation(fields)
+	}
+
+	version, err := s.Repo.updateProduct(updatedProduct)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	updatedProduct.Version = version
+	s.Index.Upsert(updatedProduct)
+	return &updatedProduct, nil
+}
+
+// patchProductService applies a JSON Merge Patch to a product: only the fields present in the patch
+// are written, so e.g. the stock can be changed without knowing the description.
+// A non-zero version, or the version member of the patch, must be the current version of the product.
+func (s *ProductService) patchProductService(productID, version int, patch map[string]json.RawMessage) (*Product, error) {
+	product, err := s.getProductService(productID)
+	if err != nil {
+		return nil, err
+	}
+	current := product.Version
+	if version != 0 && version != current {
+		return nil, ErrVersionConflict
+	}
+
+	columns, fields := utils.ApplyMergePatch(product, patch)
+	if fields != nil {
+		return nil, response.Validation(fields)
+	}
+	if product.ProductID != productID {
+		return nil, errProductIDMismatch
+	}
+	// the ID and version members are only compared, the repository bumps the version
+	if product.Version != current {
+		return nil, ErrVersionConflict
+	}
+	columns = slices.DeleteFunc(columns, func(column string) bool { return column == PRODUCT_ID || column == VERSION })
+	if len(columns) == 0 {
+		return product, nil
+	}
+	if fields := utils.Validate(product); fields != nil {
+		return nil, response.Validation(fields)
+	}
+
+	_, err = s.Repo.updateProduct(*product, columns...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	// reload the product, fields outside the patch may have changed meanwhile
+	product, err = s.getProductService(productID)
+	if err != nil {
+		return nil, err
+	}
+	s.Index.Upsert(*product)
+	return product, nil
+}
+
+// getVariantsService returns the variants of an existing product, the default variant first
+func (s *ProductService) getVariantsService(productID int) ([]Variant, error) {
+	if _, err := s.getProductService(productID); err != nil {
+		return nil, err
+	}
+
+	variants, err := s.Repo.getVariants(productID)
+	if err != nil {
+		log.Printf("Error fetching variants of product %d: %v", productID, err)
+		return nil, err
+	}
+	return variants, nil
+}
+
+// getVariantService returns a variant of a product
+func (s *ProductService) getVariantService(productID, variantID int) (*Variant, error) {
+	variant, err := s.Repo.getVariant(variantID)
+	if err != nil {
+		return nil, err
+	}
+	if variant == nil || variant.ProductID != productID {
+		return nil, ErrVariantNotFound
+	}
+
+	return variant, nil
+}
+
+// addVariantService stores a valid variant of a product and returns its new ID.
+// Variants of a product must differ by their attributes.
+func (s *ProductService) addVariantService(productID int, newVariant Variant) (int, error) {
+	newVariant.ProductID = productID
+	if fields := validateVariant(newVariant); fields != nil {
+		return 0, response.Validation(fields)
+	}
+
+	variants, err := s.getVariantsService(productID)
+	if err != nil {
+		return 0, err
+	}
+	if sameAttributes(variants, newVariant) {
+		return 0, ErrVariantExists
+	}
+
+	variantID, err := s.Repo.addVariant(newVariant)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return variantID, nil
+}
+
+// updateVariantService replaces a variant, the stock of its product follows the change of its stock
+func (s *ProductService) updateVariantService(updatedVariant Variant) error {
+	if fields := validateVariant(updatedVariant); fields != nil {
+		return response.Validation(fields)
+	}
+
+	variants, err := s.getVariantsService(updatedVariant.ProductID)
+	if err != nil {
+		return err
+	}
+	if sameAttributes(variants, updatedVariant) {
+		return ErrVariantExists
+	}
+
+	err = s.Repo.updateVariant(updatedVariant)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// removeVariantService removes a variant other than the default one
+func (s *ProductService) removeVariantService(productID, variantID int) error {
+	err := s.Repo.removeVariant(productID, variantID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// getProductCategoriesService returns the categories of an existing product
+func (s *ProductService) getProductCategoriesService(productID int) ([]category.Category, error) {
+	if _, err := s.getProductService(productID); err != nil {
+		return nil, err
+	}
+	return s.Categories.ProductCategories(productID)
+}
+
+// setProductCategoriesService replaces the categories of an existing product
+func (s *ProductService) setProductCategoriesService(productID int, categoryIDs []int) ([]category.Category, error) {
+	if _, err := s.getProductService(productID); err != nil {
+		return nil, err
+	}
+	return s.Categories.SetProductCategories(productID, categoryIDs)
+}
+
+// removeProductService removes a product, then the files of its images
+func (s *ProductService) removeProductService(productID int) error {
+	images, err := s.Repo.getImages(productID)
+	if err != nil {
+		return err
+	}
+
+	err = s.Repo.removeProduct(productID)
+	if err != nil {
+		return err
+	}
+	s.Index.Remove(productID)
+	s.deleteImageFiles(images...)
+	return nil
+}
+
+// getImagesService returns the images of an existing product, oldest first
+func (s *ProductService) getImagesService(productID int) ([]Image, error) {
+	if _, err := s.getProductService(productID); err != nil {
+		return nil, err
+	}
+
+	images, err := s.Repo.getImages(productID)
+	if err != nil {
+		log.Printf("Error fetching images of product %d: %v", productID, err)
+		return nil, err
+	}
+	for i := range images {
+		images[i].withURLs()
+	}
+	return images, nil
+}
+
+// withImagesService joins products with their images, keeping the order of the products
+func (s *ProductService) withImagesService(products ...Product) ([]ProductDetail, error) {
+	productIDs := make([]int, len(products))
+	for i, product := range products {
+		productIDs[i] = product.ProductID
+	}
+	images, err := s.Repo.getImages(productIDs...)
+	if err != nil {
+		log.Printf("Error fetching product images: %v", err)
+		return nil, err
+	}
+
+	byProduct := make(map[int][]Image, len(products))
+	for _, image := range images {
+		image.withURLs()
+		byProduct[image.ProductID] = append(byProduct[image.ProductID], image)
+	}
+	details := make([]ProductDetail, len(products))
+	for i, product := range products {
+		details[i] = ProductDetail{Product: product, Images: byProduct[product.ProductID]}
+		if details[i].Images == nil {
+			details[i].Images = []Image{}
+		}
+	}
+	return details, nil
+}
+
+// addImageService checks an uploaded image of a product, stores it along with its thumbnail
+// in the blob store and adds it to the images of the product
+func (s *ProductService) addImageService(productID int, data []byte) (*Image, error) {
+	if int64(len(data)) > s.MaxImageSize {
+		return nil, ErrImageTooLarge.Withf("the image is too large: at most %d bytes", s.MaxImageSize)
+	}
+	images, err := s.getImagesService(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	image, thumb, err := newImage(productID, data)
+	if err != nil {
+		return nil, err
+	}
+	// the files of an image are named after its checksum, so a duplicate would share them
+	if slices.ContainsFunc(images, func(i Image) bool { return i.Checksum == image.Checksum }) {
+		return nil, ErrImageExists
+	}
+
+	if err := s.Blobs.Put(image.BlobKey, bytes.NewReader(data)); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if err := s.Blobs.Put(image.ThumbnailKey, bytes.NewReader(thumb)); err != nil {
+		log.Println(err)
+		s.deleteImageFiles(*image)
+		return nil, err
+	}
+
+	image.ID, err = s.Repo.addImage(*image)
+	if err == ErrImageExists {
+		// added meanwhile by another upload, which owns the files now
+		return nil, err
+	} else if err != nil {
+		log.Println(err)
+		s.deleteImageFiles(*image)
+		return nil, err
+	}
+
+	// reload the image for the time it was stored at
+	return s.getImageService(productID, image.ID)
+}
+
+// getImageService returns an image of a product
+func (s *ProductService) getImageService(productID, imageID int) (*Image, error) {
+	image, err := s.Repo.getImage(imageID)
+	if err != nil {
+		return nil, err
+	}
+	if image == nil || image.ProductID != productID {
+		return nil, ErrImageNotFound
+	}
+
+	image.withURLs()
+	return image, nil
+}
+
+// openImageService returns an image of a product along with its file, or the file of its thumbnail.
+// The caller must close the file.
+func (s *ProductService) openImageService(productID, imageID int, thumb bool) (*Image, io.ReadSeekCloser, error) {
+	image, err := s.getImageService(productID, imageID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := image.BlobKey
+	if thumb {
+		key = image.ThumbnailKey
+	}
+	file, err := s.Blobs.Open(key)
+	if err == blob.ErrNotFound {
+		log.Printf("File %s of image %d is missing", key, imageID)
+		return nil, nil, ErrImageNotFound
+	} else if err != nil {
+		log.Println(err)
+		return nil, nil, err
+	}
+	return image, file, nil
+}
+
+// removeImageService removes an image of a product, then its files
+func (s *ProductService) removeImageService(productID, imageID int) error {
+	image, err := s.getImageService(productID, imageID)
+	if err != nil {
+		return err
+	}
+
+	err = s.Repo.removeImage(productID, imageID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	s.deleteImageFiles(*image)
+	return nil
+}
+
+// ImportProductsService creates or updates the products of a CSV or NDJSON file in a single transaction.
+// Only the columns present in a row are written. Every row is checked before anything is written: when
+// one is invalid, or for a dry run, nothing is imported and the report tells what would have happened.
+func (s *ProductService) ImportProductsService(r io.Reader, format string, dryRun bool) (*ImportReport, error) {
+	rows, err := decodeImport(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{DryRun: dryRun, Rows: make([]ImportResult, 0, len(rows))}
+	var written []Product
+	err = s.Repo.withTransaction(func(repo ProductRepository) error {
+		plans, err := planImport(repo, rows, report)
+		if err != nil || report.Failed > 0 || dryRun {
+			return err
+		}
+
+		// nothing failed, so there is a plan for every row of the report
+		for i, plan := range plans {
+			if plan.create {
+				plan.product.ProductID, err = repo.addProduct(plan.product)
+				report.Rows[i].ProductID = plan.product.ProductID
+			} else if len(plan.columns) > 0 {
+				_, err = repo.updateProduct(plan.product, plan.columns...)
+			}
+			if err != nil {
+				appErr := response.From(err)
+				return appErr.Withf("line %d: %s", plan.line, appErr.Message)
+			}
+			written = append(written, plan.product)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error importing products: %v", err)
+		return nil, err
+	}
+	if report.Failed > 0 {
+		return report, ErrImportFailed.WithDetails(report)
+	}
+
+	for _, product := range written {
+		s.Index.Upsert(product)
+	}
+	return report, nil
+}
+
+// ExportProductsService writes the whole catalog in a CSV or NDJSON file, ordered by productId.
+// Products are read and written a page at a time, so the catalog is never held in memory.
+func (s *ProductService) ExportProductsService(w io.Writer, format string) error {
+	write, flush, err := newProductWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	q := ProductQuery{Page: 1, Limit: MaxPageLimit}
+	for {
+		products, _, err := s.Repo.getProducts(q)
+		if err != nil {
+			log.Printf("Error exporting products: %v", err)
+			return err
+		}
+		for _, product := range products {
+			if err := write(product); err != nil {
+				return err
+			}
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+
+		if len(products) < q.Limit {
+			return nil
+		}
+		q.Page++
+	}
+}
+
+// helper functions
+
+// deleteImageFiles deletes the files of images from the blob store. Failures are only logged,
+// a file left behind takes space but is never served.
+func (s *ProductService) deleteImageFiles(images ...Image) {
+	for _, image := range images {
+		for _, key := range []string{image.BlobKey, image.ThumbnailKey} {
+			if err := s.Blobs.Delete(key); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// resolveCategory fills in the subcategories of the category filter of a query
+func (s *ProductService) resolveCategory(q ProductQuery) (ProductQuery, error) {
+	if q.Category == 0 {
+		return q, nil
+	}
+
+	categoryIDs, err := s.Categories.Subtree(q.Category)
+	if err != nil {
+		return q, err
+	}
+	q.CategoryIDs = categoryIDs
+	return q, nil
+}
@@ -0,0 +1,98 @@
+package product
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/core/blob"
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/services/category"
+)
+
+// newProductService returns a product service over the memory repositories
+func newProductService(t *testing.T) *ProductService {
+	t.Helper()
+	mem := memory.New()
+	categories := category.NewCategoryService(category.NewMemoryCategoryRepository(mem))
+	return NewProductService(NewMemoryProductRepository(mem), categories, &blob.LocalStore{Dir: t.TempDir()}, 1<<20)
+}
+
+func TestProductServiceCRUD(t *testing.T) {
+	s := newProductService(t)
+
+	productID, err := s.addProductService(Product{SKU: "MUG-1", PricePerUnit: 12.5, ProductName: "Mug", ProductBrand: "Acme", StockQuantity: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	product, err := s.getProductService(productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.ProductName != "Mug" || product.StockQuantity != 3 || product.Version != 1 {
+		t.Fatalf("added product = %+v", product)
+	}
+	variants, err := s.getVariantsService(productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variants) != 1 || !variants[0].IsDefault || variants[0].StockQuantity != 3 {
+		t.Fatalf("variants = %+v, want a default variant holding the stock", variants)
+	}
+
+	product.ProductName = "Big Mug"
+	product.PricePerUnit = 15
+	updated, err := s.updateProductService(*product)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("version after update = %d, want 2", updated.Version)
+	}
+
+	// an update based on the first version is stale now
+	product.Version = 1
+	if _, err := s.updateProductService(*product); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale update: err = %v, want %v", err, ErrVersionConflict)
+	}
+
+	patched, err := s.patchProductService(productID, 0, map[string]json.RawMessage{"description": json.RawMessage(`"Holds a lot of coffee"`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.Description != "Holds a lot of coffee" || patched.ProductName != "Big Mug" || patched.PricePerUnit != 15 {
+		t.Errorf("patched product = %+v", patched)
+	}
+
+	if err := s.removeProductService(productID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.getProductService(productID); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("removed product: err = %v, want %v", err, ErrProductNotFound)
+	}
+}
+
+func TestProductServiceValidation(t *testing.T) {
+	s := newProductService(t)
+
+	_, err := s.addProductService(Product{PricePerUnit: 0, ProductBrand: "Acme", StockQuantity: -1})
+	apiErr := response.From(err)
+	if apiErr.Status != http.StatusUnprocessableEntity {
+		t.Fatalf("err = %v, want a validation error", err)
+	}
+	for _, field := range []string{"productName", "pricePerUnit", "stockQuantity"} {
+		if apiErr.Fields[field] == "" {
+			t.Errorf("no validation error on %s: %v", field, apiErr.Fields)
+		}
+	}
+
+	if _, err := s.addProductService(Product{SKU: "MUG-1", PricePerUnit: 1, ProductName: "Mug", ProductBrand: "Acme"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.addProductService(Product{SKU: "MUG-1", PricePerUnit: 1, ProductName: "Other Mug", ProductBrand: "Acme"}); !errors.Is(err, ErrSKUTaken) {
+		t.Errorf("duplicate SKU: err = %v, want %v", err, ErrSKUTaken)
+	}
+}
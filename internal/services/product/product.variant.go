@@ -0,0 +1,132 @@
+package product
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/utils"
+)
+
+// maxAttributeLength is the longest attribute name or value of a variant
+const maxAttributeLength = 50
+
+var (
+	ErrVariantNotFound = response.New(http.StatusNotFound, "variant_not_found", "no variant found")
+	ErrDefaultVariant  = response.New(http.StatusConflict, "default_variant", "a product must keep a default variant, make another variant the default first")
+	ErrStockByVariant  = response.New(http.StatusConflict, "stock_by_variant", "this product has several variants, change the stock of each variant instead")
+	ErrVariantExists   = response.New(http.StatusConflict, "variant_exists", "the product already has a variant with these attributes")
+)
+
+// Variant is a version of a product that can be sold on its own, e.g. a size and color of a shirt,
+// with its own SKU and stock. Every product has exactly one default variant, the one sold when no
+// variant is chosen. Product.StockQuantity is the total stock of the variants of the product, and a
+// variant without a price override sells at the price of its product.
+type Variant struct {
+	ID            int        `json:"id"`
+	ProductID     int        `json:"productId"`
+	SKU           string     `json:"sku" validate:"max=64"`
+	Attributes    Attributes `json:"attributes"`
+	PriceOverride *float64   `json:"priceOverride"`
+	StockQuantity int        `json:"stockQuantity" validate:"min=0"`
+	IsDefault     bool       `json:"isDefault"`
+}
+
+// Attributes are what tells the variants of a product apart, e.g. {"size": "M", "color": "red"}.
+// They are stored as a JSON object.
+type Attributes map[string]string
+
+// Price is the price of the variant, that of its product unless it has a price override
+func (v Variant) Price(product Product) float64 {
+	if v.PriceOverride != nil {
+		return *v.PriceOverride
+	}
+	return product.PricePerUnit
+}
+
+// String describes the attributes in name order, e.g. "color: red, size: M"
+func (a Attributes) String() string {
+	parts := make([]string, 0, len(a))
+	for _, name := range slices.Sorted(maps.Keys(a)) {
+		parts = append(parts, fmt.Sprintf("%s: %s", name, a[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Equal reports whether both attributes have the same names and values
+func (a Attributes) Equal(other Attributes) bool {
+	return maps.Equal(a, other)
+}
+
+// Value stores the attributes as a JSON object
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return "{}", nil
+	}
+	encoded, err := json.Marshal(map[string]string(a))
+	return string(encoded), err
+}
+
+// Scan reads attributes stored as a JSON object
+func (a *Attributes) Scan(src interface{}) error {
+	var raw []byte
+	switch src := src.(type) {
+	case []byte:
+		raw = src
+	case string:
+		raw = []byte(src)
+	case nil:
+		*a = Attributes{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Attributes", src)
+	}
+
+	attributes := Attributes{}
+	if err := json.Unmarshal(raw, &attributes); err != nil {
+		return err
+	}
+	*a = attributes
+	return nil
+}
+
+// validateVariant checks a variant against the validate tags and the rules they can't express:
+// a price override must be positive, attribute names and values can't be blank or too long, and
+// only the default variant can do without attributes
+func validateVariant(variant Variant) map[string]string {
+	fields := utils.Validate(variant)
+	if fields == nil {
+		fields = map[string]string{}
+	}
+
+	if variant.PriceOverride != nil && *variant.PriceOverride <= 0 {
+		fields["priceOverride"] = "must be greater than 0"
+	}
+	for name, value := range variant.Attributes {
+		if strings.TrimSpace(name) == "" || strings.TrimSpace(value) == "" {
+			fields["attributes"] = "names and values can't be blank"
+		} else if len(name) > maxAttributeLength || len(value) > maxAttributeLength {
+			fields["attributes"] = fmt.Sprintf("names and values must be at most %d characters long", maxAttributeLength)
+		}
+	}
+	if len(variant.Attributes) == 0 && !variant.IsDefault {
+		fields["attributes"] = "is required"
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// sameAttributes reports whether another variant of the list has the attributes of variant
+func sameAttributes(variants []Variant, variant Variant) bool {
+	return slices.ContainsFunc(variants, func(v Variant) bool {
+		return v.ID != variant.ID && v.Attributes.Equal(variant.Attributes)
+	})
+}
@@ -0,0 +1,151 @@
+package promotion
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/ecommerce/internal/core/middleware"
+	"github.com/ecommerce/internal/core/response"
+	"github.com/gorilla/mux"
+)
+
+const (
+	promotionsBasePath = "promotions"
+	apiBasePath        = "api"
+)
+
+var (
+	errPromotionIDSet      = response.BadRequest("id must not be set when adding a promotion")
+	errPromotionIDMismatch = response.BadRequest("id of the payload doesn't match the URL")
+)
+
+// SetupRoutes :
+func SetupPromotionRoutes(r *mux.Router, s *PromotionService) {
+	apiUrlPath := fmt.Sprintf("/%s/%s", apiBasePath, promotionsBasePath)
+	promotionRouter := r.PathPrefix(apiUrlPath).Subrouter()
+
+	// only admins manage promotions, customers redeem them through the coupon of their cart
+	promotionRouter.HandleFunc("", middleware.RequireRole(middleware.RoleAdmin, promotionsHandler(s)))
+	promotionRouter.HandleFunc("/{id}", middleware.RequireRole(middleware.RoleAdmin, promotionHandler(s)))
+}
+
+func promotionsHandler(s *PromotionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			promotions, err := s.getPromotionsService()
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, promotions)
+			return
+		case http.MethodPost:
+			var newPromotion Promotion
+			err := json.NewDecoder(r.Body).Decode(&newPromotion)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if newPromotion.ID != 0 {
+				log.Println(errPromotionIDSet)
+				response.WriteError(w, errPromotionIDSet)
+				return
+			}
+
+			newPromotion.ID, err = s.addPromotionService(newPromotion)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			created, err := s.getPromotionService(newPromotion.ID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			response.JSON(w, http.StatusCreated, created)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func promotionHandler(s *PromotionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		promotionID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, ErrPromotionNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			promotion, err := s.getPromotionService(promotionID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, promotion)
+			return
+		case http.MethodPut:
+			var updatedPromotion Promotion
+			err := json.NewDecoder(r.Body).Decode(&updatedPromotion)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if updatedPromotion.ID != promotionID {
+				log.Println(errPromotionIDMismatch)
+				response.WriteError(w, errPromotionIDMismatch)
+				return
+			}
+
+			err = s.updatePromotionService(updatedPromotion)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			updated, err := s.getPromotionService(promotionID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			response.JSON(w, http.StatusOK, updated)
+			return
+		case http.MethodDelete:
+			err := s.removePromotionService(promotionID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package promotion
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ecommerce/utils"
+)
+
+// Kind is the reward a promotion gives
+type Kind string
+
+const (
+	KindPercentOff Kind = "percent_off" // Value percent off the eligible items
+	KindFixedOff   Kind = "fixed_off"   // Value off the eligible items, never more than they cost
+	KindBuyXGetY   Kind = "buy_x_get_y" // for every BuyQuantity eligible units, GetQuantity more get Value percent off
+)
+
+// Promotion is a coupon code along with the discount it gives and the conditions it applies under.
+// Only the items of CategoryID and its subcategories are eligible when it is set, every item otherwise,
+// and the eligible items must cost at least MinSpend. A MaxUses or MaxUsesPerUser of 0 means no limit.
+// Codes are stored in upper case and matched regardless of case.
+type Promotion struct {
+	ID             int        `json:"id"`
+	Code           string     `json:"code" validate:"required,max=32"`
+	Description    string     `json:"description" validate:"max=255"`
+	Kind           Kind       `json:"kind" validate:"required"`
+	Value          float64    `json:"value" validate:"gt=0"`
+	BuyQuantity    int        `json:"buy_quantity" validate:"min=0"`
+	GetQuantity    int        `json:"get_quantity" validate:"min=0"`
+	MinSpend       float64    `json:"min_spend" validate:"min=0"`
+	CategoryID     int        `json:"category_id" validate:"min=0"`
+	MaxUses        int        `json:"max_uses" validate:"min=0"`
+	MaxUsesPerUser int        `json:"max_uses_per_user" validate:"min=0"`
+	StartsAt       *time.Time `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+	Active         bool       `json:"active"`
+	Uses           int        `json:"uses"` // orders placed with the promotion, kept by checkout
+}
+
+// Redemption records the discount a promotion gave to an order
+type Redemption struct {
+	ID          int       `json:"id"`
+	PromotionID int       `json:"promotion_id"`
+	UserID      int       `json:"user_id"`
+	OrderID     int       `json:"order_id"`
+	Amount      float64   `json:"amount"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Line is a priced cart line a promotion is evaluated against
+type Line struct {
+	ProductID int
+	Quantity  int
+	UnitPrice float64
+}
+
+// Discount is what a promotion takes off a cart
+type Discount struct {
+	PromotionID int     `json:"promotion_id"`
+	Code        string  `json:"code"`
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+}
+
+// Offer is a promotion a user may redeem, along with the products it applies to.
+// Checkout evaluates it against the lines it prices and redeems it in the same transaction.
+type Offer struct {
+	Promotion Promotion
+	// ProductIDs are the eligible products of a per-category promotion, nil when every product is eligible
+	ProductIDs map[int]bool
+}
+
+// NormalizeCode returns a coupon code the way it is stored
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// IsValid reports whether k is one of the known promotion kinds
+func (k Kind) IsValid() bool {
+	switch k {
+	case KindPercentOff, KindFixedOff, KindBuyXGetY:
+		return true
+	}
+	return false
+}
+
+// Running reports whether the promotion is active and within its time window at the given time
+func (p Promotion) Running(now time.Time) bool {
+	if !p.Active {
+		return false
+	}
+	if p.StartsAt != nil && now.Before(*p.StartsAt) {
+		return false
+	}
+	if p.EndsAt != nil && !now.Before(*p.EndsAt) {
+		return false
+	}
+	return true
+}
+
+// Exhausted reports whether the promotion reached its overall usage limit
+func (p Promotion) Exhausted() bool {
+	return p.MaxUses > 0 && p.Uses >= p.MaxUses
+}
+
+// Discount evaluates the offer against the lines of a cart. It fails with ErrNotApplicable when no line
+// is eligible and with ErrMinSpendNotMet when the eligible lines cost less than the minimum spend.
+func (o *Offer) Discount(lines []Line) (*Discount, error) {
+	p := o.Promotion
+
+	var eligible []Line
+	var eligibleTotal float64
+	for _, line := range lines {
+		if o.ProductIDs != nil && !o.ProductIDs[line.ProductID] {
+			continue
+		}
+		eligible = append(eligible, line)
+		eligibleTotal += line.UnitPrice * float64(line.Quantity)
+	}
+	if len(eligible) == 0 {
+		return nil, ErrNotApplicable
+	}
+	if eligibleTotal < p.MinSpend {
+		return nil, ErrMinSpendNotMet.Withf("the coupon needs a minimum spend of %.2f on eligible items, the cart has %.2f", p.MinSpend, utils.RoundAmount(eligibleTotal))
+	}
+
+	var amount float64
+	switch p.Kind {
+	case KindPercentOff:
+		amount = eligibleTotal * p.Value / 100
+	case KindFixedOff:
+		amount = p.Value
+	case KindBuyXGetY:
+		amount = buyXGetY(eligible, p.BuyQuantity, p.GetQuantity, p.Value)
+	}
+	amount = utils.RoundAmount(math.Min(amount, eligibleTotal))
+	if amount <= 0 {
+		return nil, ErrNotApplicable
+	}
+
+	return &Discount{PromotionID: p.ID, Code: p.Code, Description: p.Description, Amount: amount}, nil
+}
+
+// helper functions
+
+// buyXGetY groups the eligible units from the most to the least expensive, in every full group of
+// buy+get units the get cheapest ones are discounted by percent
+func buyXGetY(lines []Line, buy, get int, percent float64) float64 {
+	var prices []float64
+	for _, line := range lines {
+		for i := 0; i < line.Quantity; i++ {
+			prices = append(prices, line.UnitPrice)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(prices)))
+
+	var amount float64
+	group := buy + get
+	for start := 0; start+group <= len(prices); start += group {
+		for _, price := range prices[start+buy : start+group] {
+			amount += price * percent / 100
+		}
+	}
+	return amount
+}
@@ -0,0 +1,126 @@
+package promotion
+
+import (
+	"github.com/ecommerce/database/memory"
+)
+
+// MemoryPromotionRepository is a PromotionRepository keeping promotions in a memory.DB
+type MemoryPromotionRepository struct {
+	mem *memory.DB
+}
+
+func NewMemoryPromotionRepository(mem *memory.DB) *MemoryPromotionRepository {
+	return &MemoryPromotionRepository{mem: mem}
+}
+
+// getPromotions returns every promotion, the newest first
+func (repo *MemoryPromotionRepository) getPromotions() ([]Promotion, error) {
+	promotions := make([]Promotion, 0)
+	err := repo.mem.View(func() error {
+		rows := PromotionsOf(repo.mem).Rows()
+		for i := len(rows) - 1; i >= 0; i-- {
+			promotions = append(promotions, rows[i])
+		}
+		return nil
+	})
+	return promotions, err
+}
+
+func (repo *MemoryPromotionRepository) getPromotion(promotionID int) (*Promotion, error) {
+	var promotion *Promotion
+	err := repo.mem.View(func() error {
+		if found, ok := PromotionsOf(repo.mem).Get(promotionID); ok {
+			promotion = &found
+		}
+		return nil
+	})
+	return promotion, err
+}
+
+func (repo *MemoryPromotionRepository) getPromotionByCode(code string) (*Promotion, error) {
+	var promotion *Promotion
+	err := repo.mem.View(func() error {
+		if found, ok := PromotionsOf(repo.mem).First(func(p Promotion) bool { return p.Code == code }); ok {
+			promotion = &found
+		}
+		return nil
+	})
+	return promotion, err
+}
+
+func (repo *MemoryPromotionRepository) addPromotion(promotion Promotion) (int, error) {
+	err := repo.mem.Update(func() error {
+		if repo.codeTaken(promotion) {
+			return ErrCodeTaken
+		}
+		promotion.ID = PromotionsOf(repo.mem).NextID()
+		promotion.Uses = 0
+		PromotionsOf(repo.mem).Put(promotion.ID, promotion)
+		return nil
+	})
+	return promotion.ID, err
+}
+
+// updatePromotion changes everything but the number of uses, which only checkout changes
+func (repo *MemoryPromotionRepository) updatePromotion(promotion Promotion) error {
+	return repo.mem.Update(func() error {
+		existing, ok := PromotionsOf(repo.mem).Get(promotion.ID)
+		if !ok {
+			return ErrPromotionNotFound
+		}
+		if repo.codeTaken(promotion) {
+			return ErrCodeTaken
+		}
+		promotion.Uses = existing.Uses
+		PromotionsOf(repo.mem).Put(promotion.ID, promotion)
+		return nil
+	})
+}
+
+func (repo *MemoryPromotionRepository) removePromotion(promotionID int) error {
+	return repo.mem.Update(func() error {
+		if _, redeemed := RedemptionsOf(repo.mem).First(func(r Redemption) bool { return r.PromotionID == promotionID }); redeemed {
+			return ErrPromotionRedeemed
+		}
+		if !PromotionsOf(repo.mem).Delete(promotionID) {
+			return ErrPromotionNotFound
+		}
+		return nil
+	})
+}
+
+// countRedemptions returns how many orders of the user redeemed the promotion
+func (repo *MemoryPromotionRepository) countRedemptions(promotionID, userID int) (int, error) {
+	var count int
+	err := repo.mem.View(func() error {
+		count = CountRedemptionsOf(repo.mem, promotionID, userID)
+		return nil
+	})
+	return count, err
+}
+
+// codeTaken reports whether another promotion already has the code of promotion, the promotions table has a unique key on it
+func (repo *MemoryPromotionRepository) codeTaken(promotion Promotion) bool {
+	_, taken := PromotionsOf(repo.mem).First(func(p Promotion) bool {
+		return p.Code == promotion.Code && p.ID != promotion.ID
+	})
+	return taken
+}
+
+// functions for memory repositories outside promotion pkg
+
+// PromotionsOf returns the promotions table of an in-memory database
+func PromotionsOf(mem *memory.DB) *memory.Table[Promotion] {
+	return memory.TableOf[Promotion](mem, TABLE_NAME)
+}
+
+// RedemptionsOf returns the promotion redemptions table of an in-memory database
+func RedemptionsOf(mem *memory.DB) *memory.Table[Redemption] {
+	return memory.TableOf[Redemption](mem, REDEMPTIONS_TABLE)
+}
+
+// CountRedemptionsOf returns how many orders of the user redeemed the promotion.
+// The caller must hold a lock of the database.
+func CountRedemptionsOf(mem *memory.DB, promotionID, userID int) int {
+	return len(RedemptionsOf(mem).Filter(func(r Redemption) bool { return r.PromotionID == promotionID && r.UserID == userID }))
+}
@@ -0,0 +1,211 @@
+package promotion
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/utils"
+)
+
+const (
+	TABLE_NAME        = "promotions"
+	REDEMPTIONS_TABLE = "promotion_redemptions"
+)
+
+// promotionColumns are the columns scanned by scanPromotion
+const promotionColumns = `id, code, description, kind, value, buy_quantity, get_quantity, min_spend, COALESCE(category_id, 0),
+	max_uses, max_uses_per_user, starts_at, ends_at, active, uses`
+
+var (
+	ErrPromotionNotFound = response.New(http.StatusNotFound, "promotion_not_found", "no promotion found")
+	ErrCodeTaken         = response.New(http.StatusConflict, "code_taken", "another promotion already uses this code")
+	ErrPromotionRedeemed = response.New(http.StatusConflict, "promotion_redeemed", "the promotion was already redeemed, deactivate it instead")
+
+	ErrCouponNotFound  = response.New(http.StatusNotFound, "coupon_not_found", "no such coupon")
+	ErrCouponInactive  = response.New(http.StatusBadRequest, "coupon_inactive", "the coupon is not active")
+	ErrCouponExhausted = response.New(http.StatusConflict, "coupon_exhausted", "the coupon reached its usage limit")
+	ErrCouponUserLimit = response.New(http.StatusConflict, "coupon_user_limit", "you already used this coupon as many times as allowed")
+	ErrNotApplicable   = response.New(http.StatusBadRequest, "coupon_not_applicable", "the coupon doesn't apply to any item in the cart")
+	ErrMinSpendNotMet  = response.New(http.StatusBadRequest, "min_spend_not_met", "the cart doesn't reach the minimum spend of the coupon")
+)
+
+// PromotionRepository stores promotions and their redemptions. MySQLPromotionRepository is the
+// production implementation, MemoryPromotionRepository keeps everything in process for demos and tests.
+// Redemptions are written by checkout, in the transaction that places the order.
+type PromotionRepository interface {
+	getPromotions() ([]Promotion, error)
+	getPromotion(promotionID int) (*Promotion, error)
+	getPromotionByCode(code string) (*Promotion, error)
+	addPromotion(promotion Promotion) (int, error)
+	updatePromotion(promotion Promotion) error
+	removePromotion(promotionID int) error
+	countRedemptions(promotionID, userID int) (int, error)
+}
+
+type MySQLPromotionRepository struct {
+	db *sql.DB
+}
+
+func NewMySQLPromotionRepository(db *sql.DB) *MySQLPromotionRepository {
+	return &MySQLPromotionRepository{db: db}
+}
+
+// getPromotions returns every promotion, the newest first
+func (repo *MySQLPromotionRepository) getPromotions() ([]Promotion, error) {
+	rows, err := repo.db.Query(`SELECT ` + promotionColumns + ` FROM promotions ORDER BY id DESC`)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	promotions := make([]Promotion, 0)
+	for rows.Next() {
+		var promotion Promotion
+		if err := scanPromotion(rows, &promotion); err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, promotion)
+	}
+	return promotions, rows.Err()
+}
+
+func (repo *MySQLPromotionRepository) getPromotion(promotionID int) (*Promotion, error) {
+	promotion := &Promotion{}
+	err := scanPromotion(repo.db.QueryRow(`SELECT `+promotionColumns+` FROM promotions WHERE id = ?`, promotionID), promotion)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return promotion, nil
+}
+
+func (repo *MySQLPromotionRepository) getPromotionByCode(code string) (*Promotion, error) {
+	promotion := &Promotion{}
+	err := scanPromotion(repo.db.QueryRow(`SELECT `+promotionColumns+` FROM promotions WHERE code = ?`, code), promotion)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return promotion, nil
+}
+
+func (repo *MySQLPromotionRepository) addPromotion(promotion Promotion) (int, error) {
+	result, err := repo.db.Exec(`
+		INSERT INTO promotions (code, description, kind, value, buy_quantity, get_quantity, min_spend, category_id,
+			max_uses, max_uses_per_user, starts_at, ends_at, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), ?, ?, ?, ?, ?)`,
+		promotion.Code, promotion.Description, promotion.Kind, promotion.Value, promotion.BuyQuantity, promotion.GetQuantity,
+		promotion.MinSpend, promotion.CategoryID, promotion.MaxUses, promotion.MaxUsesPerUser, promotion.StartsAt, promotion.EndsAt,
+		promotion.Active)
+	if utils.IsDuplicateEntry(err) {
+		return 0, ErrCodeTaken
+	} else if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	insertID, err := result.LastInsertId()
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	return int(insertID), nil
+}
+
+// updatePromotion changes everything but the number of uses, which only checkout changes
+func (repo *MySQLPromotionRepository) updatePromotion(promotion Promotion) error {
+	result, err := repo.db.Exec(`
+		UPDATE promotions SET code = ?, description = ?, kind = ?, value = ?, buy_quantity = ?, get_quantity = ?,
+			min_spend = ?, category_id = NULLIF(?, 0), max_uses = ?, max_uses_per_user = ?, starts_at = ?, ends_at = ?, active = ?
+		WHERE id = ?`,
+		promotion.Code, promotion.Description, promotion.Kind, promotion.Value, promotion.BuyQuantity, promotion.GetQuantity,
+		promotion.MinSpend, promotion.CategoryID, promotion.MaxUses, promotion.MaxUsesPerUser, promotion.StartsAt, promotion.EndsAt,
+		promotion.Active, promotion.ID)
+	if utils.IsDuplicateEntry(err) {
+		return ErrCodeTaken
+	} else if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	// MySQL reports 0 affected rows for an update that changes nothing, so check the promotion exists
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		existing, err := repo.getPromotion(promotion.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return ErrPromotionNotFound
+		}
+	}
+	return nil
+}
+
+// removePromotion deletes a promotion that was never redeemed, the foreign key of the redemptions
+// refuses to delete any other
+func (repo *MySQLPromotionRepository) removePromotion(promotionID int) error {
+	result, err := repo.db.Exec(`DELETE FROM promotions WHERE id = ?`, promotionID)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrPromotionNotFound
+	}
+	return nil
+}
+
+// countRedemptions returns how many orders of the user redeemed the promotion
+func (repo *MySQLPromotionRepository) countRedemptions(promotionID, userID int) (int, error) {
+	var count int
+	err := repo.db.QueryRow(`SELECT COUNT(*) FROM promotion_redemptions WHERE promotion_id = ? AND user_id = ?`,
+		promotionID, userID).Scan(&count)
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	return count, nil
+}
+
+// helper functions
+
+// scanPromotion scans a row of the promotionColumns into promotion
+func scanPromotion(row utils.RowScanner, promotion *Promotion) error {
+	var startsAt, endsAt sql.NullTime
+	err := row.Scan(
+		&promotion.ID,
+		&promotion.Code,
+		&promotion.Description,
+		&promotion.Kind,
+		&promotion.Value,
+		&promotion.BuyQuantity,
+		&promotion.GetQuantity,
+		&promotion.MinSpend,
+		&promotion.CategoryID,
+		&promotion.MaxUses,
+		&promotion.MaxUsesPerUser,
+		&startsAt,
+		&endsAt,
+		&promotion.Active,
+		&promotion.Uses)
+	if err != nil {
+		return err
+	}
+	promotion.StartsAt = timeOrNil(startsAt)
+	promotion.EndsAt = timeOrNil(endsAt)
+	return nil
+}
+
+// timeOrNil returns the time of a nullable column, nil for NULL
+func timeOrNil(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,191 @@
+package promotion
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/services/category"
+	"github.com/ecommerce/utils"
+)
+
+// PromotionService handles business logic for promotion-related operations.
+type PromotionService struct {
+	Repo       PromotionRepository
+	Categories *category.CategoryService
+}
+
+// NewPromotionService creates a new PromotionService, categories resolve the products of per-category promotions.
+func NewPromotionService(repo PromotionRepository, categories *category.CategoryService) *PromotionService {
+	return &PromotionService{
+		Repo:       repo,
+		Categories: categories,
+	}
+}
+
+func (s *PromotionService) getPromotionsService() ([]Promotion, error) {
+	promotions, err := s.Repo.getPromotions()
+	if err != nil {
+		log.Printf("Error fetching promotions: %v", err)
+		return nil, err
+	}
+
+	return promotions, nil
+}
+
+func (s *PromotionService) getPromotionService(promotionID int) (*Promotion, error) {
+	promotion, err := s.Repo.getPromotion(promotionID)
+	if err != nil {
+		return nil, err
+	}
+	if promotion == nil {
+		return nil, ErrPromotionNotFound
+	}
+
+	return promotion, nil
+}
+
+// addPromotionService stores a valid promotion and returns its new ID
+func (s *PromotionService) addPromotionService(newPromotion Promotion) (int, error) {
+	if err := s.validate(&newPromotion); err != nil {
+		return 0, err
+	}
+
+	promotionID, err := s.Repo.addPromotion(newPromotion)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return promotionID, nil
+}
+
+// updatePromotionService replaces a promotion, its number of uses is kept
+func (s *PromotionService) updatePromotionService(updatedPromotion Promotion) error {
+	if err := s.validate(&updatedPromotion); err != nil {
+		return err
+	}
+
+	err := s.Repo.updatePromotion(updatedPromotion)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// removePromotionService deletes a promotion that was never redeemed, orders keep the code they were placed with
+func (s *PromotionService) removePromotionService(promotionID int) error {
+	promotion, err := s.getPromotionService(promotionID)
+	if err != nil {
+		return err
+	}
+	if promotion.Uses > 0 {
+		return ErrPromotionRedeemed
+	}
+
+	return s.Repo.removePromotion(promotionID)
+}
+
+// Offer returns the promotion of a coupon code if the user may redeem it now, along with the products it
+// applies to. The usage limits are checked again when the order is placed, since other orders may
+// redeem the promotion in the meantime.
+func (s *PromotionService) Offer(code string, userID int) (*Offer, error) {
+	code = NormalizeCode(code)
+	promotion, err := s.Repo.getPromotionByCode(code)
+	if err != nil {
+		return nil, err
+	}
+	if promotion == nil {
+		return nil, ErrCouponNotFound.Withf("no coupon %q", code)
+	}
+	if !promotion.Running(time.Now()) {
+		return nil, ErrCouponInactive
+	}
+	if promotion.Exhausted() {
+		return nil, ErrCouponExhausted
+	}
+	if promotion.MaxUsesPerUser > 0 {
+		used, err := s.Repo.countRedemptions(promotion.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if used >= promotion.MaxUsesPerUser {
+			return nil, ErrCouponUserLimit
+		}
+	}
+
+	offer := &Offer{Promotion: *promotion}
+	if promotion.CategoryID != 0 {
+		// a promotion whose category was removed applies to no product
+		categoryIDs, err := s.Categories.Subtree(promotion.CategoryID)
+		if errors.Is(err, category.ErrCategoryNotFound) {
+			return nil, ErrNotApplicable
+		} else if err != nil {
+			return nil, err
+		}
+		productIDs, err := s.Categories.ProductIDs(categoryIDs)
+		if err != nil {
+			return nil, err
+		}
+		offer.ProductIDs = make(map[int]bool, len(productIDs))
+		for _, productID := range productIDs {
+			offer.ProductIDs[productID] = true
+		}
+	}
+	return offer, nil
+}
+
+// Preview returns the discount a coupon code would give the user on the given cart lines
+func (s *PromotionService) Preview(code string, userID int, lines []Line) (*Discount, error) {
+	offer, err := s.Offer(code, userID)
+	if err != nil {
+		return nil, err
+	}
+	return offer.Discount(lines)
+}
+
+// helper functions
+
+// validate normalizes the code of a promotion, then checks the promotion is consistent
+func (s *PromotionService) validate(promotion *Promotion) error {
+	promotion.Code = NormalizeCode(promotion.Code)
+
+	fields := utils.Validate(promotion)
+	if fields == nil {
+		fields = make(map[string]string)
+	}
+	if strings.IndexFunc(promotion.Code, func(r rune) bool {
+		return !('A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == '_')
+	}) >= 0 {
+		fields["code"] = "must only contain letters, digits, dashes and underscores"
+	}
+	if _, ok := fields["kind"]; !ok && !promotion.Kind.IsValid() {
+		fields["kind"] = "must be percent_off, fixed_off or buy_x_get_y"
+	}
+	if _, ok := fields["value"]; !ok && promotion.Kind != KindFixedOff && promotion.Value > 100 {
+		fields["value"] = "must be at most 100"
+	}
+	if promotion.Kind == KindBuyXGetY {
+		if promotion.BuyQuantity < 1 {
+			fields["buy_quantity"] = "must be at least 1"
+		}
+		if promotion.GetQuantity < 1 {
+			fields["get_quantity"] = "must be at least 1"
+		}
+	}
+	if promotion.StartsAt != nil && promotion.EndsAt != nil && !promotion.EndsAt.After(*promotion.StartsAt) {
+		fields["ends_at"] = "must be after starts_at"
+	}
+	if len(fields) > 0 {
+		return response.Validation(fields)
+	}
+
+	if promotion.CategoryID != 0 {
+		if _, err := s.Categories.Subtree(promotion.CategoryID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
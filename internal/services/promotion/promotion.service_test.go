@@ -0,0 +1,209 @@
+package promotion
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/services/category"
+)
+
+const userID = 5
+
+func TestDiscount(t *testing.T) {
+	// a cart of two units at 30 of product 1 and one unit at 10 of product 2
+	lines := []Line{{ProductID: 1, Quantity: 2, UnitPrice: 30}, {ProductID: 2, Quantity: 1, UnitPrice: 10}}
+
+	tests := []struct {
+		name    string
+		offer   Offer
+		want    float64
+		wantErr error
+	}{
+		{"percent off", Offer{Promotion: Promotion{Kind: KindPercentOff, Value: 10}}, 7, nil},
+		{"percent off rounded", Offer{Promotion: Promotion{Kind: KindPercentOff, Value: 12.5}}, 8.75, nil},
+		{"fixed off", Offer{Promotion: Promotion{Kind: KindFixedOff, Value: 15}}, 15, nil},
+		{"fixed off above the total", Offer{Promotion: Promotion{Kind: KindFixedOff, Value: 100}}, 70, nil},
+		{"buy 1 get 1 free", Offer{Promotion: Promotion{Kind: KindBuyXGetY, BuyQuantity: 1, GetQuantity: 1, Value: 100}}, 30, nil},
+		{"buy 2 get 1 half price", Offer{Promotion: Promotion{Kind: KindBuyXGetY, BuyQuantity: 2, GetQuantity: 1, Value: 50}}, 5, nil},
+		{"buy 3 get 1, not enough units", Offer{Promotion: Promotion{Kind: KindBuyXGetY, BuyQuantity: 3, GetQuantity: 1, Value: 100}}, 0, ErrNotApplicable},
+		{"minimum spend met", Offer{Promotion: Promotion{Kind: KindFixedOff, Value: 5, MinSpend: 70}}, 5, nil},
+		{"minimum spend not met", Offer{Promotion: Promotion{Kind: KindFixedOff, Value: 5, MinSpend: 70.01}}, 0, ErrMinSpendNotMet},
+		{"eligible product only", Offer{Promotion: Promotion{Kind: KindPercentOff, Value: 50}, ProductIDs: map[int]bool{2: true}}, 5, nil},
+		{"minimum spend on eligible products", Offer{Promotion: Promotion{Kind: KindFixedOff, Value: 5, MinSpend: 20}, ProductIDs: map[int]bool{2: true}}, 0, ErrMinSpendNotMet},
+		{"no eligible product", Offer{Promotion: Promotion{Kind: KindPercentOff, Value: 50}, ProductIDs: map[int]bool{3: true}}, 0, ErrNotApplicable},
+	}
+	for _, tt := range tests {
+		discount, err := tt.offer.Discount(lines)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && discount.Amount != tt.want {
+			t.Errorf("%s: discount %.2f, want %.2f", tt.name, discount.Amount, tt.want)
+		}
+	}
+}
+
+func TestBuyXGetY(t *testing.T) {
+	tests := []struct {
+		name          string
+		lines         []Line
+		buy, get      int
+		percent, want float64
+	}{
+		{"one full group", []Line{{Quantity: 2, UnitPrice: 10}}, 1, 1, 100, 10},
+		{"the cheapest units of a group", []Line{{Quantity: 1, UnitPrice: 50}, {Quantity: 1, UnitPrice: 20}, {Quantity: 1, UnitPrice: 30}}, 2, 1, 100, 20},
+		{"groups from the most expensive", []Line{{Quantity: 2, UnitPrice: 40}, {Quantity: 2, UnitPrice: 10}}, 1, 1, 100, 50},
+		{"incomplete group left out", []Line{{Quantity: 5, UnitPrice: 10}}, 1, 1, 100, 20},
+		{"partial percent", []Line{{Quantity: 3, UnitPrice: 20}}, 2, 1, 25, 5},
+		{"no full group", []Line{{Quantity: 2, UnitPrice: 10}}, 2, 1, 100, 0},
+	}
+	for _, tt := range tests {
+		if got := buyXGetY(tt.lines, tt.buy, tt.get, tt.percent); got != tt.want {
+			t.Errorf("%s: %.2f off, want %.2f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := NewPromotionService(NewMemoryPromotionRepository(memory.New()), category.NewCategoryService(category.NewMemoryCategoryRepository(memory.New())))
+	starts := time.Now()
+	ends := starts.Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		promotion Promotion
+		field     string // field refused, "" when the promotion is valid
+	}{
+		{"percent off", Promotion{Code: " summer-10 ", Kind: KindPercentOff, Value: 10}, ""},
+		{"fixed off above 100", Promotion{Code: "BIG", Kind: KindFixedOff, Value: 150}, ""},
+		{"buy x get y", Promotion{Code: "B2G1", Kind: KindBuyXGetY, Value: 100, BuyQuantity: 2, GetQuantity: 1}, ""},
+		{"code with a space", Promotion{Code: "SUMMER 10", Kind: KindPercentOff, Value: 10}, "code"},
+		{"unknown kind", Promotion{Code: "X", Kind: "free_lunch", Value: 10}, "kind"},
+		{"percent above 100", Promotion{Code: "X", Kind: KindPercentOff, Value: 110}, "value"},
+		{"no value", Promotion{Code: "X", Kind: KindPercentOff}, "value"},
+		{"buy x get y without buy", Promotion{Code: "X", Kind: KindBuyXGetY, Value: 100, GetQuantity: 1}, "buy_quantity"},
+		{"buy x get y without get", Promotion{Code: "X", Kind: KindBuyXGetY, Value: 100, BuyQuantity: 1}, "get_quantity"},
+		{"ends before it starts", Promotion{Code: "X", Kind: KindPercentOff, Value: 10, StartsAt: &starts, EndsAt: &ends}, "ends_at"},
+	}
+	for _, tt := range tests {
+		err := s.validate(&tt.promotion)
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%s: %v %v", tt.name, err, response.From(err).Fields)
+			}
+			continue
+		}
+		if response.From(err).Fields[tt.field] == "" {
+			t.Errorf("%s: err = %v, want %s refused", tt.name, err, tt.field)
+		}
+	}
+
+	if err := s.validate(&Promotion{Code: "X", Kind: KindPercentOff, Value: 10, CategoryID: 42}); !errors.Is(err, category.ErrCategoryNotFound) {
+		t.Errorf("promotion of a missing category: err = %v, want %v", err, category.ErrCategoryNotFound)
+	}
+}
+
+// newOfferService returns a promotion service over a memory database holding the promotions
+func newOfferService(t *testing.T, promotions ...Promotion) (*PromotionService, *memory.DB) {
+	t.Helper()
+	mem := memory.New()
+	mem.Update(func() error {
+		for _, p := range promotions {
+			p.ID = PromotionsOf(mem).NextID()
+			PromotionsOf(mem).Put(p.ID, p)
+		}
+		return nil
+	})
+	return NewPromotionService(NewMemoryPromotionRepository(mem), category.NewCategoryService(category.NewMemoryCategoryRepository(mem))), mem
+}
+
+func TestOfferLimits(t *testing.T) {
+	yesterday, tomorrow := time.Now().Add(-24*time.Hour), time.Now().Add(24*time.Hour)
+
+	tests := []struct {
+		name           string
+		promotion      Promotion
+		redeemedByUser int // redemptions of the promotion by userID, one more by another user
+		wantErr        error
+	}{
+		{"no limits", Promotion{Active: true}, 3, nil},
+		{"under the overall limit", Promotion{Active: true, MaxUses: 5, Uses: 4}, 0, nil},
+		{"overall limit reached", Promotion{Active: true, MaxUses: 5, Uses: 5}, 0, ErrCouponExhausted},
+		{"under the per-user limit", Promotion{Active: true, MaxUsesPerUser: 2}, 1, nil},
+		{"per-user limit reached", Promotion{Active: true, MaxUsesPerUser: 2}, 2, ErrCouponUserLimit},
+		{"inactive", Promotion{}, 0, ErrCouponInactive},
+		{"not started", Promotion{Active: true, StartsAt: &tomorrow}, 0, ErrCouponInactive},
+		{"ended", Promotion{Active: true, EndsAt: &yesterday}, 0, ErrCouponInactive},
+	}
+	for _, tt := range tests {
+		p := tt.promotion
+		p.Code, p.Kind, p.Value = "SAVE", KindPercentOff, 10
+		s, mem := newOfferService(t, p)
+		mem.Update(func() error {
+			redemptions := RedemptionsOf(mem)
+			for i := 0; i <= tt.redeemedByUser; i++ {
+				r := Redemption{ID: redemptions.NextID(), PromotionID: 1, UserID: userID, OrderID: i + 1}
+				if i == tt.redeemedByUser {
+					r.UserID = userID + 1
+				}
+				redemptions.Put(r.ID, r)
+			}
+			return nil
+		})
+
+		offer, err := s.Offer(" save ", userID)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		} else if err == nil && offer.Promotion.Code != "SAVE" {
+			t.Errorf("%s: offer of promotion %q", tt.name, offer.Promotion.Code)
+		}
+	}
+
+	s, _ := newOfferService(t)
+	if _, err := s.Offer("NOPE", userID); !errors.Is(err, ErrCouponNotFound) {
+		t.Errorf("unknown code: err = %v, want %v", err, ErrCouponNotFound)
+	}
+}
+
+func TestOfferPerCategory(t *testing.T) {
+	// shoes has the subcategory sneakers, product 1 is a sneaker, product 2 has no category
+	s, mem := newOfferService(t, Promotion{Code: "SHOES", Kind: KindPercentOff, Value: 50, Active: true, CategoryID: 1})
+	mem.Update(func() error {
+		categories := memory.TableOf[category.Category](mem, category.TABLE_NAME)
+		categories.Put(1, category.Category{ID: 1, Name: "Shoes"})
+		categories.Put(2, category.Category{ID: 2, ParentID: 1, Name: "Sneakers"})
+		category.LinksOf(mem).Put(1, category.ProductCategory{ID: 1, ProductID: 1, CategoryID: 2})
+		return nil
+	})
+
+	offer, err := s.Offer("SHOES", userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !offer.ProductIDs[1] || offer.ProductIDs[2] {
+		t.Errorf("eligible products %v, want only product 1", offer.ProductIDs)
+	}
+	discount, err := offer.Discount([]Line{{ProductID: 1, Quantity: 1, UnitPrice: 80}, {ProductID: 2, Quantity: 1, UnitPrice: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if discount.Amount != 40 {
+		t.Errorf("discount %.2f, want half of the sneaker", discount.Amount)
+	}
+	if _, err := offer.Discount([]Line{{ProductID: 2, Quantity: 1, UnitPrice: 20}}); !errors.Is(err, ErrNotApplicable) {
+		t.Errorf("cart without shoes: err = %v, want %v", err, ErrNotApplicable)
+	}
+
+	// the category of the promotion was removed since
+	mem.Update(func() error {
+		memory.TableOf[category.Category](mem, category.TABLE_NAME).Delete(1)
+		return nil
+	})
+	if _, err := s.Offer("SHOES", userID); !errors.Is(err, ErrNotApplicable) {
+		t.Errorf("promotion of a removed category: err = %v, want %v", err, ErrNotApplicable)
+	}
+}
@@ -1,307 +1,402 @@
-package user
-
-import (
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
-	"strconv"
-	"text/template"
-
-	"github.com/ecommerce/internal/core/session"
-	"github.com/ecommerce/utils"
-	"github.com/gorilla/mux"
-)
-
-const (
-	usersBasePath = "users"
-	prodBasePath  = "prod"
-	apiBasePath   = "api"
-)
-
-// SetupRoutes :
-func SetupUserRoutes(r *mux.Router, s *UserService) {
-	apiUrlPath := fmt.Sprintf("/%s/%s", apiBasePath, usersBasePath)
-	userRouter := r.PathPrefix(apiUrlPath).Subrouter()
-
-	userRouter.HandleFunc("", usersHandler(s))
-	userRouter.HandleFunc("/{id}", userHandler(s))
-	userRouter.HandleFunc("/resetPass", resetPassHandler(s)).Methods(http.MethodPost)
-
-	// -------------------------PROD----------------------
-	prodUrlPath := fmt.Sprintf("/%s/%s", prodBasePath, usersBasePath)
-	prodUsersRouter := r.PathPrefix(prodUrlPath).Subrouter()
-
-	// r.HandleFunc(fmt.Sprintf("/%s/%s", apiVersion, usersBasePath), usersProdHandler)
-	// r.HandleFunc(fmt.Sprintf("/%s/%s/{id}", apiVersion, usersBasePath), userProdHandler)
-	// r.HandleFunc(fmt.Sprintf("/%s/%s/resetPass", apiVersion, usersBasePath), resetPassProdHandler).Methods("POST")
-	prodUsersRouter.HandleFunc("/dashboard", userDashboardHandler(s)).Methods(http.MethodGet)
-}
-
-func userDashboardHandler(s *UserService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		sess, err := session.GetSessionFromContext(r)
-		if sess == nil {
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		if sess.Values == nil {
-			err = errors.New("session values nil")
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		userId, err := session.GetSessionUserID(sess)
-		if err != nil {
-			log.Println("UserId is not set in session", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		user, res, err := s.getUserService(userId)
-
-		if err != nil {
-			log.Println("error : ", err)
-			http.Error(w, err.Error(), res)
-			return
-		}
-		log.Println(utils.ToString(*user))
-
-		// Parse the template file (adjust path if necessary)
-		tmpl, err := template.ParseFiles("template/dashboard.html")
-		if err != nil {
-			http.Error(w, "Error loading dashboard page", http.StatusInternalServerError)
-			log.Println("Template parsing error:", err)
-			return
-		}
-
-		switch r.Method {
-		case http.MethodGet:
-			// Execute the template, sending data if needed (or nil if not)
-			err = tmpl.Execute(w, user)
-			if err != nil {
-				http.Error(w, "Error rendering dashboard page", http.StatusInternalServerError)
-				log.Println("Template execution error:", err)
-				return
-			}
-		case http.MethodOptions:
-			return
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	}
-}
-
-func usersProdHandler(w http.ResponseWriter, r *http.Request) {
-}
-
-func userProdHandler(w http.ResponseWriter, r *http.Request) {
-}
-
-func resetPassProdHandler(w http.ResponseWriter, r *http.Request) {
-}
-
-func usersHandler(s *UserService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			userList, res, err := s.getAllUsersService()
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), res)
-				return
-			}
-
-			usersJson, err := json.Marshal(userList)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(usersJson)
-			return
-		case http.MethodPost:
-			// add a new user to the list
-			var newUser User
-			bodyBytes, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			err = json.Unmarshal(bodyBytes, &newUser)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			if newUser.UserID != 0 {
-				err := errors.New("UserId cannot be zero")
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			//adding user
-			res, err := s.addUserService(newUser)
-
-			if err == nil {
-				log.Println(err)
-				http.Error(w, err.Error(), res)
-				return
-			}
-
-			w.WriteHeader(http.StatusCreated)
-			return
-		case http.MethodOptions:
-			return
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	}
-}
-
-func userHandler(s *UserService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		userID, err := strconv.Atoi(vars["id"])
-
-		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-
-		user, res, err := s.getUserService(userID)
-
-		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), res)
-			return
-		}
-
-		switch r.Method {
-		case http.MethodGet:
-			//return single user
-			userJson, err := json.Marshal(user)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(userJson)
-		case http.MethodPut:
-			//update user in the list
-			var updatedUser User
-			bodyBytes, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			err = json.Unmarshal(bodyBytes, &updatedUser)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			if updatedUser.UserID != userID {
-				err := errors.New("Payload User Id Mismatch")
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			// update user cred
-			res, err := s.updateUserService(updatedUser)
-
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), res)
-				return
-			}
-			w.WriteHeader(http.StatusOK)
-			return
-		case http.MethodDelete:
-			res, err := s.removeUserService(userID)
-			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), res)
-				return
-			}
-			w.WriteHeader(http.StatusOK)
-			return
-		case http.MethodOptions:
-			return
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-		}
-	}
-}
-
-func resetPassHandler(s *UserService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		userID, err := strconv.Atoi(vars["id"])
-
-		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-
-		_, res, err := s.getUserService(userID)
-
-		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), res)
-			return
-		}
-
-		var updatedUser User
-		bodyBytes, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		err = json.Unmarshal(bodyBytes, &updatedUser)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		if updatedUser.UserID != userID {
-			err := errors.New("Payload User Id Mismatch")
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		//update user pass
-		res, err = s.updatePasswordService(updatedUser)
-
-		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), res)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-}
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/ecommerce/internal/core/middleware"
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/core/session"
+	"github.com/ecommerce/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	usersBasePath = "users"
+	prodBasePath  = "prod"
+	apiBasePath   = "api"
+)
+
+var (
+	errUserIDSet      = response.BadRequest("userId must not be set when adding a user")
+	errUserIDMismatch = response.BadRequest("userId of the payload doesn't match the URL")
+)
+
+// SetupRoutes :
+func SetupUserRoutes(r *mux.Router, s *UserService) {
+	apiUrlPath := fmt.Sprintf("/%s/%s", apiBasePath, usersBasePath)
+	userRouter := r.PathPrefix(apiUrlPath).Subrouter()
+
+	// password reset is public, it must be registered before /{id}
+	userRouter.HandleFunc("/resetPass", resetPassHandler(s)).Methods(http.MethodPost, http.MethodOptions)
+	userRouter.HandleFunc("/resetPass/confirm", resetPassConfirmHandler(s)).Methods(http.MethodPost, http.MethodOptions)
+
+	// user management is reserved to admins
+	userRouter.HandleFunc("", middleware.RequireRole(middleware.RoleAdmin, usersHandler(s)))
+	userRouter.HandleFunc("/{id}", middleware.RequireRole(middleware.RoleAdmin, userHandler(s)))
+
+	// -------------------------PROD----------------------
+	prodUrlPath := fmt.Sprintf("/%s/%s", prodBasePath, usersBasePath)
+	prodUsersRouter := r.PathPrefix(prodUrlPath).Subrouter()
+
+	// r.HandleFunc(fmt.Sprintf("/%s/%s", apiVersion, usersBasePath), usersProdHandler)
+	// r.HandleFunc(fmt.Sprintf("/%s/%s/{id}", apiVersion, usersBasePath), userProdHandler)
+	// r.HandleFunc(fmt.Sprintf("/%s/%s/resetPass", apiVersion, usersBasePath), resetPassProdHandler).Methods("POST")
+	prodUsersRouter.HandleFunc("/dashboard", userDashboardHandler(s)).Methods(http.MethodGet)
+	prodUsersRouter.HandleFunc("/forgotPass", forgotPassProdHandler(s)).Methods(http.MethodGet, http.MethodPost)
+	prodUsersRouter.HandleFunc("/resetPass", resetPassProdHandler(s)).Methods(http.MethodGet, http.MethodPost)
+}
+
+func userDashboardHandler(s *UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, err := session.GetSessionFromContext(r)
+		if sess == nil {
+			log.Println(err)
+			response.PageError(w, err)
+			return
+		}
+
+		if sess.Values == nil {
+			err = errors.New("session values nil")
+			log.Println(err)
+			response.PageError(w, err)
+			return
+		}
+
+		userId, err := session.GetSessionUserID(sess)
+		if err != nil {
+			log.Println("UserId is not set in session", err)
+			response.PageError(w, err)
+			return
+		}
+
+		user, err := s.getUserService(userId)
+
+		if err != nil {
+			log.Println("error : ", err)
+			response.PageError(w, err)
+			return
+		}
+		log.Println(utils.ToString(*user))
+
+		// Parse the template file (adjust path if necessary)
+		tmpl, err := template.ParseFiles("template/dashboard.html")
+		if err != nil {
+			http.Error(w, "Error loading dashboard page", http.StatusInternalServerError)
+			log.Println("Template parsing error:", err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			// Execute the template, sending data if needed (or nil if not)
+			err = tmpl.Execute(w, user)
+			if err != nil {
+				http.Error(w, "Error rendering dashboard page", http.StatusInternalServerError)
+				log.Println("Template execution error:", err)
+				return
+			}
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func usersProdHandler(w http.ResponseWriter, r *http.Request) {
+}
+
+func userProdHandler(w http.ResponseWriter, r *http.Request) {
+}
+
+// forgotPassProdHandler shows the forgot password form and sends the reset link
+func forgotPassProdHandler(s *UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tmpl, err := template.ParseFiles("template/forgot_password.html")
+		if err != nil {
+			http.Error(w, "Error loading forgot password page", http.StatusInternalServerError)
+			log.Println("Template parsing error:", err)
+			return
+		}
+
+		data := map[string]string{}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, "Error parsing form", http.StatusBadRequest)
+				return
+			}
+
+			err := s.requestPasswordResetService(r.FormValue("email"))
+			if err != nil {
+				log.Println(err)
+				data["Error"] = response.From(err).Message
+			} else {
+				data["Message"] = "If an account exists for this email, a link to reset your password is on its way."
+			}
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := tmpl.Execute(w, data); err != nil {
+			http.Error(w, "Error rendering forgot password page", http.StatusInternalServerError)
+			log.Println("Template execution error:", err)
+		}
+	}
+}
+
+// resetPassProdHandler shows the new password form of a reset link and consumes its token
+func resetPassProdHandler(s *UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tmpl, err := template.ParseFiles("template/reset_password.html")
+		if err != nil {
+			http.Error(w, "Error loading reset password page", http.StatusInternalServerError)
+			log.Println("Template parsing error:", err)
+			return
+		}
+
+		data := map[string]string{"Token": r.URL.Query().Get("token")}
+		switch r.Method {
+		case http.MethodGet:
+			if data["Token"] == "" {
+				data["Error"] = ErrInvalidResetToken.Message
+			}
+		case http.MethodPost:
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, "Error parsing form", http.StatusBadRequest)
+				return
+			}
+
+			data["Token"] = r.FormValue("token")
+			if r.FormValue("password") != r.FormValue("confirmPassword") {
+				data["Error"] = "passwords do not match"
+				break
+			}
+
+			err := s.resetPasswordService(data["Token"], r.FormValue("password"))
+			if err != nil {
+				log.Println(err)
+				apiErr := response.From(err)
+				data["Error"] = apiErr.Message
+				if message, ok := apiErr.Fields["password"]; ok {
+					data["Error"] = "password " + message
+				}
+			} else {
+				data["Message"] = "Your password has been reset, you can now log in."
+			}
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := tmpl.Execute(w, data); err != nil {
+			http.Error(w, "Error rendering reset password page", http.StatusInternalServerError)
+			log.Println("Template execution error:", err)
+		}
+	}
+}
+
+func usersHandler(s *UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			userList, err := s.getAllUsersService()
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			response.JSON(w, http.StatusOK, userList)
+			return
+		case http.MethodPost:
+			// add a new user to the list
+			var newUser User
+			err := json.NewDecoder(r.Body).Decode(&newUser)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if newUser.UserID != 0 {
+				log.Println(errUserIDSet)
+				response.WriteError(w, errUserIDSet)
+				return
+			}
+
+			//adding user
+			err = s.addUserService(newUser)
+
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+
+			w.WriteHeader(http.StatusCreated)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func userHandler(s *UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userID, err := strconv.Atoi(vars["id"])
+
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, ErrUserNotFound)
+			return
+		}
+
+		user, err := s.getUserService(userID)
+
+		if err != nil {
+			log.Println(err)
+			response.WriteError(w, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			//return single user
+			response.JSON(w, http.StatusOK, user)
+		case http.MethodPut:
+			//update user in the list
+			var updatedUser User
+			err := json.NewDecoder(r.Body).Decode(&updatedUser)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			if updatedUser.UserID != userID {
+				log.Println(errUserIDMismatch)
+				response.WriteError(w, errUserIDMismatch)
+				return
+			}
+
+			// update user cred
+			err = s.updateUserService(updatedUser)
+
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		case http.MethodPatch:
+			// update only the fields present in the body (JSON Merge Patch)
+			var patch map[string]json.RawMessage
+			err := json.NewDecoder(r.Body).Decode(&patch)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			patched, err := s.patchUserService(userID, patch)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			response.JSON(w, http.StatusOK, patched)
+			return
+		case http.MethodDelete:
+			err := s.removeUserService(userID)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// resetPassHandler mails a password reset link, the response never tells whether the email exists
+func resetPassHandler(s *UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var request struct {
+				Email string `json:"email"`
+			}
+			err := json.NewDecoder(r.Body).Decode(&request)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			err = s.requestPasswordResetService(request.Email)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// resetPassConfirmHandler consumes a reset token and sets the new password
+func resetPassConfirmHandler(s *UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var request struct {
+				Token    string `json:"token"`
+				Password string `json:"password"`
+			}
+			err := json.NewDecoder(r.Body).Decode(&request)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, response.InvalidBody(err))
+				return
+			}
+
+			err = s.resetPasswordService(request.Token, request.Password)
+			if err != nil {
+				log.Println(err)
+				response.WriteError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		case http.MethodOptions:
+			return
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// chdirRoot moves to the repository root, where the page handlers find their templates
+func chdirRoot(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("../../.."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestResetPassProdHandlerEscapesToken(t *testing.T) {
+	chdirRoot(t)
+
+	hostile := `"><script>alert(1)</script>`
+	req := httptest.NewRequest(http.MethodGet, "/prod/users/resetPass?token="+url.QueryEscape(hostile), nil)
+	rec := httptest.NewRecorder()
+	resetPassProdHandler(nil)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "<script>alert(1)</script>") {
+		t.Fatalf("the token was rendered unescaped:\n%s", body)
+	}
+	if !strings.Contains(body, `value="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"`) {
+		t.Fatalf("the token wasn't rendered escaped in the hidden input:\n%s", body)
+	}
+}
+
+func TestResetPassProdHandlerEscapesError(t *testing.T) {
+	chdirRoot(t)
+
+	form := url.Values{
+		"token":           {`<img src=x onerror=alert(1)>`},
+		"password":        {"longenough"},
+		"confirmPassword": {"different"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/prod/users/resetPass", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	resetPassProdHandler(nil)(rec, req)
+
+	body := rec.Body.String()
+	if strings.Contains(body, "<img src=x") {
+		t.Fatalf("the token was rendered unescaped:\n%s", body)
+	}
+	if !strings.Contains(body, "passwords do not match") {
+		t.Fatalf("the error message is missing:\n%s", body)
+	}
+}
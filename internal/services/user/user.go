@@ -1,8 +1,25 @@
-package user
-
-type User struct {
-	UserID   int    `json:"userId"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	IsAdmin  int    `json:"isAdmin"`
-}
+package user
+
+import "time"
+
+// PasswordResetTTL is how long a password reset link stays valid
+const PasswordResetTTL = time.Hour
+
+// User is validated with utils.Validate before it is stored, see the validate tags
+type User struct {
+	UserID   int    `json:"userId"`
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,min=8"`
+	IsAdmin  int    `json:"isAdmin"`
+}
+
+// PasswordReset is a single-use password reset token. Only the hash of the token is stored,
+// the token itself is only ever sent to the user by mail.
+type PasswordReset struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
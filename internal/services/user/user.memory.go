@@ -0,0 +1,234 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/services/cart"
+	"github.com/ecommerce/internal/services/order"
+	"github.com/ecommerce/utils"
+)
+
+// MemoryUserRepository is a UserRepository keeping users in a memory.DB
+type MemoryUserRepository struct {
+	mem *memory.DB
+}
+
+func NewMemoryUserRepository(mem *memory.DB) *MemoryUserRepository {
+	return &MemoryUserRepository{mem: mem}
+}
+
+func (repo *MemoryUserRepository) getUserByEmail(email string) (*User, error) {
+	var user *User
+	err := repo.mem.View(func() error {
+		found, ok := repo.users().First(func(u User) bool { return u.Email == email })
+		if !ok {
+			return ErrUserNotFound
+		}
+		user = &found
+		return nil
+	})
+	return user, err
+}
+
+func (repo *MemoryUserRepository) getUser(userID int) (*User, error) {
+	var user *User
+	err := repo.mem.View(func() error {
+		if found, ok := repo.users().Get(userID); ok {
+			user = &found
+		}
+		return nil
+	})
+	return user, err
+}
+
+// removeUser deletes the user along with its carts and password resets, like the MySQL
+// removeUser it refuses to delete a user who placed orders
+func (repo *MemoryUserRepository) removeUser(userID int) error {
+	return repo.mem.Update(func() error {
+		if _, ok := order.OrdersOf(repo.mem).First(func(o order.Order) bool { return o.UserID == userID }); ok {
+			return ErrUserHasOrders
+		}
+		repo.users().Delete(userID)
+		repo.resets().DeleteWhere(func(r PasswordReset) bool { return r.UserID == userID })
+		cart.CartsOf(repo.mem).DeleteWhere(func(c cart.Cart) bool { return c.UserID == userID })
+		return nil
+	})
+}
+
+func (repo *MemoryUserRepository) getAllUsers() ([]User, error) {
+	var users []User
+	err := repo.mem.View(func() error {
+		users = repo.users().Rows()
+		return nil
+	})
+	return users, err
+}
+
+func (repo *MemoryUserRepository) updatePassword(user User) error {
+	hashedPass, err := hashPassword(user.Password)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return repo.mem.Update(func() error {
+		repo.users().Update(func(u User) bool { return u.UserID == user.UserID }, func(u User) User {
+			u.Password = hashedPass
+			return u
+		})
+		return nil
+	})
+}
+
+func (repo *MemoryUserRepository) updateUser(user User, columns ...string) error {
+	if len(columns) == 0 || slices.Contains(columns, PASSWORD) {
+		hashedPass, err := hashPassword(user.Password)
+		if err != nil {
+			log.Println(err.Error())
+			return err
+		}
+		user.Password = hashedPass
+	}
+
+	return repo.mem.Update(func() error {
+		current, ok := repo.users().Get(user.UserID)
+		if !ok {
+			return ErrUserNotFound
+		}
+		// the users table has a unique key on email
+		if _, taken := repo.users().First(func(u User) bool { return u.Email == user.Email && u.UserID != user.UserID }); taken {
+			return ErrEmailTaken
+		}
+
+		utils.CopyColumns(&current, user, columns...)
+		repo.users().Put(user.UserID, current)
+		return nil
+	})
+}
+
+func (repo *MemoryUserRepository) addUser(user User) (int, error) {
+	hashedPass, err := hashPassword(user.Password)
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+
+	err = repo.mem.Update(func() error {
+		user, err = repo.insertUser(user, hashedPass)
+		return err
+	})
+	return user.UserID, err
+}
+
+func (repo *MemoryUserRepository) createPasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	return repo.mem.Update(func() error {
+		id := repo.resets().NextID()
+		repo.resets().Put(id, PasswordReset{ID: id, UserID: userID, TokenHash: tokenHash, ExpiresAt: expiresAt, CreatedAt: time.Now()})
+		return nil
+	})
+}
+
+// claimPasswordReset marks an unused, unexpired reset token as used and returns it
+func (repo *MemoryUserRepository) claimPasswordReset(tokenHash string) (*PasswordReset, error) {
+	var reset *PasswordReset
+	err := repo.mem.Update(func() error {
+		now := time.Now()
+		found, ok := repo.resets().First(func(r PasswordReset) bool { return r.TokenHash == tokenHash })
+		if !ok || found.UsedAt != nil || !found.ExpiresAt.After(now) {
+			return ErrInvalidResetToken
+		}
+
+		found.UsedAt = &now
+		repo.resets().Put(found.ID, found)
+		reset = &found
+		return nil
+	})
+	return reset, err
+}
+
+func (repo *MemoryUserRepository) releasePasswordReset(resetID int) error {
+	return repo.mem.Update(func() error {
+		repo.resets().Update(func(r PasswordReset) bool { return r.ID == resetID }, func(r PasswordReset) PasswordReset {
+			r.UsedAt = nil
+			return r
+		})
+		return nil
+	})
+}
+
+func (repo *MemoryUserRepository) expirePasswordResets(userID int) error {
+	return repo.mem.Update(func() error {
+		now := time.Now()
+		repo.resets().Update(func(r PasswordReset) bool { return r.UserID == userID && r.UsedAt == nil }, func(r PasswordReset) PasswordReset {
+			r.UsedAt = &now
+			return r
+		})
+		return nil
+	})
+}
+
+// functions for service layer outside user pkg
+
+// RegisterUser adds the user along with their cart
+func (repo *MemoryUserRepository) RegisterUser(user User) (int, error) {
+	hashedPass, err := hashPassword(user.Password)
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+
+	err = repo.mem.Update(func() error {
+		user, err = repo.insertUser(user, hashedPass)
+		if err != nil {
+			return err
+		}
+
+		carts := cart.CartsOf(repo.mem)
+		now := time.Now()
+		c := cart.Cart{ID: carts.NextID(), UserID: user.UserID, CreatedAt: now, UpdatedAt: now}
+		carts.Put(c.ID, c)
+		return nil
+	})
+	return user.UserID, err
+}
+
+func (repo *MemoryUserRepository) LoginUser(user User) (*User, error) {
+	return checkCredentials(repo, user)
+}
+
+func (repo *MemoryUserRepository) GetCartForUser(userID int) (int, error) {
+	var cartID int
+	err := repo.mem.View(func() error {
+		found, ok := cart.CartsOf(repo.mem).First(func(c cart.Cart) bool { return c.UserID == userID })
+		if !ok {
+			return fmt.Errorf("no cart found for user %d", userID)
+		}
+		cartID = found.ID
+		return nil
+	})
+	return cartID, err
+}
+
+// insertUser stores a new user with the hash of their password, the caller must hold the write lock
+func (repo *MemoryUserRepository) insertUser(user User, hashedPass string) (User, error) {
+	// the users table has a unique key on email
+	if _, exists := repo.users().First(func(u User) bool { return u.Email == user.Email }); exists {
+		return user, ErrEmailTaken
+	}
+
+	user = User{UserID: repo.users().NextID(), Email: user.Email, Password: hashedPass}
+	repo.users().Put(user.UserID, user)
+	return user, nil
+}
+
+func (repo *MemoryUserRepository) users() *memory.Table[User] {
+	return memory.TableOf[User](repo.mem, TABLE_NAME)
+}
+
+func (repo *MemoryUserRepository) resets() *memory.Table[PasswordReset] {
+	return memory.TableOf[PasswordReset](repo.mem, PASSWORD_RESETS_TABLE)
+}
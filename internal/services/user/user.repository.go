@@ -1,253 +1,402 @@
-package user
-
-import (
-	"database/sql"
-	"errors"
-	"fmt"
-	"log"
-	"net/http"
-
-	"golang.org/x/crypto/bcrypt"
-)
-
-type UserRepository struct {
-	db *sql.DB
-}
-
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
-}
-
-func (repo *UserRepository) getUserByEmail(email string) (*User, error) {
-	row := repo.db.QueryRow(`SELECT 
-	userId, 	
-	email,
-	password,
-	isAdmin	
-	FROM users
-	WHERE email = ?`, email)
-
-	user := &User{}
-	err := row.Scan(
-		&user.UserID,
-		&user.Email,
-		&user.Password,
-		&user.IsAdmin)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("no user found with email %s: %v", email, err)
-	} else if err != nil {
-		log.Println(err)
-		return nil, err
-	}
-	return user, nil
-}
-
-func (repo *UserRepository) getUser(userID int) (*User, error) {
-	row := repo.db.QueryRow(`SELECT 
-	userId, 	
-	email,
-	password,
-	isAdmin	
-	FROM users
-	WHERE userId = ?`, userID)
-
-	user := &User{}
-	err := row.Scan(
-		&user.UserID,
-		&user.Email,
-		&user.Password,
-		&user.IsAdmin)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	} else if err != nil {
-		log.Println(err)
-		return nil, err
-	}
-	return user, nil
-}
-
-func (repo *UserRepository) removeUser(userID int) error {
-	_, err := repo.db.Exec(`DELETE FROM users where userId = ?`, userID)
-	if err != nil {
-		log.Println(err.Error())
-		return err
-	}
-	return nil
-}
-
-func (repo *UserRepository) getAllUsers() ([]User, error) {
-	results, err := repo.db.Query(`SELECT 
-	userId, 	 
-	email,
-	password,
-	isAdmin	
-	FROM users`)
-	if err != nil {
-		log.Println(err.Error())
-		return nil, err
-	}
-	defer results.Close()
-	users := make([]User, 0)
-	for results.Next() {
-		var user User
-		results.Scan(&user.UserID,
-			&user.Email,
-			&user.Password,
-			&user.IsAdmin)
-
-		users = append(users, user)
-	}
-	return users, nil
-}
-
-func (repo *UserRepository) updateEmail(user User) error {
-	_, err := repo.db.Exec(`UPDATE users SET 		 				 
-		email=?		
-		WHERE userId=?`,
-		user.Email,
-		user.UserID)
-	if err != nil {
-		log.Println(err.Error())
-		return err
-	}
-	return nil
-}
-
-func (repo *UserRepository) updatePassword(user User) error {
-	hashedPass, err := hashPassword(user.Password)
-	if err != nil {
-		log.Println(err.Error())
-		return err
-	}
-
-	result, err := repo.db.Exec(`UPDATE users SET 		 				 
-		password=?		
-		WHERE userId=?`,
-		hashedPass,
-		user.UserID)
-	if err != nil {
-		result.RowsAffected()
-		log.Println(err.Error())
-		return err
-	}
-	return nil
-}
-
-func (repo *UserRepository) updateUser(user User) error {
-	err_e := repo.updateEmail(user)
-	// err_p := updatePassword(user)
-
-	if err_e != nil {
-		log.Println(err_e.Error())
-		return err_e
-	}
-
-	// if err_p != nil {
-	// 	log.Println(err_p.Error())
-	// 	return err_p
-	// }
-
-	return nil
-}
-
-func (repo *UserRepository) addUser(user User) (int, error) {
-	hashedPass, err := hashPassword(user.Password)
-	if err != nil {
-		log.Println(err.Error())
-		return 0, err
-	}
-
-	result, err := repo.db.Exec(`INSERT INTO users  
-	(email,
-	password) VALUES (?, ?)`,
-		user.Email,
-		hashedPass)
-	if err != nil {
-		log.Println(err.Error())
-		return 0, err
-	}
-	insertID, err := result.LastInsertId()
-	if err != nil {
-		log.Println(err.Error())
-		return 0, err
-	}
-
-	return int(insertID), nil
-}
-
-// functions for service layer outside user pkg
-
-func (repo *UserRepository) RegisterUser(user User) (int, error) {
-	return repo.addUser(user)
-}
-func (repo *UserRepository) LoginUser(user User) (int, error) {
-	existingUser, err := repo.getUserByEmail(user.Email)
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
-
-	// Check if user was found (i.e., existingUser is not nil)
-	if existingUser == nil {
-		return http.StatusNotFound, errors.New("user not found")
-	}
-
-	//compare existing-hashed-pass and request-pass
-	isCredMisMatchError := bcrypt.CompareHashAndPassword([]byte(existingUser.Password), []byte(user.Password))
-	if isCredMisMatchError != nil {
-		return http.StatusUnauthorized, errors.New("incorrect password")
-	}
-	return http.StatusOK, nil
-}
-
-func (repo *UserRepository) createCartForUser(userID int) (int, error) {
-	// ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	// Create a new cart record for the user
-	query := `INSERT INTO carts (user_id) VALUES (?)`
-	result, err := repo.db.Exec(query, userID)
-	if err != nil {
-		return 0, fmt.Errorf("failed to create cart for user %d: %v", userID, err)
-	}
-
-	cartID, err := result.LastInsertId()
-	if err != nil {
-		log.Println(err.Error())
-		return 0, err
-	}
-
-	log.Printf("Cart %d created for user %d successfully", cartID, userID)
-	return int(cartID), nil
-}
-
-func (repo *UserRepository) GetCartForUser(userID int) (int, error) {
-	// Query to get the cart ID for the given user ID
-	query := `SELECT id FROM carts WHERE user_id = ?`
-	var cartID int
-	err := repo.db.QueryRow(query, userID).Scan(&cartID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			// Return a specific error if no cart exists for the user
-			return 0, fmt.Errorf("no cart found for user %d", userID)
-		}
-		log.Printf("Failed to get cart for user %d: %v", userID, err)
-		return 0, err
-	}
-
-	log.Printf("Cart %d retrieved for user %d successfully", cartID, userID)
-	return cartID, nil
-}
-
-// helper functions
-
-func hashPassword(password string) (string, error) {
-	// Convert the string password to a byte slice
-	passwordBytes := []byte(password)
-
-	// Generate the hashed password
-	hashed, err := bcrypt.GenerateFromPassword(passwordBytes, bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-
-	// Convert the hashed password back to a string
-	return string(hashed), nil
-}
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	TABLE_NAME            = "users"
+	USER_ID               = "userId"
+	PASSWORD              = "password"
+	PASSWORD_RESETS_TABLE = "password_resets"
+)
+
+var (
+	ErrUserNotFound       = response.New(http.StatusNotFound, "user_not_found", "user not found")
+	ErrEmailTaken         = response.New(http.StatusConflict, "email_taken", "an account already exists for this email")
+	ErrInvalidCredentials = response.New(http.StatusUnauthorized, "invalid_credentials", "incorrect email or password")
+	ErrInvalidResetToken  = response.New(http.StatusBadRequest, "invalid_reset_token", "invalid or expired password reset token")
+	ErrUserHasOrders      = response.New(http.StatusConflict, "user_has_orders", "the user placed orders, which are kept, so the user can't be deleted")
+)
+
+// UserRepository stores users, their password resets and their carts. MySQLUserRepository is the
+// production implementation, MemoryUserRepository keeps everything in process for demos and tests.
+type UserRepository interface {
+	getUserByEmail(email string) (*User, error)
+	getUser(userID int) (*User, error)
+	removeUser(userID int) error
+	getAllUsers() ([]User, error)
+	updatePassword(user User) error
+	updateUser(user User, columns ...string) error
+	addUser(user User) (int, error)
+	createPasswordReset(userID int, tokenHash string, expiresAt time.Time) error
+	claimPasswordReset(tokenHash string) (*PasswordReset, error)
+	releasePasswordReset(resetID int) error
+	expirePasswordResets(userID int) error
+
+	// used by the authentication service
+	RegisterUser(user User) (int, error)
+	LoginUser(user User) (*User, error)
+	GetCartForUser(userID int) (int, error)
+}
+
+type MySQLUserRepository struct {
+	db *sql.DB
+}
+
+func NewMySQLUserRepository(db *sql.DB) *MySQLUserRepository {
+	return &MySQLUserRepository{db: db}
+}
+
+func (repo *MySQLUserRepository) getUserByEmail(email string) (*User, error) {
+	row := repo.db.QueryRow(`SELECT 
+	userId, 	
+	email,
+	password,
+	isAdmin	
+	FROM users
+	WHERE email = ?`, email)
+
+	user := &User{}
+	err := row.Scan(
+		&user.UserID,
+		&user.Email,
+		&user.Password,
+		&user.IsAdmin)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return user, nil
+}
+
+func (repo *MySQLUserRepository) getUser(userID int) (*User, error) {
+	row := repo.db.QueryRow(`SELECT 
+	userId, 	
+	email,
+	password,
+	isAdmin	
+	FROM users
+	WHERE userId = ?`, userID)
+
+	user := &User{}
+	err := row.Scan(
+		&user.UserID,
+		&user.Email,
+		&user.Password,
+		&user.IsAdmin)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return user, nil
+}
+
+// removeUser deletes the user along with its carts, addresses, tokens and password resets.
+// Orders are kept for the books, so a user who placed some can't be deleted.
+func (repo *MySQLUserRepository) removeUser(userID int) error {
+	_, err := repo.db.Exec(`DELETE FROM users where userId = ?`, userID)
+	if utils.IsReferenced(err) {
+		return ErrUserHasOrders
+	} else if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (repo *MySQLUserRepository) getAllUsers() ([]User, error) {
+	results, err := repo.db.Query(`SELECT 
+	userId, 	 
+	email,
+	password,
+	isAdmin	
+	FROM users`)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	users := make([]User, 0)
+	for results.Next() {
+		var user User
+		results.Scan(&user.UserID,
+			&user.Email,
+			&user.Password,
+			&user.IsAdmin)
+
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (repo *MySQLUserRepository) updatePassword(user User) error {
+	hashedPass, err := hashPassword(user.Password)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	_, err = repo.db.Exec(`UPDATE users SET 		 				 
+		password=?		
+		WHERE userId=?`,
+		hashedPass,
+		user.UserID)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+// updateUser writes the given columns of the user, all of them when none are given.
+// The password is hashed before it is stored.
+func (repo *MySQLUserRepository) updateUser(user User, columns ...string) error {
+	if len(columns) == 0 || slices.Contains(columns, PASSWORD) {
+		hashedPass, err := hashPassword(user.Password)
+		if err != nil {
+			log.Println(err.Error())
+			return err
+		}
+		user.Password = hashedPass
+	}
+
+	whereClause := fmt.Sprintf("%s = %d", USER_ID, user.UserID)
+	query, args := utils.BuildUpdateQuery(TABLE_NAME, user, whereClause, columns...)
+	_, err := repo.db.Exec(query, args...)
+	if utils.IsDuplicateEntry(err) {
+		return ErrEmailTaken
+	} else if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (repo *MySQLUserRepository) addUser(user User) (int, error) {
+	return insertUser(context.Background(), repo.db, user)
+}
+
+// createPasswordReset stores the hash of a new reset token for the user
+func (repo *MySQLUserRepository) createPasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := repo.db.Exec(`INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES (?, ?, ?)`,
+		userID, tokenHash, expiresAt)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+// claimPasswordReset marks an unused, unexpired reset token as used and returns it.
+// The conditional update makes sure a token can only be claimed once, even by concurrent requests.
+func (repo *MySQLUserRepository) claimPasswordReset(tokenHash string) (*PasswordReset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin password reset transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	reset := &PasswordReset{}
+	err = tx.QueryRowContext(ctx, `
+		SELECT
+			id,
+			user_id,
+			token_hash,
+			expires_at,
+			used_at,
+			created_at
+		FROM
+			password_resets
+		WHERE
+			token_hash = ?
+		FOR UPDATE`, tokenHash).Scan(
+		&reset.ID,
+		&reset.UserID,
+		&reset.TokenHash,
+		&reset.ExpiresAt,
+		&reset.UsedAt,
+		&reset.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidResetToken
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx, `UPDATE password_resets SET used_at = ? WHERE id = ? AND used_at IS NULL AND expires_at > ?`,
+		now, reset.ID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim password reset %d: %v", reset.ID, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected != 1 {
+		return nil, ErrInvalidResetToken
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit password reset claim: %v", err)
+	}
+
+	reset.UsedAt = &now
+	return reset, nil
+}
+
+// releasePasswordReset makes a claimed reset token usable again, used when the password update fails
+func (repo *MySQLUserRepository) releasePasswordReset(resetID int) error {
+	_, err := repo.db.Exec(`UPDATE password_resets SET used_at = NULL WHERE id = ?`, resetID)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+// expirePasswordResets burns every outstanding reset token of the user
+func (repo *MySQLUserRepository) expirePasswordResets(userID int) error {
+	_, err := repo.db.Exec(`UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL`,
+		time.Now(), userID)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+// functions for service layer outside user pkg
+
+// RegisterUser adds the user along with their cart, in one transaction so that no account is left without a cart
+func (repo *MySQLUserRepository) RegisterUser(user User) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin registration transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	userID, err := insertUser(ctx, tx, user)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO carts (user_id) VALUES (?)`, userID); err != nil {
+		return 0, fmt.Errorf("failed to create cart for user %d: %v", userID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit registration of user %d: %v", userID, err)
+	}
+	return userID, nil
+}
+
+func (repo *MySQLUserRepository) LoginUser(user User) (*User, error) {
+	return checkCredentials(repo, user)
+}
+
+func (repo *MySQLUserRepository) GetCartForUser(userID int) (int, error) {
+	// Query to get the cart ID for the given user ID
+	query := `SELECT id FROM carts WHERE user_id = ?`
+	var cartID int
+	err := repo.db.QueryRow(query, userID).Scan(&cartID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Return a specific error if no cart exists for the user
+			return 0, fmt.Errorf("no cart found for user %d", userID)
+		}
+		log.Printf("Failed to get cart for user %d: %v", userID, err)
+		return 0, err
+	}
+
+	log.Printf("Cart %d retrieved for user %d successfully", cartID, userID)
+	return cartID, nil
+}
+
+// helper functions
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertUser stores a new user with a hash of their password and returns the ID of the user
+func insertUser(ctx context.Context, db execer, user User) (int, error) {
+	hashedPass, err := hashPassword(user.Password)
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+
+	result, err := db.ExecContext(ctx, `INSERT INTO users  
+	(email,
+	password) VALUES (?, ?)`,
+		user.Email,
+		hashedPass)
+	if utils.IsDuplicateEntry(err) {
+		return 0, ErrEmailTaken
+	} else if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	insertID, err := result.LastInsertId()
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+
+	return int(insertID), nil
+}
+
+func hashPassword(password string) (string, error) {
+	// Convert the string password to a byte slice
+	passwordBytes := []byte(password)
+
+	// Generate the hashed password
+	hashed, err := bcrypt.GenerateFromPassword(passwordBytes, bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	// Convert the hashed password back to a string
+	return string(hashed), nil
+}
+
+// checkCredentials compares the password of user with the stored hash of the account with the same email
+// and returns that account. Unknown emails and wrong passwords fail alike with ErrInvalidCredentials.
+func checkCredentials(repo UserRepository, user User) (*User, error) {
+	existingUser, err := repo.getUserByEmail(user.Email)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+
+	//compare existing-hashed-pass and request-pass
+	isCredMisMatchError := bcrypt.CompareHashAndPassword([]byte(existingUser.Password), []byte(user.Password))
+	if isCredMisMatchError != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return existingUser, nil
+}
@@ -1,97 +1,216 @@
-package user
-
-import (
-	"log"
-	"net/http"
-)
-
-// UserService handles business logic for user-related operations.
-type UserService struct {
-	Repo *UserRepository
-}
-
-// NewUserService creates a new UserService.
-func NewUserService(repo *UserRepository) *UserService {
-	return &UserService{
-		Repo: repo,
-	}
-}
-
-func (s *UserService) getAllUsersService() ([]User, int, error) {
-	userList, err := s.Repo.getAllUsers()
-	if err != nil {
-		log.Printf("Error fetching users: %v", err)
-		return nil, http.StatusInternalServerError, err
-	}
-	return userList, http.StatusOK, nil
-}
-
-func (s *UserService) getUserService(userID int) (*User, int, error) {
-	user, err := s.Repo.getUser(userID)
-
-	if err != nil {
-		return nil, http.StatusInternalServerError, err
-	}
-	if user == nil {
-		return nil, http.StatusNotFound, err
-	}
-
-	return user, http.StatusOK, nil
-}
-
-func (s *UserService) GetUserByEmailService(email string) (*User, int, error) {
-	user, err := s.Repo.getUserByEmail(email)
-
-	if err != nil {
-		log.Print(err)
-		return nil, http.StatusBadRequest, err
-	}
-	return user, http.StatusOK, nil
-}
-
-func (s *UserService) CreateCartForUserService(userID int) (int, int, error) {
-	CartId, err := s.Repo.createCartForUser(userID)
-
-	if err != nil {
-		log.Print(err)
-		return 0, http.StatusBadRequest, err
-	}
-	return CartId, http.StatusOK, nil
-}
-
-func (s *UserService) addUserService(newUser User) (int, error) {
-	_, err := s.Repo.addUser(newUser)
-	if err != nil {
-		log.Print(err)
-		return http.StatusBadRequest, err
-	}
-	return http.StatusOK, nil
-}
-
-func (s *UserService) updateUserService(updatedUser User) (int, error) {
-	err := s.Repo.updateUser(updatedUser)
-
-	if err != nil {
-		log.Print(err)
-		return http.StatusBadRequest, err
-	}
-	return http.StatusOK, nil
-}
-
-func (s *UserService) updatePasswordService(updatedUser User) (int, error) {
-	err := s.Repo.updatePassword(updatedUser)
-
-	if err != nil {
-		log.Print(err)
-		return http.StatusBadRequest, err
-	}
-	return http.StatusOK, nil
-}
-
-func (s *UserService) removeUserService(userID int) (int, error) {
-	err := s.Repo.removeUser(userID)
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
-	return http.StatusOK, nil
-}
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/ecommerce/internal/core/mailer"
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/utils"
+)
+
+// UserService handles business logic for user-related operations.
+type UserService struct {
+	Repo    UserRepository
+	Mailer  mailer.Mailer
+	BaseURL string // public URL of the site, used in the links sent by mail
+
+	// SignOutEverywhere ends every session and revokes every token of a user once their password
+	// is reset. It is set by the authentication service, which owns the tokens and the session store.
+	SignOutEverywhere func(userID int) error
+}
+
+// NewUserService creates a new UserService.
+func NewUserService(repo UserRepository, mail mailer.Mailer, baseURL string) *UserService {
+	return &UserService{
+		Repo:    repo,
+		Mailer:  mail,
+		BaseURL: baseURL,
+	}
+}
+
+func (s *UserService) getAllUsersService() ([]User, error) {
+	userList, err := s.Repo.getAllUsers()
+	if err != nil {
+		log.Printf("Error fetching users: %v", err)
+		return nil, err
+	}
+	return userList, nil
+}
+
+func (s *UserService) getUserService(userID int) (*User, error) {
+	user, err := s.Repo.getUser(userID)
+
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (s *UserService) GetUserByEmailService(email string) (*User, error) {
+	user, err := s.Repo.getUserByEmail(email)
+
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *UserService) GetUserByIDService(userID int) (*User, error) {
+	return s.getUserService(userID)
+}
+
+func (s *UserService) addUserService(newUser User) error {
+	if fields := utils.Validate(newUser); fields != nil {
+		return response.Validation(fields)
+	}
+
+	_, err := s.Repo.addUser(newUser)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	return nil
+}
+
+func (s *UserService) updateUserService(updatedUser User) error {
+	if fields := utils.Validate(updatedUser); fields != nil {
+		return response.Validation(fields)
+	}
+
+	err := s.Repo.updateUser(updatedUser)
+
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	return nil
+}
+
+// patchUserService applies a JSON Merge Patch to a user: only the fields present in the patch
+// are written, a new password is hashed like any other.
+func (s *UserService) patchUserService(userID int, patch map[string]json.RawMessage) (*User, error) {
+	user, err := s.getUserService(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, fields := utils.ApplyMergePatch(user, patch)
+	if fields != nil {
+		return nil, response.Validation(fields)
+	}
+	if user.UserID != userID {
+		return nil, errUserIDMismatch
+	}
+	// the ID member is only compared, it is never updated
+	columns = slices.DeleteFunc(columns, func(column string) bool { return column == USER_ID })
+	if len(columns) == 0 {
+		return user, nil
+	}
+	if fields := utils.Validate(user); fields != nil {
+		return nil, response.Validation(fields)
+	}
+
+	err = s.Repo.updateUser(*user, columns...)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	return s.getUserService(userID)
+}
+
+func (s *UserService) removeUserService(userID int) error {
+	return s.Repo.removeUser(userID)
+}
+
+// requestPasswordResetService mails a single-use reset link to the user owning the email.
+// Unknown emails are not reported to the caller so the endpoint can't be used to discover accounts.
+func (s *UserService) requestPasswordResetService(email string) error {
+	if email == "" {
+		return response.Validation(map[string]string{"email": "is required"})
+	}
+
+	user, err := s.Repo.getUserByEmail(email)
+	if errors.Is(err, ErrUserNotFound) {
+		log.Printf("Password reset requested for unknown email %s", email)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = s.Repo.createPasswordReset(user.UserID, utils.HashToken(token), time.Now().Add(PasswordResetTTL))
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/%s/%s/resetPass?token=%s", s.BaseURL, prodBasePath, usersBasePath, token)
+	err = s.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your account.\n\n"+
+			"Open the link below within %v to choose a new password:\n%s\n\n"+
+			"If it wasn't you, you can ignore this email.", PasswordResetTTL, link),
+	})
+	if err != nil {
+		// answer like for an unknown email, a different error would tell the account exists
+		log.Printf("Error sending password reset mail to user %d: %v", user.UserID, err)
+		return nil
+	}
+
+	return nil
+}
+
+// resetPasswordService consumes a reset token and sets the new password of its user
+func (s *UserService) resetPasswordService(token, password string) error {
+	if token == "" {
+		return ErrInvalidResetToken
+	}
+	// the new password follows the rules of a registration
+	if fields := utils.Validate(User{Password: password}); fields["password"] != "" {
+		return response.Validation(map[string]string{"password": fields["password"]})
+	}
+
+	reset, err := s.Repo.claimPasswordReset(utils.HashToken(token))
+	if err != nil {
+		return err
+	}
+
+	err = s.Repo.updatePassword(User{UserID: reset.UserID, Password: password})
+	if err != nil {
+		// give the token back so the user can retry with the same link
+		if releaseErr := s.Repo.releasePasswordReset(reset.ID); releaseErr != nil {
+			log.Printf("Error releasing password reset %d: %v", reset.ID, releaseErr)
+		}
+		return err
+	}
+
+	// any other link sent before this one is now stale
+	if err := s.Repo.expirePasswordResets(reset.UserID); err != nil {
+		log.Printf("Error expiring password resets of user %d: %v", reset.UserID, err)
+	}
+
+	// whoever knew the old password may still be signed in
+	if s.SignOutEverywhere != nil {
+		if err := s.SignOutEverywhere(reset.UserID); err != nil {
+			log.Printf("Error signing user %d out after a password reset: %v", reset.UserID, err)
+			return err
+		}
+	}
+
+	log.Printf("Password of user %d reset", reset.UserID)
+	return nil
+}
@@ -0,0 +1,155 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ecommerce/database/memory"
+	"github.com/ecommerce/internal/core/mailer"
+	"github.com/ecommerce/internal/core/response"
+	"github.com/ecommerce/internal/services/order"
+	"github.com/ecommerce/utils"
+)
+
+// failingMailer fails every message, like an unreachable mail server
+type failingMailer struct{}
+
+func (failingMailer) Send(mailer.Message) error { return errors.New("connection refused") }
+
+// newResetFixture registers a user and returns the service with a reset token of that user
+func newResetFixture(t *testing.T) (*UserService, int, string) {
+	t.Helper()
+	repo := NewMemoryUserRepository(memory.New())
+	userID, err := repo.RegisterUser(User{Email: "reset@example.com", Password: "oldpassword"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := "reset-token"
+	if err := repo.createPasswordReset(userID, utils.HashToken(token), time.Now().Add(PasswordResetTTL)); err != nil {
+		t.Fatal(err)
+	}
+	return NewUserService(repo, &mailer.LogMailer{}, "http://localhost"), userID, token
+}
+
+func TestResetPasswordServiceValidatesPassword(t *testing.T) {
+	s, _, token := newResetFixture(t)
+
+	err := s.resetPasswordService(token, "short")
+	apiErr := response.From(err)
+	if apiErr.Status != http.StatusUnprocessableEntity || !strings.Contains(apiErr.Fields["password"], "at least 8") {
+		t.Fatalf("err = %v, want a validation error on the password", err)
+	}
+
+	// the token wasn't claimed by the rejected attempt
+	if err := s.resetPasswordService(token, "longenough"); err != nil {
+		t.Fatalf("reset with a valid password: %v", err)
+	}
+}
+
+func TestResetPasswordServiceSignsOutEverywhere(t *testing.T) {
+	s, userID, token := newResetFixture(t)
+
+	var signedOut []int
+	s.SignOutEverywhere = func(id int) error {
+		signedOut = append(signedOut, id)
+		return nil
+	}
+
+	if err := s.resetPasswordService(token, "longenough"); err != nil {
+		t.Fatal(err)
+	}
+	if len(signedOut) != 1 || signedOut[0] != userID {
+		t.Fatalf("signed out %v, want [%d]", signedOut, userID)
+	}
+}
+
+func TestRequestPasswordResetServiceHidesMailFailures(t *testing.T) {
+	s, _, _ := newResetFixture(t)
+	s.Mailer = failingMailer{}
+
+	if err := s.requestPasswordResetService("reset@example.com"); err != nil {
+		t.Fatalf("known email: err = %v, want nil like an unknown email", err)
+	}
+	if err := s.requestPasswordResetService("nobody@example.com"); err != nil {
+		t.Fatalf("unknown email: err = %v, want nil", err)
+	}
+}
+
+// updateRecorder records the columns of the updates it passes on to the memory repository
+type updateRecorder struct {
+	*MemoryUserRepository
+	updates [][]string
+}
+
+func (repo *updateRecorder) updateUser(user User, columns ...string) error {
+	repo.updates = append(repo.updates, columns)
+	return repo.MemoryUserRepository.updateUser(user, columns...)
+}
+
+func TestPatchUserServiceNeverUpdatesTheID(t *testing.T) {
+	repo := &updateRecorder{MemoryUserRepository: NewMemoryUserRepository(memory.New())}
+	userID, err := repo.RegisterUser(User{Email: "patch@example.com", Password: "longenough"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewUserService(repo, &mailer.LogMailer{}, "http://localhost")
+
+	// a patch only repeating the ID changes nothing
+	if _, err := s.patchUserService(userID, map[string]json.RawMessage{"userId": json.RawMessage(strconv.Itoa(userID))}); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.updates) != 0 {
+		t.Fatalf("updates = %v, want none", repo.updates)
+	}
+
+	patched, err := s.patchUserService(userID, map[string]json.RawMessage{
+		"userId": json.RawMessage(strconv.Itoa(userID)),
+		"email":  json.RawMessage(`"new@example.com"`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.Email != "new@example.com" || len(repo.updates) != 1 || !slices.Equal(repo.updates[0], []string{"email"}) {
+		t.Errorf("patched user = %+v after updates %v, want the email updated alone", patched, repo.updates)
+	}
+}
+
+func TestRemoveUserServiceKeepsUsersWithOrders(t *testing.T) {
+	mem := memory.New()
+	repo := NewMemoryUserRepository(mem)
+	s := NewUserService(repo, &mailer.LogMailer{}, "http://localhost")
+	buyerID, err := repo.RegisterUser(User{Email: "buyer@example.com", Password: "longenough"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	browserID, err := repo.RegisterUser(User{Email: "browser@example.com", Password: "longenough"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem.Update(func() error {
+		orders := order.OrdersOf(mem)
+		placed := order.Order{ID: orders.NextID(), UserID: buyerID, Status: order.StatusDelivered}
+		orders.Put(placed.ID, placed)
+		return nil
+	})
+
+	if err := s.removeUserService(buyerID); !errors.Is(err, ErrUserHasOrders) {
+		t.Errorf("removing a user with orders: err = %v, want %v", err, ErrUserHasOrders)
+	}
+	if _, err := s.getUserService(buyerID); err != nil {
+		t.Errorf("user with orders after the refused removal: %v", err)
+	}
+
+	if err := s.removeUserService(browserID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.getUserService(browserID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("removed user: err = %v, want %v", err, ErrUserNotFound)
+	}
+}
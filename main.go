@@ -1,46 +1,79 @@
-package main
-
-import (
-	"fmt"
-	"log"
-	"net/http"
-
-	"github.com/ecommerce/internal/core/middleware"
-	"github.com/ecommerce/internal/core/routes"
-	"github.com/ecommerce/internal/core/setup"
-	"github.com/ecommerce/internal/services/index"
-
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/gorilla/mux"
-)
-
-const (
-	configFilePath = "config.yaml"
-)
-
-func main() {
-	fmt.Println("Hello! dev-anand")
-
-	//setup configuration
-	setupRes, err := setup.InitializeAll(configFilePath)
-	if err != nil {
-		log.Fatalf("Failed to initialize application: %v", err)
-	}
-	defer setupRes.DbConn.Close() // Always close the connection when the application exits
-
-	//Creating Mux Router
-	r := mux.NewRouter()
-
-	//Registering Middlewares
-	middleware.RegisterMiddleWares(r, setupRes)
-
-	//Registering routes
-	routes.RegisterRoutes(r, setupRes)
-
-	fmt.Println("Server is running at http://localhost:5000")
-
-	// Automatically open the landing page in the default browser
-	go index.ServeIndexPage()
-
-	log.Fatal(http.ListenAndServe(":5000", r))
-}
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ecommerce/internal/core/middleware"
+	"github.com/ecommerce/internal/core/routes"
+	"github.com/ecommerce/internal/core/setup"
+	"github.com/ecommerce/internal/services/index"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+const (
+	configFilePath = "config.yaml"
+
+	// shutdownTimeout is how long requests in flight get to finish on shutdown
+	shutdownTimeout = 10 * time.Second
+)
+
+func main() {
+	// commands such as "migrate up" run and exit without starting the server
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	fmt.Println("Hello! dev-anand")
+
+	//setup configuration
+	setupRes, err := setup.InitializeAll(configFilePath)
+	if err != nil {
+		log.Fatalf("Failed to initialize application: %v", err)
+	}
+	defer setupRes.Close() // Always stop the session cleanup and close the connection when the application exits
+
+	//Creating Mux Router
+	r := mux.NewRouter()
+
+	//Registering Middlewares
+	middleware.RegisterMiddleWares(r, setupRes)
+
+	//Registering routes
+	routes.RegisterRoutes(r, setupRes)
+
+	fmt.Println("Server is running at http://localhost:5000")
+
+	// Automatically open the landing page in the default browser
+	go index.ServeIndexPage()
+
+	server := &http.Server{Addr: ":5000", Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// run until interrupted, then let the requests in flight finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	log.Println("Shutting down the server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to shut down the server: %v", err)
+	}
+}
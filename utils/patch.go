@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+)
+
+// ApplyMergePatch applies a JSON Merge Patch (RFC 7396) to a pointer to a struct: each member of
+// the patch replaces the field with the same json name, fields missing from the patch are left alone.
+// It returns the json names of the patched fields in struct order, along with what is wrong with
+// each member that can't be applied. Nulls are rejected since none of our columns can be removed.
+func ApplyMergePatch(model interface{}, patch map[string]json.RawMessage) ([]string, map[string]string) {
+	val := reflect.ValueOf(model)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		panic("model must be a pointer to a struct")
+	}
+	val = val.Elem()
+	typ := val.Type()
+
+	errs := make(map[string]string)
+	patched := make(map[string]bool, len(patch))
+	var columns []string
+	for i := 0; i < typ.NumField(); i++ {
+		name := typ.Field(i).Tag.Get("json")
+		raw, ok := patch[name]
+		if name == "" || name == "-" || !ok {
+			continue
+		}
+		patched[name] = true
+
+		if string(raw) == "null" {
+			errs[name] = "cannot be null"
+			continue
+		}
+		// decode into a copy so a failed member leaves the field untouched
+		value := reflect.New(typ.Field(i).Type)
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			errs[name] = typeMessage(typ.Field(i).Type.Kind())
+			continue
+		}
+		val.Field(i).Set(value.Elem())
+		columns = append(columns, name)
+	}
+
+	for name := range patch {
+		if !patched[name] {
+			errs[name] = "is not a known field"
+		}
+	}
+
+	if len(errs) == 0 {
+		return columns, nil
+	}
+	return columns, errs
+}
+
+// CopyColumns copies the fields of src whose json names are listed in columns onto dst,
+// every tagged field when columns is empty. dst must be a pointer to a struct of the type of src.
+func CopyColumns(dst, src interface{}, columns ...string) {
+	to := reflect.ValueOf(dst).Elem()
+	from := reflect.ValueOf(src)
+	if from.Kind() == reflect.Ptr {
+		from = from.Elem()
+	}
+
+	typ := to.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		name := typ.Field(i).Tag.Get("json")
+		if name == "" || name == "-" || len(columns) > 0 && !slices.Contains(columns, name) {
+			continue
+		}
+		to.Field(i).Set(from.Field(i))
+	}
+}
+
+// typeMessage describes the JSON value expected for a field of the given kind
+func typeMessage(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "must be a string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "must be a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "must be a number"
+	case reflect.Bool:
+		return "must be true or false"
+	default:
+		return "has the wrong type"
+	}
+}
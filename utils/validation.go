@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validate checks every field of a struct against the rules of its `validate` tag and returns
+// what is wrong with each invalid field, keyed by the json name of the field, or nil when
+// the struct is valid. Rules are comma separated and checked in order:
+//
+//	required  the field can't be empty, blank strings are empty
+//	min=N     numbers must be at least N, strings at least N characters long
+//	max=N     numbers must be at most N, strings at most N characters long
+//	gt=N      numbers must be greater than N
+//	email     non-empty strings must be a plain email address
+func Validate(model interface{}) map[string]string {
+	val := reflect.ValueOf(model)
+	if val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+
+	// Ensure we're working with a struct
+	if val.Kind() != reflect.Struct {
+		panic("model must be a struct or a pointer to a struct")
+	}
+
+	errs := make(map[string]string)
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		rules := field.Tag.Get("validate")
+		if rules == "" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			name = field.Name
+		}
+		if message := checkRules(val.Field(i), rules); message != "" {
+			errs[name] = message
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// checkRules returns the message of the first rule the value breaks, an empty string if there is none
+func checkRules(value reflect.Value, rules string) string {
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "required":
+			if value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "" || value.IsZero() {
+				return "is required"
+			}
+		case "min", "max", "gt":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic(fmt.Sprintf("invalid validation rule %q", rule))
+			}
+			if message := checkBound(value, name, limit); message != "" {
+				return message
+			}
+		case "email":
+			if email := value.String(); email != "" && !isEmail(email) {
+				return "must be a valid email address"
+			}
+		default:
+			panic(fmt.Sprintf("unknown validation rule %q", rule))
+		}
+	}
+	return ""
+}
+
+// checkBound compares a number, or the length of a string, with the limit of a min, max or gt rule
+func checkBound(value reflect.Value, rule string, limit float64) string {
+	var n float64
+	unit := ""
+	switch value.Kind() {
+	case reflect.String:
+		n = float64(utf8.RuneCountInString(value.String()))
+		unit = " characters"
+		if rule == "min" {
+			unit = " characters long"
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(value.Int())
+	case reflect.Float32, reflect.Float64:
+		n = value.Float()
+	default:
+		panic(fmt.Sprintf("%s rule can't be applied to a %s", rule, value.Kind()))
+	}
+
+	bound := strconv.FormatFloat(limit, 'f', -1, 64)
+	switch {
+	case rule == "min" && n < limit:
+		return fmt.Sprintf("must be at least %s%s", bound, unit)
+	case rule == "max" && n > limit:
+		return fmt.Sprintf("must be at most %s%s", bound, unit)
+	case rule == "gt" && n <= limit:
+		return fmt.Sprintf("must be greater than %s", bound)
+	}
+	return ""
+}
+
+// isEmail reports whether s is a bare address such as jane@example.com, without a display name
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s && strings.Contains(s[strings.LastIndex(s, "@"):], ".")
+}